@@ -79,6 +79,17 @@ func prepareOptions() *genopenapi.Options {
 		&generatorOptions.DisableDefaultErrors, "disable_default_errors", generatorOptions.DisableDefaultErrors,
 		"if set, default error response does not get generated. Useful when custom error structure is used.")
 
+	flag.BoolVar(
+		&generatorOptions.UseProblemDetails, "use_problem_details", generatorOptions.UseProblemDetails,
+		"if set, the default error response uses the RFC 7807 problem details schema with 'application/problem+json'"+
+			" content type instead of google.rpc.Status. Use along with the problem details error handlers in the gateway.")
+
+	flag.StringVar(
+		&generatorOptions.StatusCodeMappingFile, "status_code_mapping_file", generatorOptions.StatusCodeMappingFile,
+		"if set, this YAML/JSON file holds the HTTP status codes used for gRPC codes, globally under 'codes' and"+
+			" per method under 'methods', and an error response gets generated for each mapped HTTP status code."+
+			" Use the same table with the status code mapping options in the gateway.")
+
 	flag.BoolVar(
 		&generatorOptions.DisableDefaultResponses, "disable_default_responses", generatorOptions.DisableDefaultResponses,
 		"if set, default success response does not get generated. Useful when non 200 status codes are needed.")
@@ -166,6 +166,19 @@ func prepareHTTPPattern(path *httprule.Template) string {
 
 }
 
+func prepareStreamingMode(method *descriptor.Method) string {
+	switch {
+	case method.GetClientStreaming() && method.GetServerStreaming():
+		return "gateway.StreamingModeBidirectional"
+	case method.GetClientStreaming():
+		return "gateway.StreamingModeClient"
+	case method.GetServerStreaming():
+		return "gateway.StreamingModeServer"
+	default:
+		return "gateway.StreamingModeUnary"
+	}
+}
+
 type trailerParams struct {
 	Services           []*descriptor.Service
 	UseRequestContext  bool
@@ -301,16 +314,17 @@ var (
 		localHandlerTemplate.New("local-client-rpc-request-func").Funcs(funcMap).Parse(
 			templateDataLocalClientRPCRequestFunc))
 
-	//go:embed templates/local_trailer.tmpl
-	templateDataLocalTrailer string
-	localTrailerTemplate     = template.Must(
-		template.New("local-trailer").Funcs(trailerFuncMap).Parse(templateDataLocalTrailer))
-
 	//go:embed templates/trailer.tmpl
 	templateDataTrailer string
 	trailerFuncMap      = map[string]interface{}{
-		"httpPath":    prepareHTTPPath,
-		"httpPattern": prepareHTTPPattern,
+		"httpPath":      prepareHTTPPath,
+		"httpPattern":   prepareHTTPPattern,
+		"streamingMode": prepareStreamingMode,
 	}
 	trailerTemplate = template.Must(template.New("trailer").Funcs(trailerFuncMap).Parse(templateDataTrailer))
+
+	//go:embed templates/local_trailer.tmpl
+	templateDataLocalTrailer string
+	localTrailerTemplate     = template.Must(
+		template.Must(trailerTemplate.Clone()).New("local-trailer").Parse(templateDataLocalTrailer))
 )
@@ -24,12 +24,15 @@ const defaultSuccessfulResponse = "a successful response."
 const (
 	mimeTypeJSON = "application/json"
 	mimeTypeSSE  = "text/event-stream"
+
+	mimeTypeProblemJSON = "application/problem+json"
 )
 const (
 	httpStatusOK      = "200"
 	httpStatusDefault = "default"
 
 	rpcStatusProto                = ".google.rpc.Status"
+	problemDetailsSchemaName      = "ProblemDetails"
 	streamingInputDescription     = " (streaming inputs)"
 	streamingResponsesDescription = " (streaming responses)"
 	headerTransferEncoding        = "Transfer-Encoding"
@@ -37,6 +37,9 @@ type Generator struct {
 	// services holds a reference to the service and any matched configuration for it.
 	services map[string]*internal.OpenAPIServiceSpec
 
+	// statusCodeMapping holds the HTTP status codes used for gRPC codes loaded from the status code mapping file.
+	statusCodeMapping statusCodeMapping
+
 	configPathBuilder configpath.Builder
 }
 
@@ -0,0 +1,146 @@
+package genopenapi
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/meshapi/grpc-api-gateway/codegen/internal/descriptor"
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+const (
+	testProtoFile = "test/v1/test.proto"
+
+	testGatewayConfig = `
+gateway:
+  endpoints:
+    - selector: 'test.v1.TestService.Echo'
+      post: '/v1/echo'
+      body: '*'
+`
+)
+
+// testDocument holds the parts of a generated OpenAPI document that are checked in the tests.
+type testDocument struct {
+	Paths      map[string]map[string]testOperation `json:"paths"`
+	Components struct {
+		Schemas map[string]json.RawMessage `json:"schemas"`
+	} `json:"components"`
+}
+
+type testOperation struct {
+	Responses map[string]testResponse `json:"responses"`
+}
+
+type testResponse struct {
+	Description string `json:"description"`
+	Content     map[string]struct {
+		Schema struct {
+			Ref string `json:"$ref"`
+		} `json:"schema"`
+	} `json:"content"`
+}
+
+// testProto returns a proto file with the test.v1.TestService service and its messages, extra messages are added
+// to the file as empty messages.
+func testProto(extraMessages ...string) *descriptorpb.FileDescriptorProto {
+	stringField := func(name string) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(1),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+		}
+	}
+
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String(testProtoFile),
+		Package: proto.String("test.v1"),
+		Syntax:  proto.String("proto3"),
+		Options: &descriptorpb.FileOptions{GoPackage: proto.String("example.com/test/v1;testv1")},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("EchoRequest"), Field: []*descriptorpb.FieldDescriptorProto{stringField("text")}},
+			{Name: proto.String("EchoResponse"), Field: []*descriptorpb.FieldDescriptorProto{stringField("text")}},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{
+			{
+				Name: proto.String("TestService"),
+				Method: []*descriptorpb.MethodDescriptorProto{
+					{
+						Name:       proto.String("Echo"),
+						InputType:  proto.String(".test.v1.EchoRequest"),
+						OutputType: proto.String(".test.v1.EchoResponse"),
+					},
+				},
+			},
+		},
+	}
+
+	for _, name := range extraMessages {
+		file.MessageType = append(file.MessageType, &descriptorpb.DescriptorProto{Name: proto.String(name)})
+	}
+
+	return file
+}
+
+// generateTestDocument generates the OpenAPI document for the proto file with the test gateway config. The files
+// are written to the config search path before generating the document.
+func generateTestDocument(
+	t *testing.T, protoFile *descriptorpb.FileDescriptorProto, options Options, files map[string]string) (
+	*testDocument, error) {
+
+	t.Helper()
+
+	searchPath := t.TempDir()
+	files["gateway.yaml"] = testGatewayConfig
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(searchPath, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write %s: %s", name, err)
+		}
+	}
+
+	plugin, err := protogen.Options{}.New(&pluginpb.CodeGeneratorRequest{
+		FileToGenerate: []string{protoFile.GetName()},
+		ProtoFile:      []*descriptorpb.FileDescriptorProto{protoFile},
+	})
+	if err != nil {
+		t.Fatalf("failed to create plugin: %s", err)
+	}
+
+	registryOptions := descriptor.DefaultRegistryOptions()
+	registryOptions.SearchPath = searchPath
+	registryOptions.GatewayFileLoadOptions.GlobalGatewayConfigFile = "gateway.yaml"
+	registry := descriptor.NewRegistry(registryOptions)
+	if err := registry.LoadFromPlugin(plugin); err != nil {
+		t.Fatalf("failed to load the descriptor registry: %s", err)
+	}
+
+	target, err := registry.LookupFile(protoFile.GetName())
+	if err != nil {
+		t.Fatalf("failed to look up the proto file: %s", err)
+	}
+
+	options.ConfigSearchPath = searchPath
+	options.OutputMode = OutputModeMerge
+	options.OutputFormat = OutputFormatJSON
+	responseFiles, err := New(registry, options).Generate([]*descriptor.File{target})
+	if err != nil {
+		return nil, err
+	}
+	if len(responseFiles) != 1 {
+		t.Fatalf("expected one generated file, got %d", len(responseFiles))
+	}
+
+	doc := &testDocument{}
+	if err := json.Unmarshal([]byte(responseFiles[0].GetContent()), doc); err != nil {
+		t.Fatalf("failed to unmarshal the generated document: %s", err)
+	}
+
+	return doc, nil
+}
@@ -10,9 +10,11 @@ type ErrorResponse struct {
 }
 
 var (
-	anySchema      OpenAPISchema
-	httpBodySchema OpenAPISchema
-	errorResponse  ErrorResponse
+	anySchema              OpenAPISchema
+	httpBodySchema         OpenAPISchema
+	problemDetailsSchema   OpenAPISchema
+	errorResponse          ErrorResponse
+	problemDetailsResponse *openapiv3.Ref[openapiv3.Response]
 )
 
 func AnySchema() OpenAPISchema {
@@ -75,3 +77,94 @@ func SetErrorResponseRef(ref string) {
 	errorResponse.Response.Data.Object.Content["application/json"].Object.Schema.Object.Ref = ref
 	errorResponse.ReferenceIsResolved = true
 }
+
+// ProblemDetailsSchema returns the schema of the RFC 7807 problem details documents rendered by the gateway.
+func ProblemDetailsSchema() OpenAPISchema {
+	if problemDetailsSchema.Schema == nil {
+		stringSchema := func(description string) *openapiv3.Schema {
+			return &openapiv3.Schema{
+				Object: openapiv3.SchemaCore{
+					Type:        openapiv3.TypeSet{openapiv3.TypeString},
+					Description: description,
+				},
+			}
+		}
+
+		problemDetailsSchema.Schema = &openapiv3.Schema{
+			Object: openapiv3.SchemaCore{
+				Type:        openapiv3.TypeSet{openapiv3.TypeObject},
+				Description: "RFC 7807 problem details.",
+				Properties: map[string]*openapiv3.Schema{
+					"type":     stringSchema("A URI reference that identifies the problem type."),
+					"title":    stringSchema("A short, human-readable summary of the problem type."),
+					"detail":   stringSchema("A human-readable explanation specific to this occurrence of the problem."),
+					"instance": stringSchema("A URI reference that identifies the specific occurrence of the problem."),
+					"status": {
+						Object: openapiv3.SchemaCore{
+							Type:        openapiv3.TypeSet{openapiv3.TypeInteger},
+							Format:      "int32",
+							Description: "The HTTP status code.",
+						},
+					},
+					"code":   stringSchema("The gRPC status code name."),
+					"reason": stringSchema("The reason of the error from the error info details."),
+					"domain": stringSchema("The logical grouping of the error reason from the error info details."),
+					"locale": stringSchema("The locale of the localized detail message."),
+					"metadata": {
+						Object: openapiv3.SchemaCore{
+							Type:                 openapiv3.TypeSet{openapiv3.TypeObject},
+							Description:          "Additional structured details from the error info details.",
+							AdditionalProperties: stringSchema(""),
+						},
+					},
+					"invalid_params": {
+						Object: openapiv3.SchemaCore{
+							Type:        openapiv3.TypeSet{openapiv3.TypeArray},
+							Description: "The request fields that failed validation.",
+							Items: &openapiv3.ItemSpec{
+								Schema: &openapiv3.Schema{
+									Object: openapiv3.SchemaCore{
+										Type: openapiv3.TypeSet{openapiv3.TypeObject},
+										Properties: map[string]*openapiv3.Schema{
+											"name":   stringSchema("The path to the field."),
+											"reason": stringSchema("The reason the field is invalid."),
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	return problemDetailsSchema
+}
+
+// ProblemDetailsErrorResponse returns the default error response using RFC 7807 problem details that references the
+// problem details schema.
+func ProblemDetailsErrorResponse(ref string) *openapiv3.Ref[openapiv3.Response] {
+	if problemDetailsResponse == nil {
+		problemDetailsResponse = &openapiv3.Ref[openapiv3.Response]{
+			Data: openapiv3.Response{
+				Object: openapiv3.ResponseCore{
+					Description: "An unexpected error response.",
+					Content: map[string]*openapiv3.MediaType{
+						"application/problem+json": {
+							Object: openapiv3.MediaTypeCore{
+								Schema: &openapiv3.Schema{
+									Object: openapiv3.SchemaCore{
+										Ref: ref,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	return problemDetailsResponse
+}
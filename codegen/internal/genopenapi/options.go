@@ -59,6 +59,13 @@ type Options struct {
 	// If set to true, the default error response does not get added to the responses.
 	DisableDefaultErrors bool
 
+	// If set to true, the default error response uses the RFC 7807 problem details schema instead of google.rpc.Status.
+	UseProblemDetails bool
+
+	// StatusCodeMappingFile points to a YAML/JSON file that holds the HTTP status codes used for gRPC codes, globally
+	// and per method. An error response gets generated for each mapped HTTP status code.
+	StatusCodeMappingFile string
+
 	// If set to true, the default 200 successful response does not get added to the responses.
 	DisableDefaultResponses bool
 
@@ -124,6 +131,8 @@ func DefaultOptions() Options {
 		IgnoreComments:                 false,
 		RemoveInternalComments:         false,
 		DisableDefaultErrors:           false,
+		UseProblemDetails:              false,
+		StatusCodeMappingFile:          "",
 		DisableDefaultResponses:        false,
 		UseEnumNumbers:                 false,
 		GlobalOpenAPIConfigFile:        "",
@@ -56,6 +56,12 @@ func (g *Generator) configFilePath(fileName string) string {
 }
 
 func (g *Generator) loadFromDescriptorRegistry() error {
+	if g.StatusCodeMappingFile != "" {
+		if err := g.loadStatusCodeMapping(); err != nil {
+			return err
+		}
+	}
+
 	if g.GlobalOpenAPIConfigFile != "" {
 		configPath := g.configFilePath(g.GlobalOpenAPIConfigFile)
 		doc, err := g.loadFile(configPath)
@@ -94,6 +94,10 @@ func (s *Session) renderOperation(
 		return nil, err
 	}
 
+	if err := s.addMappedErrorResponses(binding.Method, &operation.Object); err != nil {
+		return nil, err
+	}
+
 	return operation, nil
 }
 
@@ -102,31 +106,120 @@ func (s *Session) addDefaultErrorResponse(operation *openapiv3.OperationCore) er
 		return nil
 	}
 
-	response := internal.DefaultErrorResponse()
-	if !response.ReferenceIsResolved {
-		ref, err := s.schemaNameForFQN(rpcStatusProto)
-		if err != nil {
-			return fmt.Errorf("unexpected error: %w", err)
+	ref, err := s.includeErrorSchema()
+	if err != nil {
+		return err
+	}
+
+	var response *openapiv3.Ref[openapiv3.Response]
+	if s.UseProblemDetails {
+		response = internal.ProblemDetailsErrorResponse(ref)
+	} else {
+		defaultResponse := internal.DefaultErrorResponse()
+		if !defaultResponse.ReferenceIsResolved {
+			internal.SetErrorResponseRef(ref)
 		}
-		internal.SetErrorResponseRef(refPrefix + ref)
+		response = defaultResponse.Response
 	}
 
 	if operation.Responses == nil {
 		operation.Responses = map[string]*openapiv3.Ref[openapiv3.Response]{
-			httpStatusDefault: response.Response,
+			httpStatusDefault: response,
 		}
 	} else {
-		operation.Responses[httpStatusDefault] = response.Response
+		operation.Responses[httpStatusDefault] = response
+	}
+
+	return nil
+}
+
+// addMappedErrorResponses adds an error response for each HTTP status code in the status code mappings that apply
+// to the method, unless a response for that status code already exists.
+func (s *Session) addMappedErrorResponses(method *descriptor.Method, operation *openapiv3.OperationCore) error {
+	if s.DisableDefaultErrors {
+		return nil
+	}
+
+	grpcCodes := s.statusCodeMapping.codesByHTTPStatus(method)
+	if len(grpcCodes) == 0 {
+		return nil
+	}
+
+	ref, err := s.includeErrorSchema()
+	if err != nil {
+		return err
+	}
+
+	mediaType := mimeTypeJSON
+	if s.UseProblemDetails {
+		mediaType = mimeTypeProblemJSON
+	}
+
+	if operation.Responses == nil {
+		operation.Responses = make(map[string]*openapiv3.Ref[openapiv3.Response])
+	}
+
+	for httpStatus, codeNames := range grpcCodes {
+		key := strconv.Itoa(httpStatus)
+		if _, exists := operation.Responses[key]; exists {
+			continue
+		}
+
+		operation.Responses[key] = &openapiv3.Ref[openapiv3.Response]{
+			Data: openapiv3.Response{
+				Object: openapiv3.ResponseCore{
+					Description: "Returned for gRPC status codes: " + strings.Join(codeNames, ", ") + ".",
+					Content: map[string]*openapiv3.MediaType{
+						mediaType: {
+							Object: openapiv3.MediaTypeCore{
+								Schema: &openapiv3.Schema{
+									Object: openapiv3.SchemaCore{
+										Ref: ref,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	return nil
+}
+
+// includeErrorSchema includes the schema used for error responses in the document and returns the reference to it.
+func (s *Session) includeErrorSchema() (string, error) {
+	if s.UseProblemDetails {
+		if !s.includedDefaultErrorStatusDependency {
+			schemas := s.Document.Object.Components.Object.Schemas
+			if schemas == nil {
+				schemas = make(map[string]*openapiv3.Schema)
+				s.Document.Object.Components.Object.Schemas = schemas
+			}
+			if _, exists := schemas[problemDetailsSchemaName]; exists {
+				return "", fmt.Errorf("schema name %q is already in use", problemDetailsSchemaName)
+			}
+			schemas[problemDetailsSchemaName] = internal.ProblemDetailsSchema().Schema
+			s.includedDefaultErrorStatusDependency = true
+		}
+
+		return refPrefix + problemDetailsSchemaName, nil
+	}
+
+	ref, err := s.schemaNameForFQN(rpcStatusProto)
+	if err != nil {
+		return "", fmt.Errorf("unexpected error: %w", err)
 	}
 
 	if !s.includedDefaultErrorStatusDependency {
 		if err := s.includeMessage(rpcStatusProto); err != nil {
-			return fmt.Errorf("unexpected error importing rpc.Status: %w", err)
+			return "", fmt.Errorf("unexpected error importing rpc.Status: %w", err)
 		}
 		s.includedDefaultErrorStatusDependency = true
 	}
 
-	return nil
+	return refPrefix + ref, nil
 }
 
 func (s *Session) addDefaultResponses(responses internal.DefaultResponses, operation *openapiv3.OperationCore) error {
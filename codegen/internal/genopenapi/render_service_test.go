@@ -0,0 +1,118 @@
+package genopenapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestDefaultErrorResponse(t *testing.T) {
+	testCases := []struct {
+		Name              string
+		Proto             *descriptorpb.FileDescriptorProto
+		UseProblemDetails bool
+		ExpectedMediaType string
+		ExpectedSchema    string
+		UnexpectedSchema  string
+		Err               string
+	}{
+		{
+			Name:              "RPCStatus",
+			Proto:             testProto(),
+			ExpectedMediaType: mimeTypeJSON,
+			ExpectedSchema:    "Status",
+			UnexpectedSchema:  problemDetailsSchemaName,
+		},
+		{
+			Name:              "ProblemDetails",
+			Proto:             testProto(),
+			UseProblemDetails: true,
+			ExpectedMediaType: mimeTypeProblemJSON,
+			ExpectedSchema:    problemDetailsSchemaName,
+			UnexpectedSchema:  "Status",
+		},
+		{
+			Name:              "RPCStatusWithProblemDetailsMessage",
+			Proto:             testProto(problemDetailsSchemaName),
+			ExpectedMediaType: mimeTypeJSON,
+			ExpectedSchema:    "Status",
+		},
+		{
+			Name:              "ProblemDetailsSchemaNameInUse",
+			Proto:             testProto(problemDetailsSchemaName),
+			UseProblemDetails: true,
+			Err:               `schema name "ProblemDetails" is already in use`,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.UseProblemDetails = tt.UseProblemDetails
+
+			doc, err := generateTestDocument(t, tt.Proto, options, map[string]string{})
+			if tt.Err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.Err) {
+					t.Fatalf("expected error containing %q, got %v", tt.Err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to generate document: %s", err)
+			}
+
+			response, ok := doc.Paths["/v1/echo"]["post"].Responses[httpStatusDefault]
+			if !ok {
+				t.Fatalf("expected a default error response")
+			}
+			if len(response.Content) != 1 {
+				t.Errorf("expected a single media type, got %v", response.Content)
+			}
+			if ref := response.Content[tt.ExpectedMediaType].Schema.Ref; ref != refPrefix+tt.ExpectedSchema {
+				t.Errorf("expected %s response with schema %q, got %q", tt.ExpectedMediaType, tt.ExpectedSchema, ref)
+			}
+
+			if _, ok := doc.Components.Schemas[tt.ExpectedSchema]; !ok {
+				t.Errorf("expected schema %q to be included", tt.ExpectedSchema)
+			}
+			if _, ok := doc.Components.Schemas[tt.UnexpectedSchema]; ok && tt.UnexpectedSchema != "" {
+				t.Errorf("expected schema %q not to be included", tt.UnexpectedSchema)
+			}
+		})
+	}
+}
+
+func TestProblemDetailsSchema(t *testing.T) {
+	options := DefaultOptions()
+	options.UseProblemDetails = true
+
+	doc, err := generateTestDocument(t, testProto(), options, map[string]string{})
+	if err != nil {
+		t.Fatalf("failed to generate document: %s", err)
+	}
+
+	var schema struct {
+		Type       string                     `json:"type"`
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal(doc.Components.Schemas[problemDetailsSchemaName], &schema); err != nil {
+		t.Fatalf("failed to unmarshal the problem details schema: %s", err)
+	}
+
+	properties := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		properties = append(properties, name)
+	}
+	sort.Strings(properties)
+
+	expected := []string{
+		"code", "detail", "domain", "instance", "invalid_params", "locale", "metadata", "reason", "status", "title", "type",
+	}
+	if schema.Type != "object" || !reflect.DeepEqual(properties, expected) {
+		t.Errorf("expected an object with properties %v, got %q with %v", expected, schema.Type, properties)
+	}
+}
@@ -0,0 +1,97 @@
+package genopenapi
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+
+	"github.com/meshapi/grpc-api-gateway/codegen/internal/descriptor"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"gopkg.in/yaml.v3"
+)
+
+// statusCodeMappingFile is the format of the status code mapping file.
+//
+// Codes are the gRPC code names such as NOT_FOUND and methods are in the format of "/package.service/method", same
+// as the gateway WithStatusCodeMapping and WithMethodStatusCodeMapping options.
+type statusCodeMappingFile struct {
+	Codes   map[string]int            `yaml:"codes"`
+	Methods map[string]map[string]int `yaml:"methods"`
+}
+
+// statusCodeMapping holds the HTTP status codes used by the gateway for gRPC codes.
+type statusCodeMapping struct {
+	codes   map[code.Code]int
+	methods map[string]map[code.Code]int
+}
+
+func (g *Generator) loadStatusCodeMapping() error {
+	filePath := g.configFilePath(g.StatusCodeMappingFile)
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read status code mapping file: %w", err)
+	}
+
+	// NOTE: YAML is a superset of JSON so this handles both formats.
+	file := statusCodeMappingFile{}
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return fmt.Errorf("failed to decode status code mapping file %q: %w", filePath, err)
+	}
+
+	g.statusCodeMapping.codes, err = mapStatusCodes(file.Codes)
+	if err != nil {
+		return fmt.Errorf("invalid status code mapping in %q: %w", filePath, err)
+	}
+
+	g.statusCodeMapping.methods = make(map[string]map[code.Code]int, len(file.Methods))
+	for method, mapping := range file.Methods {
+		g.statusCodeMapping.methods[method], err = mapStatusCodes(mapping)
+		if err != nil {
+			return fmt.Errorf("invalid status code mapping for method %q in %q: %w", method, filePath, err)
+		}
+	}
+
+	return nil
+}
+
+func mapStatusCodes(mapping map[string]int) (map[code.Code]int, error) {
+	result := make(map[code.Code]int, len(mapping))
+	for name, httpStatus := range mapping {
+		value, ok := code.Code_value[name]
+		if !ok {
+			return nil, fmt.Errorf("unrecognized gRPC code %q", name)
+		}
+		if http.StatusText(httpStatus) == "" {
+			return nil, fmt.Errorf("invalid HTTP status code %d for gRPC code %q", httpStatus, name)
+		}
+		result[code.Code(value)] = httpStatus
+	}
+
+	return result, nil
+}
+
+// codesByHTTPStatus returns the sorted gRPC code names for each mapped HTTP status code that applies to the method.
+func (m statusCodeMapping) codesByHTTPStatus(method *descriptor.Method) map[int][]string {
+	merged := make(map[code.Code]int, len(m.codes))
+	for grpcCode, httpStatus := range m.codes {
+		merged[grpcCode] = httpStatus
+	}
+	for grpcCode, httpStatus := range m.methods["/"+method.Service.FQSN()[1:]+"/"+method.GetName()] {
+		merged[grpcCode] = httpStatus
+	}
+
+	if len(merged) == 0 {
+		return nil
+	}
+
+	result := make(map[int][]string)
+	for grpcCode, httpStatus := range merged {
+		result[httpStatus] = append(result[httpStatus], grpcCode.String())
+	}
+	for _, names := range result {
+		sort.Strings(names)
+	}
+
+	return result
+}
@@ -0,0 +1,189 @@
+package genopenapi
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/code"
+)
+
+func TestLoadStatusCodeMapping(t *testing.T) {
+	testCases := []struct {
+		Name            string
+		FileName        string
+		Content         string
+		ExpectedCodes   map[code.Code]int
+		ExpectedMethods map[string]map[code.Code]int
+		Err             string
+	}{
+		{
+			Name:     "YAML",
+			FileName: "status_codes.yaml",
+			Content: `
+codes:
+  NOT_FOUND: 404
+  UNAVAILABLE: 503
+methods:
+  /test.v1.TestService/Echo:
+    NOT_FOUND: 410
+`,
+			ExpectedCodes:   map[code.Code]int{code.Code_NOT_FOUND: 404, code.Code_UNAVAILABLE: 503},
+			ExpectedMethods: map[string]map[code.Code]int{"/test.v1.TestService/Echo": {code.Code_NOT_FOUND: 410}},
+		},
+		{
+			Name:            "JSON",
+			FileName:        "status_codes.json",
+			Content:         `{"codes": {"ABORTED": 409}}`,
+			ExpectedCodes:   map[code.Code]int{code.Code_ABORTED: 409},
+			ExpectedMethods: map[string]map[code.Code]int{},
+		},
+		{
+			Name:     "UnknownCode",
+			FileName: "status_codes.yaml",
+			Content:  "codes:\n  MISSING: 404\n",
+			Err:      `unrecognized gRPC code "MISSING"`,
+		},
+		{
+			Name:     "InvalidStatus",
+			FileName: "status_codes.yaml",
+			Content:  "codes:\n  NOT_FOUND: 999\n",
+			Err:      `invalid HTTP status code 999 for gRPC code "NOT_FOUND"`,
+		},
+		{
+			Name:     "InvalidMethodStatus",
+			FileName: "status_codes.yaml",
+			Content:  "methods:\n  /test.v1.TestService/Echo:\n    NOT_FOUND: 0\n",
+			Err:      `invalid status code mapping for method "/test.v1.TestService/Echo"`,
+		},
+		{
+			Name:     "InvalidFile",
+			FileName: "status_codes.yaml",
+			Content:  "codes: [NOT_FOUND]\n",
+			Err:      "failed to decode status code mapping file",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			searchPath := t.TempDir()
+			if err := os.WriteFile(filepath.Join(searchPath, tt.FileName), []byte(tt.Content), 0o644); err != nil {
+				t.Fatalf("failed to write the mapping file: %s", err)
+			}
+
+			g := &Generator{Options: Options{ConfigSearchPath: searchPath, StatusCodeMappingFile: tt.FileName}}
+			err := g.loadStatusCodeMapping()
+			if tt.Err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.Err) {
+					t.Fatalf("expected error containing %q, got %v", tt.Err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if !reflect.DeepEqual(g.statusCodeMapping.codes, tt.ExpectedCodes) {
+				t.Errorf("expected codes %v, got %v", tt.ExpectedCodes, g.statusCodeMapping.codes)
+			}
+			if !reflect.DeepEqual(g.statusCodeMapping.methods, tt.ExpectedMethods) {
+				t.Errorf("expected methods %v, got %v", tt.ExpectedMethods, g.statusCodeMapping.methods)
+			}
+		})
+	}
+}
+
+func TestMappedErrorResponses(t *testing.T) {
+	testCases := []struct {
+		Name                 string
+		Mapping              string
+		DisableDefaultErrors bool
+		UseProblemDetails    bool
+		// ExpectedResponses maps the HTTP status codes to the expected descriptions of the mapped error responses.
+		ExpectedResponses map[string]string
+	}{
+		{
+			Name: "GlobalCodes",
+			Mapping: `
+codes:
+  NOT_FOUND: 404
+  FAILED_PRECONDITION: 400
+  OUT_OF_RANGE: 400
+`,
+			ExpectedResponses: map[string]string{
+				"404": "Returned for gRPC status codes: NOT_FOUND.",
+				"400": "Returned for gRPC status codes: FAILED_PRECONDITION, OUT_OF_RANGE.",
+			},
+		},
+		{
+			Name: "MethodCodes",
+			Mapping: `
+codes:
+  NOT_FOUND: 404
+methods:
+  /test.v1.TestService/Echo:
+    NOT_FOUND: 410
+    ABORTED: 409
+  /test.v1.TestService/Other:
+    UNAVAILABLE: 503
+`,
+			ExpectedResponses: map[string]string{
+				"410": "Returned for gRPC status codes: NOT_FOUND.",
+				"409": "Returned for gRPC status codes: ABORTED.",
+			},
+		},
+		{
+			Name:              "ProblemDetails",
+			Mapping:           "codes:\n  NOT_FOUND: 404\n",
+			UseProblemDetails: true,
+			ExpectedResponses: map[string]string{
+				"404": "Returned for gRPC status codes: NOT_FOUND.",
+			},
+		},
+		{
+			Name:                 "DisableDefaultErrors",
+			Mapping:              "codes:\n  NOT_FOUND: 404\n",
+			DisableDefaultErrors: true,
+			ExpectedResponses:    map[string]string{},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			options := DefaultOptions()
+			options.StatusCodeMappingFile = "status_codes.yaml"
+			options.DisableDefaultErrors = tt.DisableDefaultErrors
+			options.UseProblemDetails = tt.UseProblemDetails
+
+			doc, err := generateTestDocument(t, testProto(), options, map[string]string{
+				"status_codes.yaml": tt.Mapping,
+			})
+			if err != nil {
+				t.Fatalf("failed to generate document: %s", err)
+			}
+
+			mediaType, ref := mimeTypeJSON, refPrefix+"Status"
+			if tt.UseProblemDetails {
+				mediaType, ref = mimeTypeProblemJSON, refPrefix+problemDetailsSchemaName
+			}
+
+			responses := doc.Paths["/v1/echo"]["post"].Responses
+			mapped := map[string]string{}
+			for status, response := range responses {
+				if status == httpStatusOK || status == httpStatusDefault {
+					continue
+				}
+
+				mapped[status] = response.Description
+				if schemaRef := response.Content[mediaType].Schema.Ref; schemaRef != ref {
+					t.Errorf("expected %s response with schema %q, got %q", status, ref, schemaRef)
+				}
+			}
+			if !reflect.DeepEqual(mapped, tt.ExpectedResponses) {
+				t.Errorf("expected mapped responses %v, got %v", tt.ExpectedResponses, mapped)
+			}
+		})
+	}
+}
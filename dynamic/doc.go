@@ -0,0 +1,8 @@
+// Package dynamic builds the gateway routes at runtime from protobuf descriptors and gateway configs instead of
+// generated code.
+//
+// The bindings are read from the same gateway config format that is consumed by the code generator and from the
+// HTTP options of the methods. The requests are decoded into dynamic messages and forwarded through a gRPC client
+// connection, supporting unary, server-streaming, client-streaming and bidirectional streaming methods the same way
+// the generated handlers do.
+package dynamic
@@ -0,0 +1,835 @@
+package dynamic
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/meshapi/grpc-api-gateway/api"
+	"github.com/meshapi/grpc-api-gateway/api/openapi"
+	"github.com/meshapi/grpc-api-gateway/dotpath"
+	"github.com/meshapi/grpc-api-gateway/gateway"
+	"github.com/meshapi/grpc-api-gateway/pkg/httprule"
+	"github.com/meshapi/grpc-api-gateway/trie"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+var (
+	selectorPattern = regexp.MustCompile(`^\w+(?:[.]\w+)+$`)
+)
+
+// Option configures the way the bindings are resolved.
+type Option interface {
+	apply(*options)
+}
+
+type optionFunc func(*options)
+
+func (f optionFunc) apply(o *options) {
+	f(o)
+}
+
+type options struct {
+	protoPackage               string
+	generateUnboundMethods     bool
+	allowDeleteBody            bool
+	disablePatchFeature        bool
+	repeatedPathParamSeparator rune
+	overlay                    *api.GatewaySpec
+}
+
+// WithProtoPackage sets the proto package that is used to resolve the relative selectors, the selectors that start
+// with "~.".
+func WithProtoPackage(protoPackage string) Option {
+	return optionFunc(func(o *options) {
+		o.protoPackage = protoPackage
+	})
+}
+
+// WithGenerateUnboundMethods binds the methods that do not have any HTTP bindings to "POST /package.Service/Method"
+// with the whole request message as the body.
+func WithGenerateUnboundMethods() Option {
+	return optionFunc(func(o *options) {
+		o.generateUnboundMethods = true
+	})
+}
+
+// WithAllowDeleteBody allows the bindings with the DELETE HTTP method to have a request body.
+func WithAllowDeleteBody() Option {
+	return optionFunc(func(o *options) {
+		o.allowDeleteBody = true
+	})
+}
+
+// WithoutPatchFeature disables populating the update mask of the PATCH requests from the fields in the request body.
+func WithoutPatchFeature() Option {
+	return optionFunc(func(o *options) {
+		o.disablePatchFeature = true
+	})
+}
+
+// WithRepeatedPathParameterSeparator sets the separator that is used to split the path parameters of repeated
+// fields. Default is ','.
+func WithRepeatedPathParameterSeparator(separator rune) Option {
+	return optionFunc(func(o *options) {
+		o.repeatedPathParamSeparator = separator
+	})
+}
+
+// Gateway holds the HTTP bindings of the gRPC methods, resolved against the protobuf descriptors.
+type Gateway struct {
+	methods []*method
+}
+
+// Route describes an HTTP route of the gateway.
+type Route struct {
+	// HTTPMethod is the HTTP method of the route.
+	HTTPMethod string
+	// HTTPPathPattern is the path of the route in the HTTP rule format, such as "/v1/users/{id}".
+	HTTPPathPattern string
+	// RPCMethod is the full name of the gRPC method, such as "/package.Service/Method".
+	RPCMethod string
+	// StreamingMode is the streaming mode of the gRPC method.
+	StreamingMode gateway.StreamingMode
+	// Operation holds the OpenAPI operation annotations of the gRPC method, nil if there are none.
+	Operation *openapi.Operation
+}
+
+func (r Route) String() string {
+	return r.HTTPMethod + " " + r.HTTPPathPattern + " -> " + r.RPCMethod
+}
+
+// Routes returns the HTTP routes of the gateway.
+func (g *Gateway) Routes() []Route {
+	var routes []Route
+	for _, m := range g.methods {
+		for _, b := range m.bindings {
+			routes = append(routes, b.route())
+		}
+	}
+	return routes
+}
+
+// method is a gRPC method with HTTP bindings.
+type method struct {
+	desc          protoreflect.MethodDescriptor
+	rpcMethod     string
+	streamingMode gateway.StreamingMode
+	input         protoreflect.MessageType
+	output        protoreflect.MessageType
+	operation     *openapi.Operation
+	bindings      []*binding
+}
+
+// binding describes how an HTTP endpoint is bound to a gRPC method.
+type binding struct {
+	method       *method
+	index        int
+	httpMethod   string
+	template     httprule.Template
+	pathParams   []pathParam
+	body         *fieldPath
+	responseBody fieldPath
+
+	hasQueryParams bool
+	queryParams    gateway.QueryParameterParseOptions
+
+	allowWebsocket       bool
+	allowSSE             bool
+	allowChunkedTransfer bool
+
+	// fieldMask is the update mask field that gets populated from the request body in PATCH requests.
+	fieldMask protoreflect.FieldDescriptor
+
+	repeatedPathParamSeparator rune
+}
+
+type pathParam struct {
+	name string
+	path fieldPath
+}
+
+// fieldPath is a path to a proto field.
+type fieldPath []protoreflect.FieldDescriptor
+
+func (f fieldPath) String() string {
+	components := make([]string, 0, len(f))
+	for _, field := range f {
+		components = append(components, string(field.Name()))
+	}
+	return strings.Join(components, ".")
+}
+
+func (f fieldPath) target() protoreflect.FieldDescriptor {
+	return f[len(f)-1]
+}
+
+func (b *binding) route() Route {
+	return Route{
+		HTTPMethod:      b.httpMethod,
+		HTTPPathPattern: httpPattern(b.template),
+		RPCMethod:       b.method.rpcMethod,
+		StreamingMode:   b.method.streamingMode,
+		Operation:       b.method.operation,
+	}
+}
+
+func (b *binding) routeInfo() gateway.RouteInfo {
+	info := gateway.RouteInfo{
+		HTTPMethod:              b.httpMethod,
+		Path:                    httpPath(b.template),
+		RPCMethod:               b.method.rpcMethod,
+		HTTPPathPattern:         httpPattern(b.template),
+		BindingIndex:            b.index,
+		StreamingMode:           b.method.streamingMode,
+		ResponseBody:            b.responseBody.String(),
+		SupportsChunkedTransfer: b.needsChunkedTransfer(),
+		SupportsSSE:             b.needsSSE(),
+		SupportsWebsocket:       b.needsWebsocket(),
+	}
+	switch {
+	case b.body == nil:
+	case len(*b.body) == 0:
+		info.RequestBody = "*"
+	default:
+		info.RequestBody = b.body.String()
+	}
+	return info
+}
+
+// WithOverlay applies the endpoint bindings of "overlay" on top of the bindings from the gateway spec and the method
+// options.
+//
+// An overlay binding with an HTTP pattern replaces the binding of the method, or binds the method if it has no
+// bindings. An overlay binding without a pattern amends the binding of the method instead:
+//
+//   - query_params are merged with the query parameters of the binding, replacing the ones with the same selector.
+//   - disable_query_param_discovery disables the query parameter discovery when set.
+//   - stream replaces the stream config of the binding when set.
+//   - additional_bindings are added to the additional bindings of the binding.
+//   - body and response_body replace the ones of the binding when set.
+func WithOverlay(overlay *api.GatewaySpec) Option {
+	return optionFunc(func(o *options) {
+		o.overlay = overlay
+	})
+}
+
+// UnresolvedSelectorsError is returned when selectors of the gateway spec or the overlay do not match any method.
+type UnresolvedSelectorsError struct {
+	// Selectors are the unresolved selectors of the gateway spec.
+	Selectors []string
+	// OverlaySelectors are the unresolved selectors of the overlay.
+	OverlaySelectors []string
+}
+
+func (u UnresolvedSelectorsError) Error() string {
+	var messages []string
+	if len(u.Selectors) > 0 {
+		messages = append(messages, "selectors do not match any method: "+strings.Join(u.Selectors, ", "))
+	}
+	if len(u.OverlaySelectors) > 0 {
+		messages = append(messages, "overlay selectors do not match any method: "+strings.Join(u.OverlaySelectors, ", "))
+	}
+	return strings.Join(messages, "; ")
+}
+
+// New resolves the endpoint bindings of the gateway spec and the HTTP options of the methods in the files.
+//
+// The gateway spec has the same format as the "gateway" section of the config files consumed by the code generator.
+// An error is returned if a binding is invalid or if a selector does not match any method in the files.
+func New(files *protoregistry.Files, spec *api.GatewaySpec, opts ...Option) (*Gateway, error) {
+	o := options{repeatedPathParamSeparator: ','}
+	for _, opt := range opts {
+		opt.apply(&o)
+	}
+
+	endpoints, err := resolveSelectors(spec, o)
+	if err != nil {
+		return nil, err
+	}
+	overlayEndpoints, err := resolveSelectors(o.overlay, o)
+	if err != nil {
+		return nil, fmt.Errorf("invalid overlay: %w", err)
+	}
+
+	var fileDescriptors []protoreflect.FileDescriptor
+	files.RangeFiles(func(file protoreflect.FileDescriptor) bool {
+		fileDescriptors = append(fileDescriptors, file)
+		return true
+	})
+	sort.Slice(fileDescriptors, func(i, j int) bool {
+		return fileDescriptors[i].Path() < fileDescriptors[j].Path()
+	})
+
+	result := &Gateway{}
+	for _, file := range fileDescriptors {
+		services := file.Services()
+		for serviceIndex := 0; serviceIndex < services.Len(); serviceIndex++ {
+			methods := services.Get(serviceIndex).Methods()
+			for methodIndex := 0; methodIndex < methods.Len(); methodIndex++ {
+				desc := methods.Get(methodIndex)
+
+				endpoint, ok := endpoints[desc.FullName()]
+				delete(endpoints, desc.FullName())
+				embeddedEndpoint := endpointFromMethodOptions(desc)
+				switch {
+				case ok && embeddedEndpoint != nil:
+					return nil, fmt.Errorf(
+						"conflicting binding for %q: both the gateway spec and the method options contain bindings",
+						desc.FullName())
+				case !ok && embeddedEndpoint != nil:
+					endpoint = embeddedEndpoint
+				case !ok && o.generateUnboundMethods:
+					endpoint = &api.EndpointBinding{
+						Pattern: &api.EndpointBinding_Post{
+							Post: fmt.Sprintf("/%s/%s", desc.Parent().FullName(), desc.Name()),
+						},
+						Body: "*",
+					}
+				}
+
+				if overlayEndpoint, ok := overlayEndpoints[desc.FullName()]; ok {
+					delete(overlayEndpoints, desc.FullName())
+					endpoint, err = applyOverlay(endpoint, overlayEndpoint)
+					if err != nil {
+						return nil, fmt.Errorf("failed to apply overlay on method %q: %w", desc.FullName(), err)
+					}
+				}
+				if endpoint == nil {
+					continue
+				}
+
+				m, err := newMethod(desc, endpoint, o)
+				if err != nil {
+					return nil, fmt.Errorf("failed to process method %q: %w", desc.FullName(), err)
+				}
+				result.methods = append(result.methods, m)
+			}
+		}
+	}
+
+	if len(endpoints) > 0 || len(overlayEndpoints) > 0 {
+		return nil, UnresolvedSelectorsError{
+			Selectors:        sortedSelectors(endpoints),
+			OverlaySelectors: sortedSelectors(overlayEndpoints),
+		}
+	}
+
+	return result, nil
+}
+
+// resolveSelectors returns the endpoints of the spec by their fully qualified method name.
+func resolveSelectors(
+	spec *api.GatewaySpec, o options) (map[protoreflect.FullName]*api.EndpointBinding, error) {
+
+	endpoints := map[protoreflect.FullName]*api.EndpointBinding{}
+	for _, endpoint := range spec.GetEndpoints() {
+		selector := endpoint.GetSelector()
+		if strings.HasPrefix(selector, "~.") {
+			if o.protoPackage == "" {
+				return nil, fmt.Errorf(
+					"no proto package context is available, cannot use relative selector: %s", selector)
+			}
+			selector = o.protoPackage + selector[1:]
+		}
+		selector = strings.TrimPrefix(selector, ".")
+
+		if !selectorPattern.MatchString(selector) {
+			return nil, fmt.Errorf("invalid selector: %q", endpoint.GetSelector())
+		}
+		if _, ok := endpoints[protoreflect.FullName(selector)]; ok {
+			return nil, fmt.Errorf("conflicting binding for %q: the selector is used more than once", selector)
+		}
+		endpoints[protoreflect.FullName(selector)] = endpoint
+	}
+
+	return endpoints, nil
+}
+
+func sortedSelectors(endpoints map[protoreflect.FullName]*api.EndpointBinding) []string {
+	if len(endpoints) == 0 {
+		return nil
+	}
+
+	selectors := make([]string, 0, len(endpoints))
+	for selector := range endpoints {
+		selectors = append(selectors, string(selector))
+	}
+	sort.Strings(selectors)
+	return selectors
+}
+
+// applyOverlay returns the endpoint that results from applying "overlay" on "endpoint", see WithOverlay.
+func applyOverlay(endpoint, overlay *api.EndpointBinding) (*api.EndpointBinding, error) {
+	if overlay.GetPattern() != nil {
+		return overlay, nil
+	}
+	if endpoint == nil {
+		return nil, fmt.Errorf("the overlay binding has no pattern and the method has no binding to amend")
+	}
+
+	result := proto.Clone(endpoint).(*api.EndpointBinding)
+	if overlay.GetBody() != "" {
+		result.Body = overlay.GetBody()
+	}
+	if overlay.GetResponseBody() != "" {
+		result.ResponseBody = overlay.GetResponseBody()
+	}
+	if overlay.GetDisableQueryParamDiscovery() {
+		result.DisableQueryParamDiscovery = true
+	}
+	if overlay.GetStream() != nil {
+		result.Stream = overlay.GetStream()
+	}
+	result.AdditionalBindings = append(result.AdditionalBindings, overlay.GetAdditionalBindings()...)
+
+	for _, queryParam := range overlay.GetQueryParams() {
+		replaced := false
+		for index, existing := range result.QueryParams {
+			if existing.GetSelector() == queryParam.GetSelector() {
+				result.QueryParams[index] = queryParam
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			result.QueryParams = append(result.QueryParams, queryParam)
+		}
+	}
+
+	return result, nil
+}
+
+// endpointFromMethodOptions returns the binding in the HTTP options of the method, or nil if there is none.
+func endpointFromMethodOptions(desc protoreflect.MethodDescriptor) *api.EndpointBinding {
+	methodOptions := desc.Options()
+	if methodOptions == nil || !proto.HasExtension(methodOptions, api.E_Http) {
+		return nil
+	}
+
+	embeddedBinding, ok := proto.GetExtension(methodOptions, api.E_Http).(*api.ProtoEndpointBinding)
+	if !ok || embeddedBinding == nil {
+		return nil
+	}
+
+	endpoint := &api.EndpointBinding{
+		Selector:                   string(desc.FullName()),
+		Body:                       embeddedBinding.GetBody(),
+		QueryParams:                embeddedBinding.GetQueryParams(),
+		AdditionalBindings:         embeddedBinding.GetAdditionalBindings(),
+		DisableQueryParamDiscovery: embeddedBinding.GetDisableQueryParamDiscovery(),
+		Stream:                     embeddedBinding.GetStream(),
+	}
+
+	switch pattern := embeddedBinding.GetPattern().(type) {
+	case *api.ProtoEndpointBinding_Get:
+		endpoint.Pattern = &api.EndpointBinding_Get{Get: pattern.Get}
+	case *api.ProtoEndpointBinding_Put:
+		endpoint.Pattern = &api.EndpointBinding_Put{Put: pattern.Put}
+	case *api.ProtoEndpointBinding_Post:
+		endpoint.Pattern = &api.EndpointBinding_Post{Post: pattern.Post}
+	case *api.ProtoEndpointBinding_Delete:
+		endpoint.Pattern = &api.EndpointBinding_Delete{Delete: pattern.Delete}
+	case *api.ProtoEndpointBinding_Patch:
+		endpoint.Pattern = &api.EndpointBinding_Patch{Patch: pattern.Patch}
+	case *api.ProtoEndpointBinding_Custom:
+		endpoint.Pattern = &api.EndpointBinding_Custom{Custom: pattern.Custom}
+	}
+
+	return endpoint
+}
+
+// operationFromMethodOptions returns the OpenAPI operation in the options of the method, or nil if there is none.
+func operationFromMethodOptions(desc protoreflect.MethodDescriptor) *openapi.Operation {
+	methodOptions := desc.Options()
+	if methodOptions == nil || !proto.HasExtension(methodOptions, api.E_OpenapiOperation) {
+		return nil
+	}
+
+	operation, _ := proto.GetExtension(methodOptions, api.E_OpenapiOperation).(*openapi.Operation)
+	return operation
+}
+
+// bindingInput holds the fields that are shared between the endpoint binding and the additional bindings.
+type bindingInput struct {
+	httpMethod                      string
+	path                            string
+	body                            string
+	responseBody                    string
+	disableQueryParamsAutoDiscovery bool
+	queryParams                     []*api.QueryParameterBinding
+	streamConfig                    *api.StreamConfig
+}
+
+func newMethod(desc protoreflect.MethodDescriptor, endpoint *api.EndpointBinding, o options) (*method, error) {
+	m := &method{
+		desc:      desc,
+		rpcMethod: fmt.Sprintf("/%s/%s", desc.Parent().FullName(), desc.Name()),
+		input:     messageTypeOf(desc.Input()),
+		output:    messageTypeOf(desc.Output()),
+		operation: operationFromMethodOptions(desc),
+	}
+
+	switch {
+	case desc.IsStreamingClient() && desc.IsStreamingServer():
+		m.streamingMode = gateway.StreamingModeBidirectional
+	case desc.IsStreamingClient():
+		m.streamingMode = gateway.StreamingModeClient
+	case desc.IsStreamingServer():
+		m.streamingMode = gateway.StreamingModeServer
+	default:
+		m.streamingMode = gateway.StreamingModeUnary
+	}
+
+	httpMethod, path, err := parseEndpointPattern(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	inputs := []bindingInput{{
+		httpMethod:                      httpMethod,
+		path:                            path,
+		body:                            endpoint.GetBody(),
+		responseBody:                    endpoint.GetResponseBody(),
+		disableQueryParamsAutoDiscovery: endpoint.GetDisableQueryParamDiscovery(),
+		queryParams:                     endpoint.GetQueryParams(),
+		streamConfig:                    endpoint.GetStream(),
+	}}
+
+	for _, additionalBinding := range endpoint.GetAdditionalBindings() {
+		httpMethod, path, err := parseAdditionalEndpointPattern(additionalBinding)
+		if err != nil {
+			return nil, err
+		}
+
+		inputs = append(inputs, bindingInput{
+			httpMethod:                      httpMethod,
+			path:                            path,
+			body:                            additionalBinding.GetBody(),
+			responseBody:                    additionalBinding.GetResponseBody(),
+			disableQueryParamsAutoDiscovery: additionalBinding.GetDisableQueryParamDiscovery(),
+			queryParams:                     additionalBinding.GetQueryParams(),
+			streamConfig:                    additionalBinding.GetStream(),
+		})
+	}
+
+	for index, input := range inputs {
+		b, err := m.newBinding(index, input, o)
+		if err != nil {
+			return nil, err
+		}
+		m.bindings = append(m.bindings, b)
+	}
+
+	return m, nil
+}
+
+func (m *method) newBinding(index int, input bindingInput, o options) (*binding, error) {
+	tpl, err := httprule.Parse(input.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTTP rule %s: %w", input.path, err)
+	}
+
+	if m.desc.IsStreamingClient() && tpl.HasVariables() {
+		return nil, fmt.Errorf("cannot use path parameters in client streaming: %s", input.path)
+	}
+
+	b := &binding{
+		method:     m,
+		index:      index,
+		httpMethod: input.httpMethod,
+		template:   tpl,
+	}
+
+	for _, segment := range tpl.Segments {
+		if segment.Type != httprule.SegmentTypeCatchAllSelector && segment.Type != httprule.SegmentTypeSelector {
+			continue
+		}
+
+		path, err := resolveFieldPath(m.desc.Input(), segment.Value, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to map path parameter in %s: %w", input.path, err)
+		}
+		if !isScalarField(path.target()) {
+			return nil, fmt.Errorf(
+				"%s is a protobuf message type. Protobuf message types cannot be used as path parameters,"+
+					" use a scalar value type (such as string) instead", segment.Value)
+		}
+		b.pathParams = append(b.pathParams, pathParam{name: segment.Value, path: path})
+	}
+
+	if !o.allowDeleteBody && input.httpMethod == http.MethodDelete && input.body != "" {
+		return nil, fmt.Errorf(
+			"must not set request body when http method is DELETE except allow delete body option is set: %q",
+			input.path)
+	}
+
+	switch input.body {
+	case "":
+	case "*":
+		b.body = &fieldPath{}
+	default:
+		path, err := resolveFieldPath(m.desc.Input(), input.body, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse request body selector %q: %w", input.body, err)
+		}
+		if m.desc.IsStreamingClient() && !isMessageField(path.target()) {
+			return nil, fmt.Errorf(
+				"request body selector %q of a client streaming method must be a message field", input.body)
+		}
+		b.body = &path
+	}
+
+	switch input.responseBody {
+	case "", "*":
+	default:
+		b.responseBody, err = resolveFieldPath(m.desc.Output(), input.responseBody, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse response body selector %q: %w", input.responseBody, err)
+		}
+	}
+
+	if err := b.resolveQueryParameters(input); err != nil {
+		return nil, err
+	}
+
+	if m.desc.IsStreamingClient() || m.desc.IsStreamingServer() {
+		b.allowWebsocket = !input.streamConfig.GetDisableWebsockets()
+		b.allowSSE = !input.streamConfig.GetDisableSse()
+		b.allowChunkedTransfer = !input.streamConfig.GetDisableChunkedTransfer()
+
+		if m.desc.IsStreamingServer() && !b.needsChunkedTransfer() && !b.needsSSE() && !b.needsWebsocket() {
+			return nil, fmt.Errorf(
+				"streaming method does not support any streaming method (sse, websocket, chunked transfer),"+
+					" note that you must use GET for SSE and Websocket streaming methods: %s", input.path)
+		}
+	}
+
+	if !o.disablePatchFeature && input.httpMethod == http.MethodPatch && b.body != nil && len(*b.body) > 0 &&
+		isMessageField(b.body.target()) {
+		b.fieldMask = fieldMaskField(m.desc.Input())
+	}
+
+	b.repeatedPathParamSeparator = o.repeatedPathParamSeparator
+
+	return b, nil
+}
+
+// resolveQueryParameters prepares the query parameter parse options, equivalent to the ones in the generated code.
+func (b *binding) resolveQueryParameters(input bindingInput) error {
+	filter := b.queryParameterFilter()
+	wholeBody := b.body != nil && len(*b.body) == 0
+
+	var aliases map[string]string
+	var ignoredFields []fieldPath
+	for _, queryParam := range input.queryParams {
+		path, err := resolveFieldPath(b.method.desc.Input(), queryParam.GetSelector(), false)
+		if err != nil {
+			return fmt.Errorf("failed to resolve field at selector %q: %w", queryParam.GetSelector(), err)
+		}
+
+		// if query param is already used by another target, error out.
+		selector := queryParam.GetSelector()
+		if wholeBody || filter.HasCommonPrefix(dotpath.Parse(&selector)) {
+			return fmt.Errorf(
+				"cannot use selector %q for query parameter %q because it will already be read from payload/path params",
+				queryParam.GetSelector(), queryParam.GetName())
+		}
+
+		if !isScalarField(path.target()) {
+			return fmt.Errorf(
+				"cannot use selector %q for query parameter %q because it points to a"+
+					" Protobuf message type, only scalar types can be used",
+				queryParam.GetSelector(), queryParam.GetName())
+		}
+
+		if queryParam.GetIgnore() {
+			ignoredFields = append(ignoredFields, path)
+			continue
+		}
+
+		name := queryParam.GetName()
+		if name == "" {
+			name = path.String()
+		}
+		if aliases == nil {
+			aliases = map[string]string{}
+		}
+		aliases[name] = path.String()
+	}
+
+	for _, path := range aliases {
+		filter.AddString(path)
+	}
+	for _, path := range ignoredFields {
+		filter.AddString(path.String())
+	}
+
+	// if body is '*' (everything), there are no query parameters.
+	b.hasQueryParams = !wholeBody && (!input.disableQueryParamsAutoDiscovery || len(aliases) > 0)
+	b.queryParams = gateway.QueryParameterParseOptions{
+		Filter:         filter,
+		Aliases:        aliases,
+		LimitToAliases: input.disableQueryParamsAutoDiscovery,
+	}
+
+	return nil
+}
+
+// queryParameterFilter returns a trie that filters out the field paths that are bound to the body or the path.
+func (b *binding) queryParameterFilter() *trie.Node {
+	node := trie.New()
+
+	if b.body != nil {
+		node.AddString(b.body.String())
+		for _, field := range *b.body {
+			if field.HasJSONName() {
+				node.AddString(field.JSONName())
+			}
+		}
+	}
+
+	for _, param := range b.pathParams {
+		node.AddString(param.path.String())
+		if param.path.target().HasJSONName() {
+			node.AddString(param.path.target().JSONName())
+		}
+	}
+
+	return node
+}
+
+func (b *binding) needsWebsocket() bool {
+	return b.httpMethod == http.MethodGet && b.method.desc.IsStreamingServer() && b.allowWebsocket
+}
+
+func (b *binding) needsSSE() bool {
+	return b.httpMethod == http.MethodGet && b.method.desc.IsStreamingServer() && b.allowSSE
+}
+
+func (b *binding) needsChunkedTransfer() bool {
+	return b.method.desc.IsStreamingServer() && b.allowChunkedTransfer
+}
+
+// resolveFieldPath resolves the dot-separated field names, starting from the message.
+func resolveFieldPath(msg protoreflect.MessageDescriptor, path string, isPathParam bool) (fieldPath, error) {
+	root := msg
+	var result fieldPath
+	for index, name := range strings.Split(path, ".") {
+		if index > 0 {
+			previous := result[index-1]
+			if previous.Message() == nil || previous.IsList() || previous.IsMap() {
+				return nil, fmt.Errorf("not an aggregate type: %s in %s", previous.Name(), path)
+			}
+			msg = previous.Message()
+		}
+
+		field := msg.Fields().ByName(protoreflect.Name(name))
+		if field == nil {
+			return nil, fmt.Errorf("no field %q found in %s", path, root.Name())
+		}
+
+		if isPathParam && field.HasOptionalKeyword() && field.ContainingOneof() != nil {
+			return nil, fmt.Errorf("optional field not allowed in field path: %s in %s", field.Name(), path)
+		}
+
+		result = append(result, field)
+	}
+
+	return result, nil
+}
+
+// isScalarField returns whether or not the field has a scalar type. Wrappers, timestamps and durations are also
+// considered as scalars since they have a string representation.
+func isScalarField(field protoreflect.FieldDescriptor) bool {
+	if field.Message() == nil {
+		return true
+	}
+
+	switch field.Message().FullName() {
+	case "google.protobuf.Timestamp", "google.protobuf.Duration", "google.protobuf.StringValue",
+		"google.protobuf.FloatValue", "google.protobuf.DoubleValue", "google.protobuf.BoolValue",
+		"google.protobuf.BytesValue", "google.protobuf.Int32Value", "google.protobuf.UInt32Value",
+		"google.protobuf.Int64Value", "google.protobuf.UInt64Value":
+		return true
+	}
+
+	return false
+}
+
+// isMessageField returns whether or not the field is a singular message field.
+func isMessageField(field protoreflect.FieldDescriptor) bool {
+	return field.Message() != nil && !field.IsList() && !field.IsMap()
+}
+
+// fieldMaskField returns the FieldMask field of the message if there is exactly one, otherwise nil.
+func fieldMaskField(msg protoreflect.MessageDescriptor) protoreflect.FieldDescriptor {
+	var result protoreflect.FieldDescriptor
+	fields := msg.Fields()
+	for index := 0; index < fields.Len(); index++ {
+		field := fields.Get(index)
+		if field.Message() == nil || field.Message().FullName() != "google.protobuf.FieldMask" {
+			continue
+		}
+		// if there is more than 1 FieldMask for this request, then return none.
+		if result != nil {
+			return nil
+		}
+		result = field
+	}
+	return result
+}
+
+// messageTypeOf returns the registered type of the message, falling back to a dynamic message type.
+func messageTypeOf(desc protoreflect.MessageDescriptor) protoreflect.MessageType {
+	if messageType, err := protoregistry.GlobalTypes.FindMessageByName(desc.FullName()); err == nil &&
+		messageType.Descriptor() == desc {
+		return messageType
+	}
+	return dynamicpb.NewMessageType(desc)
+}
+
+// parseEndpointPattern returns HTTP method and path.
+func parseEndpointPattern(spec *api.EndpointBinding) (string, string, error) {
+	switch pattern := spec.GetPattern().(type) {
+	case *api.EndpointBinding_Custom:
+		return strings.ToUpper(pattern.Custom.GetMethod()), pattern.Custom.GetPath(), nil
+	case *api.EndpointBinding_Get:
+		return http.MethodGet, pattern.Get, nil
+	case *api.EndpointBinding_Patch:
+		return http.MethodPatch, pattern.Patch, nil
+	case *api.EndpointBinding_Post:
+		return http.MethodPost, pattern.Post, nil
+	case *api.EndpointBinding_Put:
+		return http.MethodPut, pattern.Put, nil
+	case *api.EndpointBinding_Delete:
+		return http.MethodDelete, pattern.Delete, nil
+	default:
+		return "", "", fmt.Errorf("no pattern specified in HTTP rule")
+	}
+}
+
+// parseAdditionalEndpointPattern returns HTTP method and path.
+func parseAdditionalEndpointPattern(spec *api.AdditionalEndpointBinding) (string, string, error) {
+	switch pattern := spec.GetPattern().(type) {
+	case *api.AdditionalEndpointBinding_Custom:
+		return strings.ToUpper(pattern.Custom.GetMethod()), pattern.Custom.GetPath(), nil
+	case *api.AdditionalEndpointBinding_Get:
+		return http.MethodGet, pattern.Get, nil
+	case *api.AdditionalEndpointBinding_Patch:
+		return http.MethodPatch, pattern.Patch, nil
+	case *api.AdditionalEndpointBinding_Post:
+		return http.MethodPost, pattern.Post, nil
+	case *api.AdditionalEndpointBinding_Put:
+		return http.MethodPut, pattern.Put, nil
+	case *api.AdditionalEndpointBinding_Delete:
+		return http.MethodDelete, pattern.Delete, nil
+	default:
+		return "", "", fmt.Errorf("no pattern specified in HTTP rule")
+	}
+}
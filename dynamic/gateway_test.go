@@ -0,0 +1,538 @@
+package dynamic_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/meshapi/grpc-api-gateway/api"
+	"github.com/meshapi/grpc-api-gateway/dynamic"
+	"github.com/meshapi/grpc-api-gateway/gateway"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const testConfig = `
+gateway:
+  endpoints:
+    - selector: "~.EchoService.Echo"
+      post: "/v1/echo/{id}"
+      body: "nested"
+      additional_bindings:
+        - get: "/v1/echo/{id}/{status}"
+          response_body: "tags"
+        - patch: "/v1/echo/{id}"
+          body: "nested"
+    - selector: "~.EchoService.Collect"
+      post: "/v1/collect"
+      body: "*"
+    - selector: "~.EchoService.Chat"
+      post: "/v1/chat"
+      body: "nested"
+      response_body: "id"
+`
+
+// testFileDescriptor describes the dyn.test package. The Stream method is bound through its HTTP option and the other
+// methods are bound in the test config.
+func testFileDescriptor() *descriptorpb.FileDescriptorProto {
+	streamOptions := &descriptorpb.MethodOptions{}
+	proto.SetExtension(streamOptions, api.E_Http, &api.ProtoEndpointBinding{
+		Pattern: &api.ProtoEndpointBinding_Get{Get: "/v1/stream/{id}"},
+	})
+
+	field := func(
+		name string, number int32, fieldType descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Type:     fieldType.Enum(),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		}
+	}
+	typed := func(f *descriptorpb.FieldDescriptorProto, typeName string) *descriptorpb.FieldDescriptorProto {
+		f.TypeName = proto.String(typeName)
+		return f
+	}
+	repeated := func(f *descriptorpb.FieldDescriptorProto) *descriptorpb.FieldDescriptorProto {
+		f.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+		return f
+	}
+	method := func(name string, clientStreaming, serverStreaming bool) *descriptorpb.MethodDescriptorProto {
+		return &descriptorpb.MethodDescriptorProto{
+			Name:            proto.String(name),
+			InputType:       proto.String(".dyn.test.EchoRequest"),
+			OutputType:      proto.String(".dyn.test.EchoRequest"),
+			ClientStreaming: proto.Bool(clientStreaming),
+			ServerStreaming: proto.Bool(serverStreaming),
+		}
+	}
+
+	stream := method("Stream", false, true)
+	stream.Options = streamOptions
+
+	return &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("dyn/test.proto"),
+		Package:    proto.String("dyn.test"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/field_mask.proto"},
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Status"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("UNKNOWN"), Number: proto.Int32(0)},
+				{Name: proto.String("ACTIVE"), Number: proto.Int32(1)},
+			},
+		}},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name:  proto.String("Nested"),
+				Field: []*descriptorpb.FieldDescriptorProto{field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING)},
+			},
+			{
+				Name: proto.String("EchoRequest"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("id", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+					field("num", 2, descriptorpb.FieldDescriptorProto_TYPE_INT64),
+					typed(field("nested", 3, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE), ".dyn.test.Nested"),
+					repeated(field("tags", 4, descriptorpb.FieldDescriptorProto_TYPE_STRING)),
+					typed(field("status", 5, descriptorpb.FieldDescriptorProto_TYPE_ENUM), ".dyn.test.Status"),
+					typed(field("update_mask", 6, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE),
+						".google.protobuf.FieldMask"),
+				},
+			},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("EchoService"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				method("Echo", false, false),
+				stream,
+				method("Collect", true, false),
+				method("Chat", true, true),
+			},
+		}},
+	}
+}
+
+func testFiles(t *testing.T) *protoregistry.Files {
+	t.Helper()
+
+	files, err := dynamic.NewFiles(&descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{testFileDescriptor()},
+	})
+	if err != nil {
+		t.Fatalf("failed to build files: %s", err)
+	}
+	return files
+}
+
+// testServer implements the test service with dynamic messages.
+func testServer(desc protoreflect.MessageDescriptor) grpc.StreamHandler {
+	return func(_ any, stream grpc.ServerStream) error {
+		rpcMethod, _ := grpc.MethodFromServerStream(stream)
+		newMessage := func() *dynamicpb.Message { return dynamicpb.NewMessage(desc) }
+		fields := desc.Fields()
+
+		switch rpcMethod {
+		case "/dyn.test.EchoService/Echo":
+			msg := newMessage()
+			if err := stream.RecvMsg(msg); err != nil {
+				return err
+			}
+			_ = stream.SetHeader(metadata.Pairs("x-method", "echo"))
+			return stream.SendMsg(msg)
+		case "/dyn.test.EchoService/Stream":
+			msg := newMessage()
+			if err := stream.RecvMsg(msg); err != nil {
+				return err
+			}
+			for index := 1; index <= 3; index++ {
+				msg.Set(fields.ByName("num"), protoreflect.ValueOfInt64(int64(index)))
+				if err := stream.SendMsg(msg); err != nil {
+					return err
+				}
+			}
+			return nil
+		case "/dyn.test.EchoService/Collect":
+			result := newMessage()
+			tags := result.Mutable(fields.ByName("tags")).List()
+			for {
+				msg := newMessage()
+				err := stream.RecvMsg(msg)
+				if err == io.EOF {
+					return stream.SendMsg(result)
+				}
+				if err != nil {
+					return err
+				}
+				tags.Append(msg.Get(fields.ByName("id")))
+			}
+		case "/dyn.test.EchoService/Chat":
+			for {
+				msg := newMessage()
+				err := stream.RecvMsg(msg)
+				if err == io.EOF {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				nested := msg.Get(fields.ByName("nested")).Message()
+				name := nested.Get(nested.Descriptor().Fields().ByName("name"))
+				msg.Set(fields.ByName("id"), protoreflect.ValueOfString("hi "+name.String()))
+				if err := stream.SendMsg(msg); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	}
+}
+
+func newTestConn(t *testing.T, files *protoregistry.Files) *grpc.ClientConn {
+	t.Helper()
+
+	desc, err := files.FindDescriptorByName("dyn.test.EchoRequest")
+	if err != nil {
+		t.Fatalf("failed to find message: %s", err)
+	}
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(grpc.UnknownServiceHandler(testServer(desc.(protoreflect.MessageDescriptor))))
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial: %s", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return conn
+}
+
+func newTestMux(t *testing.T, files *protoregistry.Files) *gateway.ServeMux {
+	t.Helper()
+
+	conn := newTestConn(t, files)
+	config, err := dynamic.ParseConfig([]byte(testConfig))
+	if err != nil {
+		t.Fatalf("failed to parse config: %s", err)
+	}
+
+	gw, err := dynamic.New(files, config.GetGateway(), dynamic.WithProtoPackage("dyn.test"))
+	if err != nil {
+		t.Fatalf("failed to build gateway: %s", err)
+	}
+
+	mux := gateway.NewServeMux()
+	gw.Register(mux, conn)
+	return mux
+}
+
+func TestGateway(t *testing.T) {
+	mux := newTestMux(t, testFiles(t))
+
+	testCases := []struct {
+		Name           string
+		Method         string
+		Path           string
+		Body           string
+		ExpectedStatus int
+		ExpectedBody   string
+	}{
+		{
+			Name:           "Unary",
+			Method:         http.MethodPost,
+			Path:           "/v1/echo/abc?num=5&tags=a&tags=b",
+			Body:           `{"name":"nest"}`,
+			ExpectedStatus: http.StatusOK,
+			ExpectedBody: `{"id":"abc","num":"5","nested":{"name":"nest"},"tags":["a","b"],"status":"UNKNOWN",` +
+				`"update_mask":null}`,
+		},
+		{
+			Name:           "EnumPathParameterAndResponseBody",
+			Method:         http.MethodGet,
+			Path:           "/v1/echo/abc/ACTIVE?tags=x",
+			ExpectedStatus: http.StatusOK,
+			ExpectedBody:   `["x"]`,
+		},
+		{
+			Name:           "InvalidEnum",
+			Method:         http.MethodGet,
+			Path:           "/v1/echo/abc/NOPE",
+			ExpectedStatus: http.StatusBadRequest,
+		},
+		{
+			Name:           "PatchFieldMask",
+			Method:         http.MethodPatch,
+			Path:           "/v1/echo/abc",
+			Body:           `{"name":"nest"}`,
+			ExpectedStatus: http.StatusOK,
+			ExpectedBody:   `{"id":"abc","num":"0","nested":{"name":"nest"},"tags":[],"status":"UNKNOWN","update_mask":"name"}`,
+		},
+		{
+			Name:           "ServerStreaming",
+			Method:         http.MethodGet,
+			Path:           "/v1/stream/abc",
+			ExpectedStatus: http.StatusOK,
+			ExpectedBody: `{"id":"abc","num":"1","nested":null,"tags":[],"status":"UNKNOWN","update_mask":null}` + "\n" +
+				`{"id":"abc","num":"2","nested":null,"tags":[],"status":"UNKNOWN","update_mask":null}` + "\n" +
+				`{"id":"abc","num":"3","nested":null,"tags":[],"status":"UNKNOWN","update_mask":null}` + "\n",
+		},
+		{
+			Name:           "ClientStreaming",
+			Method:         http.MethodPost,
+			Path:           "/v1/collect",
+			Body:           `{"id":"a"}{"id":"b"}{"id":"c"}`,
+			ExpectedStatus: http.StatusOK,
+			ExpectedBody:   `{"id":"","num":"0","nested":null,"tags":["a","b","c"],"status":"UNKNOWN","update_mask":null}`,
+		},
+		{
+			Name:           "BidiStreaming",
+			Method:         http.MethodPost,
+			Path:           "/v1/chat",
+			Body:           `{"name":"a"}{"name":"b"}`,
+			ExpectedStatus: http.StatusOK,
+			ExpectedBody:   `"hi a"` + "\n" + `"hi b"` + "\n",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.Method, tt.Path, strings.NewReader(tt.Body))
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.ExpectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.ExpectedStatus, recorder.Code, recorder.Body.String())
+			}
+			if tt.ExpectedBody == "" {
+				return
+			}
+			if got := compactJSONLines(t, recorder.Body.String()); got != tt.ExpectedBody {
+				t.Errorf("expected body %s, got %s", tt.ExpectedBody, got)
+			}
+		})
+	}
+}
+
+// compactJSONLines removes the insignificant spaces that protojson adds to its output at random.
+func compactJSONLines(t *testing.T, body string) string {
+	t.Helper()
+
+	result := &bytes.Buffer{}
+	for _, line := range strings.SplitAfter(body, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if err := json.Compact(result, []byte(line)); err != nil {
+			t.Fatalf("invalid JSON %q: %s", line, err)
+		}
+		if strings.HasSuffix(line, "\n") {
+			result.WriteByte('\n')
+		}
+	}
+	return result.String()
+}
+
+func TestGatewayHeaders(t *testing.T) {
+	mux := newTestMux(t, testFiles(t))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/echo/abc", strings.NewReader(`{}`))
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+
+	if got := recorder.Header().Get("Grpc-Metadata-X-Method"); got != "echo" {
+		t.Errorf("expected x-method header %q, got %q", "echo", got)
+	}
+}
+
+func TestLoadFileDescriptorSet(t *testing.T) {
+	set := &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{
+			protodesc.ToFileDescriptorProto(descriptorpb.File_google_protobuf_descriptor_proto),
+			testFileDescriptor(),
+		},
+	}
+	content, err := proto.Marshal(set)
+	if err != nil {
+		t.Fatalf("failed to marshal set: %s", err)
+	}
+
+	filePath := filepath.Join(t.TempDir(), "set.binpb")
+	if err := os.WriteFile(filePath, content, 0o600); err != nil {
+		t.Fatalf("failed to write set: %s", err)
+	}
+
+	files, err := dynamic.LoadFileDescriptorSet(filePath)
+	if err != nil {
+		t.Fatalf("failed to load set: %s", err)
+	}
+	if _, err := files.FindDescriptorByName("dyn.test.EchoService"); err != nil {
+		t.Errorf("expected the service to be loaded: %s", err)
+	}
+
+	mux := newTestMux(t, files)
+	req := httptest.NewRequest(http.MethodGet, "/v1/stream/xyz", nil)
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+
+	var first map[string]any
+	if err := json.NewDecoder(recorder.Body).Decode(&first); err != nil {
+		t.Fatalf("failed to decode response: %s", err)
+	}
+	if first["id"] != "xyz" {
+		t.Errorf("unexpected response: %v", first)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	files := testFiles(t)
+
+	testCases := []struct {
+		Name          string
+		Config        string
+		Options       []dynamic.Option
+		ExpectedError string
+	}{
+		{
+			Name: "UnresolvedSelector",
+			Config: `
+gateway:
+  endpoints:
+    - selector: "dyn.test.EchoService.Missing"
+      get: "/v1/missing"`,
+			ExpectedError: "selectors do not match any method: dyn.test.EchoService.Missing",
+		},
+		{
+			Name: "RelativeSelectorWithoutPackage",
+			Config: `
+gateway:
+  endpoints:
+    - selector: "~.EchoService.Echo"
+      get: "/v1/echo"`,
+			ExpectedError: "no proto package context is available",
+		},
+		{
+			Name: "ConflictWithMethodOptions",
+			Config: `
+gateway:
+  endpoints:
+    - selector: "dyn.test.EchoService.Stream"
+      get: "/v1/other"`,
+			ExpectedError: "conflicting binding",
+		},
+		{
+			Name: "UnknownPathParameter",
+			Config: `
+gateway:
+  endpoints:
+    - selector: "dyn.test.EchoService.Echo"
+      get: "/v1/echo/{unknown}"`,
+			ExpectedError: `no field "unknown" found in EchoRequest`,
+		},
+		{
+			Name: "DeleteBody",
+			Config: `
+gateway:
+  endpoints:
+    - selector: "dyn.test.EchoService.Echo"
+      delete: "/v1/echo"
+      body: "*"`,
+			ExpectedError: "must not set request body when http method is DELETE",
+		},
+		{
+			Name: "PathParameterInClientStreaming",
+			Config: `
+gateway:
+  endpoints:
+    - selector: "dyn.test.EchoService.Collect"
+      post: "/v1/collect/{id}"`,
+			ExpectedError: "cannot use path parameters in client streaming",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			config, err := dynamic.ParseConfig([]byte(tt.Config))
+			if err != nil {
+				t.Fatalf("failed to parse config: %s", err)
+			}
+
+			_, err = dynamic.New(files, config.GetGateway(), tt.Options...)
+			if err == nil || !strings.Contains(err.Error(), tt.ExpectedError) {
+				t.Errorf("expected error containing %q, got: %v", tt.ExpectedError, err)
+			}
+		})
+	}
+}
+
+func TestGenerateUnboundMethods(t *testing.T) {
+	gw, err := dynamic.New(testFiles(t), nil, dynamic.WithGenerateUnboundMethods())
+	if err != nil {
+		t.Fatalf("failed to build gateway: %s", err)
+	}
+
+	var routes []string
+	mux := gateway.NewServeMux(gateway.WithRouteMiddleware(
+		func(gateway.RouteInfo) bool { return true },
+		func(info gateway.RouteInfo, next httprouter.Handle) httprouter.Handle {
+			routes = append(routes, info.HTTPMethod+" "+info.Path)
+			return next
+		}))
+	gw.Register(mux, nil)
+
+	expected := []string{
+		"POST /dyn.test.EchoService/Echo",
+		"GET /v1/stream/:id",
+		"POST /dyn.test.EchoService/Collect",
+		"POST /dyn.test.EchoService/Chat",
+	}
+	if strings.Join(routes, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected routes %v, got %v", expected, routes)
+	}
+}
+
+func TestRouteInfo(t *testing.T) {
+	routes := map[string]gateway.RouteInfo{}
+	for _, route := range newTestMux(t, testFiles(t)).Routes() {
+		routes[route.HTTPMethod+" "+route.HTTPPathPattern] = route
+	}
+
+	echo := routes["POST /v1/echo/{id}"]
+	if echo.RPCMethod != "/dyn.test.EchoService/Echo" || echo.RequestBody != "nested" || echo.ResponseBody != "" {
+		t.Errorf("unexpected route info: %+v", echo)
+	}
+	if route := routes["GET /v1/echo/{id}/{status}"]; route.RequestBody != "" || route.ResponseBody != "tags" {
+		t.Errorf("unexpected route info: %+v", route)
+	}
+	if route := routes["POST /v1/collect"]; route.RequestBody != "*" {
+		t.Errorf("unexpected route info: %+v", route)
+	}
+	stream := routes["GET /v1/stream/{id}"]
+	if !stream.SupportsChunkedTransfer || !stream.SupportsSSE || !stream.SupportsWebsocket {
+		t.Errorf("expected all the stream modes to be supported: %+v", stream)
+	}
+}
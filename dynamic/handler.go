@@ -0,0 +1,617 @@
+package dynamic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/meshapi/grpc-api-gateway/dotpath"
+	"github.com/meshapi/grpc-api-gateway/gateway"
+	"github.com/meshapi/grpc-api-gateway/iofactory"
+	"github.com/meshapi/grpc-api-gateway/partialfieldmask"
+	"github.com/meshapi/grpc-api-gateway/pkg/httprule"
+	"github.com/meshapi/grpc-api-gateway/protopath"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/grpclog"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/runtime/protoiface"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// message is a protobuf message that implements both of the protobuf APIs, the gRPC codec expects the older one.
+type message interface {
+	protoreflect.ProtoMessage
+	protoiface.MessageV1
+}
+
+// requestBody is a request message whose body is bound to one of its fields.
+type requestBody struct {
+	message
+	path fieldPath
+}
+
+func (r requestBody) XXX_RequestBody() any {
+	return mutableMessage(r.ProtoReflect(), r.path).Interface()
+}
+
+// responseBody is a response message whose body is bound to one of its fields.
+type responseBody struct {
+	message
+	path fieldPath
+}
+
+func (r responseBody) XXX_ResponseBody() any {
+	return fieldValue(r.ProtoReflect(), r.path)
+}
+
+// Register registers the HTTP handlers of all the bindings to "mux". The handlers forward requests to the gRPC
+// server over "conn".
+func (g *Gateway) Register(mux *gateway.ServeMux, conn grpc.ClientConnInterface) {
+	for _, m := range g.methods {
+		for _, b := range m.bindings {
+			mux.HandleWithParams(
+				b.httpMethod, httpPath(b.template), b.handler(mux, conn), gateway.WithRouteInfo(b.routeInfo()))
+		}
+	}
+}
+
+func (b *binding) handler(mux *gateway.ServeMux, conn grpc.ClientConnInterface) func(
+	http.ResponseWriter, *http.Request, gateway.Params) {
+	pattern := httpPattern(b.template)
+	serverStreaming := b.method.desc.IsStreamingServer()
+
+	return func(w http.ResponseWriter, req *http.Request, pathParams gateway.Params) {
+		ctx, cancel := context.WithCancel(req.Context())
+		defer cancel()
+		inboundMarshaler, outboundMarshaler := mux.MarshalerForRequest(req)
+		annotatedContext, err := gateway.AnnotateContext(
+			ctx, mux, req, b.method.rpcMethod, gateway.WithHTTPPathPattern(pattern))
+		if err != nil {
+			mux.HTTPError(ctx, outboundMarshaler, w, req, err)
+			return
+		}
+
+		if b.needsWebsocket() && mux.IsWebsocketUpgrade(req) {
+			b.serveWebsocket(annotatedContext, inboundMarshaler, outboundMarshaler, mux, conn, w, req, pathParams)
+			return
+		}
+
+		if serverStreaming && !b.needsChunkedTransfer() && !b.needsSSE() {
+			mux.HTTPError(ctx, outboundMarshaler, w, req, gateway.ErrStreamingMethodNotAllowed{
+				MethodSupportsWebsocket:       b.needsWebsocket(),
+				MethodSupportsSSE:             false,
+				MethodSupportsChunkedTransfer: false,
+			})
+			return
+		}
+
+		if !serverStreaming {
+			resp, md, err := b.call(annotatedContext, inboundMarshaler, mux, conn, req, pathParams)
+			annotatedContext = gateway.NewServerMetadataContext(annotatedContext, md)
+			if err != nil {
+				mux.HTTPError(annotatedContext, outboundMarshaler, w, req, err)
+				return
+			}
+
+			mux.ForwardResponseMessage(annotatedContext, outboundMarshaler, w, req, b.wrapResponse(resp))
+			return
+		}
+
+		stream, md, err := b.openStream(annotatedContext, inboundMarshaler, mux, conn, req, pathParams)
+		annotatedContext = gateway.NewServerMetadataContext(annotatedContext, md)
+		if err != nil {
+			mux.HTTPError(annotatedContext, outboundMarshaler, w, req, err)
+			return
+		}
+
+		recv := func() (proto.Message, error) {
+			resp := b.method.newOutput()
+			err := stream.RecvMsg(resp)
+			return b.wrapResponse(resp), err
+		}
+
+		if b.needsSSE() && mux.IsSSE(req) {
+			mux.ForwardResponseStreamSSE(annotatedContext, outboundMarshaler, w, req, recv)
+			return
+		}
+
+		if b.needsChunkedTransfer() {
+			mux.ForwardResponseStreamChunked(annotatedContext, outboundMarshaler, w, req, recv)
+			return
+		}
+
+		mux.HTTPError(ctx, outboundMarshaler, w, req, gateway.ErrStreamingMethodNotAllowed{
+			MethodSupportsWebsocket:       b.needsWebsocket(),
+			MethodSupportsSSE:             b.needsSSE(),
+			MethodSupportsChunkedTransfer: false,
+		})
+	}
+}
+
+// call invokes a unary or a client-streaming method and returns the response message.
+func (b *binding) call(
+	ctx context.Context, marshaler gateway.Marshaler, mux *gateway.ServeMux, conn grpc.ClientConnInterface,
+	req *http.Request, pathParams gateway.Params) (message, gateway.ServerMetadata, error) {
+
+	var metadata gateway.ServerMetadata
+	if b.method.desc.IsStreamingClient() {
+		stream, err := conn.NewStream(ctx, b.method.streamDesc(), b.method.rpcMethod)
+		if err != nil {
+			grpclog.Infof("Failed to start streaming: %v", err)
+			return nil, metadata, err
+		}
+		dec := marshaler.NewDecoder(req.Body)
+		for {
+			protoReq := b.method.newInput()
+			err = dec.Decode(b.requestBodyTarget(protoReq))
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				grpclog.Infof("Failed to decode request: %v", err)
+				return nil, metadata, gateway.ErrMarshal{Err: err, Inbound: true}
+			}
+			if err = stream.SendMsg(protoReq); err != nil {
+				if err == io.EOF {
+					break
+				}
+				grpclog.Infof("Failed to send request: %v", err)
+				return nil, metadata, err
+			}
+		}
+
+		if err := stream.CloseSend(); err != nil {
+			grpclog.Infof("Failed to terminate client stream: %v", err)
+			return nil, metadata, err
+		}
+		header, err := stream.Header()
+		if err != nil {
+			grpclog.Infof("Failed to get header from client: %v", err)
+			return nil, metadata, err
+		}
+		metadata.HeaderMD = header
+
+		msg := b.method.newOutput()
+		err = stream.RecvMsg(msg)
+		metadata.TrailerMD = stream.Trailer()
+		return msg, metadata, err
+	}
+
+	protoReq, err := b.newRequest(marshaler, mux, req, pathParams)
+	if err != nil {
+		return nil, metadata, err
+	}
+
+	msg := b.method.newOutput()
+	err = conn.Invoke(ctx, b.method.rpcMethod, protoReq, msg,
+		grpc.Header(&metadata.HeaderMD), grpc.Trailer(&metadata.TrailerMD))
+	return msg, metadata, err
+}
+
+// openStream starts a server-streaming or a bidirectional streaming method and returns the stream.
+func (b *binding) openStream(
+	ctx context.Context, marshaler gateway.Marshaler, mux *gateway.ServeMux, conn grpc.ClientConnInterface,
+	req *http.Request, pathParams gateway.Params) (grpc.ClientStream, gateway.ServerMetadata, error) {
+
+	var metadata gateway.ServerMetadata
+	if b.method.desc.IsStreamingClient() {
+		stream, err := conn.NewStream(ctx, b.method.streamDesc(), b.method.rpcMethod)
+		if err != nil {
+			grpclog.Infof("Failed to start streaming: %v", err)
+			return nil, metadata, err
+		}
+		dec := marshaler.NewDecoder(req.Body)
+		handleSend := func() error {
+			protoReq := b.method.newInput()
+			err := dec.Decode(b.requestBodyTarget(protoReq))
+			if err == io.EOF {
+				return err
+			}
+			if err != nil {
+				grpclog.Infof("Failed to decode request: %v", err)
+				return err
+			}
+			if err := stream.SendMsg(protoReq); err != nil {
+				grpclog.Infof("Failed to send request: %v", err)
+				return err
+			}
+			return nil
+		}
+		go func() {
+			for {
+				if err := handleSend(); err != nil {
+					break
+				}
+			}
+			if err := stream.CloseSend(); err != nil {
+				grpclog.Infof("Failed to terminate client stream: %v", err)
+			}
+		}()
+		header, err := stream.Header()
+		if err != nil {
+			grpclog.Infof("Failed to get header from client: %v", err)
+			return nil, metadata, err
+		}
+		metadata.HeaderMD = header
+		return stream, metadata, nil
+	}
+
+	protoReq, err := b.newRequest(marshaler, mux, req, pathParams)
+	if err != nil {
+		return nil, metadata, err
+	}
+
+	stream, err := b.method.newServerStream(ctx, conn, protoReq)
+	if err != nil {
+		return nil, metadata, err
+	}
+	header, err := stream.Header()
+	if err != nil {
+		return nil, metadata, err
+	}
+	metadata.HeaderMD = header
+	return stream, metadata, nil
+}
+
+// serveWebsocket upgrades the request and forwards the messages between the websocket and the gRPC stream.
+func (b *binding) serveWebsocket(
+	ctx context.Context, inboundMarshaler, outboundMarshaler gateway.Marshaler, mux *gateway.ServeMux,
+	conn grpc.ClientConnInterface, w http.ResponseWriter, req *http.Request, pathParams gateway.Params) {
+
+	if b.method.desc.IsStreamingClient() {
+		websocketConnection, err := mux.UpgradeToWebsocket(w, req)
+		if err != nil {
+			grpclog.Infof("Failed to upgrade HTTP request: %v", err)
+			return
+		}
+		stream, err := conn.NewStream(ctx, b.method.streamDesc(), b.method.rpcMethod)
+		if err != nil {
+			grpclog.Infof("Failed to start gRPC stream: %v", err)
+			mux.WebsocketError(ctx, outboundMarshaler, req, websocketConnection, err)
+			if err := websocketConnection.Close(); err != nil {
+				grpclog.Infof("Failed to close websocket connection: %v", err)
+			}
+			return
+		}
+
+		var protoReq gateway.ProtoMessage = b.method.newInput()
+		if b.body != nil && len(*b.body) > 0 {
+			protoReq = requestBody{message: b.method.newInput(), path: *b.body}
+		}
+		mux.ForwardWebsocket(
+			ctx, req, stream, websocketConnection, inboundMarshaler, outboundMarshaler, protoReq,
+			b.wrapResponse(b.method.newOutput()))
+		return
+	}
+
+	protoReq := b.method.newInput()
+	if err := b.populatePathParameters(protoReq, pathParams); err != nil {
+		mux.HTTPError(ctx, outboundMarshaler, w, req, err)
+		return
+	}
+	if err := b.populateQueryParameters(mux, protoReq, req); err != nil {
+		mux.HTTPError(ctx, outboundMarshaler, w, req, err)
+		return
+	}
+
+	websocketConnection, err := mux.UpgradeToWebsocket(w, req)
+	if err != nil {
+		grpclog.Infof("Failed to upgrade HTTP request: %v", err)
+		return
+	}
+	closeConnection := func() {
+		if err := websocketConnection.Close(); err != nil {
+			grpclog.Infof("Failed to close websocket connection: %v", err)
+		}
+	}
+	requestData, err := websocketConnection.ReceiveMessage()
+	if err == io.EOF {
+		closeConnection()
+		return
+	}
+	if err != nil {
+		grpclog.Infof("failed to receive message: %v", err)
+		closeConnection()
+		return
+	}
+	if err := inboundMarshaler.Unmarshal(requestData, protoReq); err != nil {
+		grpclog.Infof("Failed to decode request from websocket: %v", err)
+		mux.WebsocketError(ctx, outboundMarshaler, req, websocketConnection, gateway.ErrMarshal{Err: err, Inbound: true})
+		closeConnection()
+		return
+	}
+	stream, err := b.method.newServerStream(ctx, conn, protoReq)
+	if err != nil {
+		grpclog.Infof("Failed to start gRPC stream: %v", err)
+		mux.WebsocketError(ctx, outboundMarshaler, req, websocketConnection, err)
+		closeConnection()
+		return
+	}
+	mux.ForwardWebsocketServerStreaming(
+		ctx, req, stream, websocketConnection, outboundMarshaler, b.method.newOutput())
+}
+
+// newRequest builds the request message from the body, the path parameters and the query parameters.
+func (b *binding) newRequest(
+	marshaler gateway.Marshaler, mux *gateway.ServeMux, req *http.Request, pathParams gateway.Params) (message, error) {
+
+	protoReq := b.method.newInput()
+	if b.body != nil {
+		if err := b.decodeBody(marshaler, protoReq, req.Body); err != nil {
+			return nil, err
+		}
+	}
+	if err := b.populatePathParameters(protoReq, pathParams); err != nil {
+		return nil, err
+	}
+	if err := b.populateQueryParameters(mux, protoReq, req); err != nil {
+		return nil, err
+	}
+
+	return protoReq, nil
+}
+
+func (b *binding) decodeBody(marshaler gateway.Marshaler, protoReq message, body io.Reader) error {
+	if b.fieldMask == nil {
+		if err := b.decode(marshaler.NewDecoder(body), protoReq); err != nil && err != io.EOF {
+			return gateway.ErrMarshal{Err: err, Inbound: true}
+		}
+		return nil
+	}
+
+	newReader, err := iofactory.NewReader(body)
+	if err != nil {
+		return gateway.ErrMarshal{Err: err, Inbound: true}
+	}
+	if err := b.decode(marshaler.NewDecoder(newReader()), protoReq); err != nil && err != io.EOF {
+		return gateway.ErrMarshal{Err: err, Inbound: true}
+	}
+
+	msg := protoReq.ProtoReflect()
+	if msg.Has(b.fieldMask) {
+		mask := msg.Get(b.fieldMask).Message()
+		if mask.Get(mask.Descriptor().Fields().ByName("paths")).List().Len() > 0 {
+			return nil
+		}
+	}
+
+	fieldMask, err := partialfieldmask.FieldMaskFromRequestBodyJSON(
+		newReader(), mutableMessage(msg, *b.body).Interface())
+	if err != nil {
+		return gateway.ErrMarshal{Err: err, Inbound: true}
+	}
+	msg.Set(b.fieldMask, protoreflect.ValueOfMessage(fieldMask.ProtoReflect()))
+
+	return nil
+}
+
+// decoder is the decoder of a marshaler.
+type decoder interface {
+	Decode(v any) error
+}
+
+// decode decodes the request body into the field that is bound to the body.
+func (b *binding) decode(dec decoder, protoReq message) error {
+	if len(*b.body) == 0 || isMessageField(b.body.target()) {
+		return dec.Decode(b.requestBodyTarget(protoReq))
+	}
+
+	// non-message fields are decoded as JSON values and are then read into the field using protojson.
+	value := &structpb.Value{}
+	if err := dec.Decode(value); err != nil {
+		return err
+	}
+	valueJSON, err := protojson.Marshal(value)
+	if err != nil {
+		return err
+	}
+	field := b.body.target()
+	data, err := json.Marshal(map[string]json.RawMessage{field.JSONName(): valueJSON})
+	if err != nil {
+		return err
+	}
+
+	parent := mutableMessage(protoReq.ProtoReflect(), (*b.body)[:len(*b.body)-1])
+	decoded := parent.New()
+	if err := protojson.Unmarshal(data, decoded.Interface()); err != nil {
+		return err
+	}
+	parent.Set(field, decoded.Get(field))
+
+	return nil
+}
+
+// requestBodyTarget returns the message that the request body needs to be decoded into.
+func (b *binding) requestBodyTarget(protoReq message) proto.Message {
+	if b.body == nil || len(*b.body) == 0 {
+		return protoReq
+	}
+	return mutableMessage(protoReq.ProtoReflect(), *b.body).Interface()
+}
+
+func (b *binding) populatePathParameters(protoReq message, pathParams gateway.Params) error {
+	for _, param := range b.pathParams {
+		val := pathParams.ByName(param.name)
+		if val == "" {
+			return gateway.ErrPathParameterMissing{Name: param.name}
+		}
+
+		values := []string{val}
+		if param.path.target().IsList() {
+			values = strings.Split(val, string(b.repeatedPathParamSeparator))
+		}
+
+		name := param.name
+		err := protopath.PopulateFieldValueFromPath(protoReq.ProtoReflect(), dotpath.Parse(&name), values)
+		if err != nil {
+			if param.path.target().Enum() != nil {
+				return gateway.ErrPathParameterInvalidEnum{Err: err, Name: param.name}
+			}
+			return gateway.ErrPathParameterTypeMismatch{Err: err, Name: param.name}
+		}
+	}
+
+	return nil
+}
+
+func (b *binding) populateQueryParameters(mux *gateway.ServeMux, protoReq message, req *http.Request) error {
+	if !b.hasQueryParams {
+		return nil
+	}
+
+	if err := req.ParseForm(); err != nil {
+		return gateway.ErrInvalidQueryParameters{Err: err}
+	}
+	if err := mux.PopulateQueryParameters(protoReq, req.Form, b.queryParams); err != nil {
+		return gateway.ErrInvalidQueryParameters{Err: err}
+	}
+
+	return nil
+}
+
+// wrapResponse wraps the response message if only a field of it needs to be written out.
+func (b *binding) wrapResponse(msg message) gateway.ProtoMessage {
+	if len(b.responseBody) == 0 {
+		return msg
+	}
+	return responseBody{message: msg, path: b.responseBody}
+}
+
+func (m *method) newInput() message {
+	return m.input.New().Interface().(message)
+}
+
+func (m *method) newOutput() message {
+	return m.output.New().Interface().(message)
+}
+
+func (m *method) streamDesc() *grpc.StreamDesc {
+	return &grpc.StreamDesc{
+		StreamName:    string(m.desc.Name()),
+		ServerStreams: m.desc.IsStreamingServer(),
+		ClientStreams: m.desc.IsStreamingClient(),
+	}
+}
+
+// newServerStream starts a server-streaming call, sending the only request message.
+func (m *method) newServerStream(
+	ctx context.Context, conn grpc.ClientConnInterface, protoReq message) (grpc.ClientStream, error) {
+	stream, err := conn.NewStream(ctx, m.streamDesc(), m.rpcMethod)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.SendMsg(protoReq); err != nil {
+		return nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// mutableMessage returns the message at the field path, creating the messages along the way.
+func mutableMessage(msg protoreflect.Message, path fieldPath) protoreflect.Message {
+	for _, field := range path {
+		msg = msg.Mutable(field).Message()
+	}
+	return msg
+}
+
+// fieldValue returns the value of the field at the field path in a form that the marshalers can encode, which is
+// what the generated code returns for the response body fields.
+func fieldValue(msg protoreflect.Message, path fieldPath) any {
+	for _, field := range path[:len(path)-1] {
+		msg = msg.Get(field).Message()
+	}
+
+	field := path.target()
+	value := msg.Get(field)
+	switch {
+	case field.IsList():
+		list := value.List()
+		if field.Message() != nil {
+			result := make([]proto.Message, list.Len())
+			for index := range result {
+				result[index] = list.Get(index).Message().Interface()
+			}
+			return result
+		}
+		result := make([]any, list.Len())
+		for index := range result {
+			result[index] = scalarValue(field, list.Get(index))
+		}
+		return result
+	case field.IsMap():
+		result := map[string]any{}
+		value.Map().Range(func(key protoreflect.MapKey, value protoreflect.Value) bool {
+			if field.MapValue().Message() != nil {
+				result[key.String()] = value.Message().Interface()
+			} else {
+				result[key.String()] = scalarValue(field.MapValue(), value)
+			}
+			return true
+		})
+		return result
+	case field.Message() != nil:
+		return value.Message().Interface()
+	default:
+		return scalarValue(field, value)
+	}
+}
+
+func scalarValue(field protoreflect.FieldDescriptor, value protoreflect.Value) any {
+	if field.Enum() != nil {
+		if enumValue := field.Enum().Values().ByNumber(value.Enum()); enumValue != nil {
+			return string(enumValue.Name())
+		}
+		return int32(value.Enum())
+	}
+	return value.Interface()
+}
+
+// httpPath returns the router path of the template.
+func httpPath(tpl httprule.Template) string {
+	if len(tpl.Segments) == 0 {
+		return "/"
+	}
+
+	writer := &strings.Builder{}
+	for _, segment := range tpl.Segments {
+		switch segment.Type {
+		case httprule.SegmentTypeSelector:
+			_, _ = fmt.Fprintf(writer, "/:%s", segment.Value)
+		case httprule.SegmentTypeCatchAllSelector:
+			_, _ = fmt.Fprintf(writer, "/*%s", segment.Value)
+		default:
+			_, _ = fmt.Fprintf(writer, "/%s", segment.Value)
+		}
+	}
+
+	return writer.String()
+}
+
+// httpPattern returns the HTTP rule pattern of the template.
+func httpPattern(tpl httprule.Template) string {
+	if len(tpl.Segments) == 0 {
+		return "/"
+	}
+
+	writer := &strings.Builder{}
+	for _, segment := range tpl.Segments {
+		switch segment.Type {
+		case httprule.SegmentTypeSelector:
+			_, _ = fmt.Fprintf(writer, "/{%s}", segment.Value)
+		case httprule.SegmentTypeCatchAllSelector:
+			_, _ = fmt.Fprintf(writer, "/{%s=*}", segment.Value)
+		default:
+			_, _ = fmt.Fprintf(writer, "/%s", segment.Value)
+		}
+	}
+
+	return writer.String()
+}
@@ -0,0 +1,143 @@
+package dynamic
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/meshapi/grpc-api-gateway/api"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"gopkg.in/yaml.v3"
+)
+
+// LoadFileDescriptorSet reads a serialized FileDescriptorSet, such as the output of "protoc --descriptor_set_out" or
+// "buf build -o", and returns the files in the set.
+func LoadFileDescriptorSet(filePath string) (*protoregistry.Files, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filePath, err)
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(content, set); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal file descriptor set: %w", err)
+	}
+
+	return NewFiles(set)
+}
+
+// NewFiles builds the files of a FileDescriptorSet.
+//
+// The well-known types are always resolved from protoregistry.GlobalFiles and so are the imports that are not
+// included in the set, which means the set does not need to be built with the imports included as long as the
+// imported files are linked into the binary.
+func NewFiles(set *descriptorpb.FileDescriptorSet) (*protoregistry.Files, error) {
+	files := &protoregistry.Files{}
+	resolver := fileResolver{files: files}
+
+	pending := make(map[string]*descriptorpb.FileDescriptorProto, len(set.GetFile()))
+	for _, file := range set.GetFile() {
+		if !isWellKnownFile(file.GetName()) {
+			pending[file.GetName()] = file
+		}
+	}
+
+	var register func(name string) error
+	register = func(name string) error {
+		fileProto, ok := pending[name]
+		if !ok {
+			// the file is either registered already or it gets resolved from the global files.
+			return nil
+		}
+		delete(pending, name)
+
+		for _, dependency := range fileProto.GetDependency() {
+			if err := register(dependency); err != nil {
+				return err
+			}
+		}
+
+		file, err := protodesc.NewFile(fileProto, resolver)
+		if err != nil {
+			return fmt.Errorf("invalid file %q: %w", name, err)
+		}
+		return files.RegisterFile(file)
+	}
+
+	for _, file := range set.GetFile() {
+		if err := register(file.GetName()); err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+func isWellKnownFile(name string) bool {
+	return strings.HasPrefix(name, "google/protobuf/")
+}
+
+// fileResolver resolves the descriptors from the files, falling back to the global files.
+type fileResolver struct {
+	files *protoregistry.Files
+}
+
+func (f fileResolver) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
+	if file, err := f.files.FindFileByPath(path); err == nil {
+		return file, nil
+	}
+	return protoregistry.GlobalFiles.FindFileByPath(path)
+}
+
+func (f fileResolver) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	if desc, err := f.files.FindDescriptorByName(name); err == nil {
+		return desc, nil
+	}
+	return protoregistry.GlobalFiles.FindDescriptorByName(name)
+}
+
+// LoadConfig reads a gateway config file in the YAML or JSON format, the same format that is consumed by the code
+// generator.
+func LoadConfig(filePath string) (*api.Config, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filePath, err)
+	}
+
+	config, err := ParseConfig(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", filePath, err)
+	}
+
+	return config, nil
+}
+
+// ParseConfig parses a gateway config in the YAML or JSON format.
+func ParseConfig(content []byte) (*api.Config, error) {
+	// JSON is valid YAML, so the content is always decoded as YAML.
+	var yamlContents interface{}
+	if err := yaml.Unmarshal(content, &yamlContents); err != nil {
+		return nil, fmt.Errorf("failed to decode config: %w", err)
+	}
+	if yamlContents == nil {
+		return &api.Config{}, nil
+	}
+
+	jsonContents, err := json.Marshal(yamlContents)
+	if err != nil {
+		return nil, fmt.Errorf("failed to JSON marshal content: %w", err)
+	}
+
+	config := &api.Config{}
+	if err := protojson.Unmarshal(jsonContents, config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+
+	return config, nil
+}
@@ -0,0 +1,191 @@
+package dynamic
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/meshapi/grpc-api-gateway/gateway"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/grpclog"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// DefaultRefreshInterval is the default interval between the refreshes of the routes discovered through reflection.
+const DefaultRefreshInterval = time.Minute
+
+// ReflectionConfig configures the routes that are discovered through the gRPC server reflection service.
+type ReflectionConfig struct {
+	// RefreshInterval is the interval between refreshing the descriptors, default is DefaultRefreshInterval.
+	// A negative value disables the refreshes.
+	RefreshInterval time.Duration
+
+	// OnChange gets called with the routes that are added and removed, the first call has all the discovered routes.
+	// It is not called when the routes do not change.
+	OnChange func(added, removed []Route)
+
+	// Options are the options used to build the gateway from the discovered descriptors.
+	Options []Option
+}
+
+// FilesFromReflection queries the gRPC server reflection service over "conn" and returns the files of all the
+// services that the server exposes, except for the reflection service itself.
+func FilesFromReflection(ctx context.Context, conn grpc.ClientConnInterface) (*protoregistry.Files, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open reflection stream: %w", err)
+	}
+	defer func() { _ = stream.CloseSend() }()
+
+	request := func(req *reflectionpb.ServerReflectionRequest) (*reflectionpb.ServerReflectionResponse, error) {
+		if err := stream.Send(req); err != nil {
+			return nil, err
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		if errResp := resp.GetErrorResponse(); errResp != nil {
+			return nil, status.Error(codes.Code(errResp.GetErrorCode()), errResp.GetErrorMessage())
+		}
+		return resp, nil
+	}
+
+	resp, err := request(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	seen := map[string]struct{}{}
+	addFiles := func(resp *reflectionpb.ServerReflectionResponse) error {
+		for _, content := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			file := &descriptorpb.FileDescriptorProto{}
+			if err := proto.Unmarshal(content, file); err != nil {
+				return fmt.Errorf("failed to unmarshal file descriptor: %w", err)
+			}
+			if _, ok := seen[file.GetName()]; ok {
+				continue
+			}
+			seen[file.GetName()] = struct{}{}
+			set.File = append(set.File, file)
+		}
+		return nil
+	}
+
+	for _, service := range resp.GetListServicesResponse().GetService() {
+		if strings.HasPrefix(service.GetName(), "grpc.reflection.") {
+			continue
+		}
+
+		resp, err := request(&reflectionpb.ServerReflectionRequest{
+			MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{
+				FileContainingSymbol: service.GetName(),
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get file of service %q: %w", service.GetName(), err)
+		}
+		if err := addFiles(resp); err != nil {
+			return nil, err
+		}
+	}
+
+	// the server only sends the dependencies once per stream but they can still be missing, for instance when the
+	// server limits the size of the responses.
+	for index := 0; index < len(set.File); index++ {
+		for _, dependency := range set.File[index].GetDependency() {
+			if _, ok := seen[dependency]; ok || isWellKnownFile(dependency) {
+				continue
+			}
+			if _, err := protoregistry.GlobalFiles.FindFileByPath(dependency); err == nil {
+				continue
+			}
+
+			resp, err := request(&reflectionpb.ServerReflectionRequest{
+				MessageRequest: &reflectionpb.ServerReflectionRequest_FileByFilename{FileByFilename: dependency},
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to get file %q: %w", dependency, err)
+			}
+			if err := addFiles(resp); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return NewFiles(set)
+}
+
+// RegisterFromReflection discovers the services of the gRPC server over "conn" through the server reflection service
+// and registers routes for the methods with HTTP bindings in their method options to "mux".
+//
+// The first discovery happens before this function returns and its error is returned. After that, the routes are
+// refreshed periodically until "ctx" is done; errors during the refreshes are logged and the previous routes are
+// kept. See Registrar for how routes that are removed are handled.
+func RegisterFromReflection(
+	ctx context.Context, mux *gateway.ServeMux, conn grpc.ClientConnInterface, config ReflectionConfig) error {
+
+	registrar := NewRegistrar(mux, conn)
+	refresh := func() error {
+		files, err := FilesFromReflection(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		gw, err := New(files, nil, config.Options...)
+		if err != nil {
+			return err
+		}
+
+		added, removed, err := registrar.Update(gw)
+		if err != nil {
+			return err
+		}
+		if config.OnChange != nil && (len(added) > 0 || len(removed) > 0) {
+			config.OnChange(added, removed)
+		}
+		return nil
+	}
+
+	if err := refresh(); err != nil {
+		return err
+	}
+
+	interval := config.RefreshInterval
+	if interval == 0 {
+		interval = DefaultRefreshInterval
+	}
+	if interval < 0 {
+		return nil
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := refresh(); err != nil {
+					grpclog.Errorf("Failed to refresh the routes from reflection: %v", err)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,300 @@
+package dynamic_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/meshapi/grpc-api-gateway/api"
+	"github.com/meshapi/grpc-api-gateway/api/openapi"
+	"github.com/meshapi/grpc-api-gateway/dynamic"
+	"github.com/meshapi/grpc-api-gateway/gateway"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/reflection"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// serviceList is the list of services that the reflection service reports, it can be changed while serving.
+type serviceList struct {
+	mutex    sync.Mutex
+	services map[string]grpc.ServiceInfo
+}
+
+func (s *serviceList) GetServiceInfo() map[string]grpc.ServiceInfo {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.services
+}
+
+func (s *serviceList) set(services ...string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.services = map[string]grpc.ServiceInfo{}
+	for _, service := range services {
+		s.services[service] = grpc.ServiceInfo{}
+	}
+}
+
+func newReflectionConn(t *testing.T, services *serviceList) *grpc.ClientConn {
+	t.Helper()
+
+	fileProto := testFileDescriptor()
+	proto.SetExtension(fileProto.Service[0].Method[1].Options, api.E_OpenapiOperation, &openapi.Operation{
+		Summary: "Streams echoes",
+		Tags:    []string{"echo"},
+	})
+	files, err := dynamic.NewFiles(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{fileProto}})
+	if err != nil {
+		t.Fatalf("failed to build files: %s", err)
+	}
+	desc, err := files.FindDescriptorByName("dyn.test.EchoRequest")
+	if err != nil {
+		t.Fatalf("failed to find message: %s", err)
+	}
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(grpc.UnknownServiceHandler(testServer(desc.(protoreflect.MessageDescriptor))))
+	reflectionpb.RegisterServerReflectionServer(server, reflection.NewServerV1(reflection.ServerOptions{
+		Services:           services,
+		DescriptorResolver: files,
+	}))
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial: %s", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return conn
+}
+
+func TestRegisterFromReflection(t *testing.T) {
+	services := &serviceList{}
+	services.set("dyn.test.EchoService")
+	conn := newReflectionConn(t, services)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	type change struct{ added, removed []dynamic.Route }
+	changes := make(chan change, 10)
+
+	mux := gateway.NewServeMux()
+	err := dynamic.RegisterFromReflection(ctx, mux, conn, dynamic.ReflectionConfig{
+		RefreshInterval: 10 * time.Millisecond,
+		OnChange: func(added, removed []dynamic.Route) {
+			changes <- change{added: added, removed: removed}
+		},
+		Options: []dynamic.Option{dynamic.WithGenerateUnboundMethods()},
+	})
+	if err != nil {
+		t.Fatalf("failed to register routes: %s", err)
+	}
+
+	first := <-changes
+	if len(first.removed) != 0 {
+		t.Errorf("unexpected removed routes: %v", first.removed)
+	}
+	var streamRoute *dynamic.Route
+	var routes []string
+	for index, route := range first.added {
+		routes = append(routes, route.String())
+		if route.RPCMethod == "/dyn.test.EchoService/Stream" {
+			streamRoute = &first.added[index]
+		}
+	}
+	expectedRoutes := []string{
+		"POST /dyn.test.EchoService/Chat -> /dyn.test.EchoService/Chat",
+		"POST /dyn.test.EchoService/Collect -> /dyn.test.EchoService/Collect",
+		"POST /dyn.test.EchoService/Echo -> /dyn.test.EchoService/Echo",
+		"GET /v1/stream/{id} -> /dyn.test.EchoService/Stream",
+	}
+	if strings.Join(routes, "\n") != strings.Join(expectedRoutes, "\n") {
+		t.Fatalf("expected routes:\n%s\ngot:\n%s", strings.Join(expectedRoutes, "\n"), strings.Join(routes, "\n"))
+	}
+	if streamRoute.Operation.GetSummary() != "Streams echoes" {
+		t.Errorf("expected the OpenAPI operation of the method, got %v", streamRoute.Operation)
+	}
+	if streamRoute.StreamingMode != gateway.StreamingModeServer {
+		t.Errorf("expected server streaming mode, got %v", streamRoute.StreamingMode)
+	}
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(http.MethodPost, "/dyn.test.EchoService/Echo", `{"id": "abc"}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"abc"`) {
+		t.Fatalf("unexpected response %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = serve(http.MethodGet, "/v1/stream/abc", "")
+	if rec.Code != http.StatusOK || strings.Count(rec.Body.String(), `"abc"`) != 3 {
+		t.Fatalf("unexpected response %d: %s", rec.Code, rec.Body.String())
+	}
+
+	services.set()
+	select {
+	case second := <-changes:
+		if len(second.added) != 0 || len(second.removed) != len(expectedRoutes) {
+			t.Fatalf("unexpected changes: added %v, removed %v", second.added, second.removed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("routes were not refreshed")
+	}
+
+	if rec := serve(http.MethodGet, "/v1/stream/abc", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected removed route to respond with 404, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	services.set("dyn.test.EchoService")
+	select {
+	case third := <-changes:
+		if len(third.added) != len(expectedRoutes) {
+			t.Fatalf("unexpected added routes: %v", third.added)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("routes were not refreshed")
+	}
+
+	if rec := serve(http.MethodGet, "/v1/stream/abc", ""); rec.Code != http.StatusOK {
+		t.Errorf("expected restored route to be served, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRegistrarConflicts(t *testing.T) {
+	files := testFiles(t)
+	mux := gateway.NewServeMux(gateway.WithRoutingErrorHandler(
+		func(_ context.Context, _ *gateway.ServeMux, _ gateway.Marshaler, w http.ResponseWriter, _ *http.Request,
+			err gateway.ErrRouting) {
+			w.WriteHeader(http.StatusTeapot)
+		}))
+	registrar := dynamic.NewRegistrar(mux, nil)
+
+	build := func(config string) *dynamic.Gateway {
+		t.Helper()
+
+		spec, err := dynamic.ParseConfig([]byte(config))
+		if err != nil {
+			t.Fatalf("failed to parse config: %s", err)
+		}
+		gw, err := dynamic.New(files, spec.GetGateway(), dynamic.WithProtoPackage("dyn.test"))
+		if err != nil {
+			t.Fatalf("failed to build gateway: %s", err)
+		}
+		return gw
+	}
+
+	muxRoutes := func() string {
+		var routes []string
+		for _, route := range mux.Routes() {
+			routes = append(routes, route.HTTPMethod+" "+route.Path+" -> "+route.RPCMethod)
+		}
+		return strings.Join(routes, "\n")
+	}
+
+	added, _, err := registrar.Update(build(`
+gateway:
+  endpoints:
+    - selector: "~.EchoService.Echo"
+      post: "/v1/echo"
+      body: "*"
+`))
+	if err != nil || len(added) != 2 {
+		t.Fatalf("unexpected update result: %v, %v", added, err)
+	}
+
+	added, removed, err := registrar.Update(build(`
+gateway:
+  endpoints:
+    - selector: "~.EchoService.Collect"
+      post: "/v1/echo"
+      body: "*"
+    - selector: "~.EchoService.Echo"
+      get: "/v1/stream/{num}"
+`))
+	if err == nil || !strings.Contains(err.Error(), "failed to register route GET /v1/stream/{num}") {
+		t.Errorf("expected conflict error, got %v", err)
+	}
+	if len(added) != 0 || len(removed) != 0 {
+		t.Errorf("expected no changes, got added %v, removed %v", added, removed)
+	}
+
+	var routes []string
+	for _, route := range registrar.Routes() {
+		routes = append(routes, route.String())
+	}
+	expectedRoutes := "POST /v1/echo -> /dyn.test.EchoService/Echo\nGET /v1/stream/{id} -> /dyn.test.EchoService/Stream"
+	if strings.Join(routes, "\n") != expectedRoutes {
+		t.Errorf("expected the routes to stay unchanged, got:\n%s", strings.Join(routes, "\n"))
+	}
+	expectedRoutes = "POST /v1/echo -> /dyn.test.EchoService/Echo\nGET /v1/stream/:id -> /dyn.test.EchoService/Stream"
+	if routes := muxRoutes(); routes != expectedRoutes {
+		t.Errorf("expected the routes of the mux to stay unchanged, got:\n%s", routes)
+	}
+
+	// a route can be bound to another gRPC method, which replaces the route info on the mux.
+	_, removed, err = registrar.Update(build(`
+gateway:
+  endpoints:
+    - selector: "~.EchoService.Collect"
+      post: "/v1/echo"
+      body: "*"
+`))
+	if err != nil || len(removed) != 1 {
+		t.Fatalf("unexpected update result: %v, %v", removed, err)
+	}
+
+	expectedRoutes = "POST /v1/echo -> /dyn.test.EchoService/Collect\nGET /v1/stream/:id -> /dyn.test.EchoService/Stream"
+	if routes := muxRoutes(); routes != expectedRoutes {
+		t.Errorf("unexpected routes of the mux:\n%s", routes)
+	}
+	for _, route := range mux.Routes() {
+		if route.Path == "/v1/echo" && route.StreamingMode != gateway.StreamingModeClient {
+			t.Errorf("expected the streaming mode of the rebound route to be updated, got %v", route.StreamingMode)
+		}
+	}
+
+	// removed routes are not listed and are handled by the routing error handler.
+	_, removed, err = registrar.Update(build(`
+gateway:
+  endpoints:
+    - selector: "~.EchoService.Collect"
+      post: "/v1/collect"
+      body: "*"
+`))
+	if err != nil || len(removed) != 1 {
+		t.Fatalf("unexpected update result: %v, %v", removed, err)
+	}
+
+	expectedRoutes = "POST /v1/collect -> /dyn.test.EchoService/Collect\n" +
+		"GET /v1/stream/:id -> /dyn.test.EchoService/Stream"
+	if routes := muxRoutes(); routes != expectedRoutes {
+		t.Errorf("unexpected routes of the mux:\n%s", routes)
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/echo", strings.NewReader("{}")))
+	if rec.Code != http.StatusTeapot {
+		t.Errorf("expected the removed route to be handled by the routing error handler, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,92 @@
+package dynamic
+
+import (
+	"sync"
+
+	"github.com/meshapi/grpc-api-gateway/api"
+	"github.com/meshapi/grpc-api-gateway/gateway"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// Reloader serves the bindings of a gateway spec and swaps the overlay applied on top of them while serving.
+//
+// To change the bindings of the services that are compiled into the binary without recompiling, use
+// protoregistry.GlobalFiles as the files and register the Reloader in place of the generated Register functions.
+type Reloader struct {
+	mutex     sync.Mutex
+	files     *protoregistry.Files
+	spec      *api.GatewaySpec
+	options   []Option
+	overlay   *api.GatewaySpec
+	registrar *Registrar
+}
+
+// NewReloader registers the bindings of "spec" and the HTTP options of the methods in "files" to "mux" without any
+// overlays. The requests are forwarded over "conn".
+func NewReloader(
+	mux *gateway.ServeMux, conn grpc.ClientConnInterface, files *protoregistry.Files, spec *api.GatewaySpec,
+	opts ...Option) (*Reloader, error) {
+
+	reloader := &Reloader{
+		files:     files,
+		spec:      spec,
+		options:   opts,
+		registrar: NewRegistrar(mux, conn),
+	}
+	if _, _, err := reloader.Reload(nil); err != nil {
+		return nil, err
+	}
+
+	return reloader, nil
+}
+
+// Reload replaces the overlay and returns the routes that were added and removed. See WithOverlay for how the
+// overlay is applied.
+//
+// The bindings are validated before any change is made, if they are invalid or if a selector of the overlay does not
+// match any method, an error is returned and the previous overlay stays active. Use errors.As with
+// UnresolvedSelectorsError to get the selectors that do not match. The requests that are in flight are not affected.
+func (r *Reloader) Reload(overlay *api.GatewaySpec) (added, removed []Route, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	opts := append([]Option{}, r.options...)
+	opts = append(opts, WithOverlay(overlay))
+	gw, err := New(r.files, r.spec, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	added, removed, err = r.registrar.Update(gw)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r.overlay = overlay
+	return added, removed, nil
+}
+
+// ReloadFile loads the overlay from the "gateway" section of a config file and replaces the active overlay. See
+// Reload.
+func (r *Reloader) ReloadFile(filePath string) (added, removed []Route, err error) {
+	config, err := LoadConfig(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return r.Reload(config.GetGateway())
+}
+
+// Overlay returns the active overlay.
+func (r *Reloader) Overlay() *api.GatewaySpec {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.overlay
+}
+
+// Routes returns the active routes.
+func (r *Reloader) Routes() []Route {
+	return r.registrar.Routes()
+}
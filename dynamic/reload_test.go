@@ -0,0 +1,179 @@
+package dynamic_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/meshapi/grpc-api-gateway/api"
+	"github.com/meshapi/grpc-api-gateway/dynamic"
+	"github.com/meshapi/grpc-api-gateway/gateway"
+)
+
+const testOverlay = `
+gateway:
+  endpoints:
+    - selector: "~.EchoService.Echo"
+      query_params:
+        - selector: "tags"
+          name: "tag"
+      additional_bindings:
+        - get: "/v2/echo/{id}"
+          response_body: "id"
+    - selector: "~.EchoService.Stream"
+      stream:
+        disable_chunked_transfer: true
+`
+
+func TestReloader(t *testing.T) {
+	files := testFiles(t)
+	conn := newTestConn(t, files)
+	config, err := dynamic.ParseConfig([]byte(testConfig))
+	if err != nil {
+		t.Fatalf("failed to parse config: %s", err)
+	}
+
+	mux := gateway.NewServeMux()
+	reloader, err := dynamic.NewReloader(mux, conn, files, config.GetGateway(), dynamic.WithProtoPackage("dyn.test"))
+	if err != nil {
+		t.Fatalf("failed to create reloader: %s", err)
+	}
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+	overlay := func(content string) *api.GatewaySpec {
+		t.Helper()
+
+		config, err := dynamic.ParseConfig([]byte(content))
+		if err != nil {
+			t.Fatalf("failed to parse overlay: %s", err)
+		}
+		return config.GetGateway()
+	}
+
+	if rec := serve(http.MethodGet, "/v2/echo/abc", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 before the overlay, got %d", rec.Code)
+	}
+	if rec := serve(http.MethodPost, "/v1/echo/abc?tag=x", `{}`); strings.Contains(rec.Body.String(), `"x"`) {
+		t.Fatalf("expected the query parameter alias to be unknown before the overlay, got %s", rec.Body.String())
+	}
+
+	// a client-streaming request that is in flight during the reload must not be interrupted.
+	bodyReader, bodyWriter := io.Pipe()
+	inFlight := make(chan *httptest.ResponseRecorder)
+	go func() {
+		req := httptest.NewRequest(http.MethodPost, "/v1/collect", bodyReader)
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		inFlight <- rec
+	}()
+	_, _ = io.WriteString(bodyWriter, `{"id":"a"}`)
+
+	added, removed, err := reloader.Reload(overlay(testOverlay))
+	if err != nil {
+		t.Fatalf("failed to reload: %s", err)
+	}
+	if len(added) != 1 || added[0].String() != "GET /v2/echo/{id} -> /dyn.test.EchoService/Echo" {
+		t.Errorf("unexpected added routes: %v", added)
+	}
+	if len(removed) != 0 {
+		t.Errorf("unexpected removed routes: %v", removed)
+	}
+
+	_, _ = io.WriteString(bodyWriter, `{"id":"b"}`)
+	_ = bodyWriter.Close()
+	if rec := <-inFlight; rec.Code != http.StatusOK ||
+		!strings.Contains(compactJSONLines(t, rec.Body.String()), `"tags":["a","b"]`) {
+		t.Errorf("unexpected in-flight response %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if rec := serve(http.MethodGet, "/v2/echo/abc", ""); rec.Body.String() != `"abc"` {
+		t.Errorf("unexpected response %d: %s", rec.Code, rec.Body.String())
+	}
+	rec := serve(http.MethodPost, "/v1/echo/abc?tag=x&tag=y", `{}`)
+	if !strings.Contains(compactJSONLines(t, rec.Body.String()), `"tags":["x","y"]`) {
+		t.Errorf("expected the query parameter alias to be used, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := serve(http.MethodGet, "/v1/stream/abc", ""); rec.Code == http.StatusOK {
+		t.Errorf("expected chunked transfer to be disabled, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	_, _, err = reloader.Reload(overlay(`
+gateway:
+  endpoints:
+    - selector: "~.EchoService.Missing"
+      get: "/v3/missing"
+    - selector: "dyn.test.OtherService.Method"
+      query_params:
+        - selector: "id"
+          name: "identifier"
+`))
+	var unresolved dynamic.UnresolvedSelectorsError
+	if !errors.As(err, &unresolved) {
+		t.Fatalf("expected unresolved selectors error, got %v", err)
+	}
+	expectedSelectors := "dyn.test.EchoService.Missing, dyn.test.OtherService.Method"
+	if strings.Join(unresolved.OverlaySelectors, ", ") != expectedSelectors || len(unresolved.Selectors) != 0 {
+		t.Errorf("unexpected unresolved selectors: %+v", unresolved)
+	}
+
+	_, _, err = reloader.Reload(overlay(`
+gateway:
+  endpoints:
+    - selector: "~.EchoService.Echo"
+      query_params:
+        - selector: "missing"
+          name: "m"
+`))
+	if err == nil {
+		t.Errorf("expected an invalid overlay to fail")
+	}
+
+	if rec := serve(http.MethodGet, "/v2/echo/abc", ""); rec.Code != http.StatusOK {
+		t.Errorf("expected the previous overlay to stay active, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(reloader.Overlay().GetEndpoints()) != 2 {
+		t.Errorf("expected the previous overlay to stay active, got %v", reloader.Overlay())
+	}
+
+	added, removed, err = reloader.Reload(nil)
+	if err != nil {
+		t.Fatalf("failed to reload: %s", err)
+	}
+	if len(added) != 0 || len(removed) != 1 || removed[0].HTTPPathPattern != "/v2/echo/{id}" {
+		t.Errorf("unexpected changes: added %v, removed %v", added, removed)
+	}
+	if rec := serve(http.MethodGet, "/v2/echo/abc", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected removed route to respond with 404, got %d", rec.Code)
+	}
+	if rec := serve(http.MethodGet, "/v1/stream/abc", ""); rec.Code != http.StatusOK {
+		t.Errorf("expected chunked transfer to be enabled, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestOverlayWithoutBinding(t *testing.T) {
+	files := testFiles(t)
+	config, err := dynamic.ParseConfig([]byte(`
+gateway:
+  endpoints:
+    - selector: "dyn.test.EchoService.Echo"
+      disable_query_param_discovery: true
+`))
+	if err != nil {
+		t.Fatalf("failed to parse overlay: %s", err)
+	}
+
+	_, err = dynamic.New(files, nil, dynamic.WithOverlay(config.GetGateway()))
+	if err == nil || !strings.Contains(err.Error(), "the method has no binding to amend") {
+		t.Errorf("expected error for an overlay without a binding, got %v", err)
+	}
+}
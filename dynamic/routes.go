@@ -0,0 +1,184 @@
+package dynamic
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/meshapi/grpc-api-gateway/gateway"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// Registrar registers the routes of gateways to a ServeMux and keeps them up to date as the gateway changes.
+//
+// A route that is no longer in the gateway is removed from the ServeMux, see ServeMux.RemoveRoute. When the binding
+// of a route changes, the RouteInfo of the route on the ServeMux is replaced as well, see ServeMux.ReplaceRoute.
+type Registrar struct {
+	mux  *gateway.ServeMux
+	conn grpc.ClientConnInterface
+
+	// handles holds the active handlers by the route key, it gets replaced as a whole on every update.
+	handles atomic.Pointer[map[string]httprouter.Handle]
+
+	mutex  sync.Mutex
+	infos  map[string]gateway.RouteInfo
+	routes map[string]Route
+}
+
+// NewRegistrar returns a new Registrar that registers routes to "mux" and forwards requests over "conn".
+func NewRegistrar(mux *gateway.ServeMux, conn grpc.ClientConnInterface) *Registrar {
+	return &Registrar{
+		mux:    mux,
+		conn:   conn,
+		infos:  map[string]gateway.RouteInfo{},
+		routes: map[string]Route{},
+	}
+}
+
+// Update replaces the active routes with the routes of "g" and returns the routes that were added and removed.
+//
+// All the handlers are replaced at once: the requests that are in flight finish with the handlers they started with
+// and the new requests are served by the new routes. The RouteInfo of the changed routes is replaced right after. If
+// any of the routes cannot be registered, an error is returned and the active routes are not changed.
+func (r *Registrar) Update(g *Gateway) (added, removed []Route, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var errs []error
+	bindings := map[string]*binding{}
+	for _, m := range g.methods {
+		for _, b := range m.bindings {
+			key := b.httpMethod + " " + httpPath(b.template)
+			if existing, ok := bindings[key]; ok {
+				errs = append(errs, fmt.Errorf("route %s conflicts with route %s", b.route(), existing.route()))
+				continue
+			}
+			bindings[key] = b
+		}
+	}
+	if len(errs) > 0 {
+		return nil, nil, errors.Join(errs...)
+	}
+
+	var registered []gateway.RouteInfo
+	for key, b := range bindings {
+		if _, ok := r.infos[key]; ok {
+			continue
+		}
+		if err := r.register(key, b); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		registered = append(registered, b.routeInfo())
+	}
+	if len(errs) > 0 {
+		for _, info := range registered {
+			r.mux.RemoveRoute(info.HTTPMethod, info.Path)
+		}
+		return nil, nil, errors.Join(errs...)
+	}
+
+	handles := make(map[string]httprouter.Handle, len(bindings))
+	routes := make(map[string]Route, len(bindings))
+	infos := make(map[string]gateway.RouteInfo, len(bindings))
+	for key, b := range bindings {
+		handles[key] = b.handler(r.mux, r.conn)
+		routes[key] = b.route()
+		infos[key] = b.routeInfo()
+	}
+	r.handles.Store(&handles)
+
+	for key, info := range infos {
+		if previous, ok := r.infos[key]; ok && previous != info {
+			r.mux.ReplaceRoute(info.HTTPMethod, info.Path, r.dispatch(key), gateway.WithRouteInfo(info))
+		}
+	}
+	for key, info := range r.infos {
+		if _, ok := infos[key]; !ok {
+			r.mux.RemoveRoute(info.HTTPMethod, info.Path)
+		}
+	}
+	r.infos = infos
+
+	for key, route := range routes {
+		if previous, ok := r.routes[key]; !ok || !sameRoute(previous, route) {
+			added = append(added, route)
+		}
+	}
+	for key, route := range r.routes {
+		if current, ok := routes[key]; !ok || !sameRoute(current, route) {
+			removed = append(removed, route)
+		}
+	}
+	r.routes = routes
+
+	sortRoutes(added)
+	sortRoutes(removed)
+	return added, removed, nil
+}
+
+// Routes returns the active routes.
+func (r *Registrar) Routes() []Route {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	routes := make([]Route, 0, len(r.routes))
+	for _, route := range r.routes {
+		routes = append(routes, route)
+	}
+	sortRoutes(routes)
+	return routes
+}
+
+// register registers the route with "key" to the ServeMux, the route responds with a not found error until its
+// handler is stored.
+func (r *Registrar) register(key string, b *binding) (err error) {
+	defer func() {
+		// the router panics when the route conflicts with the routes that are already registered.
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("failed to register route %s: %v", b.route(), recovered)
+		}
+	}()
+
+	info := b.routeInfo()
+	r.mux.HandleWithParams(info.HTTPMethod, info.Path, r.dispatch(key), gateway.WithRouteInfo(info))
+	return nil
+}
+
+func (r *Registrar) dispatch(key string) httprouter.Handle {
+	return func(w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		var handle httprouter.Handle
+		if handles := r.handles.Load(); handles != nil {
+			handle = (*handles)[key]
+		}
+		if handle == nil {
+			_, outboundMarshaler := r.mux.MarshalerForRequest(req)
+			r.mux.RoutingError(req.Context(), outboundMarshaler, w, req, gateway.ErrRoutingNotFound)
+			return
+		}
+
+		handle(w, req, params)
+	}
+}
+
+func sameRoute(a, b Route) bool {
+	return a.HTTPMethod == b.HTTPMethod && a.HTTPPathPattern == b.HTTPPathPattern && a.RPCMethod == b.RPCMethod &&
+		a.StreamingMode == b.StreamingMode && proto.Equal(a.Operation, b.Operation)
+}
+
+func sortRoutes(routes []Route) {
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].HTTPPathPattern != routes[j].HTTPPathPattern {
+			return routes[i].HTTPPathPattern < routes[j].HTTPPathPattern
+		}
+		if routes[i].HTTPMethod != routes[j].HTTPMethod {
+			return routes[i].HTTPMethod < routes[j].HTTPMethod
+		}
+		return routes[i].RPCMethod < routes[j].RPCMethod
+	})
+}
@@ -1,6 +1,7 @@
 module github.com/meshapi/grpc-api-gateway/examples
 
-go 1.22.0
+go 1.23.0
+
 toolchain go1.24.1
 
 replace (
@@ -13,6 +14,7 @@ require (
 	github.com/gorilla/websocket v1.5.1
 	github.com/meshapi/grpc-api-gateway v0.0.0-00010101000000-000000000000
 	github.com/meshapi/grpc-api-gateway/websocket/wrapper/gorillawrapper v0.0.0-00010101000000-000000000000
+	google.golang.org/genproto/googleapis/api v0.0.0-20231106174013-bbf56f31fb17
 	google.golang.org/grpc v1.61.1
 	google.golang.org/protobuf v1.33.0
 )
@@ -24,6 +26,6 @@ require (
 	golang.org/x/sys v0.30.0 // indirect
 	golang.org/x/text v0.22.0 // indirect
 	google.golang.org/genproto v0.0.0-20231106174013-bbf56f31fb17 // indirect
-	google.golang.org/genproto/googleapis/api v0.0.0-20231106174013-bbf56f31fb17 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20231106174013-bbf56f31fb17 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -49,7 +49,7 @@ func main() {
 		},
 	}
 	websocketUpgradeFunc := gateway.WebsocketUpgradeFunc(func(w http.ResponseWriter, r *http.Request) (ws.Connection, error) {
-		c, err := upgrader.Upgrade(w, r, nil)
+		c, err := upgrader.Upgrade(w, r, w.Header())
 		if err != nil {
 			log.Printf("ws error: %s", err)
 			return nil, fmt.Errorf("failed to upgrade: %w", err)
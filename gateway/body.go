@@ -0,0 +1,177 @@
+package gateway
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrRequestBodyTooLarge is the error returned when reading a request body that exceeds the configured limit.
+type ErrRequestBodyTooLarge struct {
+	// Limit is the maximum number of bytes allowed in the request body.
+	Limit int64
+}
+
+func (e ErrRequestBodyTooLarge) Error() string {
+	return fmt.Sprintf("request body exceeds the limit of %d bytes", e.Limit)
+}
+
+func (e ErrRequestBodyTooLarge) GRPCStatus() *status.Status {
+	return status.New(codes.ResourceExhausted, e.Error())
+}
+
+// DecompressorFunc creates a reader that decompresses the data read from the reader.
+type DecompressorFunc func(io.Reader) (io.ReadCloser, error)
+
+// DecompressionConfig configures the decompression of the request bodies.
+type DecompressionConfig struct {
+	// Decompressors maps the case-insensitive content-coding names (e.g. "gzip") to decompressors.
+	// If nil, gzip and deflate are supported.
+	Decompressors map[string]DecompressorFunc
+}
+
+// defaultDecompressors returns the decompressors for gzip and deflate content-codings.
+func defaultDecompressors() map[string]DecompressorFunc {
+	return map[string]DecompressorFunc{
+		"gzip": func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+		"deflate": func(r io.Reader) (io.ReadCloser, error) {
+			return flate.NewReader(r), nil
+		},
+	}
+}
+
+type requestBodyLimit struct {
+	selector RouteSelectorFunc
+	limit    int64
+}
+
+// requestBodyLimitFor returns the request body size limit of a route, non-positive values mean no limit.
+func (s *ServeMux) requestBodyLimitFor(info RouteInfo) int64 {
+	limit := s.maxRequestBodySize
+	for _, entry := range s.requestBodyLimits {
+		if entry.selector(info) {
+			limit = entry.limit
+		}
+	}
+	return limit
+}
+
+// wrapRequestBody wraps the route handler so that the request body gets decompressed and limited before the handler
+// reads it.
+func (s *ServeMux) wrapRequestBody(info RouteInfo, handler httprouter.Handle) httprouter.Handle {
+	limit := s.requestBodyLimitFor(info)
+	if limit <= 0 && s.decompressors == nil {
+		return handler
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		if r.Body == nil || r.Body == http.NoBody {
+			handler(w, r, p)
+			return
+		}
+
+		encodings := r.Header.Values("Content-Encoding")
+		if s.decompressors != nil && len(encodings) > 0 {
+			body, err := s.decompressRequestBody(r.Body, encodings)
+			if err != nil {
+				_, outboundMarshaler := s.MarshalerForRequest(r)
+				s.HTTPError(r.Context(), outboundMarshaler, w, r, err)
+				return
+			}
+			r.Body = body
+			r.ContentLength = -1
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+		}
+
+		if limit > 0 {
+			if r.ContentLength > limit {
+				_, outboundMarshaler := s.MarshalerForRequest(r)
+				s.HTTPError(r.Context(), outboundMarshaler, w, r, ErrRequestBodyTooLarge{Limit: limit})
+				return
+			}
+			r.Body = &limitedRequestBody{ReadCloser: r.Body, limit: limit, remaining: limit}
+		}
+
+		handler(w, r, p)
+	}
+}
+
+// decompressRequestBody returns a reader that undoes the content-codings in the reverse order that they were applied.
+func (s *ServeMux) decompressRequestBody(body io.ReadCloser, encodings []string) (io.ReadCloser, error) {
+	var names []string
+	for _, value := range encodings {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.ToLower(strings.TrimSpace(name)); name != "" && name != "identity" {
+				names = append(names, name)
+			}
+		}
+	}
+
+	result := body
+	for index := len(names) - 1; index >= 0; index-- {
+		decompressor, ok := s.decompressors[names[index]]
+		if !ok {
+			return nil, HTTPStatusError{
+				HTTPStatus: http.StatusUnsupportedMediaType,
+				Err:        status.Errorf(codes.InvalidArgument, "unsupported content encoding: %s", names[index]),
+			}
+		}
+		reader, err := decompressor(result)
+		if err != nil {
+			return nil, ErrMarshal{Err: err, Inbound: true}
+		}
+		result = &decompressedRequestBody{ReadCloser: reader, source: result}
+	}
+
+	return result, nil
+}
+
+// decompressedRequestBody closes both the decompressor and the source body.
+type decompressedRequestBody struct {
+	io.ReadCloser
+	source io.Closer
+}
+
+func (d *decompressedRequestBody) Close() error {
+	err := d.ReadCloser.Close()
+	if sourceErr := d.source.Close(); err == nil {
+		err = sourceErr
+	}
+	return err
+}
+
+// limitedRequestBody returns ErrRequestBodyTooLarge once more than the limit is read from the body.
+type limitedRequestBody struct {
+	io.ReadCloser
+	limit     int64
+	remaining int64
+}
+
+func (l *limitedRequestBody) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, ErrRequestBodyTooLarge{Limit: l.limit}
+	}
+
+	// reading one more byte than remaining detects bodies that exceed the limit.
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.ReadCloser.Read(p)
+	if int64(n) > l.remaining {
+		n = int(l.remaining)
+		l.remaining = -1
+		return n, ErrRequestBodyTooLarge{Limit: l.limit}
+	}
+	l.remaining -= int64(n)
+	return n, err
+}
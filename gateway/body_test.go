@@ -0,0 +1,203 @@
+package gateway_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/meshapi/grpc-api-gateway/gateway"
+	"github.com/meshapi/grpc-api-gateway/internal/examplepb"
+	"github.com/meshapi/grpc-api-gateway/protomarshal"
+)
+
+func newRequestBodyTestMux(options ...gateway.ServeMuxOption) *gateway.ServeMux {
+	mux := gateway.NewServeMux(options...)
+	echo := func(w http.ResponseWriter, r *http.Request, _ gateway.Params) {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			_, outbound := mux.MarshalerForRequest(r)
+			mux.HTTPError(r.Context(), outbound, w, r, gateway.ErrMarshal{Err: err, Inbound: true})
+			return
+		}
+		_, _ = w.Write(data)
+	}
+	mux.HandleWithParams(http.MethodPost, "/v1/items", echo, gateway.WithRouteInfo(gateway.RouteInfo{
+		RPCMethod: "/example.Items/Create",
+	}))
+	mux.HandleWithParams(http.MethodPost, "/v1/uploads", echo, gateway.WithRouteInfo(gateway.RouteInfo{
+		RPCMethod: "/example.Uploads/Create",
+	}))
+	return mux
+}
+
+func gzipData(t *testing.T, data string) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write([]byte(data)); err != nil {
+		t.Fatalf("failed to compress data: %s", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed to compress data: %s", err)
+	}
+	return buffer.Bytes()
+}
+
+func TestRequestBodyLimit(t *testing.T) {
+	mux := newRequestBodyTestMux(
+		gateway.WithMaxRequestBodySize(8),
+		gateway.WithRouteMaxRequestBodySize(gateway.SelectService("example.Uploads"), 16),
+	)
+
+	testCases := []struct {
+		Name           string
+		Path           string
+		Body           string
+		UnknownLength  bool
+		ExpectedStatus int
+	}{
+		{Name: "WithinLimit", Path: "/v1/items", Body: "12345678", ExpectedStatus: http.StatusOK},
+		{Name: "ContentLength", Path: "/v1/items", Body: "123456789", ExpectedStatus: http.StatusRequestEntityTooLarge},
+		{Name: "UnknownLength", Path: "/v1/items", Body: "123456789", UnknownLength: true,
+			ExpectedStatus: http.StatusRequestEntityTooLarge},
+		{Name: "RouteLimit", Path: "/v1/uploads", Body: "123456789", ExpectedStatus: http.StatusOK},
+		{Name: "RouteLimitExceeded", Path: "/v1/uploads", Body: strings.Repeat("1", 17), UnknownLength: true,
+			ExpectedStatus: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.Path, strings.NewReader(tt.Body))
+			if tt.UnknownLength {
+				req.ContentLength = -1
+			}
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.ExpectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.ExpectedStatus, recorder.Code, recorder.Body.String())
+			}
+			if tt.ExpectedStatus == http.StatusOK && recorder.Body.String() != tt.Body {
+				t.Fatalf("expected body %q, got %q", tt.Body, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestRequestBodyDecompression(t *testing.T) {
+	mux := newRequestBodyTestMux(
+		gateway.WithMaxRequestBodySize(32),
+		gateway.WithRequestDecompression(gateway.DecompressionConfig{}),
+	)
+
+	testCases := []struct {
+		Name           string
+		Encoding       string
+		Body           []byte
+		ExpectedStatus int
+		ExpectedBody   string
+	}{
+		{
+			Name:           "Gzip",
+			Encoding:       "gzip",
+			Body:           gzipData(t, `{"name":"item"}`),
+			ExpectedStatus: http.StatusOK,
+			ExpectedBody:   `{"name":"item"}`,
+		},
+		{
+			Name:           "Identity",
+			Encoding:       "identity",
+			Body:           []byte(`{"name":"item"}`),
+			ExpectedStatus: http.StatusOK,
+			ExpectedBody:   `{"name":"item"}`,
+		},
+		{
+			Name:           "DecompressedLimit",
+			Encoding:       "gzip",
+			Body:           gzipData(t, strings.Repeat("a", 64)),
+			ExpectedStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			Name:           "Unsupported",
+			Encoding:       "br",
+			Body:           []byte("data"),
+			ExpectedStatus: http.StatusUnsupportedMediaType,
+		},
+		{
+			Name:           "Corrupt",
+			Encoding:       "gzip",
+			Body:           []byte("not gzip"),
+			ExpectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/items", bytes.NewReader(tt.Body))
+			req.Header.Set("Content-Encoding", tt.Encoding)
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.ExpectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.ExpectedStatus, recorder.Code, recorder.Body.String())
+			}
+			if tt.ExpectedBody != "" && recorder.Body.String() != tt.ExpectedBody {
+				t.Fatalf("expected body %q, got %q", tt.ExpectedBody, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestMultipartRequestBody(t *testing.T) {
+	mux := gateway.NewServeMux(
+		gateway.WithMarshalerOption("multipart/form-data", &protomarshal.MultipartFormPb{MaxPartSize: 4}))
+	mux.HandleWithParams(http.MethodPost, "/v1/files", func(w http.ResponseWriter, r *http.Request, _ gateway.Params) {
+		inbound, outbound := mux.MarshalerForRequest(r)
+		var msg examplepb.Proto3Message
+		if err := inbound.NewDecoder(r.Body).Decode(&msg); err != nil {
+			mux.HTTPError(r.Context(), outbound, w, r, gateway.ErrMarshal{Err: err, Inbound: true})
+			return
+		}
+		_, _ = w.Write([]byte(msg.StringValue))
+	})
+
+	testCases := []struct {
+		Name           string
+		Value          string
+		ExpectedStatus int
+	}{
+		{Name: "WithinLimit", Value: "foo", ExpectedStatus: http.StatusOK},
+		{Name: "PartTooLarge", Value: "foobar", ExpectedStatus: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			var body bytes.Buffer
+			writer := multipart.NewWriter(&body)
+			if err := writer.WriteField("string_value", tt.Value); err != nil {
+				t.Fatalf("failed to write field: %s", err)
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatalf("failed to close writer: %s", err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/files", &body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.ExpectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.ExpectedStatus, recorder.Code, recorder.Body.String())
+			}
+			if tt.ExpectedStatus == http.StatusOK && recorder.Body.String() != tt.Value {
+				t.Errorf("expected body %q, got %q", tt.Value, recorder.Body.String())
+			}
+		})
+	}
+}
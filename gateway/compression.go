@@ -0,0 +1,304 @@
+package gateway
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/grpclog"
+)
+
+// CompressionWriter is a writer that compresses the data written to it.
+type CompressionWriter interface {
+	io.WriteCloser
+
+	// Flush writes any pending compressed data to the underlying writer.
+	Flush() error
+}
+
+// CompressorFunc creates a CompressionWriter that writes the compressed data to the writer.
+type CompressorFunc func(io.Writer) (CompressionWriter, error)
+
+// CompressorRegistry is a mapping from content-coding names (e.g. "gzip") to compressors.
+type CompressorRegistry struct {
+	compressors map[string]CompressorFunc
+	// names holds the content-coding names by order of preference.
+	names []string
+}
+
+// NewCompressorRegistry returns a new registry with gzip and deflate compressors.
+func NewCompressorRegistry() CompressorRegistry {
+	registry := CompressorRegistry{compressors: make(map[string]CompressorFunc)}
+
+	_ = registry.Add("gzip", func(w io.Writer) (CompressionWriter, error) {
+		return gzip.NewWriterLevel(w, gzip.DefaultCompression)
+	})
+	_ = registry.Add("deflate", func(w io.Writer) (CompressionWriter, error) {
+		return flate.NewWriter(w, flate.DefaultCompression)
+	})
+
+	return registry
+}
+
+// Add adds a compressor for a case-insensitive content-coding name. Compressors added earlier are preferred when the
+// client accepts multiple content-codings with the same quality.
+func (r *CompressorRegistry) Add(name string, compressor CompressorFunc) error {
+	if len(name) == 0 {
+		return errors.New("empty content-coding name")
+	}
+	if compressor == nil {
+		return errors.New("nil compressor")
+	}
+
+	if r.compressors == nil {
+		r.compressors = make(map[string]CompressorFunc)
+	}
+
+	name = strings.ToLower(name)
+	if _, ok := r.compressors[name]; !ok {
+		r.names = append(r.names, name)
+	}
+	r.compressors[name] = compressor
+
+	return nil
+}
+
+// negotiate selects the content-coding for the Accept-Encoding header values. An empty string means no compression.
+func (r *CompressorRegistry) negotiate(acceptEncoding []string) string {
+	qualities := make(map[string]float64)
+	wildcard := -1.0
+	for _, value := range acceptEncoding {
+		for _, item := range strings.Split(value, ",") {
+			name, quality, ok := parseQualityItem(item)
+			if !ok {
+				continue
+			}
+			if name == "*" {
+				wildcard = quality
+			} else {
+				qualities[name] = quality
+			}
+		}
+	}
+
+	selected, selectedQuality := "", 0.0
+	for _, name := range r.names {
+		quality, ok := qualities[name]
+		if !ok {
+			if wildcard < 0 {
+				continue
+			}
+			quality = wildcard
+		}
+		if quality > selectedQuality {
+			selected, selectedQuality = name, quality
+		}
+	}
+
+	return selected
+}
+
+// parseQualityItem parses a single item of a header with quality values, e.g. "gzip;q=0.5".
+func parseQualityItem(item string) (string, float64, bool) {
+	name, params, _ := strings.Cut(item, ";")
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return "", 0, false
+	}
+
+	quality := 1.0
+	for _, param := range strings.Split(params, ";") {
+		key, value, found := strings.Cut(strings.TrimSpace(param), "=")
+		if !found || strings.ToLower(strings.TrimSpace(key)) != "q" {
+			continue
+		}
+		q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || q < 0 || q > 1 {
+			return "", 0, false
+		}
+		quality = q
+	}
+
+	return name, quality, true
+}
+
+// CompressionConfig configures the response compression.
+type CompressionConfig struct {
+	// Registry holds the available compressors. If empty, gzip and deflate are used.
+	Registry CompressorRegistry
+
+	// MinSize is the minimum size of a response body in bytes for it to get compressed. Responses that get flushed,
+	// such as streams, are compressed regardless of their size. If zero, DefaultCompressionMinSize is used.
+	MinSize int
+}
+
+// DefaultCompressionMinSize is the default minimum size of the response bodies to compress.
+const DefaultCompressionMinSize = 1024
+
+// newCompressionWriter returns a response writer that compresses the response if the client accepts any of the
+// registered content-codings, nil is returned if the response should not be compressed.
+func (c *CompressionConfig) newCompressionWriter(w http.ResponseWriter, req *http.Request) *compressionResponseWriter {
+	if req.Method == http.MethodHead {
+		return nil
+	}
+
+	acceptEncoding := req.Header.Values("Accept-Encoding")
+	w.Header().Add("Vary", "Accept-Encoding")
+	if len(acceptEncoding) == 0 {
+		return nil
+	}
+
+	encoding := c.Registry.negotiate(acceptEncoding)
+	if encoding == "" {
+		return nil
+	}
+
+	return &compressionResponseWriter{
+		ResponseWriter: w,
+		encoding:       encoding,
+		compressor:     c.Registry.compressors[encoding],
+		minSize:        c.MinSize,
+	}
+}
+
+// compressionResponseWriter buffers the response until it reaches the minimum size or gets flushed, then decides
+// whether or not to compress it.
+type compressionResponseWriter struct {
+	http.ResponseWriter
+
+	encoding   string
+	compressor CompressorFunc
+	minSize    int
+
+	status   int
+	buffer   []byte
+	decided  bool
+	hijacked bool
+	writer   CompressionWriter
+}
+
+func (w *compressionResponseWriter) WriteHeader(statusCode int) {
+	// informational responses are passed through.
+	if w.decided || statusCode < http.StatusOK {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	if w.status == 0 {
+		w.status = statusCode
+	}
+}
+
+func (w *compressionResponseWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		w.buffer = append(w.buffer, data...)
+		if len(w.buffer) < w.minSize {
+			return len(data), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+
+	if w.writer != nil {
+		return w.writer.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// decide writes the header and the buffered data, compressing them if compress is true and the response can be
+// compressed.
+func (w *compressionResponseWriter) decide(compress bool) error {
+	w.decided = true
+
+	header := w.Header()
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	if compress && header.Get("Content-Encoding") == "" &&
+		status != http.StatusNoContent && status != http.StatusNotModified {
+
+		writer, err := w.compressor(w.ResponseWriter)
+		if err != nil {
+			grpclog.Infof("Failed to create %s compressor: %v", w.encoding, err)
+		} else {
+			w.writer = writer
+			header.Set("Content-Encoding", w.encoding)
+			header.Del("Content-Length")
+		}
+	}
+
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+
+	buffer := w.buffer
+	w.buffer = nil
+	if len(buffer) == 0 {
+		return nil
+	}
+
+	var err error
+	if w.writer != nil {
+		_, err = w.writer.Write(buffer)
+	} else {
+		_, err = w.ResponseWriter.Write(buffer)
+	}
+	return err
+}
+
+func (w *compressionResponseWriter) Flush() {
+	if !w.decided {
+		if err := w.decide(true); err != nil {
+			grpclog.Infof("Failed to write response: %v", err)
+		}
+	}
+	if w.writer != nil {
+		if err := w.writer.Flush(); err != nil {
+			grpclog.Infof("Failed to flush compressed response: %v", err)
+		}
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *compressionResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking is not supported by the underlying response writer")
+	}
+	w.hijacked = true
+	return hijacker.Hijack()
+}
+
+// Unwrap returns the underlying response writer, used by http.ResponseController.
+func (w *compressionResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Close writes any buffered data and completes the compressed stream.
+func (w *compressionResponseWriter) Close() {
+	if w.hijacked {
+		return
+	}
+	if !w.decided {
+		// the response is smaller than the minimum size.
+		if err := w.decide(false); err != nil {
+			grpclog.Infof("Failed to write response: %v", err)
+		}
+	}
+	if w.writer != nil {
+		if err := w.writer.Close(); err != nil {
+			grpclog.Infof("Failed to complete compressed response: %v", err)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package gateway_test
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/meshapi/grpc-api-gateway/gateway"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func newCompressionTestMux() *gateway.ServeMux {
+	mux := gateway.NewServeMux(gateway.WithCompression(gateway.CompressionConfig{MinSize: 64}))
+	mux.HandleWithParams(http.MethodGet, "/v1/items/:size", func(w http.ResponseWriter, r *http.Request, p gateway.Params) {
+		ctx := gateway.NewServerMetadataContext(r.Context(), gateway.ServerMetadata{})
+		size := 0
+		if p.ByName("size") == "large" {
+			size = 256
+		}
+		_, outbound := mux.MarshalerForRequest(r)
+		mux.ForwardResponseMessage(ctx, outbound, w, r, wrapperspb.String(strings.Repeat("a", size)))
+	})
+	mux.HandleWithParams(http.MethodGet, "/v1/stream", func(w http.ResponseWriter, r *http.Request, _ gateway.Params) {
+		ctx := gateway.NewServerMetadataContext(r.Context(), gateway.ServerMetadata{})
+		_, outbound := mux.MarshalerForRequest(r)
+		count := 0
+		mux.ForwardResponseStreamChunked(ctx, outbound, w, r, func() (proto.Message, error) {
+			if count == 3 {
+				return nil, io.EOF
+			}
+			count++
+			return wrapperspb.String("chunk"), nil
+		})
+	})
+	return mux
+}
+
+func TestCompressionNegotiation(t *testing.T) {
+	mux := newCompressionTestMux()
+
+	testCases := []struct {
+		Name           string
+		Path           string
+		AcceptEncoding string
+		Expected       string
+	}{
+		{Name: "Gzip", Path: "/v1/items/large", AcceptEncoding: "gzip", Expected: "gzip"},
+		{Name: "Preference", Path: "/v1/items/large", AcceptEncoding: "deflate, gzip", Expected: "gzip"},
+		{Name: "Quality", Path: "/v1/items/large", AcceptEncoding: "gzip;q=0.5, deflate", Expected: "deflate"},
+		{Name: "Excluded", Path: "/v1/items/large", AcceptEncoding: "gzip;q=0, deflate;q=0", Expected: ""},
+		{Name: "Wildcard", Path: "/v1/items/large", AcceptEncoding: "*", Expected: "gzip"},
+		{Name: "WildcardExclusion", Path: "/v1/items/large", AcceptEncoding: "gzip;q=0, *", Expected: "deflate"},
+		{Name: "Unknown", Path: "/v1/items/large", AcceptEncoding: "br", Expected: ""},
+		{Name: "Missing", Path: "/v1/items/large", Expected: ""},
+		{Name: "Small", Path: "/v1/items/small", AcceptEncoding: "gzip", Expected: ""},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.Path, nil)
+			if tt.AcceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.AcceptEncoding)
+			}
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, req)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, recorder.Code)
+			}
+			if got := recorder.Header().Get("Content-Encoding"); got != tt.Expected {
+				t.Fatalf("expected content encoding %q, got %q", tt.Expected, got)
+			}
+			if got := recorder.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Fatalf("expected Vary header to be set, got %q", got)
+			}
+
+			body := recorder.Body.String()
+			if tt.Expected == "gzip" {
+				reader, err := gzip.NewReader(recorder.Body)
+				if err != nil {
+					t.Fatalf("failed to read gzip response: %s", err)
+				}
+				data, err := io.ReadAll(reader)
+				if err != nil {
+					t.Fatalf("failed to decompress response: %s", err)
+				}
+				body = string(data)
+			}
+			if tt.Expected == "" && !strings.HasPrefix(body, `"`) {
+				t.Fatalf("unexpected response body: %q", body)
+			}
+		})
+	}
+}
+
+func TestCompressionStream(t *testing.T) {
+	server := httptest.NewServer(newCompressionTestMux())
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/v1/stream", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %s", err)
+	}
+	// setting the header explicitly disables transparent decompression in the client.
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to send request: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if got := resp.Header.Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("expected gzip content encoding for the stream, got %q", got)
+	}
+
+	reader, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read gzip response: %s", err)
+	}
+	scanner := bufio.NewScanner(reader)
+	var chunks []string
+	for scanner.Scan() {
+		chunks = append(chunks, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("failed to decompress stream: %s", err)
+	}
+	if len(chunks) != 3 || chunks[0] != `"chunk"` {
+		t.Fatalf("unexpected stream chunks: %q", chunks)
+	}
+}
@@ -0,0 +1,543 @@
+package gateway
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	connectStreamingContentTypePrefix = "application/connect+"
+	connectErrorContentType           = "application/json"
+
+	connectProtocolVersionHeader = "Connect-Protocol-Version"
+	connectTimeoutHeader         = "Connect-Timeout-Ms"
+
+	// Connect envelope flags.
+	connectFlagCompressed = 0x01
+	connectFlagEndStream  = 0x02
+
+	connectEnvelopeHeaderSize = 5
+)
+
+// ConnectConfig configures the Connect protocol support of the ServeMux.
+type ConnectConfig struct {
+	// Conn is the connection used to forward the Connect requests, which is usually the same connection that is used
+	// to register the generated handlers.
+	Conn grpc.ClientConnInterface
+
+	// ServiceConns maps the full names of the gRPC services, e.g. "package.Service", to the connections that are used
+	// instead of Conn for the methods of those services.
+	ServiceConns map[string]grpc.ClientConnInterface
+
+	// HeaderMatcher maps the request headers to the outgoing gRPC metadata. If nil, DefaultConnectHeaderMatcher is
+	// used.
+	HeaderMatcher HeaderMatcherFunc
+
+	// Services lists the full names of the gRPC services whose methods are served even if they do not have any routes
+	// registered on the ServeMux, e.g. "package.Service". The methods are found in Files.
+	Services []string
+
+	// Files is used to find the method descriptors, which are needed to transcode the JSON messages and to find the
+	// methods of Services. If nil, protoregistry.GlobalFiles is used.
+	Files *protoregistry.Files
+}
+
+// DefaultConnectHeaderMatcher forwards the request headers as gRPC metadata, except for the headers of the Connect
+// protocol and the headers that are not forwarded by DefaultGRPCWebHeaderMatcher.
+func DefaultConnectHeaderMatcher(key string) (string, bool) {
+	key = textproto.CanonicalMIMEHeaderKey(key)
+	if strings.HasPrefix(key, "Connect-") || key == "Content-Encoding" {
+		return "", false
+	}
+	return DefaultGRPCWebHeaderMatcher(key)
+}
+
+// isConnectRequest returns whether or not the request uses the Connect protocol. Unary requests are only treated as
+// Connect requests if their path is a gRPC method, and the ones that do not have the Connect-Protocol-Version header
+// only if no route handles them.
+func (s *ServeMux) isConnectRequest(r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	if strings.HasPrefix(mediaType, connectStreamingContentTypePrefix) {
+		return true
+	}
+	if mediaType != "application/json" && mediaType != "application/proto" {
+		return false
+	}
+	if _, ok := s.lookupConnectMethod(r.URL.Path); !ok {
+		return false
+	}
+	if r.Header.Get(connectProtocolVersionHeader) != "" {
+		return true
+	}
+	handle, _, _ := s.lookupRoute(http.MethodPost, r.URL.Path)
+	return handle == nil
+}
+
+// lookupConnectMethod returns the streaming mode of the gRPC method of a Connect request path.
+func (s *ServeMux) lookupConnectMethod(rpcMethod string) (StreamingMode, bool) {
+	if s.connect == nil {
+		return 0, false
+	}
+	return s.lookupPassthroughMethod(rpcMethod, s.connect.Services, s.connect.Files)
+}
+
+// serveConnect forwards a Connect request to the gRPC method of the request path.
+//
+// See: https://connectrpc.com/docs/protocol
+func (s *ServeMux) serveConnect(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	streaming := strings.HasPrefix(mediaType, connectStreamingContentTypePrefix)
+
+	codecName := strings.TrimPrefix(mediaType, "application/")
+	if streaming {
+		codecName = strings.TrimPrefix(mediaType, connectStreamingContentTypePrefix)
+	}
+	if codecName != "json" && codecName != "proto" {
+		if !streaming {
+			w.Header().Set("Accept-Post", "application/json, application/proto")
+		}
+		http.Error(w, "unsupported Connect codec: "+codecName, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	rpcMethod := r.URL.Path
+	mode, ok := s.lookupConnectMethod(rpcMethod)
+	if !ok {
+		s.recordError(r, ErrRoutingNotFound)
+		response := &connectResponse{writer: w, streaming: streaming, contentType: mediaType}
+		response.finish(s, nil, nil, status.Newf(codes.Unimplemented, "unknown method %s", rpcMethod), nil)
+		return
+	}
+
+	// the middlewares apply to the Connect requests the same way they apply to the routes of the gRPC method.
+	info := RouteInfo{HTTPMethod: http.MethodPost, Path: rpcMethod, RPCMethod: rpcMethod, StreamingMode: mode}
+	s.wrapHandler(info, func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		response := &connectResponse{writer: w, streaming: streaming, contentType: mediaType}
+		s.forwardConnectRequest(response, r, info, codecName == "json")
+	})(w, r, nil)
+}
+
+func (s *ServeMux) forwardConnectRequest(response *connectResponse, r *http.Request, info RouteInfo, useJSON bool) {
+	fail := func(err error) {
+		s.recordError(r, err)
+		response.finish(s, nil, nil, status.Convert(err), nil)
+	}
+
+	if response.streaming != (info.StreamingMode != StreamingModeUnary) {
+		fail(status.Errorf(codes.Unimplemented, "method %s is %s", info.RPCMethod, info.StreamingMode))
+		return
+	}
+
+	var codec connectCodec = connectProtoCodec{}
+	if useJSON {
+		jsonCodec, err := s.connectJSONCodec(info)
+		if err != nil {
+			fail(err)
+			return
+		}
+		codec = jsonCodec
+	}
+
+	messages, err := s.readConnectRequest(r, info, response.streaming)
+	if err != nil {
+		fail(err)
+		return
+	}
+	for index, message := range messages {
+		if messages[index], err = codec.toProto(message); err != nil {
+			fail(status.Errorf(codes.InvalidArgument, "invalid request message: %s", err))
+			return
+		}
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	if value := r.Header.Get(connectTimeoutHeader); value != "" {
+		timeout, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || timeout < 0 {
+			fail(status.Errorf(codes.InvalidArgument, "invalid %s header: %q", connectTimeoutHeader, value))
+			return
+		}
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Millisecond)
+		defer cancel()
+	}
+
+	headerMatcher := s.connect.HeaderMatcher
+	if headerMatcher == nil {
+		headerMatcher = DefaultConnectHeaderMatcher
+	}
+	ctx, md, err := annotateContextWithMatcher(ctx, s, headerMatcher, r, info.RPCMethod)
+	if err != nil {
+		fail(err)
+		return
+	}
+	if md != nil {
+		ctx = metadata.NewOutgoingContext(ctx, md)
+	}
+
+	var result []byte
+	conn := connForService(s.connect.Conn, s.connect.ServiceConns, info.Service())
+	header, trailer, st := forwardPassthrough(ctx, conn, info, messages, func(header metadata.MD, message []byte) error {
+		data, err := codec.fromProto(message)
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to encode the response message: %s", err)
+		}
+		if !response.streaming {
+			result = data
+			return nil
+		}
+
+		if !response.wroteHeader {
+			response.startStream(s, header)
+		}
+		if err := response.writeEnvelope(0, data); err != nil {
+			grpclog.Infof("Failed to send Connect message: %v", err)
+			return err
+		}
+		if flusher, ok := response.writer.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if st.Code() != codes.OK {
+		s.recordError(r, st.Err())
+	}
+
+	response.finish(s, header, trailer, st, result)
+}
+
+// readConnectRequest reads the messages of the request body, which is a single message in unary requests and a
+// sequence of envelopes in streaming requests.
+func (s *ServeMux) readConnectRequest(r *http.Request, info RouteInfo, streaming bool) ([][]byte, error) {
+	var body io.ReadCloser = r.Body
+	if encodings := r.Header.Values("Content-Encoding"); !streaming && len(encodings) > 0 {
+		if s.decompressors == nil {
+			return nil, status.Error(codes.Unimplemented, "compressed Connect messages are not supported")
+		}
+		decompressed, err := s.decompressRequestBody(body, encodings)
+		if err != nil {
+			return nil, err
+		}
+		body = decompressed
+	}
+	if limit := s.requestBodyLimitFor(info); limit > 0 {
+		body = &limitedRequestBody{ReadCloser: body, limit: limit, remaining: limit}
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if !streaming {
+		return [][]byte{data}, nil
+	}
+
+	var messages [][]byte
+	for len(data) > 0 {
+		if len(data) < connectEnvelopeHeaderSize {
+			return nil, status.Error(codes.InvalidArgument, "incomplete Connect envelope")
+		}
+		flag, length := data[0], binary.BigEndian.Uint32(data[1:connectEnvelopeHeaderSize])
+		data = data[connectEnvelopeHeaderSize:]
+		if uint64(length) > uint64(len(data)) {
+			return nil, status.Error(codes.InvalidArgument, "incomplete Connect envelope")
+		}
+		if flag&connectFlagCompressed != 0 {
+			return nil, status.Error(codes.Unimplemented, "compressed Connect messages are not supported")
+		}
+		if flag&connectFlagEndStream == 0 {
+			messages = append(messages, data[:length])
+		}
+		data = data[length:]
+	}
+
+	clientStreams := info.StreamingMode == StreamingModeClient || info.StreamingMode == StreamingModeBidirectional
+	if !clientStreams && len(messages) != 1 {
+		return nil, status.Errorf(codes.InvalidArgument, "expected a single request message, got %d", len(messages))
+	}
+
+	return messages, nil
+}
+
+// connectCodec converts the Connect messages to and from the protobuf wire format.
+type connectCodec interface {
+	toProto(data []byte) ([]byte, error)
+	fromProto(data []byte) ([]byte, error)
+}
+
+type connectProtoCodec struct{}
+
+func (connectProtoCodec) toProto(data []byte) ([]byte, error)   { return data, nil }
+func (connectProtoCodec) fromProto(data []byte) ([]byte, error) { return data, nil }
+
+// connectJSONCodec transcodes the JSON messages using the message types of the gRPC method.
+type connectJSONCodec struct {
+	input  protoreflect.MessageType
+	output protoreflect.MessageType
+}
+
+func (c connectJSONCodec) toProto(data []byte) ([]byte, error) {
+	msg := c.input.New().Interface()
+	if len(data) > 0 {
+		if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(data, msg); err != nil {
+			return nil, err
+		}
+	}
+	return proto.Marshal(msg)
+}
+
+func (c connectJSONCodec) fromProto(data []byte) ([]byte, error) {
+	msg := c.output.New().Interface()
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+	return protojson.Marshal(msg)
+}
+
+// connectJSONCodec returns the JSON codec of the gRPC method of the route.
+func (s *ServeMux) connectJSONCodec(info RouteInfo) (connectJSONCodec, error) {
+	files := s.connect.Files
+	if files == nil {
+		files = protoregistry.GlobalFiles
+	}
+
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(info.Service() + "." + info.Method()))
+	if err != nil {
+		return connectJSONCodec{}, status.Errorf(codes.Unimplemented, "method %s is not found: %s", info.RPCMethod, err)
+	}
+	method, ok := desc.(protoreflect.MethodDescriptor)
+	if !ok {
+		return connectJSONCodec{}, status.Errorf(codes.Unimplemented, "%s is not a method", info.RPCMethod)
+	}
+
+	return connectJSONCodec{input: messageTypeOf(method.Input()), output: messageTypeOf(method.Output())}, nil
+}
+
+// messageTypeOf returns the registered type of the message, falling back to a dynamic message type.
+func messageTypeOf(desc protoreflect.MessageDescriptor) protoreflect.MessageType {
+	if messageType, err := protoregistry.GlobalTypes.FindMessageByName(desc.FullName()); err == nil {
+		return messageType
+	}
+	return dynamicpb.NewMessageType(desc)
+}
+
+// connectResponse writes the response of a Connect request.
+type connectResponse struct {
+	writer      http.ResponseWriter
+	streaming   bool
+	contentType string
+	wroteHeader bool
+}
+
+// writeHeader writes the gRPC headers as HTTP headers. Unary responses carry the trailers as HTTP headers with the
+// Trailer- prefix.
+func (c *connectResponse) writeHeader(s *ServeMux, header, trailer metadata.MD) {
+	c.wroteHeader = true
+	writeMetadata := func(prefix string, md metadata.MD) {
+		for key, values := range md {
+			if key == "content-type" || strings.HasPrefix(key, ":") || strings.HasPrefix(key, "grpc-") {
+				continue
+			}
+			for _, value := range values {
+				c.writer.Header().Add(prefix+key, encodeGRPCWebMetadataValue(key, value))
+			}
+			if s.cors != nil {
+				s.cors.exposeMetadataHeader(c.writer, prefix+key)
+			}
+		}
+	}
+	writeMetadata("", header)
+	writeMetadata("Trailer-", trailer)
+}
+
+// startStream writes the gRPC headers and the status of a streaming response.
+func (c *connectResponse) startStream(s *ServeMux, header metadata.MD) {
+	c.writeHeader(s, header, nil)
+	c.writer.Header().Set("Content-Type", c.contentType)
+	c.writer.WriteHeader(http.StatusOK)
+}
+
+// writeEnvelope writes a length-prefixed envelope of a streaming response.
+func (c *connectResponse) writeEnvelope(flag byte, data []byte) error {
+	envelope := make([]byte, connectEnvelopeHeaderSize, connectEnvelopeHeaderSize+len(data))
+	envelope[0] = flag
+	binary.BigEndian.PutUint32(envelope[1:], uint32(len(data)))
+	envelope = append(envelope, data...)
+
+	_, err := c.writer.Write(envelope)
+	return err
+}
+
+// finish writes the end of the response. Unary responses carry either the response message or the error, streaming
+// responses end with the end-of-stream envelope that has the error and the trailers.
+func (c *connectResponse) finish(s *ServeMux, header, trailer metadata.MD, st *status.Status, result []byte) {
+	if c.streaming {
+		if !c.wroteHeader {
+			c.startStream(s, header)
+		}
+		endStream := connectEndStream{Error: newConnectError(st)}
+		if len(trailer) > 0 {
+			endStream.Metadata = make(map[string][]string, len(trailer))
+			for key, values := range trailer {
+				for _, value := range values {
+					endStream.Metadata[key] = append(endStream.Metadata[key], encodeGRPCWebMetadataValue(key, value))
+				}
+			}
+		}
+		data, err := json.Marshal(endStream)
+		if err == nil {
+			err = c.writeEnvelope(connectFlagEndStream, data)
+		}
+		if err != nil {
+			grpclog.Infof("Failed to send Connect end of stream: %v", err)
+		}
+		return
+	}
+
+	c.writeHeader(s, header, trailer)
+	if st.Code() != codes.OK {
+		data, err := json.Marshal(newConnectError(st))
+		if err != nil {
+			data = []byte(`{"code":"internal"}`)
+		}
+		c.writer.Header().Set("Content-Type", connectErrorContentType)
+		c.writer.WriteHeader(connectHTTPStatus(st.Code()))
+		result = data
+	} else {
+		c.writer.Header().Set("Content-Type", c.contentType)
+		c.writer.WriteHeader(http.StatusOK)
+	}
+	if _, err := c.writer.Write(result); err != nil {
+		grpclog.Infof("Failed to send Connect response: %v", err)
+	}
+}
+
+// connectEndStream is the message of the end-of-stream envelope.
+type connectEndStream struct {
+	Error    *connectError       `json:"error,omitempty"`
+	Metadata map[string][]string `json:"metadata,omitempty"`
+}
+
+// connectError is the JSON representation of the errors in the Connect protocol.
+type connectError struct {
+	Code    string               `json:"code"`
+	Message string               `json:"message,omitempty"`
+	Details []connectErrorDetail `json:"details,omitempty"`
+}
+
+type connectErrorDetail struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// newConnectError returns the Connect error of the status, or nil if the status is OK.
+func newConnectError(st *status.Status) *connectError {
+	if st.Code() == codes.OK {
+		return nil
+	}
+
+	result := &connectError{Code: connectCodeName(st.Code()), Message: st.Message()}
+	for _, detail := range st.Proto().GetDetails() {
+		result.Details = append(result.Details, connectErrorDetail{
+			Type:  string(detail.MessageName()),
+			Value: base64.RawStdEncoding.EncodeToString(detail.GetValue()),
+		})
+	}
+	return result
+}
+
+// connectCodeName returns the name of the code in the Connect protocol.
+func connectCodeName(code codes.Code) string {
+	switch code {
+	case codes.Canceled:
+		return "canceled"
+	case codes.Unknown:
+		return "unknown"
+	case codes.InvalidArgument:
+		return "invalid_argument"
+	case codes.DeadlineExceeded:
+		return "deadline_exceeded"
+	case codes.NotFound:
+		return "not_found"
+	case codes.AlreadyExists:
+		return "already_exists"
+	case codes.PermissionDenied:
+		return "permission_denied"
+	case codes.ResourceExhausted:
+		return "resource_exhausted"
+	case codes.FailedPrecondition:
+		return "failed_precondition"
+	case codes.Aborted:
+		return "aborted"
+	case codes.OutOfRange:
+		return "out_of_range"
+	case codes.Unimplemented:
+		return "unimplemented"
+	case codes.Internal:
+		return "internal"
+	case codes.Unavailable:
+		return "unavailable"
+	case codes.DataLoss:
+		return "data_loss"
+	case codes.Unauthenticated:
+		return "unauthenticated"
+	}
+	return fmt.Sprintf("code_%d", code)
+}
+
+// connectHTTPStatus returns the HTTP status of the unary error responses in the Connect protocol.
+func connectHTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,253 @@
+package gateway_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/meshapi/grpc-api-gateway/gateway"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// passthroughTestFiles returns the descriptors of the test service, which are needed to transcode the JSON messages.
+func passthroughTestFiles(t *testing.T) *protoregistry.Files {
+	t.Helper()
+
+	fileProto := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("test/echo.proto"),
+		Package:    proto.String("test"),
+		Dependency: []string{"google/protobuf/wrappers.proto"},
+		Syntax:     proto.String("proto3"),
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Echo"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				{
+					Name:       proto.String("Echo"),
+					InputType:  proto.String(".google.protobuf.StringValue"),
+					OutputType: proto.String(".google.protobuf.StringValue"),
+				},
+				{
+					Name:            proto.String("Repeat"),
+					InputType:       proto.String(".google.protobuf.StringValue"),
+					OutputType:      proto.String(".google.protobuf.StringValue"),
+					ServerStreaming: proto.Bool(true),
+				},
+			},
+		}},
+	}
+
+	file, err := protodesc.NewFile(fileProto, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatalf("failed to build the file descriptor: %s", err)
+	}
+	files := &protoregistry.Files{}
+	if err := files.RegisterFile(file); err != nil {
+		t.Fatalf("failed to register the file descriptor: %s", err)
+	}
+	return files
+}
+
+func newConnectTestMux(t *testing.T) *gateway.ServeMux {
+	t.Helper()
+
+	mux := gateway.NewServeMux(gateway.WithConnect(gateway.ConnectConfig{
+		Conn:  dialPassthroughTestService(t),
+		Files: passthroughTestFiles(t),
+	}))
+	registerPassthroughTestRoutes(mux)
+	return mux
+}
+
+func TestConnectUnary(t *testing.T) {
+	mux := newConnectTestMux(t)
+
+	protoBody, err := proto.Marshal(wrapperspb.String("hi"))
+	if err != nil {
+		t.Fatalf("failed to marshal message: %s", err)
+	}
+	protoResponse, err := proto.Marshal(wrapperspb.String("echo: hi"))
+	if err != nil {
+		t.Fatalf("failed to marshal message: %s", err)
+	}
+
+	testCases := []struct {
+		Name                string
+		Path                string
+		ContentType         string
+		ProtocolHeader      bool
+		Body                []byte
+		ExpectedStatus      int
+		ExpectedContentType string
+		ExpectedBody        string
+	}{
+		{Name: "JSON", Path: "/test.Echo/Echo", ContentType: "application/json", ProtocolHeader: true,
+			Body: []byte(`"hi"`), ExpectedStatus: http.StatusOK, ExpectedContentType: "application/json",
+			ExpectedBody: `"echo: hi"`},
+		{Name: "WithoutProtocolHeader", Path: "/test.Echo/Echo", ContentType: "application/json; charset=utf-8",
+			Body: []byte(`"hi"`), ExpectedStatus: http.StatusOK, ExpectedContentType: "application/json",
+			ExpectedBody: `"echo: hi"`},
+		{Name: "Proto", Path: "/test.Echo/Echo", ContentType: "application/proto", ProtocolHeader: true,
+			Body: protoBody, ExpectedStatus: http.StatusOK, ExpectedContentType: "application/proto",
+			ExpectedBody: string(protoResponse)},
+		{Name: "Error", Path: "/test.Echo/Echo", ContentType: "application/json", ProtocolHeader: true,
+			Body: []byte(`"fail"`), ExpectedStatus: http.StatusBadRequest, ExpectedContentType: "application/json",
+			ExpectedBody: `{"code":"invalid_argument","message":"invalid value: 100%"}`},
+		{Name: "InvalidMessage", Path: "/test.Echo/Echo", ContentType: "application/json", ProtocolHeader: true,
+			Body: []byte(`{`), ExpectedStatus: http.StatusBadRequest, ExpectedContentType: "application/json"},
+		{Name: "UnknownMethod", Path: "/test.Echo/Unknown", ContentType: "application/json", ProtocolHeader: true,
+			Body: []byte(`"hi"`), ExpectedStatus: http.StatusNotFound, ExpectedContentType: "application/json"},
+		{Name: "StreamingMethod", Path: "/test.Echo/Repeat", ContentType: "application/json", ProtocolHeader: true,
+			Body: []byte(`"hi"`), ExpectedStatus: http.StatusNotImplemented, ExpectedContentType: "application/json",
+			ExpectedBody: `{"code":"unimplemented","message":"method /test.Echo/Repeat is server_streaming"}`},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.Path, bytes.NewReader(tt.Body))
+			req.Header.Set("Content-Type", tt.ContentType)
+			req.Header.Set("X-User", "alice")
+			if tt.ProtocolHeader {
+				req.Header.Set("Connect-Protocol-Version", "1")
+			}
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.ExpectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.ExpectedStatus, recorder.Code, recorder.Body.String())
+			}
+			if got := recorder.Header().Get("Content-Type"); got != tt.ExpectedContentType {
+				t.Errorf("expected content type %q, got %q", tt.ExpectedContentType, got)
+			}
+			if tt.ExpectedBody != "" && recorder.Body.String() != tt.ExpectedBody {
+				t.Errorf("expected body %q, got %q", tt.ExpectedBody, recorder.Body.String())
+			}
+
+			if tt.Path == "/test.Echo/Echo" && tt.Name != "InvalidMessage" {
+				if got := recorder.Header().Get("X-User"); got != "alice" {
+					t.Errorf("expected x-user header %q, got %q", "alice", got)
+				}
+				if got := recorder.Header().Get("Trailer-X-Trailer"); got != "done" {
+					t.Errorf("expected trailer-x-trailer header %q, got %q", "done", got)
+				}
+			}
+		})
+	}
+}
+
+func TestConnectMethodResolution(t *testing.T) {
+	mux := gateway.NewServeMux(gateway.WithConnect(gateway.ConnectConfig{
+		Conn:     dialPassthroughTestService(t),
+		Services: []string{"test.Echo"},
+		Files:    passthroughTestFiles(t),
+	}))
+	mux.HandleWithParams(http.MethodPost, "/v1/items", func(w http.ResponseWriter, _ *http.Request, _ gateway.Params) {
+		_, _ = w.Write([]byte("rest"))
+	})
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader([]byte(`"hi"`)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Connect-Protocol-Version", "1")
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	// the methods of the services of the config are served without any routes.
+	if recorder := serve("/test.Echo/Echo"); recorder.Code != http.StatusOK || recorder.Body.String() != `"echo: hi"` {
+		t.Errorf("expected the method to be served, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	// the REST routes are not treated as Connect requests even with the Connect-Protocol-Version header.
+	if recorder := serve("/v1/items"); recorder.Code != http.StatusOK || recorder.Body.String() != "rest" {
+		t.Errorf("expected the route to be served, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestConnectStreaming(t *testing.T) {
+	mux := newConnectTestMux(t)
+
+	for _, codec := range []string{"json", "proto"} {
+		t.Run(codec, func(t *testing.T) {
+			var data []byte
+			if codec == "json" {
+				data = []byte(`"a"`)
+			} else {
+				data, _ = proto.Marshal(wrapperspb.String("a"))
+			}
+			envelope := []byte{0, 0, 0, 0, 0}
+			binary.BigEndian.PutUint32(envelope[1:], uint32(len(data)))
+
+			req := httptest.NewRequest(http.MethodPost, "/test.Echo/Repeat", bytes.NewReader(append(envelope, data...)))
+			req.Header.Set("Content-Type", "application/connect+"+codec)
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, req)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", recorder.Code, recorder.Body.String())
+			}
+			if got := recorder.Header().Get("Content-Type"); got != "application/connect+"+codec {
+				t.Errorf("expected content type %q, got %q", "application/connect+"+codec, got)
+			}
+
+			body := recorder.Body.Bytes()
+			var messages [][]byte
+			var endStream []byte
+			for len(body) > 0 {
+				flag, length := body[0], binary.BigEndian.Uint32(body[1:5])
+				if flag&0x02 != 0 {
+					endStream = body[5 : 5+length]
+				} else {
+					messages = append(messages, body[5:5+length])
+				}
+				body = body[5+length:]
+			}
+
+			if len(messages) != 3 {
+				t.Fatalf("expected 3 messages, got %d", len(messages))
+			}
+			for _, message := range messages {
+				if !bytes.Equal(message, data) {
+					t.Errorf("expected message %q, got %q", data, message)
+				}
+			}
+			if string(endStream) != "{}" {
+				t.Errorf("expected an empty end of stream message, got %q", endStream)
+			}
+		})
+	}
+}
+
+func TestConnectStreamingError(t *testing.T) {
+	mux := newConnectTestMux(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/test.Echo/Echo", bytes.NewReader(nil))
+	req.Header.Set("Content-Type", "application/connect+json")
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+
+	body, _ := io.ReadAll(recorder.Body)
+	if len(body) < 5 || body[0] != 0x02 {
+		t.Fatalf("expected an end of stream envelope, got %q", body)
+	}
+
+	var endStream struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body[5:], &endStream); err != nil {
+		t.Fatalf("failed to unmarshal end of stream message: %s", err)
+	}
+	if endStream.Error.Code != "unimplemented" {
+		t.Errorf("expected error code %q, got %q", "unimplemented", endStream.Error.Code)
+	}
+}
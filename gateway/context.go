@@ -51,8 +51,9 @@ var malformedHTTPHeaders = map[string]struct{}{
 }
 
 type (
-	rpcMethodKey       struct{}
-	httpPathPatternKey struct{}
+	rpcMethodKey        struct{}
+	httpPathPatternKey  struct{}
+	statusCodeMapperKey struct{}
 
 	AnnotateContextOption func(ctx context.Context) context.Context
 )
@@ -137,10 +138,24 @@ func isValidGRPCMetadataTextValue(textValue string) bool {
 }
 
 func annotateContext(ctx context.Context, mux *ServeMux, req *http.Request, rpcMethodName string, options ...AnnotateContextOption) (context.Context, metadata.MD, error) {
+	return annotateContextWithMatcher(ctx, mux, mux.incomingHeaderMatcher, req, rpcMethodName, options...)
+}
+
+func annotateContextWithMatcher(
+	ctx context.Context,
+	mux *ServeMux,
+	headerMatcher HeaderMatcherFunc,
+	req *http.Request,
+	rpcMethodName string,
+	options ...AnnotateContextOption) (context.Context, metadata.MD, error) {
 	ctx = withRPCMethod(ctx, rpcMethodName)
 	for _, o := range options {
 		ctx = o(ctx)
 	}
+	if state := requestStateFromRequest(req); state != nil {
+		state.rpcMethod = rpcMethodName
+		state.httpPathPattern, _ = HTTPPathPattern(ctx)
+	}
 	timeout := DefaultContextTimeout
 	if tm := req.Header.Get(metadataGrpcTimeout); tm != "" {
 		var err error
@@ -150,14 +165,21 @@ func annotateContext(ctx context.Context, mux *ServeMux, req *http.Request, rpcM
 		}
 	}
 	var pairs []string
+	if mux.tracer != nil {
+		ctx, pairs = mux.startSpan(ctx, req, rpcMethodName)
+	}
 	for key, vals := range req.Header {
 		key = textproto.CanonicalMIMEHeaderKey(key)
+		// trace context headers are replaced by the gateway span.
+		if mux.tracer != nil && isTraceContextHeader(key) {
+			continue
+		}
 		for _, val := range vals {
 			// For backwards-compatibility, pass through 'authorization' header with no prefix.
 			if key == "Authorization" {
 				pairs = append(pairs, "authorization", val)
 			}
-			if h, ok := mux.incomingHeaderMatcher(key); ok {
+			if h, ok := headerMatcher(key); ok {
 				if !isValidGRPCMetadataKey(h) {
 					grpclog.Errorf("HTTP header name %q is not valid as gRPC metadata key; skipping", h)
 					continue
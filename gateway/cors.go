@@ -0,0 +1,290 @@
+package gateway
+
+import (
+	"net/http"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSPolicy describes the Cross-Origin Resource Sharing (CORS) policy enforced by the ServeMux.
+//
+// See: https://fetch.spec.whatwg.org/#http-cors-protocol
+type CORSPolicy struct {
+	// AllowedOrigins is the list of origins that may access the resources.
+	//
+	// Each value can be an exact origin such as "https://example.com", a wildcard subdomain such as
+	// "https://*.example.com" or "*" to allow all origins.
+	AllowedOrigins []string
+
+	// AllowedOriginPatterns is the list of regular expressions matched against the request origin.
+	AllowedOriginPatterns []*regexp.Regexp
+
+	// AllowedMethods is the list of methods allowed in preflight requests. If empty, the methods registered for the
+	// requested path are used.
+	AllowedMethods []string
+
+	// AllowedHeaders is the list of request headers allowed in preflight requests. A value that ends with "*" matches
+	// all headers with that prefix (e.g. "Grpc-Metadata-*") and "*" alone allows all headers.
+	//
+	// CORS-safelisted request headers are always allowed.
+	AllowedHeaders []string
+
+	// ExposedHeaders is the list of response headers the client is allowed to access.
+	ExposedHeaders []string
+
+	// ExposeMetadataHeaders exposes the headers produced from gRPC header and trailer metadata by the outgoing header
+	// matcher, in addition to ExposedHeaders.
+	ExposeMetadataHeaders bool
+
+	// AllowCredentials indicates whether or not the response can be shared when the request credentials mode is
+	// "include". When enabled, a wildcard origin is answered with the request origin instead of "*".
+	AllowCredentials bool
+
+	// MaxAge is the duration the results of a preflight request can be cached. Zero omits the header.
+	MaxAge time.Duration
+}
+
+const (
+	corsAllowOriginHeader      = "Access-Control-Allow-Origin"
+	corsAllowCredentialsHeader = "Access-Control-Allow-Credentials"
+	corsAllowMethodsHeader     = "Access-Control-Allow-Methods"
+	corsAllowHeadersHeader     = "Access-Control-Allow-Headers"
+	corsExposeHeadersHeader    = "Access-Control-Expose-Headers"
+	corsMaxAgeHeader           = "Access-Control-Max-Age"
+	corsRequestMethodHeader    = "Access-Control-Request-Method"
+	corsRequestHeadersHeader   = "Access-Control-Request-Headers"
+)
+
+// corsSafelistedHeaders are the request headers that never need to be allowed explicitly.
+var corsSafelistedHeaders = map[string]struct{}{
+	"Accept":           {},
+	"Accept-Language":  {},
+	"Content-Language": {},
+	"Content-Type":     {},
+}
+
+// corsHandler is the compiled form of a CORSPolicy.
+type corsHandler struct {
+	policy CORSPolicy
+
+	allowAllOrigins bool
+	exactOrigins    map[string]struct{}
+	wildcardOrigins [][2]string
+
+	allowAllHeaders bool
+	exactHeaders    map[string]struct{}
+	headerPrefixes  []string
+
+	allowedMethods string
+	exposedHeaders string
+}
+
+func newCORSHandler(policy CORSPolicy) *corsHandler {
+	handler := &corsHandler{
+		policy:       policy,
+		exactOrigins: make(map[string]struct{}),
+		exactHeaders: make(map[string]struct{}),
+	}
+
+	for _, origin := range policy.AllowedOrigins {
+		switch index := strings.IndexByte(origin, '*'); {
+		case origin == "*":
+			handler.allowAllOrigins = true
+		case index >= 0:
+			handler.wildcardOrigins = append(handler.wildcardOrigins, [2]string{
+				strings.ToLower(origin[:index]), strings.ToLower(origin[index+1:])})
+		default:
+			handler.exactOrigins[strings.ToLower(origin)] = struct{}{}
+		}
+	}
+
+	for _, header := range policy.AllowedHeaders {
+		switch {
+		case header == "*":
+			handler.allowAllHeaders = true
+		case strings.HasSuffix(header, "*"):
+			handler.headerPrefixes = append(handler.headerPrefixes, textproto.CanonicalMIMEHeaderKey(header[:len(header)-1]))
+		default:
+			handler.exactHeaders[textproto.CanonicalMIMEHeaderKey(header)] = struct{}{}
+		}
+	}
+
+	methods := make([]string, len(policy.AllowedMethods))
+	for index, method := range policy.AllowedMethods {
+		methods[index] = strings.ToUpper(method)
+	}
+	handler.allowedMethods = strings.Join(methods, ", ")
+
+	exposed := make([]string, len(policy.ExposedHeaders))
+	for index, header := range policy.ExposedHeaders {
+		exposed[index] = textproto.CanonicalMIMEHeaderKey(header)
+	}
+	handler.exposedHeaders = strings.Join(exposed, ", ")
+
+	return handler
+}
+
+// isOriginAllowed reports whether or not the origin matches the policy.
+func (c *corsHandler) isOriginAllowed(origin string) bool {
+	if c.allowAllOrigins {
+		return true
+	}
+
+	lowerOrigin := strings.ToLower(origin)
+	if _, ok := c.exactOrigins[lowerOrigin]; ok {
+		return true
+	}
+
+	for _, wildcard := range c.wildcardOrigins {
+		if len(lowerOrigin) > len(wildcard[0])+len(wildcard[1]) &&
+			strings.HasPrefix(lowerOrigin, wildcard[0]) && strings.HasSuffix(lowerOrigin, wildcard[1]) {
+			return true
+		}
+	}
+
+	for _, pattern := range c.policy.AllowedOriginPatterns {
+		if pattern.MatchString(origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isHeaderAllowed reports whether or not a canonical header name is allowed in requests.
+func (c *corsHandler) isHeaderAllowed(header string) bool {
+	if c.allowAllHeaders {
+		return true
+	}
+	if _, ok := corsSafelistedHeaders[header]; ok {
+		return true
+	}
+	if _, ok := c.exactHeaders[header]; ok {
+		return true
+	}
+	for _, prefix := range c.headerPrefixes {
+		if strings.HasPrefix(header, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeOriginHeaders sets the headers shared between preflight and actual requests.
+func (c *corsHandler) writeOriginHeaders(header http.Header, origin string) {
+	header.Add("Vary", "Origin")
+	if c.allowAllOrigins && !c.policy.AllowCredentials {
+		header.Set(corsAllowOriginHeader, "*")
+	} else {
+		header.Set(corsAllowOriginHeader, origin)
+	}
+	if c.policy.AllowCredentials {
+		header.Set(corsAllowCredentialsHeader, "true")
+	}
+}
+
+// handleRequest applies the policy to an actual (non-preflight) request. It returns false if the origin is not
+// allowed.
+func (c *corsHandler) handleRequest(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	if !c.isOriginAllowed(origin) {
+		w.Header().Add("Vary", "Origin")
+		return false
+	}
+
+	c.writeOriginHeaders(w.Header(), origin)
+	if c.exposedHeaders != "" {
+		w.Header().Set(corsExposeHeadersHeader, c.exposedHeaders)
+	}
+
+	return true
+}
+
+// handlePreflight responds to a preflight request. It returns false if the request is not a preflight request.
+//
+// NOTE: this gets called after httprouter has set the "Allow" header for the requested path.
+func (c *corsHandler) handlePreflight(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	requestMethod := r.Header.Get(corsRequestMethodHeader)
+	if origin == "" || requestMethod == "" {
+		return false
+	}
+
+	header := w.Header()
+	header.Add("Vary", "Origin")
+	header.Add("Vary", corsRequestMethodHeader)
+	header.Add("Vary", corsRequestHeadersHeader)
+
+	if !c.isOriginAllowed(origin) {
+		w.WriteHeader(http.StatusForbidden)
+		return true
+	}
+
+	allowedMethods := c.allowedMethods
+	if allowedMethods == "" {
+		allowedMethods = header.Get("Allow")
+	}
+	if !containsToken(allowedMethods, strings.ToUpper(requestMethod)) {
+		w.WriteHeader(http.StatusForbidden)
+		return true
+	}
+
+	requestedHeaders := make([]string, 0)
+	for _, value := range r.Header.Values(corsRequestHeadersHeader) {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			name = textproto.CanonicalMIMEHeaderKey(name)
+			if !c.isHeaderAllowed(name) {
+				w.WriteHeader(http.StatusForbidden)
+				return true
+			}
+			requestedHeaders = append(requestedHeaders, name)
+		}
+	}
+
+	c.writeOriginHeaders(header, origin)
+	header.Set(corsAllowMethodsHeader, allowedMethods)
+	if len(requestedHeaders) > 0 {
+		header.Set(corsAllowHeadersHeader, strings.Join(requestedHeaders, ", "))
+	}
+	if c.policy.MaxAge > 0 {
+		header.Set(corsMaxAgeHeader, strconv.Itoa(int(c.policy.MaxAge/time.Second)))
+	}
+	w.WriteHeader(http.StatusNoContent)
+
+	return true
+}
+
+// exposeMetadataHeader adds a header produced from gRPC metadata to the exposed headers if the response is a CORS
+// response.
+func (c *corsHandler) exposeMetadataHeader(w http.ResponseWriter, key string) {
+	if !c.policy.ExposeMetadataHeaders || w.Header().Get(corsAllowOriginHeader) == "" {
+		return
+	}
+
+	key = textproto.CanonicalMIMEHeaderKey(key)
+	if exposed := w.Header().Get(corsExposeHeadersHeader); exposed == "" {
+		w.Header().Set(corsExposeHeadersHeader, key)
+	} else if !containsToken(exposed, key) {
+		w.Header().Set(corsExposeHeadersHeader, exposed+", "+key)
+	}
+}
+
+// containsToken reports whether or not a comma-separated list contains the value.
+func containsToken(list, value string) bool {
+	for _, token := range strings.Split(list, ",") {
+		if strings.TrimSpace(token) == value {
+			return true
+		}
+	}
+	return false
+}
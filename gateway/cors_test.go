@@ -0,0 +1,151 @@
+package gateway_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/meshapi/grpc-api-gateway/gateway"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func newCORSTestMux(policy gateway.CORSPolicy) *gateway.ServeMux {
+	mux := gateway.NewServeMux(gateway.WithCORS(policy))
+	mux.HandleWithParams(http.MethodGet, "/v1/items", func(w http.ResponseWriter, r *http.Request, _ gateway.Params) {
+		ctx := gateway.NewServerMetadataContext(r.Context(), gateway.ServerMetadata{
+			HeaderMD: metadata.Pairs("request-id", "42"),
+		})
+		_, outbound := mux.MarshalerForRequest(r)
+		mux.ForwardResponseMessage(ctx, outbound, w, r, &emptypb.Empty{})
+	})
+	mux.HandleWithParams(http.MethodPost, "/v1/items", func(w http.ResponseWriter, r *http.Request, _ gateway.Params) {
+		_, outbound := mux.MarshalerForRequest(r)
+		mux.HTTPError(context.Background(), outbound, w, r, gateway.ErrRoutingNotFound)
+	})
+	return mux
+}
+
+func TestCORSOrigins(t *testing.T) {
+	mux := newCORSTestMux(gateway.CORSPolicy{
+		AllowedOrigins:        []string{"https://example.com", "https://*.meshapi.dev"},
+		AllowedOriginPatterns: []*regexp.Regexp{regexp.MustCompile(`^http://localhost:\d+$`)},
+	})
+
+	testCases := []struct {
+		Origin  string
+		Allowed bool
+	}{
+		{Origin: "https://example.com", Allowed: true},
+		{Origin: "https://EXAMPLE.com", Allowed: true},
+		{Origin: "https://api.meshapi.dev", Allowed: true},
+		{Origin: "https://meshapi.dev", Allowed: false},
+		{Origin: "http://localhost:8080", Allowed: true},
+		{Origin: "http://localhost", Allowed: false},
+		{Origin: "https://evil.com", Allowed: false},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.Origin, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/items", nil)
+			req.Header.Set("Origin", tt.Origin)
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, req)
+
+			allowOrigin := recorder.Header().Get("Access-Control-Allow-Origin")
+			if tt.Allowed && allowOrigin != tt.Origin {
+				t.Fatalf("expected allowed origin %q, got %q", tt.Origin, allowOrigin)
+			}
+			if !tt.Allowed && allowOrigin != "" {
+				t.Fatalf("expected no allowed origin, got %q", allowOrigin)
+			}
+		})
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	mux := newCORSTestMux(gateway.CORSPolicy{
+		AllowedOrigins:   []string{"*"},
+		AllowedHeaders:   []string{"Authorization", "Grpc-Metadata-*"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})
+
+	req := httptest.NewRequest(http.MethodOptions, "/v1/items", nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "content-type, grpc-metadata-tenant, authorization")
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d", http.StatusNoContent, recorder.Code)
+	}
+
+	expectedHeaders := map[string]string{
+		"Access-Control-Allow-Origin":      "https://example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Headers":     "Content-Type, Grpc-Metadata-Tenant, Authorization",
+		"Access-Control-Max-Age":           "600",
+	}
+	for key, value := range expectedHeaders {
+		if got := recorder.Header().Get(key); got != value {
+			t.Errorf("header %q: expected %q, got %q", key, value, got)
+		}
+	}
+	if methods := recorder.Header().Get("Access-Control-Allow-Methods"); methods == "" {
+		t.Errorf("expected allowed methods to be set")
+	}
+
+	req.Header.Set("Access-Control-Request-Headers", "X-Unknown")
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("expected status %d for disallowed header, got %d", http.StatusForbidden, recorder.Code)
+	}
+
+	req.Header.Set("Access-Control-Request-Headers", "")
+	req.Header.Set("Access-Control-Request-Method", "DELETE")
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("expected status %d for disallowed method, got %d", http.StatusForbidden, recorder.Code)
+	}
+}
+
+func TestCORSExposedHeaders(t *testing.T) {
+	mux := newCORSTestMux(gateway.CORSPolicy{
+		AllowedOrigins:        []string{"*"},
+		ExposedHeaders:        []string{"x-total-count"},
+		ExposeMetadataHeaders: true,
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/items", nil)
+	req.Header.Set("Origin", "https://example.com")
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+
+	if got := recorder.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Fatalf("expected wildcard origin, got %q", got)
+	}
+	expected := "X-Total-Count, Grpc-Metadata-Request-Id"
+	if got := recorder.Header().Get("Access-Control-Expose-Headers"); got != expected {
+		t.Fatalf("expected exposed headers %q, got %q", expected, got)
+	}
+
+	// error responses must carry the CORS headers too.
+	req = httptest.NewRequest(http.MethodPost, "/v1/items", nil)
+	req.Header.Set("Origin", "https://example.com")
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, recorder.Code)
+	}
+	if got := recorder.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Fatalf("expected wildcard origin on error response, got %q", got)
+	}
+}
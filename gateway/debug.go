@@ -0,0 +1,119 @@
+package gateway
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"google.golang.org/grpc/grpclog"
+)
+
+// routeDescription is the JSON representation of a route in the routes debug endpoint.
+type routeDescription struct {
+	HTTPMethod      string   `json:"http_method"`
+	Path            string   `json:"path"`
+	HTTPPathPattern string   `json:"http_path_pattern,omitempty"`
+	RPCMethod       string   `json:"rpc_method,omitempty"`
+	StreamingMode   string   `json:"streaming_mode,omitempty"`
+	RequestBody     string   `json:"request_body,omitempty"`
+	ResponseBody    string   `json:"response_body,omitempty"`
+	StreamModes     []string `json:"stream_modes,omitempty"`
+}
+
+func describeRoute(info RouteInfo) routeDescription {
+	description := routeDescription{
+		HTTPMethod:      info.HTTPMethod,
+		Path:            info.Path,
+		HTTPPathPattern: info.HTTPPathPattern,
+		RPCMethod:       info.RPCMethod,
+		RequestBody:     info.RequestBody,
+		ResponseBody:    info.ResponseBody,
+	}
+	if info.RPCMethod != "" {
+		description.StreamingMode = info.StreamingMode.String()
+	}
+	if info.SupportsChunkedTransfer {
+		description.StreamModes = append(description.StreamModes, "chunked")
+	}
+	if info.SupportsSSE {
+		description.StreamModes = append(description.StreamModes, "sse")
+	}
+	if info.SupportsWebsocket {
+		description.StreamModes = append(description.StreamModes, "websocket")
+	}
+	return description
+}
+
+var routesTemplate = template.Must(template.New("routes").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Routes</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+td { font-family: monospace; }
+</style>
+</head>
+<body>
+<table>
+<tr><th>Method</th><th>Path</th><th>gRPC Method</th><th>Mode</th><th>Body</th><th>Response Body</th><th>Streams</th></tr>
+{{- range .}}
+<tr><td>{{.HTTPMethod}}</td><td>{{if .HTTPPathPattern}}{{.HTTPPathPattern}}{{else}}{{.Path}}{{end}}</td>` +
+	`<td>{{.RPCMethod}}</td><td>{{.StreamingMode}}</td><td>{{.RequestBody}}</td><td>{{.ResponseBody}}</td>` +
+	`<td>{{range $i, $mode := .StreamModes}}{{if $i}}, {{end}}{{$mode}}{{end}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// RoutesHandler returns an http.Handler that renders the routes of the ServeMux, see Routes.
+//
+// The routes are rendered as an HTML table if the request accepts "text/html" and as JSON otherwise, the "format"
+// query parameter can be set to "html" or "json" to choose the format explicitly. The handler is meant for debugging
+// and exposes the internals of the gateway, it should not be served publicly.
+func (s *ServeMux) RoutesHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		routes := s.Routes()
+		descriptions := make([]routeDescription, 0, len(routes))
+		for _, route := range routes {
+			descriptions = append(descriptions, describeRoute(route))
+		}
+
+		format := r.URL.Query().Get("format")
+		if format == "" && strings.Contains(r.Header.Get("Accept"), "text/html") {
+			format = "html"
+		}
+
+		if format == "html" {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			if err := routesTemplate.Execute(w, descriptions); err != nil {
+				grpclog.Errorf("Failed to render routes: %v", err)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]any{"routes": descriptions}); err != nil {
+			grpclog.Errorf("Failed to render routes: %v", err)
+		}
+	})
+}
+
+// WithRoutesEndpointAt returns a ServeMuxOption that serves the routes of the ServeMux at endpointPath, see
+// RoutesHandler.
+//
+// The endpoint itself is not included in the routes.
+func WithRoutesEndpointAt(endpointPath string) ServeMuxOption {
+	return optionFunc(func(s *ServeMux) {
+		handler := s.RoutesHandler()
+		handle := func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			handler.ServeHTTP(w, r)
+		}
+		s.handleEndpoint(http.MethodGet, endpointPath, handle)
+	})
+}
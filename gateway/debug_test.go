@@ -0,0 +1,113 @@
+package gateway_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/meshapi/grpc-api-gateway/gateway"
+)
+
+func newRoutesTestMux() *gateway.ServeMux {
+	mux := gateway.NewServeMux(gateway.WithRoutesEndpointAt("/debug/routes"))
+	handler := func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {}
+
+	mux.HandleWithParams(http.MethodPost, "/v1/users", handler, gateway.WithRouteInfo(gateway.RouteInfo{
+		RPCMethod:       "/example.Users/Create",
+		HTTPPathPattern: "/v1/users",
+		RequestBody:     "user",
+		ResponseBody:    "id",
+	}))
+	mux.HandleWithParams(http.MethodGet, "/v1/users/:id/events", handler, gateway.WithRouteInfo(gateway.RouteInfo{
+		RPCMethod:               "/example.Users/Watch",
+		HTTPPathPattern:         "/v1/users/{id}/events",
+		StreamingMode:           gateway.StreamingModeServer,
+		SupportsChunkedTransfer: true,
+		SupportsSSE:             true,
+		SupportsWebsocket:       true,
+	}))
+	mux.Handle(http.MethodGet, "/status", http.NotFoundHandler())
+	return mux
+}
+
+func TestRoutes(t *testing.T) {
+	routes := newRoutesTestMux().Routes()
+
+	var paths []string
+	for _, route := range routes {
+		paths = append(paths, route.HTTPMethod+" "+route.Path)
+	}
+	expected := "GET /status, POST /v1/users, GET /v1/users/:id/events"
+	if strings.Join(paths, ", ") != expected {
+		t.Fatalf("expected routes %q, got %q", expected, strings.Join(paths, ", "))
+	}
+
+	if routes[1].RPCMethod != "/example.Users/Create" || routes[1].RequestBody != "user" ||
+		routes[1].ResponseBody != "id" {
+		t.Errorf("unexpected route info: %+v", routes[1])
+	}
+	if !routes[2].SupportsSSE || routes[2].StreamingMode != gateway.StreamingModeServer {
+		t.Errorf("unexpected route info: %+v", routes[2])
+	}
+}
+
+func TestRoutesHandler(t *testing.T) {
+	mux := newRoutesTestMux()
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/routes", nil)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected response %d (%s): %s", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+
+	var result struct {
+		Routes []map[string]any `json:"routes"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("failed to unmarshal routes: %s", err)
+	}
+	if len(result.Routes) != 3 {
+		t.Fatalf("expected 3 routes, got %d: %s", len(result.Routes), rec.Body.String())
+	}
+
+	watch, err := json.Marshal(result.Routes[2])
+	if err != nil {
+		t.Fatalf("failed to marshal route: %s", err)
+	}
+	expected := `{"http_method":"GET","http_path_pattern":"/v1/users/{id}/events","path":"/v1/users/:id/events",` +
+		`"rpc_method":"/example.Users/Watch","stream_modes":["chunked","sse","websocket"],` +
+		`"streaming_mode":"server_streaming"}`
+	if string(watch) != expected {
+		t.Errorf("expected route:\n%s\ngot:\n%s", expected, watch)
+	}
+	if _, ok := result.Routes[0]["streaming_mode"]; ok {
+		t.Errorf("expected no streaming mode for a route without a gRPC method: %v", result.Routes[0])
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/debug/routes", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("expected HTML response, got %s", rec.Header().Get("Content-Type"))
+	}
+	for _, fragment := range []string{"<td>/v1/users/{id}/events</td>", "<td>chunked, sse, websocket</td>", "<td>user</td>"} {
+		if !strings.Contains(rec.Body.String(), fragment) {
+			t.Errorf("expected %q in the HTML output:\n%s", fragment, rec.Body.String())
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/debug/routes?format=json", nil)
+	req.Header.Set("Accept", "text/html")
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("expected the format parameter to choose JSON, got %s", rec.Header().Get("Content-Type"))
+	}
+}
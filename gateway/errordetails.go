@@ -0,0 +1,121 @@
+package gateway
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// ErrorDetailHandlerFunc translates a google.rpc error detail of a gRPC status into HTTP semantics.
+//
+// The handler can set response headers and returns the HTTP status code of the response, which is httpStatus if
+// the detail does not affect the status code.
+type ErrorDetailHandlerFunc func(header http.Header, st *status.Status, detail proto.Message, httpStatus int) int
+
+// DefaultErrorDetailHandlers returns the error detail handlers that the ServeMux uses by default, keyed by the full
+// name of the detail message:
+//
+//   - google.rpc.RetryInfo: sets the Retry-After header.
+//   - google.rpc.QuotaFailure: uses 429 status code and sets the RateLimit-Remaining header, and RateLimit-Reset
+//     header if the status also has a RetryInfo detail.
+//   - google.rpc.PreconditionFailure: uses 412 status code.
+//   - google.rpc.Help: adds a Link header with the "help" relation for each link.
+func DefaultErrorDetailHandlers() map[protoreflect.FullName]ErrorDetailHandlerFunc {
+	return map[protoreflect.FullName]ErrorDetailHandlerFunc{
+		proto.MessageName(&errdetails.RetryInfo{}):           RetryInfoDetailHandler,
+		proto.MessageName(&errdetails.QuotaFailure{}):        QuotaFailureDetailHandler,
+		proto.MessageName(&errdetails.PreconditionFailure{}): PreconditionFailureDetailHandler,
+		proto.MessageName(&errdetails.Help{}):                HelpDetailHandler,
+	}
+}
+
+// RetryInfoDetailHandler sets the Retry-After header using the retry delay of a google.rpc.RetryInfo detail.
+func RetryInfoDetailHandler(header http.Header, _ *status.Status, detail proto.Message, httpStatus int) int {
+	if seconds, ok := retryDelaySeconds(detail); ok {
+		header.Set("Retry-After", strconv.FormatInt(seconds, 10))
+	}
+	return httpStatus
+}
+
+// QuotaFailureDetailHandler responds with 429 status code for google.rpc.QuotaFailure details and sets the
+// RateLimit-Remaining header. If the status also has a google.rpc.RetryInfo detail, the RateLimit-Reset header is
+// set as well.
+func QuotaFailureDetailHandler(header http.Header, st *status.Status, _ proto.Message, _ int) int {
+	header.Set("RateLimit-Remaining", "0")
+	for _, detail := range st.Details() {
+		if retryInfo, ok := detail.(*errdetails.RetryInfo); ok {
+			if seconds, ok := retryDelaySeconds(retryInfo); ok {
+				header.Set("RateLimit-Reset", strconv.FormatInt(seconds, 10))
+			}
+			break
+		}
+	}
+	return http.StatusTooManyRequests
+}
+
+// PreconditionFailureDetailHandler responds with 412 status code for google.rpc.PreconditionFailure details.
+func PreconditionFailureDetailHandler(_ http.Header, _ *status.Status, _ proto.Message, _ int) int {
+	return http.StatusPreconditionFailed
+}
+
+// HelpDetailHandler adds a Link header with the "help" relation for each link of a google.rpc.Help detail.
+func HelpDetailHandler(header http.Header, _ *status.Status, detail proto.Message, httpStatus int) int {
+	help, ok := detail.(*errdetails.Help)
+	if !ok {
+		return httpStatus
+	}
+
+	for _, link := range help.GetLinks() {
+		if link.GetUrl() == "" {
+			continue
+		}
+		value := "<" + link.GetUrl() + `>; rel="help"`
+		if link.GetDescription() != "" {
+			value += `; title="` + quoteEscaper.Replace(link.GetDescription()) + `"`
+		}
+		header.Add("Link", value)
+	}
+
+	return httpStatus
+}
+
+var quoteEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// retryDelaySeconds returns the retry delay of a google.rpc.RetryInfo detail rounded up to whole seconds.
+func retryDelaySeconds(detail proto.Message) (int64, bool) {
+	retryInfo, ok := detail.(*errdetails.RetryInfo)
+	if !ok || retryInfo.GetRetryDelay() == nil {
+		return 0, false
+	}
+	delay := retryInfo.GetRetryDelay().AsDuration()
+	if delay < 0 {
+		return 0, false
+	}
+	return int64(math.Ceil(delay.Seconds())), true
+}
+
+// applyErrorDetails runs the error detail handlers for the details of the status and returns the HTTP status code of
+// the response.
+func (s *ServeMux) applyErrorDetails(header http.Header, st *status.Status, httpStatus int) int {
+	if len(s.errorDetailHandlers) == 0 {
+		return httpStatus
+	}
+
+	for _, detail := range st.Details() {
+		message, ok := detail.(proto.Message)
+		if !ok {
+			continue
+		}
+		if handler, ok := s.errorDetailHandlers[proto.MessageName(message)]; ok {
+			httpStatus = handler(header, st, message, httpStatus)
+		}
+	}
+
+	return httpStatus
+}
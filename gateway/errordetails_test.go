@@ -0,0 +1,116 @@
+package gateway_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/meshapi/grpc-api-gateway/gateway"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func serveStatusError(
+	t *testing.T, mux *gateway.ServeMux, code codes.Code, details ...protoadapt.MessageV1) *httptest.ResponseRecorder {
+	t.Helper()
+
+	st, err := status.New(code, "failure").WithDetails(details...)
+	if err != nil {
+		t.Fatalf("failed to create status: %s", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/items", nil)
+	recorder := httptest.NewRecorder()
+	_, outbound := mux.MarshalerForRequest(req)
+	mux.HTTPError(req.Context(), outbound, recorder, req, st.Err())
+	return recorder
+}
+
+func TestErrorDetailHandlers(t *testing.T) {
+	mux := gateway.NewServeMux()
+
+	t.Run("RetryInfo", func(t *testing.T) {
+		recorder := serveStatusError(t, mux, codes.Unavailable,
+			&errdetails.RetryInfo{RetryDelay: durationpb.New(1500 * time.Millisecond)})
+		if recorder.Code != http.StatusServiceUnavailable {
+			t.Fatalf("expected status %d, got %d", http.StatusServiceUnavailable, recorder.Code)
+		}
+		if got := recorder.Header().Get("Retry-After"); got != "2" {
+			t.Fatalf("expected Retry-After %q, got %q", "2", got)
+		}
+	})
+
+	t.Run("QuotaFailure", func(t *testing.T) {
+		recorder := serveStatusError(t, mux, codes.ResourceExhausted,
+			&errdetails.QuotaFailure{Violations: []*errdetails.QuotaFailure_Violation{{Subject: "user:1"}}},
+			&errdetails.RetryInfo{RetryDelay: durationpb.New(30 * time.Second)})
+		if recorder.Code != http.StatusTooManyRequests {
+			t.Fatalf("expected status %d, got %d", http.StatusTooManyRequests, recorder.Code)
+		}
+		expectedHeaders := map[string]string{
+			"Retry-After":         "30",
+			"RateLimit-Remaining": "0",
+			"RateLimit-Reset":     "30",
+		}
+		for key, value := range expectedHeaders {
+			if got := recorder.Header().Get(key); got != value {
+				t.Errorf("header %q: expected %q, got %q", key, value, got)
+			}
+		}
+	})
+
+	t.Run("PreconditionFailure", func(t *testing.T) {
+		recorder := serveStatusError(t, mux, codes.FailedPrecondition,
+			&errdetails.PreconditionFailure{Violations: []*errdetails.PreconditionFailure_Violation{{Type: "ETAG"}}})
+		if recorder.Code != http.StatusPreconditionFailed {
+			t.Fatalf("expected status %d, got %d", http.StatusPreconditionFailed, recorder.Code)
+		}
+	})
+
+	t.Run("Help", func(t *testing.T) {
+		recorder := serveStatusError(t, mux, codes.InvalidArgument, &errdetails.Help{Links: []*errdetails.Help_Link{
+			{Url: "https://example.com/docs", Description: `the "docs"`},
+			{Url: "https://example.com/faq"},
+		}})
+		if recorder.Code != http.StatusBadRequest {
+			t.Fatalf("expected status %d, got %d", http.StatusBadRequest, recorder.Code)
+		}
+		links := recorder.Header().Values("Link")
+		expected := []string{
+			`<https://example.com/docs>; rel="help"; title="the \"docs\""`,
+			`<https://example.com/faq>; rel="help"`,
+		}
+		if len(links) != len(expected) || links[0] != expected[0] || links[1] != expected[1] {
+			t.Fatalf("expected links %q, got %q", expected, links)
+		}
+	})
+}
+
+func TestWithErrorDetailHandler(t *testing.T) {
+	mux := gateway.NewServeMux(
+		gateway.WithErrorDetailHandler(proto.MessageName(&errdetails.PreconditionFailure{}), nil),
+		gateway.WithErrorDetailHandler(proto.MessageName(&errdetails.ResourceInfo{}),
+			func(header http.Header, _ *status.Status, detail proto.Message, httpStatus int) int {
+				header.Set("X-Resource-Type", detail.(*errdetails.ResourceInfo).GetResourceType())
+				return http.StatusGone
+			}),
+	)
+
+	recorder := serveStatusError(t, mux, codes.FailedPrecondition, &errdetails.PreconditionFailure{})
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d for removed handler, got %d", http.StatusBadRequest, recorder.Code)
+	}
+
+	recorder = serveStatusError(t, mux, codes.NotFound, &errdetails.ResourceInfo{ResourceType: "item"})
+	if recorder.Code != http.StatusGone {
+		t.Fatalf("expected status %d, got %d", http.StatusGone, recorder.Code)
+	}
+	if got := recorder.Header().Get("X-Resource-Type"); got != "item" {
+		t.Fatalf("expected resource type header, got %q", got)
+	}
+}
@@ -7,10 +7,12 @@ import (
 	"io"
 	"net/http"
 
+	"github.com/meshapi/grpc-api-gateway/protomarshal"
 	"github.com/meshapi/grpc-api-gateway/websocket"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/grpclog"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protodelim"
 )
 
 type (
@@ -77,6 +79,9 @@ const (
 	ErrRoutingMethodNotAllowed ErrRouting = iota
 	// ErrRoutingNotFound is for routes that are not handled by the serve mux.
 	ErrRoutingNotFound
+	// ErrRoutingNotAcceptable is for requests that do not accept any of the registered marshalers when the strict
+	// content negotiation is enabled.
+	ErrRoutingNotAcceptable
 )
 
 func (r ErrRouting) Error() string {
@@ -85,6 +90,8 @@ func (r ErrRouting) Error() string {
 		return "Method Not Allowed"
 	case ErrRoutingNotFound:
 		return "Not Found"
+	case ErrRoutingNotAcceptable:
+		return "Not Acceptable"
 	default:
 		return "Internal Server Error"
 	}
@@ -96,6 +103,8 @@ func (r ErrRouting) GRPCStatus() *status.Status {
 		return status.New(codes.Unimplemented, "Method Not Allowed")
 	case ErrRoutingNotFound:
 		return status.New(codes.NotFound, "Not Found")
+	case ErrRoutingNotAcceptable:
+		return status.New(codes.InvalidArgument, "Not Acceptable")
 	default:
 		return status.New(codes.Internal, "Internal Server Error")
 	}
@@ -105,7 +114,19 @@ func (e ErrMarshal) Error() string {
 	return e.Err.Error()
 }
 
+func (e ErrMarshal) Unwrap() error {
+	return e.Err
+}
+
 func (e ErrMarshal) GRPCStatus() *status.Status {
+	var tooLarge ErrRequestBodyTooLarge
+	if errors.As(e.Err, &tooLarge) {
+		return tooLarge.GRPCStatus()
+	}
+	if isPayloadTooLarge(e.Err) {
+		return status.New(codes.ResourceExhausted, e.Error())
+	}
+
 	if e.Inbound {
 		return status.New(codes.InvalidArgument, e.Error())
 	}
@@ -241,20 +262,77 @@ func HTTPStatusFromCode(code codes.Code) int {
 	}
 }
 
+// HTTPStatus returns the HTTP status code for the gRPC code, using the status code mappings of the ServeMux for the
+// gRPC method in the context and falling back to HTTPStatusFromCode.
+//
+// See WithStatusCodeMapping and WithMethodStatusCodeMapping.
+func (s *ServeMux) HTTPStatus(ctx context.Context, code codes.Code) int {
+	if httpStatus, ok := s.mappedHTTPStatus(ctx, code); ok {
+		return httpStatus
+	}
+	return HTTPStatusFromCode(code)
+}
+
+// mappedHTTPStatus returns the HTTP status code from the status code mappings, if one is configured for the code.
+func (s *ServeMux) mappedHTTPStatus(ctx context.Context, code codes.Code) (int, bool) {
+	if len(s.methodStatusCodeMappings) > 0 {
+		if method, ok := RPCMethod(ctx); ok {
+			if httpStatus, ok := s.methodStatusCodeMappings[method][code]; ok {
+				return httpStatus, true
+			}
+		}
+	}
+	httpStatus, ok := s.statusCodeMapping[code]
+	return httpStatus, ok
+}
+
+// errorContext returns the context to pass to the error handlers, which carries the status code mappings when they
+// are configured.
+func (s *ServeMux) errorContext(ctx context.Context) context.Context {
+	if len(s.statusCodeMapping) == 0 && len(s.methodStatusCodeMappings) == 0 &&
+		s.websocketConfig.CloseCodeFunc == nil && !s.websocketConfig.SendStatusFrame && !s.websocketConfig.Envelope {
+		return ctx
+	}
+	return context.WithValue(ctx, statusCodeMapperKey{}, s)
+}
+
+// HTTPStatusFromContext returns the HTTP status code for the gRPC code using the status code mappings of the ServeMux
+// that invoked the error handler, falling back to HTTPStatusFromCode. This can be used in stream, SSE and websocket
+// error handlers, which do not have access to the ServeMux.
+func HTTPStatusFromContext(ctx context.Context, code codes.Code) int {
+	if mux, ok := ctx.Value(statusCodeMapperKey{}).(*ServeMux); ok {
+		return mux.HTTPStatus(ctx, code)
+	}
+	return HTTPStatusFromCode(code)
+}
+
 // HTTPError uses the mux-configured error handler.
 func (s *ServeMux) HTTPError(
 	ctx context.Context, marshaler Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	s.recordError(r, err)
 	s.errorHandler(ctx, s, marshaler, w, r, err)
 }
 
+// RoutingError uses the mux-configured routing error handler.
+func (s *ServeMux) RoutingError(
+	ctx context.Context, marshaler Marshaler, w http.ResponseWriter, r *http.Request, err ErrRouting) {
+	s.recordError(r, err)
+	s.routingErrorHandler(ctx, s, marshaler, w, r, err)
+}
+
 // WebsocketError uses the mux-configured websocket error handler.
 func (s *ServeMux) WebsocketError(
 	ctx context.Context, marshaler Marshaler, r *http.Request, c websocket.Connection, err error) {
-	s.websocketErrorHandler(ctx, marshaler, r, c, err)
+	s.recordError(r, err)
+	s.websocketErrorHandler(s.errorContext(ctx), marshaler, r, c, err)
 }
 
 // DefaultHTTPErrorHandler is the default error handler.
 // If "err" is a gRPC Status, the function replies with the status code mapped by HTTPStatusFromCode.
+// If "err" is or wraps an ErrRequestBodyTooLarge, a protomarshal.ErrPartTooLarge or a protodelim.SizeTooLargeError,
+// the function replies with http.StatusRequestEntityTooLarge.
+// The error details of the status are translated using the error detail handlers of the ServeMux, see
+// WithErrorDetailHandler.
 // If "err" is a HTTPStatusError, the function replies with the status code provide by that struct. This is
 // intended to allow passing through of specific statuses via the function set via WithRoutingErrorHandler
 // for the ServeMux constructor to handle edge cases which the standard mappings in HTTPStatusFromCode
@@ -266,12 +344,7 @@ func DefaultHTTPErrorHandler(ctx context.Context, mux *ServeMux, marshaler Marsh
 	// return Internal when Marshal failed
 	const fallback = `{"code": 13, "message": "failed to marshal error message"}`
 
-	var customStatus HTTPStatusError
-	if errors.As(err, &customStatus) {
-		err = customStatus.Err
-	}
-
-	s := status.Convert(err)
+	s, st := mux.statusForResponse(ctx, w.Header(), err)
 	pb := s.Proto()
 
 	w.Header().Del("Trailer")
@@ -301,6 +374,12 @@ func DefaultHTTPErrorHandler(ctx context.Context, mux *ServeMux, marshaler Marsh
 
 	mux.handleForwardResponseServerMetadata(w, md)
 
+	if !statusAllowsBody(st) {
+		w.Header().Del("Content-Type")
+		w.WriteHeader(st)
+		return
+	}
+
 	// RFC 7230 https://tools.ietf.org/html/rfc7230#section-4.1.2
 	// Unless the request includes a TE header field indicating "trailers"
 	// is acceptable, as described in Section 4.3, a server SHOULD NOT
@@ -313,11 +392,6 @@ func DefaultHTTPErrorHandler(ctx context.Context, mux *ServeMux, marshaler Marsh
 		w.Header().Set("Transfer-Encoding", "chunked")
 	}
 
-	st := HTTPStatusFromCode(s.Code())
-	if customStatus.HTTPStatus >= 100 && customStatus.HTTPStatus < 600 {
-		st = customStatus.HTTPStatus
-	}
-
 	w.WriteHeader(st)
 	if _, err := w.Write(buf); err != nil {
 		grpclog.Infof("Failed to write response: %v", err)
@@ -328,9 +402,58 @@ func DefaultHTTPErrorHandler(ctx context.Context, mux *ServeMux, marshaler Marsh
 	}
 }
 
-func DefaultStreamErrorHandler(_ context.Context, _ *http.Request, err error) (int, any) {
+// statusAllowsBody reports whether or not a response with the HTTP status code can have a body, see RFC 9110.
+func statusAllowsBody(httpStatus int) bool {
+	return httpStatus >= http.StatusOK && httpStatus != http.StatusNoContent && httpStatus != http.StatusNotModified
+}
+
+// statusForError converts the error into a gRPC status and the HTTP status code of the response.
+func statusForError(ctx context.Context, err error) (*status.Status, int) {
+	return resolveErrorStatus(ctx, nil, nil, err)
+}
+
+// statusForResponse converts the error into a gRPC status and the HTTP status code of the response, using the status
+// code mappings and the error detail handlers to set the response headers.
+func (s *ServeMux) statusForResponse(ctx context.Context, header http.Header, err error) (*status.Status, int) {
+	return resolveErrorStatus(ctx, s, header, err)
+}
+
+func resolveErrorStatus(ctx context.Context, mux *ServeMux, header http.Header, err error) (*status.Status, int) {
+	var customStatus HTTPStatusError
+	if errors.As(err, &customStatus) {
+		err = customStatus.Err
+	}
+
+	s := status.Convert(err)
+	var httpStatus int
+	if mux != nil {
+		httpStatus = mux.HTTPStatus(ctx, s.Code())
+	} else {
+		httpStatus = HTTPStatusFromContext(ctx, s.Code())
+	}
+	if isPayloadTooLarge(err) {
+		httpStatus = http.StatusRequestEntityTooLarge
+	}
+	if mux != nil {
+		httpStatus = mux.applyErrorDetails(header, s, httpStatus)
+	}
+	if customStatus.HTTPStatus >= 100 && customStatus.HTTPStatus < 600 {
+		httpStatus = customStatus.HTTPStatus
+	}
+
+	return s, httpStatus
+}
+
+// isPayloadTooLarge returns whether or not the error is caused by a request payload that exceeds a size limit.
+func isPayloadTooLarge(err error) bool {
+	var sizeTooLarge *protodelim.SizeTooLargeError
+	return errors.As(err, &ErrRequestBodyTooLarge{}) || errors.As(err, &protomarshal.ErrPartTooLarge{}) ||
+		errors.As(err, &sizeTooLarge)
+}
+
+func DefaultStreamErrorHandler(ctx context.Context, _ *http.Request, err error) (int, any) {
 	st := status.Convert(err)
-	return HTTPStatusFromCode(st.Code()), st.Proto()
+	return HTTPStatusFromContext(ctx, st.Code()), st.Proto()
 }
 
 func DefaultSSEErrorHandler(_ context.Context, marshaler Marshaler, _ *http.Request, err error) *SSEMessage {
@@ -356,7 +479,11 @@ func DefaultSSEErrorHandler(_ context.Context, marshaler Marshaler, _ *http.Requ
 //	NotFound -> grpc.NotFound
 //	StatusBadRequest -> grpc.InvalidArgument
 //	MethodNotAllowed -> grpc.Unimplemented
+//	NotAcceptable -> grpc.InvalidArgument
 //	Other -> grpc.Internal, method is not expecting to be called for anything else
+//
+// The HTTP status codes configured using WithStatusCodeMapping for these gRPC codes take precedence, except for the
+// not acceptable routing error.
 func DefaultRoutingErrorHandler(
 	ctx context.Context, mux *ServeMux, marshaler Marshaler, w http.ResponseWriter, r *http.Request, err ErrRouting) {
 
@@ -366,21 +493,23 @@ func DefaultRoutingErrorHandler(
 		statusCode = http.StatusMethodNotAllowed
 	case ErrRoutingNotFound:
 		statusCode = http.StatusNotFound
+	case ErrRoutingNotAcceptable:
+		statusCode = http.StatusNotAcceptable
+	}
+	// NB: InvalidArgument is too broad to override the status code of the not acceptable routing error.
+	if err != ErrRoutingNotAcceptable {
+		if httpStatus, ok := mux.mappedHTTPStatus(ctx, status.Code(err)); ok {
+			statusCode = httpStatus
+		}
 	}
 
 	mux.errorHandler(ctx, mux, marshaler, w, r, HTTPStatusError{HTTPStatus: statusCode, Err: err})
 }
 
+// DefaultWebsocketErrorHandler sends the status of the error to the client and closes the connection, see
+// CloseWebsocketWithStatus.
 func DefaultWebsocketErrorHandler(
 	ctx context.Context, marshaler Marshaler, _ *http.Request, connection websocket.Connection, err error) {
 	defer connection.Close()
-	message := status.Convert(err)
-	data, uerr := marshaler.Marshal(message.Proto())
-	if uerr != nil {
-		grpclog.Infof("failed to marshal websocket error: %s", uerr)
-		return
-	}
-	if err := connection.SendMessage(data); err != nil && err != io.EOF {
-		grpclog.Infof("failed to send websocket error: %s", err)
-	}
+	CloseWebsocketWithStatus(ctx, marshaler, connection, status.Convert(err))
 }
@@ -0,0 +1,366 @@
+package gateway
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+const (
+	grpcWebContentType     = "application/grpc-web"
+	grpcWebTextContentType = "application/grpc-web-text"
+
+	// gRPC-Web frame flags.
+	grpcWebFlagCompressed = 0x01
+	grpcWebFlagTrailer    = 0x80
+
+	grpcWebFrameHeaderSize = 5
+)
+
+// GRPCWebConfig configures the gRPC-Web protocol support of the ServeMux.
+type GRPCWebConfig struct {
+	// Conn is the connection used to forward the gRPC-Web requests, which is usually the same connection that is used
+	// to register the generated handlers.
+	Conn grpc.ClientConnInterface
+
+	// ServiceConns maps the full names of the gRPC services, e.g. "package.Service", to the connections that are used
+	// instead of Conn for the methods of those services.
+	ServiceConns map[string]grpc.ClientConnInterface
+
+	// HeaderMatcher maps the request headers to the outgoing gRPC metadata. If nil, DefaultGRPCWebHeaderMatcher is
+	// used.
+	HeaderMatcher HeaderMatcherFunc
+
+	// Services lists the full names of the gRPC services whose methods are served even if they do not have any routes
+	// registered on the ServeMux, e.g. "package.Service". The methods are found in Files.
+	Services []string
+
+	// Files is used to find the methods of Services. If nil, protoregistry.GlobalFiles is used.
+	Files *protoregistry.Files
+}
+
+// DefaultGRPCWebHeaderMatcher forwards the request headers as gRPC metadata, since the gRPC-Web clients send the
+// metadata as plain HTTP headers. The standard HTTP headers except for Authorization, the headers reserved by gRPC
+// and the headers of the gRPC-Web protocol are not forwarded.
+func DefaultGRPCWebHeaderMatcher(key string) (string, bool) {
+	key = textproto.CanonicalMIMEHeaderKey(key)
+	if key == "Authorization" {
+		return "authorization", true
+	}
+	if isPermanentHTTPHeader(key) || isMalformedHTTPHeader(key) || isGRPCWebReservedHeader(key) {
+		return "", false
+	}
+	return strings.ToLower(key), true
+}
+
+func isGRPCWebReservedHeader(key string) bool {
+	switch key {
+	case "Accept-Encoding", "Content-Length", "Keep-Alive", "Proxy-Connection", "Te", "Trailer", "Transfer-Encoding",
+		"Upgrade", "X-Grpc-Web", "X-User-Agent", xForwardedFor, xForwardedHost:
+		return true
+	}
+	return strings.HasPrefix(key, "Grpc-") || strings.HasPrefix(key, "Sec-") ||
+		strings.HasPrefix(key, "Access-Control-")
+}
+
+// isGRPCWebRequest returns whether or not the request uses the gRPC-Web protocol.
+func isGRPCWebRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), grpcWebContentType)
+}
+
+// lookupGRPCWebMethod returns the streaming mode of the gRPC method of a gRPC-Web request path.
+func (s *ServeMux) lookupGRPCWebMethod(rpcMethod string) (StreamingMode, bool) {
+	if s.grpcWeb == nil {
+		return 0, false
+	}
+	return s.lookupPassthroughMethod(rpcMethod, s.grpcWeb.Services, s.grpcWeb.Files)
+}
+
+// serveGRPCWeb forwards a gRPC-Web request to the gRPC method of the request path. The headers of the gRPC response
+// are written as HTTP headers and the trailers are written in the trailer frame of the gRPC-Web response.
+//
+// See: https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-WEB.md
+func (s *ServeMux) serveGRPCWeb(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || r.Method != http.MethodPost {
+		http.Error(w, "invalid gRPC-Web request", http.StatusBadRequest)
+		return
+	}
+
+	var text bool
+	switch mediaType {
+	case grpcWebContentType, grpcWebContentType + "+proto":
+	case grpcWebTextContentType, grpcWebTextContentType + "+proto":
+		text = true
+	default:
+		http.Error(w, "unsupported gRPC-Web content type: "+mediaType, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	contentType := grpcWebContentType + "+proto"
+	if text {
+		contentType = grpcWebTextContentType + "+proto"
+	}
+
+	rpcMethod := r.URL.Path
+	mode, ok := s.lookupGRPCWebMethod(rpcMethod)
+	if !ok {
+		s.recordError(r, ErrRoutingNotFound)
+		w.Header().Set("Content-Type", contentType)
+		response := &grpcWebResponse{writer: w, text: text}
+		response.writeTrailer(nil, status.Newf(codes.Unimplemented, "unknown method %s", rpcMethod))
+		return
+	}
+
+	// the middlewares apply to the gRPC-Web requests the same way they apply to the routes of the gRPC method.
+	info := RouteInfo{HTTPMethod: http.MethodPost, Path: rpcMethod, RPCMethod: rpcMethod, StreamingMode: mode}
+	s.wrapHandler(info, func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		w.Header().Set("Content-Type", contentType)
+		s.forwardGRPCWebRequest(w, r, info, text)
+	})(w, r, nil)
+}
+
+func (s *ServeMux) forwardGRPCWebRequest(w http.ResponseWriter, r *http.Request, info RouteInfo, text bool) {
+	response := &grpcWebResponse{writer: w, text: text}
+	messages, err := s.readGRPCWebRequest(r, info, text)
+	if err != nil {
+		s.recordError(r, err)
+		response.writeTrailer(nil, status.Convert(err))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	headerMatcher := s.grpcWeb.HeaderMatcher
+	if headerMatcher == nil {
+		headerMatcher = DefaultGRPCWebHeaderMatcher
+	}
+	ctx, md, err := annotateContextWithMatcher(ctx, s, headerMatcher, r, info.RPCMethod)
+	if err != nil {
+		s.recordError(r, err)
+		response.writeTrailer(nil, status.Convert(err))
+		return
+	}
+	if md != nil {
+		ctx = metadata.NewOutgoingContext(ctx, md)
+	}
+
+	header, trailer, st := s.forwardGRPCWeb(ctx, response, info, messages)
+	if st.Code() != codes.OK {
+		s.recordError(r, st.Err())
+	}
+	if !response.wroteHeader {
+		response.writeHeader(s, header)
+	}
+	response.writeTrailer(trailer, st)
+}
+
+// readGRPCWebRequest reads the messages of the request body.
+func (s *ServeMux) readGRPCWebRequest(r *http.Request, info RouteInfo, text bool) ([][]byte, error) {
+	var body io.Reader = r.Body
+	if limit := s.requestBodyLimitFor(info); limit > 0 {
+		body = &limitedRequestBody{ReadCloser: r.Body, limit: limit, remaining: limit}
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if text {
+		if data, err = decodeGRPCWebText(data); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid gRPC-Web text body: %s", err)
+		}
+	}
+
+	var messages [][]byte
+	for len(data) > 0 {
+		if len(data) < grpcWebFrameHeaderSize {
+			return nil, status.Error(codes.InvalidArgument, "incomplete gRPC-Web frame")
+		}
+		flag, length := data[0], binary.BigEndian.Uint32(data[1:grpcWebFrameHeaderSize])
+		data = data[grpcWebFrameHeaderSize:]
+		if uint64(length) > uint64(len(data)) {
+			return nil, status.Error(codes.InvalidArgument, "incomplete gRPC-Web frame")
+		}
+		if flag&grpcWebFlagCompressed != 0 {
+			return nil, status.Error(codes.Unimplemented, "compressed gRPC-Web messages are not supported")
+		}
+		if flag&grpcWebFlagTrailer == 0 {
+			messages = append(messages, data[:length])
+		}
+		data = data[length:]
+	}
+
+	clientStreams := info.StreamingMode == StreamingModeClient || info.StreamingMode == StreamingModeBidirectional
+	if !clientStreams && len(messages) != 1 {
+		return nil, status.Errorf(codes.InvalidArgument, "expected a single request message, got %d", len(messages))
+	}
+
+	return messages, nil
+}
+
+// decodeGRPCWebText decodes a base64 encoded body, which can be a concatenation of padded base64 chunks.
+func decodeGRPCWebText(data []byte) ([]byte, error) {
+	encoded := make([]byte, 0, len(data))
+	for _, b := range data {
+		if b != '\r' && b != '\n' && b != ' ' && b != '\t' {
+			encoded = append(encoded, b)
+		}
+	}
+	if len(encoded)%4 != 0 {
+		return nil, errors.New("illegal base64 data length")
+	}
+
+	// each quantum is decoded separately since the padding can appear at the end of every chunk.
+	result := make([]byte, 0, base64.StdEncoding.DecodedLen(len(encoded)))
+	var buffer [3]byte
+	for index := 0; index < len(encoded); index += 4 {
+		n, err := base64.StdEncoding.Decode(buffer[:], encoded[index:index+4])
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, buffer[:n]...)
+	}
+
+	return result, nil
+}
+
+// forwardGRPCWeb sends the request messages to the gRPC method, writes the response messages and returns the headers,
+// the trailers and the status of the call.
+func (s *ServeMux) forwardGRPCWeb(
+	ctx context.Context,
+	response *grpcWebResponse,
+	info RouteInfo,
+	messages [][]byte) (metadata.MD, metadata.MD, *status.Status) {
+
+	conn := connForService(s.grpcWeb.Conn, s.grpcWeb.ServiceConns, info.Service())
+	return forwardPassthrough(ctx, conn, info, messages, func(header metadata.MD, message []byte) error {
+		if !response.wroteHeader {
+			response.writeHeader(s, header)
+		}
+		if err := response.writeFrame(0, message); err != nil {
+			grpclog.Infof("Failed to send gRPC-Web message: %v", err)
+			return err
+		}
+		if flusher, ok := response.writer.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		return nil
+	})
+}
+
+// grpcWebResponse writes the frames of a gRPC-Web response.
+type grpcWebResponse struct {
+	writer      http.ResponseWriter
+	text        bool
+	wroteHeader bool
+}
+
+// writeHeader writes the gRPC headers as HTTP headers, gRPC-Web clients expect the metadata keys as they are.
+func (g *grpcWebResponse) writeHeader(s *ServeMux, md metadata.MD) {
+	g.wroteHeader = true
+	for key, values := range md {
+		if key == "content-type" || strings.HasPrefix(key, ":") {
+			continue
+		}
+		for _, value := range values {
+			g.writer.Header().Add(key, encodeGRPCWebMetadataValue(key, value))
+		}
+		if s.cors != nil {
+			s.cors.exposeMetadataHeader(g.writer, key)
+		}
+	}
+	g.writer.WriteHeader(http.StatusOK)
+}
+
+// writeFrame writes a length-prefixed frame, the frames are base64 encoded separately in text mode.
+func (g *grpcWebResponse) writeFrame(flag byte, data []byte) error {
+	frame := make([]byte, grpcWebFrameHeaderSize, grpcWebFrameHeaderSize+len(data))
+	frame[0] = flag
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data)))
+	frame = append(frame, data...)
+
+	if g.text {
+		frame = []byte(base64.StdEncoding.EncodeToString(frame))
+	}
+
+	_, err := g.writer.Write(frame)
+	return err
+}
+
+// writeTrailer writes the status and the gRPC trailers in the trailer frame.
+func (g *grpcWebResponse) writeTrailer(md metadata.MD, st *status.Status) {
+	if !g.wroteHeader {
+		g.wroteHeader = true
+		g.writer.WriteHeader(http.StatusOK)
+	}
+
+	var builder strings.Builder
+	writeLine := func(key, value string) {
+		builder.WriteString(key)
+		builder.WriteString(": ")
+		builder.WriteString(value)
+		builder.WriteString("\r\n")
+	}
+
+	writeLine("grpc-status", strconv.Itoa(int(st.Code())))
+	if message := st.Message(); message != "" {
+		writeLine("grpc-message", encodeGRPCMessage(message))
+	}
+	if len(st.Proto().GetDetails()) > 0 {
+		if data, err := proto.Marshal(st.Proto()); err == nil {
+			writeLine("grpc-status-details-bin", base64.RawStdEncoding.EncodeToString(data))
+		}
+	}
+	for key, values := range md {
+		if strings.HasPrefix(key, "grpc-") {
+			continue
+		}
+		for _, value := range values {
+			writeLine(strings.ToLower(key), encodeGRPCWebMetadataValue(key, value))
+		}
+	}
+
+	if err := g.writeFrame(grpcWebFlagTrailer, []byte(builder.String())); err != nil {
+		grpclog.Infof("Failed to send gRPC-Web trailers: %v", err)
+	}
+}
+
+// encodeGRPCWebMetadataValue encodes the binary metadata values using base64.
+func encodeGRPCWebMetadataValue(key, value string) string {
+	if strings.HasSuffix(key, "-bin") {
+		return base64.RawStdEncoding.EncodeToString([]byte(value))
+	}
+	return value
+}
+
+// encodeGRPCMessage percent-encodes the status message following the gRPC protocol.
+func encodeGRPCMessage(message string) string {
+	var builder strings.Builder
+	for index := 0; index < len(message); index++ {
+		if c := message[index]; c >= ' ' && c <= '~' && c != '%' {
+			builder.WriteByte(c)
+		} else {
+			fmt.Fprintf(&builder, "%%%02X", c)
+		}
+	}
+	return builder.String()
+}
@@ -0,0 +1,287 @@
+package gateway_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/meshapi/grpc-api-gateway/gateway"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// passthroughTestService is a gRPC service with an "Echo" unary method and a "Repeat" server-streaming method.
+var passthroughTestService = grpc.ServiceDesc{
+	ServiceName: "test.Echo",
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Echo",
+		Handler: func(_ interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := &wrapperspb.StringValue{}
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			md, _ := metadata.FromIncomingContext(ctx)
+			_ = grpc.SetHeader(ctx, metadata.Pairs("x-user", strings.Join(md.Get("x-user"), ",")))
+			_ = grpc.SetTrailer(ctx, metadata.Pairs("x-trailer", "done"))
+			if req.Value == "fail" {
+				return nil, status.Error(codes.InvalidArgument, "invalid value: 100%")
+			}
+			return wrapperspb.String("echo: " + req.Value), nil
+		},
+	}},
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "Repeat",
+		ServerStreams: true,
+		Handler: func(_ interface{}, stream grpc.ServerStream) error {
+			req := &wrapperspb.StringValue{}
+			if err := stream.RecvMsg(req); err != nil {
+				return err
+			}
+			for index := 0; index < 3; index++ {
+				if err := stream.SendMsg(req); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}},
+}
+
+// dialPassthroughTestService starts the test service and returns a connection to it.
+func dialPassthroughTestService(t *testing.T) grpc.ClientConnInterface {
+	t.Helper()
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	server.RegisterService(&passthroughTestService, struct{}{})
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial: %s", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return conn
+}
+
+// registerPassthroughTestRoutes registers the REST routes of the test service methods.
+func registerPassthroughTestRoutes(mux *gateway.ServeMux) {
+	noop := func(http.ResponseWriter, *http.Request, gateway.Params) {}
+	mux.HandleWithParams(http.MethodPost, "/v1/echo", noop, gateway.WithRouteInfo(gateway.RouteInfo{
+		RPCMethod: "/test.Echo/Echo",
+	}))
+	mux.HandleWithParams(http.MethodGet, "/v1/repeat", noop, gateway.WithRouteInfo(gateway.RouteInfo{
+		RPCMethod:     "/test.Echo/Repeat",
+		StreamingMode: gateway.StreamingModeServer,
+	}))
+}
+
+func newGRPCWebTestMux(t *testing.T) *gateway.ServeMux {
+	t.Helper()
+
+	mux := gateway.NewServeMux(gateway.WithGRPCWeb(gateway.GRPCWebConfig{Conn: dialPassthroughTestService(t)}))
+	registerPassthroughTestRoutes(mux)
+	return mux
+}
+
+func grpcWebFrame(t *testing.T, flag byte, msg proto.Message) []byte {
+	t.Helper()
+
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatalf("failed to marshal message: %s", err)
+	}
+	frame := []byte{flag, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data)))
+	return append(frame, data...)
+}
+
+type grpcWebTestResponse struct {
+	messages []string
+	trailer  http.Header
+}
+
+func parseGRPCWebResponse(t *testing.T, body []byte, text bool) grpcWebTestResponse {
+	t.Helper()
+
+	if text {
+		var decoded []byte
+		for index := 0; index+4 <= len(body); index += 4 {
+			chunk, err := base64.StdEncoding.DecodeString(string(body[index : index+4]))
+			if err != nil {
+				t.Fatalf("failed to decode the response body: %s", err)
+			}
+			decoded = append(decoded, chunk...)
+		}
+		body = decoded
+	}
+
+	var response grpcWebTestResponse
+	for len(body) > 0 {
+		if len(body) < 5 {
+			t.Fatalf("incomplete frame: %q", body)
+		}
+		flag, length := body[0], binary.BigEndian.Uint32(body[1:5])
+		data := body[5 : 5+length]
+		body = body[5+length:]
+
+		if flag&0x80 != 0 {
+			response.trailer = http.Header{}
+			for _, line := range strings.Split(strings.TrimSpace(string(data)), "\r\n") {
+				key, value, _ := strings.Cut(line, ": ")
+				response.trailer.Add(key, value)
+			}
+			continue
+		}
+
+		msg := &wrapperspb.StringValue{}
+		if err := proto.Unmarshal(data, msg); err != nil {
+			t.Fatalf("failed to unmarshal message: %s", err)
+		}
+		response.messages = append(response.messages, msg.Value)
+	}
+
+	return response
+}
+
+func TestGRPCWeb(t *testing.T) {
+	mux := newGRPCWebTestMux(t)
+
+	testCases := []struct {
+		Name             string
+		Path             string
+		ContentType      string
+		Value            string
+		ExpectedMessages []string
+		ExpectedStatus   string
+		ExpectedMessage  string
+	}{
+		{Name: "Unary", Path: "/test.Echo/Echo", ContentType: "application/grpc-web+proto", Value: "hi",
+			ExpectedMessages: []string{"echo: hi"}, ExpectedStatus: "0"},
+		{Name: "UnaryText", Path: "/test.Echo/Echo", ContentType: "application/grpc-web-text", Value: "hi",
+			ExpectedMessages: []string{"echo: hi"}, ExpectedStatus: "0"},
+		{Name: "ServerStreaming", Path: "/test.Echo/Repeat", ContentType: "application/grpc-web", Value: "a",
+			ExpectedMessages: []string{"a", "a", "a"}, ExpectedStatus: "0"},
+		{Name: "ServerStreamingText", Path: "/test.Echo/Repeat", ContentType: "application/grpc-web-text+proto",
+			Value: "b", ExpectedMessages: []string{"b", "b", "b"}, ExpectedStatus: "0"},
+		{Name: "Error", Path: "/test.Echo/Echo", ContentType: "application/grpc-web", Value: "fail",
+			ExpectedStatus: "3", ExpectedMessage: "invalid value: 100%25"},
+		{Name: "UnknownMethod", Path: "/test.Echo/Unknown", ContentType: "application/grpc-web", Value: "hi",
+			ExpectedStatus: "12", ExpectedMessage: "unknown method /test.Echo/Unknown"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			text := strings.HasPrefix(tt.ContentType, "application/grpc-web-text")
+			body := grpcWebFrame(t, 0, wrapperspb.String(tt.Value))
+			if text {
+				body = []byte(base64.StdEncoding.EncodeToString(body))
+			}
+
+			req := httptest.NewRequest(http.MethodPost, tt.Path, bytes.NewReader(body))
+			req.Header.Set("Content-Type", tt.ContentType)
+			req.Header.Set("X-User", "alice")
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, req)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", recorder.Code, recorder.Body.String())
+			}
+			expectedContentType := "application/grpc-web+proto"
+			if text {
+				expectedContentType = "application/grpc-web-text+proto"
+			}
+			if got := recorder.Header().Get("Content-Type"); got != expectedContentType {
+				t.Errorf("expected content type %q, got %q", expectedContentType, got)
+			}
+
+			response := parseGRPCWebResponse(t, recorder.Body.Bytes(), text)
+			if strings.Join(response.messages, ",") != strings.Join(tt.ExpectedMessages, ",") {
+				t.Errorf("expected messages %q, got %q", tt.ExpectedMessages, response.messages)
+			}
+			if response.trailer == nil {
+				t.Fatal("expected a trailer frame")
+			}
+			if got := response.trailer.Get("grpc-status"); got != tt.ExpectedStatus {
+				t.Errorf("expected grpc-status %q, got %q", tt.ExpectedStatus, got)
+			}
+			if got := response.trailer.Get("grpc-message"); got != tt.ExpectedMessage {
+				t.Errorf("expected grpc-message %q, got %q", tt.ExpectedMessage, got)
+			}
+
+			if tt.Path == "/test.Echo/Echo" {
+				if got := recorder.Header().Get("X-User"); got != "alice" {
+					t.Errorf("expected x-user header %q, got %q", "alice", got)
+				}
+				if got := response.trailer.Get("x-trailer"); got != "done" {
+					t.Errorf("expected x-trailer %q, got %q", "done", got)
+				}
+			}
+		})
+	}
+}
+
+func TestGRPCWebServices(t *testing.T) {
+	mux := gateway.NewServeMux(gateway.WithGRPCWeb(gateway.GRPCWebConfig{
+		Conn:     dialPassthroughTestService(t),
+		Services: []string{"test.Echo"},
+		Files:    passthroughTestFiles(t),
+	}))
+
+	expectedMessages := map[string][]string{"/test.Echo/Echo": {"echo: hi"}, "/test.Echo/Repeat": {"hi", "hi", "hi"}}
+	for path, expected := range expectedMessages {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(grpcWebFrame(t, 0, wrapperspb.String("hi"))))
+		req.Header.Set("Content-Type", "application/grpc-web")
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, req)
+
+		response := parseGRPCWebResponse(t, recorder.Body.Bytes(), false)
+		if strings.Join(response.messages, ",") != strings.Join(expected, ",") {
+			t.Errorf("%s: expected messages %q, got %q", path, expected, response.messages)
+		}
+		if response.trailer == nil || response.trailer.Get("grpc-status") != "0" {
+			t.Errorf("%s: expected grpc-status 0, got %v", path, response.trailer)
+		}
+	}
+}
+
+func TestGRPCWebInvalidRequest(t *testing.T) {
+	mux := newGRPCWebTestMux(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/test.Echo/Echo", strings.NewReader("\x00\x00\x00\x00\x10abc"))
+	req.Header.Set("Content-Type", "application/grpc-web")
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+
+	response := parseGRPCWebResponse(t, recorder.Body.Bytes(), false)
+	if got := response.trailer.Get("grpc-status"); got != "3" {
+		t.Errorf("expected grpc-status 3, got %q", got)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/test.Echo/Echo", strings.NewReader(""))
+	req.Header.Set("Content-Type", "application/grpc-web+json")
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("expected status 415, got %d", recorder.Code)
+	}
+}
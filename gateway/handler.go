@@ -2,6 +2,7 @@ package gateway
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -9,6 +10,7 @@ import (
 	"strings"
 
 	"google.golang.org/grpc/grpclog"
+	grpcstatus "google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 )
 
@@ -18,6 +20,9 @@ func (s *ServeMux) handleForwardResponseServerMetadata(w http.ResponseWriter, md
 			for _, v := range vs {
 				w.Header().Add(h, v)
 			}
+			if s.cors != nil {
+				s.cors.exposeMetadataHeader(w, h)
+			}
 		}
 	}
 }
@@ -46,14 +51,32 @@ func (s *ServeMux) handleForwardResponseStreamErrorChunked(
 	err error,
 	delimiter []byte) {
 
-	status, msg := s.streamErrorHandler(ctx, req, err)
+	s.recordError(req, err)
+	status, msg := s.streamErrorHandler(s.errorContext(ctx), req, err)
+	// problem details documents are always JSON encoded, regardless of the marshaler.
+	problem, isProblem := msg.(*ProblemDetails)
 	if !wroteHeader {
-		writer.Header().Set("Content-Type", marshaler.ContentType(msg))
+		status = s.applyErrorDetails(writer.Header(), grpcstatus.Convert(err), status)
+		if !statusAllowsBody(status) {
+			writer.WriteHeader(status)
+			return
+		}
+		if isProblem {
+			writer.Header().Set("Content-Type", ProblemDetailsContentType)
+		} else {
+			writer.Header().Set("Content-Type", marshaler.ContentType(msg))
+		}
 		writer.WriteHeader(status)
 	}
 
 	if msg != nil {
-		buf, err := marshaler.Marshal(msg)
+		var buf []byte
+		var err error
+		if isProblem {
+			buf, err = json.Marshal(problem)
+		} else {
+			buf, err = marshaler.Marshal(msg)
+		}
 		if err != nil {
 			grpclog.Infof("Failed to marshal an error: %v", err)
 			return
@@ -95,7 +118,8 @@ func (s *ServeMux) handleForwardResponseStreamErrorSSE(
 	req *http.Request,
 	err error) {
 
-	msg := s.sseErrorHandler(ctx, marshaler, req, err)
+	s.recordError(req, err)
+	msg := s.sseErrorHandler(s.errorContext(ctx), marshaler, req, err)
 	if msg == nil {
 		return
 	}
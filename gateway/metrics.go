@@ -0,0 +1,137 @@
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// StreamKind is the transport used to forward a response stream.
+type StreamKind uint8
+
+const (
+	// StreamKindChunked is for streams forwarded using chunked transfer encoding.
+	StreamKindChunked StreamKind = iota
+	// StreamKindSSE is for streams forwarded using Server-Sent Events (SSE).
+	StreamKindSSE
+	// StreamKindWebsocket is for streams forwarded using websockets.
+	StreamKindWebsocket
+)
+
+func (k StreamKind) String() string {
+	switch k {
+	case StreamKindChunked:
+		return "chunked"
+	case StreamKindSSE:
+		return "sse"
+	case StreamKindWebsocket:
+		return "websocket"
+	default:
+		return "unknown"
+	}
+}
+
+// RequestMetrics holds the measurements of a request served by the ServeMux.
+type RequestMetrics struct {
+	// RPCMethod is the full gRPC method name, empty if the request did not reach a gRPC route.
+	RPCMethod string
+	// HTTPPathPattern is the HTTP path pattern of the route, empty if the request did not reach a gRPC route.
+	HTTPPathPattern string
+	// HTTPMethod is the method of the HTTP request.
+	HTTPMethod string
+	// HTTPStatus is the status code written in the response.
+	HTTPStatus int
+	// Code is the gRPC status code of the request.
+	Code codes.Code
+	// Duration is the time it took to serve the request.
+	Duration time.Duration
+	// ResponseSize is the number of bytes written in the response body.
+	ResponseSize int64
+}
+
+// StreamMetrics describes a response stream.
+type StreamMetrics struct {
+	// RPCMethod is the full gRPC method name.
+	RPCMethod string
+	// HTTPPathPattern is the HTTP path pattern of the route.
+	HTTPPathPattern string
+	// Kind is the transport used to forward the stream.
+	Kind StreamKind
+}
+
+// MetricsRecorder records the metrics of the requests served by the ServeMux.
+//
+// See the metrics package for an implementation that exposes metrics in the Prometheus text format.
+type MetricsRecorder interface {
+	// RecordRequest gets called once a request is served.
+	RecordRequest(context.Context, RequestMetrics)
+
+	// StreamStarted gets called when forwarding a response stream starts. The returned function gets called when
+	// the stream ends.
+	StreamStarted(context.Context, StreamMetrics) (done func())
+}
+
+// startStream notifies the metrics recorder of a new response stream and returns the function to call when the
+// stream ends.
+func (s *ServeMux) startStream(ctx context.Context, kind StreamKind) func() {
+	if s.metricsRecorder == nil {
+		return func() {}
+	}
+
+	info := StreamMetrics{Kind: kind}
+	info.RPCMethod, _ = RPCMethod(ctx)
+	info.HTTPPathPattern, _ = HTTPPathPattern(ctx)
+
+	return s.metricsRecorder.StreamStarted(ctx, info)
+}
+
+// metricsResponseWriter captures the status code and the size of a response.
+type metricsResponseWriter struct {
+	http.ResponseWriter
+
+	status int
+	size   int64
+}
+
+func (w *metricsResponseWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *metricsResponseWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(data)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *metricsResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *metricsResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking is not supported by the underlying response writer")
+	}
+	if w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return hijacker.Hijack()
+}
+
+// Unwrap returns the underlying response writer, used by http.ResponseController.
+func (w *metricsResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,588 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/meshapi/grpc-api-gateway/websocket"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/status"
+)
+
+// WebsocketMultiplexConfig configures the websocket multiplexing endpoint, see WithWebsocketMultiplexerAt.
+type WebsocketMultiplexConfig struct {
+	// MaxStreams is the maximum number of open streams on a connection. Default is 100.
+	MaxStreams int
+
+	// InitialCredits is the number of messages that can be sent to the client on a stream before the client has to
+	// grant more credits with credit frames. Default is 64, a negative value disables the flow control.
+	InitialCredits int
+
+	// ReceiveBufferSize is the number of messages received from the client that can be buffered for a stream. When the
+	// buffer of a stream is full, the stream fails with a ResourceExhausted error. Default is 16.
+	ReceiveBufferSize int
+}
+
+const (
+	defaultMultiplexMaxStreams        = 100
+	defaultMultiplexInitialCredits    = 64
+	defaultMultiplexReceiveBufferSize = 16
+)
+
+// Types of the frames of a multiplexed websocket connection.
+const (
+	multiplexFrameOpen    = "open"
+	multiplexFrameMessage = "message"
+	multiplexFrameEnd     = "end"
+	multiplexFrameCancel  = "cancel"
+	multiplexFrameCredit  = "credit"
+	multiplexFrameClose   = "close"
+	multiplexFrameError   = "error"
+)
+
+// multiplexFrame is a frame of a multiplexed websocket connection, the frames are sent as JSON text messages.
+type multiplexFrame struct {
+	Type    string          `json:"type"`
+	ID      uint64          `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Path    string          `json:"path,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Data    []byte          `json:"data,omitempty"`
+	Credits int             `json:"credits,omitempty"`
+	Code    int             `json:"code,omitempty"`
+	Reason  string          `json:"reason,omitempty"`
+	Message string          `json:"message,omitempty"`
+}
+
+// multiplexedStreamKey is the context key of the stream of the requests that are dispatched by a multiplexer.
+type multiplexedStreamKey struct{}
+
+var errMultiplexedStreamClosed = errors.New("multiplexed stream is closed")
+
+// errMultiplexedStreamInputEnded is returned when receiving from a stream that the client has ended with an end
+// frame. Unlike io.EOF, it does not end the stream and the responses are still sent to the client.
+var errMultiplexedStreamInputEnded = errors.New("multiplexed stream input has ended")
+
+// WithWebsocketMultiplexerAt returns a ServeMuxOption that serves a websocket multiplexing endpoint at endpointPath.
+//
+// A multiplexed websocket connection carries many streams, each one addressed to a route that supports websockets.
+// The frames are JSON text messages with a "type" and the "id" of the stream that is chosen by the client:
+//
+//	{"type": "open", "id": 1, "method": "GET", "path": "/v1/users/1/events?verbose=true"}
+//	{"type": "message", "id": 1, "payload": {...}}
+//	{"type": "credit", "id": 1, "credits": 64}
+//	{"type": "end", "id": 1}
+//	{"type": "cancel", "id": 1}
+//
+// The streams are served by the handlers of the routes the same way websocket connections are. The server sends
+// message frames, a close frame with the close code and the reason once a stream ends and error frames for the frames
+// that cannot be processed, such as opening a stream for an unknown route. Messages that are not JSON are sent in the
+// "data" field as base64 strings.
+//
+// An end frame ends the messages of the client on a stream while the responses are still sent, a cancel frame
+// cancels the stream right away.
+//
+// The request of each stream has the headers of the request of the multiplexed connection and is recorded by the
+// metrics recorder and the tracer as a request of its own. The multiplexed connection uses the keepalive and the
+// limits of the websocket config, see WithWebsocketConfig.
+func WithWebsocketMultiplexerAt(endpointPath string, config WebsocketMultiplexConfig) ServeMuxOption {
+	if config.MaxStreams <= 0 {
+		config.MaxStreams = defaultMultiplexMaxStreams
+	}
+	if config.InitialCredits == 0 {
+		config.InitialCredits = defaultMultiplexInitialCredits
+	}
+	if config.ReceiveBufferSize <= 0 {
+		config.ReceiveBufferSize = defaultMultiplexReceiveBufferSize
+	}
+
+	return optionFunc(func(s *ServeMux) {
+		handle := func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+			s.serveWebsocketMultiplexer(config, w, r)
+		}
+		s.handleEndpoint(http.MethodGet, endpointPath, handle)
+	})
+}
+
+// websocketMultiplexer dispatches the streams of a multiplexed websocket connection.
+type websocketMultiplexer struct {
+	mux     *ServeMux
+	config  WebsocketMultiplexConfig
+	request *http.Request
+	session *websocketSession
+
+	mutex   sync.Mutex
+	streams map[uint64]*multiplexedStream
+	wait    sync.WaitGroup
+}
+
+func (s *ServeMux) serveWebsocketMultiplexer(config WebsocketMultiplexConfig, w http.ResponseWriter, req *http.Request) {
+	if !s.IsWebsocketUpgrade(req) {
+		_, outboundMarshaler := s.MarshalerForRequest(req)
+		s.HTTPError(req.Context(), outboundMarshaler, w, req, HTTPStatusError{
+			HTTPStatus: http.StatusUpgradeRequired,
+			Err:        status.Error(codes.FailedPrecondition, "websocket upgrade is required"),
+		})
+		return
+	}
+
+	ws, err := s.UpgradeToWebsocket(w, req)
+	if err != nil {
+		grpclog.Infof("Failed to upgrade HTTP request: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+
+	multiplexer := &websocketMultiplexer{
+		mux:     s,
+		config:  config,
+		request: req.WithContext(ctx),
+		session: s.newWebsocketSession(ws, websocket.TextMessage),
+		streams: make(map[uint64]*multiplexedStream),
+	}
+	defer func() {
+		if err := multiplexer.session.Close(); err != nil {
+			grpclog.Infof("Failed to close websocket connection: %v", err)
+		}
+	}()
+	defer multiplexer.session.startKeepalive(multiplexer.closeWithError)()
+
+	multiplexer.serve()
+	multiplexer.shutdown()
+}
+
+// serve receives and handles the frames until the connection is closed.
+func (m *websocketMultiplexer) serve() {
+	for {
+		data, err := m.session.ReceiveMessage()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			grpclog.Infof("failed to receive message: %v", err)
+			if errors.Is(err, errWebsocketMessageTooLarge) {
+				m.closeWithError(status.Errorf(codes.ResourceExhausted,
+					"websocket message exceeds the maximum message size of %d bytes", m.session.config.MaxMessageSize))
+			}
+			return
+		}
+
+		var frame multiplexFrame
+		if err := json.Unmarshal(data, &frame); err != nil {
+			m.sendError(0, status.Errorf(codes.InvalidArgument, "invalid frame: %s", err))
+			continue
+		}
+		m.handleFrame(frame)
+	}
+}
+
+func (m *websocketMultiplexer) handleFrame(frame multiplexFrame) {
+	switch frame.Type {
+	case multiplexFrameOpen:
+		m.open(frame)
+		return
+	case multiplexFrameMessage, multiplexFrameEnd, multiplexFrameCancel, multiplexFrameCredit:
+	default:
+		m.sendError(frame.ID, status.Errorf(codes.InvalidArgument, "unknown frame type %q", frame.Type))
+		return
+	}
+
+	m.mutex.Lock()
+	stream := m.streams[frame.ID]
+	m.mutex.Unlock()
+	if stream == nil {
+		// the frames of the streams that have already ended are ignored.
+		return
+	}
+
+	switch frame.Type {
+	case multiplexFrameMessage:
+		if len(frame.Payload) > 0 {
+			stream.deliver(frame.Payload)
+		} else {
+			stream.deliver(frame.Data)
+		}
+	case multiplexFrameEnd:
+		stream.endOnce.Do(func() { close(stream.inputEnded) })
+	case multiplexFrameCancel:
+		stream.abort()
+	case multiplexFrameCredit:
+		stream.addCredits(frame.Credits)
+	}
+}
+
+// open starts a stream that is served by the handler of the route the frame is addressed to.
+func (m *websocketMultiplexer) open(frame multiplexFrame) {
+	if frame.ID == 0 {
+		m.sendError(0, status.Error(codes.InvalidArgument, "stream ID must not be zero"))
+		return
+	}
+
+	method := strings.ToUpper(frame.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	target, err := url.Parse(frame.Path)
+	if err != nil || !strings.HasPrefix(target.Path, "/") {
+		m.sendError(frame.ID, status.Errorf(codes.InvalidArgument, "invalid stream path %q", frame.Path))
+		return
+	}
+
+	handle, params, _ := m.mux.lookupWebsocketRoute(method, target.Path)
+	if handle == nil {
+		m.sendError(frame.ID, status.Errorf(codes.NotFound, "no websocket route matches %s %s", method, target.Path))
+		return
+	}
+
+	m.mutex.Lock()
+	if _, ok := m.streams[frame.ID]; ok {
+		m.mutex.Unlock()
+		m.sendError(frame.ID, status.Errorf(codes.AlreadyExists, "stream %d is already open", frame.ID))
+		return
+	}
+	if len(m.streams) >= m.config.MaxStreams {
+		m.mutex.Unlock()
+		m.sendError(frame.ID, status.Errorf(codes.ResourceExhausted,
+			"too many open streams, the limit is %d", m.config.MaxStreams))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(m.request.Context())
+	stream := &multiplexedStream{
+		id:           frame.ID,
+		multiplexer:  m,
+		cancel:       cancel,
+		incoming:     make(chan []byte, m.config.ReceiveBufferSize),
+		inputEnded:   make(chan struct{}),
+		done:         make(chan struct{}),
+		credits:      m.config.InitialCredits,
+		creditSignal: make(chan struct{}, 1),
+	}
+	m.streams[frame.ID] = stream
+	m.mutex.Unlock()
+
+	req := m.request.Clone(context.WithValue(ctx, multiplexedStreamKey{}, stream))
+	req.Method = method
+	req.URL.Path, req.URL.RawPath, req.URL.RawQuery = target.Path, target.RawPath, target.RawQuery
+	req.RequestURI = target.RequestURI()
+	req.Body, req.ContentLength = http.NoBody, 0
+
+	m.wait.Add(1)
+	go func() {
+		defer m.wait.Done()
+		m.serveStream(stream, handle, req, params)
+	}()
+}
+
+// serveStream calls the handler of the route of a stream. If the handler responds without upgrading to a websocket
+// connection, the response is sent to the client as an error frame.
+func (m *websocketMultiplexer) serveStream(
+	stream *multiplexedStream, handle httprouter.Handle, req *http.Request, params httprouter.Params) {
+
+	defer stream.Close()
+
+	serve := func(w http.ResponseWriter, req *http.Request) {
+		if panicHandler := m.mux.router.PanicHandler; panicHandler != nil {
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					panicHandler(w, req, recovered)
+				}
+			}()
+		}
+		handle(w, req, params)
+	}
+
+	// each stream is measured and traced as a request of its own.
+	writer := &bufferedResponseWriter{header: make(http.Header)}
+	if m.mux.metricsRecorder != nil || m.mux.tracer != nil {
+		m.mux.serveWithState(writer, req, serve)
+	} else {
+		serve(writer, req)
+	}
+
+	if !stream.upgraded.Load() {
+		stream.fail(m.responseError(req, writer))
+	}
+}
+
+// responseError returns the error of a response that a handler has written instead of upgrading the request.
+func (m *websocketMultiplexer) responseError(req *http.Request, writer *bufferedResponseWriter) error {
+	_, outboundMarshaler := m.mux.MarshalerForRequest(req)
+	statusProto := &spb.Status{}
+	if err := outboundMarshaler.Unmarshal(writer.body.Bytes(), statusProto); err == nil && statusProto.GetCode() != 0 {
+		return status.ErrorProto(statusProto)
+	}
+
+	statusCode := writer.statusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	return status.Errorf(codeFromHTTPStatus(statusCode), "the route responded with %d %s instead of a websocket stream",
+		statusCode, http.StatusText(statusCode))
+}
+
+// shutdown aborts the open streams and waits for their handlers to return.
+func (m *websocketMultiplexer) shutdown() {
+	m.mutex.Lock()
+	streams := make([]*multiplexedStream, 0, len(m.streams))
+	for _, stream := range m.streams {
+		streams = append(streams, stream)
+	}
+	m.mutex.Unlock()
+
+	for _, stream := range streams {
+		stream.abort()
+	}
+	m.wait.Wait()
+}
+
+// closeWithError closes the multiplexed connection with the close code of the error.
+func (m *websocketMultiplexer) closeWithError(err error) {
+	m.mux.recordError(m.request, err)
+
+	st := status.Convert(err)
+	code := WebsocketCloseCodeFromContext(m.mux.errorContext(m.request.Context()), st.Code())
+	if err := m.session.SendCloseWithCode(code, truncateCloseReason(st.Message())); err != nil && err != io.EOF {
+		grpclog.Infof("failed to send websocket close message: %s", err)
+	}
+	if err := m.session.Close(); err != nil {
+		grpclog.Infof("Failed to close websocket connection: %v", err)
+	}
+}
+
+func (m *websocketMultiplexer) send(frame multiplexFrame) error {
+	data, err := json.Marshal(frame)
+	if err != nil {
+		return err
+	}
+
+	return m.session.SendMessageWithType(websocket.TextMessage, data)
+}
+
+func (m *websocketMultiplexer) sendError(id uint64, err error) {
+	st := status.Convert(err)
+	if err := m.send(multiplexFrame{
+		Type: multiplexFrameError, ID: id, Code: int(st.Code()), Message: st.Message(),
+	}); err != nil {
+		grpclog.Infof("Failed to send multiplexed stream error: %v", err)
+	}
+}
+
+// multiplexedStream is a stream of a multiplexed websocket connection that conforms to websocket.Connection.
+type multiplexedStream struct {
+	id          uint64
+	multiplexer *websocketMultiplexer
+	cancel      context.CancelFunc
+
+	incoming   chan []byte
+	inputEnded chan struct{}
+	endOnce    sync.Once
+	done       chan struct{}
+	closeOnce  sync.Once
+
+	creditMutex  sync.Mutex
+	credits      int
+	creditSignal chan struct{}
+
+	upgraded    atomic.Bool
+	closeSent   atomic.Bool
+	pongHandler atomic.Pointer[func()]
+}
+
+func (s *multiplexedStream) SendMessage(data []byte) error {
+	return s.SendMessageWithType(websocket.TextMessage, data)
+}
+
+func (s *multiplexedStream) SendMessageWithType(messageType int, data []byte) error {
+	if err := s.acquireCredit(); err != nil {
+		return err
+	}
+
+	frame := multiplexFrame{Type: multiplexFrameMessage, ID: s.id}
+	if messageType == websocket.TextMessage && json.Valid(data) {
+		frame.Payload = data
+	} else {
+		frame.Data = data
+	}
+	return s.send(frame)
+}
+
+func (s *multiplexedStream) SendClose() error {
+	return s.SendCloseWithCode(websocket.CloseNormalClosure, "")
+}
+
+func (s *multiplexedStream) SendCloseWithCode(code int, reason string) error {
+	if !s.closeSent.CompareAndSwap(false, true) {
+		return nil
+	}
+
+	return s.send(multiplexFrame{Type: multiplexFrameClose, ID: s.id, Code: code, Reason: reason})
+}
+
+// SendPing does not send anything, the liveness of the connection is checked by the keepalive of the multiplexed
+// connection.
+func (s *multiplexedStream) SendPing() error {
+	if handler := s.pongHandler.Load(); handler != nil && *handler != nil {
+		(*handler)()
+	}
+	return nil
+}
+
+func (s *multiplexedStream) SetPongHandler(handler func()) {
+	s.pongHandler.Store(&handler)
+}
+
+// SetReadLimit does nothing, the read limit of the multiplexed connection applies to the messages of the streams.
+func (s *multiplexedStream) SetReadLimit(int64) {}
+
+func (s *multiplexedStream) ReceiveMessage() ([]byte, error) {
+	select {
+	case data := <-s.incoming:
+		return data, nil
+	case <-s.done:
+		return nil, errMultiplexedStreamClosed
+	case <-s.inputEnded:
+		select {
+		case data := <-s.incoming:
+			return data, nil
+		default:
+			return nil, errMultiplexedStreamInputEnded
+		}
+	}
+}
+
+// Close ends the stream, a close frame is sent if the stream has not sent one yet.
+func (s *multiplexedStream) Close() error {
+	var frame *multiplexFrame
+	if s.upgraded.Load() && s.closeSent.CompareAndSwap(false, true) {
+		frame = &multiplexFrame{Type: multiplexFrameClose, ID: s.id, Code: websocket.CloseNormalClosure}
+	}
+	s.finish(frame)
+	return nil
+}
+
+// abort ends the stream without sending any frames.
+func (s *multiplexedStream) abort() {
+	s.closeSent.Store(true)
+	s.finish(nil)
+}
+
+// fail ends the stream with an error frame.
+func (s *multiplexedStream) fail(err error) {
+	st := status.Convert(err)
+	s.closeSent.Store(true)
+	s.finish(&multiplexFrame{Type: multiplexFrameError, ID: s.id, Code: int(st.Code()), Message: st.Message()})
+}
+
+// finish sends the last frame of the stream, cancels the request of the stream and removes it from the multiplexer.
+func (s *multiplexedStream) finish(frame *multiplexFrame) {
+	s.closeOnce.Do(func() {
+		if frame != nil {
+			if err := s.send(*frame); err != nil {
+				grpclog.Infof("Failed to send multiplexed stream frame: %v", err)
+			}
+		}
+
+		s.cancel()
+		close(s.done)
+
+		s.multiplexer.mutex.Lock()
+		delete(s.multiplexer.streams, s.id)
+		s.multiplexer.mutex.Unlock()
+	})
+}
+
+func (s *multiplexedStream) send(frame multiplexFrame) error {
+	select {
+	case <-s.done:
+		return errMultiplexedStreamClosed
+	default:
+		return s.multiplexer.send(frame)
+	}
+}
+
+// deliver queues a message received from the client, the stream fails if its receive buffer is full.
+func (s *multiplexedStream) deliver(data []byte) {
+	select {
+	case <-s.done:
+		return
+	case <-s.inputEnded:
+		return
+	default:
+	}
+
+	select {
+	case s.incoming <- data:
+	default:
+		s.fail(status.Errorf(codes.ResourceExhausted, "the receive buffer of stream %d is full", s.id))
+	}
+}
+
+// acquireCredit waits until a message can be sent to the client.
+func (s *multiplexedStream) acquireCredit() error {
+	if s.multiplexer.config.InitialCredits < 0 {
+		return nil
+	}
+
+	for {
+		s.creditMutex.Lock()
+		if s.credits > 0 {
+			s.credits--
+			s.creditMutex.Unlock()
+			return nil
+		}
+		s.creditMutex.Unlock()
+
+		select {
+		case <-s.creditSignal:
+		case <-s.done:
+			return errMultiplexedStreamClosed
+		}
+	}
+}
+
+func (s *multiplexedStream) addCredits(credits int) {
+	if credits <= 0 {
+		return
+	}
+
+	s.creditMutex.Lock()
+	s.credits += credits
+	s.creditMutex.Unlock()
+
+	select {
+	case s.creditSignal <- struct{}{}:
+	default:
+	}
+}
+
+// codeFromHTTPStatus maps an HTTP status code to a gRPC code, following the mapping of the gRPC specification for
+// the HTTP responses that do not carry a gRPC status.
+func codeFromHTTPStatus(statusCode int) codes.Code {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return codes.Internal
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.Unimplemented
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return codes.Unavailable
+	}
+
+	return codes.Unknown
+}
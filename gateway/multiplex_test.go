@@ -0,0 +1,386 @@
+package gateway_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/meshapi/grpc-api-gateway/gateway"
+	"github.com/meshapi/grpc-api-gateway/protomarshal"
+	"github.com/meshapi/grpc-api-gateway/websocket"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type multiplexFrame struct {
+	Type    string          `json:"type"`
+	ID      uint64          `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Path    string          `json:"path,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Credits int             `json:"credits,omitempty"`
+	Code    int             `json:"code,omitempty"`
+	Reason  string          `json:"reason,omitempty"`
+	Message string          `json:"message,omitempty"`
+}
+
+// multiplexClient drives a multiplexed connection that is served over a fakeWebsocket.
+type multiplexClient struct {
+	t  *testing.T
+	ws *fakeWebsocket
+}
+
+func (c multiplexClient) send(frame multiplexFrame) {
+	c.t.Helper()
+
+	data, err := json.Marshal(frame)
+	if err != nil {
+		c.t.Fatalf("failed to marshal frame: %s", err)
+	}
+	c.ws.incoming <- data
+}
+
+func (c multiplexClient) receive() multiplexFrame {
+	c.t.Helper()
+
+	select {
+	case data := <-c.ws.sent:
+		var frame multiplexFrame
+		if err := json.Unmarshal(data, &frame); err != nil {
+			c.t.Fatalf("failed to unmarshal frame %q: %s", data, err)
+		}
+		return frame
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("no frame was received")
+		return multiplexFrame{}
+	}
+}
+
+func (c multiplexClient) expectNoFrame() {
+	c.t.Helper()
+
+	select {
+	case data := <-c.ws.sent:
+		c.t.Fatalf("unexpected frame %s", data)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWebsocketMultiplexer(t *testing.T) {
+	ws := newFakeWebsocket(false)
+	mux := gateway.NewServeMux(
+		gateway.WithWebsocketUpgrader(func(http.ResponseWriter, *http.Request) (websocket.Connection, error) {
+			return ws, nil
+		}),
+		gateway.WithWebsocketMultiplexerAt("/ws", gateway.WebsocketMultiplexConfig{InitialCredits: 1}))
+	marshaler := &protomarshal.JSONPb{}
+
+	waitDone := make(chan string, 1)
+	mux.HandleWithParams(http.MethodGet, "/v1/echo/:id", func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		connection, err := mux.UpgradeToWebsocket(w, r)
+		if err != nil {
+			t.Errorf("failed to upgrade: %s", err)
+			return
+		}
+		stream := replyStream{
+			blockingStream: blockingStream{ctx: r.Context()},
+			responses:      []proto.Message{wrapperspb.String(p.ByName("id")), wrapperspb.String(r.URL.Query().Get("q"))},
+			index:          new(int),
+		}
+		mux.ForwardWebsocketServerStreaming(r.Context(), r, stream, connection, marshaler, &wrapperspb.StringValue{})
+	}, gateway.WithRouteInfo(gateway.RouteInfo{SupportsWebsocket: true}))
+	mux.HandleWithParams(http.MethodGet, "/v1/wait", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		connection, err := mux.UpgradeToWebsocket(w, r)
+		if err != nil {
+			t.Errorf("failed to upgrade: %s", err)
+			return
+		}
+		mux.ForwardWebsocket(r.Context(), r, blockingStream{ctx: r.Context()}, connection, marshaler, marshaler,
+			&wrapperspb.StringValue{}, &wrapperspb.StringValue{})
+		waitDone <- r.Header.Get("Authorization")
+	}, gateway.WithRouteInfo(gateway.RouteInfo{SupportsWebsocket: true}))
+	mux.HandleWithParams(http.MethodGet, "/v1/plain", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		t.Error("expected the route without websocket support not to be served")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Authorization", "Bearer token")
+
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		mux.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	client := multiplexClient{t: t, ws: ws}
+
+	// flow control holds the second message until the client grants more credits.
+	client.send(multiplexFrame{Type: "open", ID: 1, Path: "/v1/echo/abc?q=second"})
+	if frame := client.receive(); frame.Type != "message" || frame.ID != 1 || string(frame.Payload) != `"abc"` {
+		t.Fatalf("unexpected frame: %+v", frame)
+	}
+	client.expectNoFrame()
+	client.send(multiplexFrame{Type: "credit", ID: 1, Credits: 5})
+	if frame := client.receive(); frame.Type != "message" || string(frame.Payload) != `"second"` {
+		t.Fatalf("unexpected frame: %+v", frame)
+	}
+	if frame := client.receive(); frame.Type != "close" || frame.ID != 1 || frame.Code != 1000 {
+		t.Fatalf("expected the stream to be closed, got %+v", frame)
+	}
+
+	// cancelling a stream cancels its request without sending any frames.
+	client.send(multiplexFrame{Type: "open", ID: 2, Path: "/v1/wait"})
+	client.send(multiplexFrame{Type: "open", ID: 2, Path: "/v1/wait"})
+	if frame := client.receive(); frame.Type != "error" || frame.ID != 2 || frame.Code != int(codes.AlreadyExists) {
+		t.Fatalf("expected a duplicate stream error, got %+v", frame)
+	}
+	client.send(multiplexFrame{Type: "cancel", ID: 2})
+	select {
+	case authorization := <-waitDone:
+		if authorization != "Bearer token" {
+			t.Errorf("expected the headers of the connection request, got %q", authorization)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the cancelled stream did not end")
+	}
+	client.expectNoFrame()
+
+	for _, path := range []string{"/v1/plain", "/v1/missing"} {
+		client.send(multiplexFrame{Type: "open", ID: 3, Path: path})
+		if frame := client.receive(); frame.Type != "error" || frame.ID != 3 || frame.Code != int(codes.NotFound) {
+			t.Errorf("expected a not found error for %s, got %+v", path, frame)
+		}
+	}
+
+	client.send(multiplexFrame{Type: "unknown", ID: 4})
+	if frame := client.receive(); frame.Type != "error" || frame.Code != int(codes.InvalidArgument) {
+		t.Errorf("expected an invalid argument error, got %+v", frame)
+	}
+
+	// closing the connection ends the open streams.
+	client.send(multiplexFrame{Type: "open", ID: 5, Path: "/v1/wait"})
+	close(ws.incoming)
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the multiplexed connection was not closed")
+	}
+	select {
+	case <-waitDone:
+	default:
+		t.Error("expected the open stream to end")
+	}
+}
+
+func TestWebsocketMultiplexerLimits(t *testing.T) {
+	ws := newFakeWebsocket(false)
+	mux := gateway.NewServeMux(
+		gateway.WithWebsocketUpgrader(func(http.ResponseWriter, *http.Request) (websocket.Connection, error) {
+			return ws, nil
+		}),
+		gateway.WithWebsocketMultiplexerAt("/ws", gateway.WebsocketMultiplexConfig{MaxStreams: 1, ReceiveBufferSize: 1}))
+
+	received := make(chan struct{})
+	mux.HandleWithParams(http.MethodGet, "/v1/wait", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		connection, err := mux.UpgradeToWebsocket(w, r)
+		if err != nil {
+			t.Errorf("failed to upgrade: %s", err)
+			return
+		}
+		// the stream does not receive messages until its context is done.
+		<-r.Context().Done()
+		_ = connection.Close()
+		close(received)
+	}, gateway.WithRouteInfo(gateway.RouteInfo{SupportsWebsocket: true}))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ws", nil))
+	if rec.Code != http.StatusUpgradeRequired {
+		t.Errorf("expected a request without upgrade to fail with 426, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	go mux.ServeHTTP(httptest.NewRecorder(), req)
+	defer close(ws.incoming)
+	client := multiplexClient{t: t, ws: ws}
+
+	client.send(multiplexFrame{Type: "open", ID: 1, Path: "/v1/wait"})
+	client.send(multiplexFrame{Type: "open", ID: 2, Path: "/v1/wait"})
+	if frame := client.receive(); frame.Type != "error" || frame.ID != 2 || frame.Code != int(codes.ResourceExhausted) {
+		t.Fatalf("expected too many streams error, got %+v", frame)
+	}
+
+	client.send(multiplexFrame{Type: "message", ID: 1, Payload: json.RawMessage(`"first"`)})
+	client.send(multiplexFrame{Type: "message", ID: 1, Payload: json.RawMessage(`"second"`)})
+	if frame := client.receive(); frame.Type != "error" || frame.ID != 1 || frame.Code != int(codes.ResourceExhausted) {
+		t.Fatalf("expected the receive buffer to overflow, got %+v", frame)
+	}
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the failed stream did not end")
+	}
+}
+
+// gatedStream is a replyStream that holds the responses until the gate is closed.
+type gatedStream struct {
+	replyStream
+
+	gate <-chan struct{}
+}
+
+func (g gatedStream) RecvMsg(message any) error {
+	<-g.gate
+	return g.replyStream.RecvMsg(message)
+}
+
+type concurrentTracer struct {
+	mutex sync.Mutex
+	spans []*testSpan
+}
+
+func (t *concurrentTracer) Start(
+	ctx context.Context, name string, parent gateway.TraceContext, _ *http.Request) (context.Context, gateway.Span) {
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	span := &testSpan{name: name, parent: parent}
+	t.spans = append(t.spans, span)
+	return ctx, span
+}
+
+type requestsRecorder struct {
+	mutex    sync.Mutex
+	requests []gateway.RequestMetrics
+}
+
+func (r *requestsRecorder) RecordRequest(_ context.Context, measurements gateway.RequestMetrics) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.requests = append(r.requests, measurements)
+}
+
+func (r *requestsRecorder) StreamStarted(context.Context, gateway.StreamMetrics) func() {
+	return func() {}
+}
+
+func TestWebsocketMultiplexerConcurrentStreams(t *testing.T) {
+	const streamCount = 20
+
+	ws := newFakeWebsocket(false)
+	tracer := &concurrentTracer{}
+	recorder := &requestsRecorder{}
+	mux := gateway.NewServeMux(
+		gateway.WithTracer(tracer),
+		gateway.WithMetricsRecorder(recorder),
+		gateway.WithWebsocketUpgrader(func(http.ResponseWriter, *http.Request) (websocket.Connection, error) {
+			return ws, nil
+		}),
+		gateway.WithWebsocketMultiplexerAt("/ws", gateway.WebsocketMultiplexConfig{}))
+	marshaler := &protomarshal.JSONPb{}
+
+	gate := make(chan struct{})
+	mux.HandleWithParams(http.MethodGet, "/v1/streams/:id", func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx, err := gateway.AnnotateContext(r.Context(), mux, r, "/example.Streams/Watch"+p.ByName("id"))
+		if err != nil {
+			t.Errorf("failed to annotate context: %s", err)
+			return
+		}
+		connection, err := mux.UpgradeToWebsocket(w, r)
+		if err != nil {
+			t.Errorf("failed to upgrade: %s", err)
+			return
+		}
+		stream := gatedStream{
+			replyStream: replyStream{
+				blockingStream: blockingStream{ctx: ctx},
+				responses:      []proto.Message{wrapperspb.String(p.ByName("id"))},
+				index:          new(int),
+			},
+			gate: gate,
+		}
+		mux.ForwardWebsocketServerStreaming(ctx, r, stream, connection, marshaler, &wrapperspb.StringValue{})
+	}, gateway.WithRouteInfo(gateway.RouteInfo{SupportsWebsocket: true}))
+
+	req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		mux.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	client := multiplexClient{t: t, ws: ws}
+
+	// the streams end their input right away, the responses are still sent.
+	for id := uint64(1); id <= streamCount; id++ {
+		client.send(multiplexFrame{Type: "open", ID: id, Path: fmt.Sprintf("/v1/streams/%d", id)})
+		client.send(multiplexFrame{Type: "end", ID: id})
+	}
+	close(gate)
+
+	messages := map[uint64]string{}
+	closed := map[uint64]bool{}
+	for len(closed) < streamCount {
+		frame := client.receive()
+		switch frame.Type {
+		case "message":
+			messages[frame.ID] = string(frame.Payload)
+		case "close":
+			if frame.Code != 1000 {
+				t.Errorf("expected stream %d to close normally, got %d", frame.ID, frame.Code)
+			}
+			closed[frame.ID] = true
+		default:
+			t.Fatalf("unexpected frame: %+v", frame)
+		}
+	}
+	for id := uint64(1); id <= streamCount; id++ {
+		if expected := fmt.Sprintf(`"%d"`, id); messages[id] != expected {
+			t.Errorf("expected stream %d to receive %s, got %q", id, expected, messages[id])
+		}
+	}
+
+	close(ws.incoming)
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the multiplexed connection was not closed")
+	}
+
+	methods := map[string]bool{}
+	for _, measurements := range recorder.requests {
+		if measurements.RPCMethod == "" {
+			continue
+		}
+		if measurements.HTTPStatus != http.StatusSwitchingProtocols || measurements.Code != codes.OK {
+			t.Errorf("unexpected measurements: %+v", measurements)
+		}
+		methods[measurements.RPCMethod] = true
+	}
+	if len(methods) != streamCount {
+		t.Errorf("expected the requests of %d streams to be recorded, got %d", streamCount, len(methods))
+	}
+
+	if len(tracer.spans) != streamCount {
+		t.Fatalf("expected a span for each stream, got %d", len(tracer.spans))
+	}
+	for _, span := range tracer.spans {
+		if !span.ended || span.code != codes.OK {
+			t.Errorf("expected span %s to end with OK, got code=%s ended=%v", span.name, span.code, span.ended)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package gateway
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -8,6 +9,8 @@ import (
 	"mime"
 	"net/http"
 	"net/textproto"
+	"net/url"
+	"sort"
 	"strings"
 	"sync"
 
@@ -21,6 +24,7 @@ import (
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
 type Params = httprouter.Params
@@ -58,6 +62,10 @@ func DefaultHeaderMatcher(key string) (string, bool) {
 // It matches http requests to patterns and invokes the corresponding handler.
 type ServeMux struct {
 	router *httprouter.Router
+	// websocketRouter holds the routes that support websockets, which can be served over a multiplexed connection.
+	websocketRouter *httprouter.Router
+	// routesMutex guards the routers and the registered methods so that routes can be registered while serving.
+	routesMutex sync.RWMutex
 
 	// handlers maps HTTP method to a list of handlers.
 	queryParamParser          QueryParameterParser
@@ -73,13 +81,32 @@ type ServeMux struct {
 	sseConfig                 SSEConfig
 	routingErrorHandler       RoutingErrorHandlerFunc
 	websocketUpgradeFunc      WebsocketUpgradeFunc
+	websocketConfig           WebsocketConfig
+	cors                      *corsHandler
+	middlewares               []middlewareEntry
+	methods                   map[string]struct{}
+	rpcMethods                map[string]StreamingMode
+	routes                    map[string]*registeredRoute
+	metricsRecorder           MetricsRecorder
+	tracer                    Tracer
+	compression               *CompressionConfig
+	decompressors             map[string]DecompressorFunc
+	maxRequestBodySize        int64
+	requestBodyLimits         []requestBodyLimit
+	errorDetailHandlers       map[protoreflect.FullName]ErrorDetailHandlerFunc
+	statusCodeMapping         map[codes.Code]int
+	methodStatusCodeMappings  map[string]map[codes.Code]int
 	disablePathLengthFallback bool
+	strictContentNegotiation  bool
+	grpcWeb                   *GRPCWebConfig
+	connect                   *ConnectConfig
 }
 
 // NewServeMux returns a new ServeMux whose internal mapping is empty.
 func NewServeMux(opts ...ServeMuxOption) *ServeMux {
 	mux := &ServeMux{
 		router:                 httprouter.New(),
+		websocketRouter:        httprouter.New(),
 		queryParamParser:       &DefaultQueryParser{},
 		forwardResponseOptions: make([]ForwardResponseFunc, 0),
 		marshalers:             protomarshal.NewMarshalerMIMERegistry(),
@@ -96,6 +123,10 @@ func NewServeMux(opts ...ServeMuxOption) *ServeMux {
 		websocketErrorHandler:     DefaultWebsocketErrorHandler,
 		routingErrorHandler:       DefaultRoutingErrorHandler,
 		disablePathLengthFallback: false,
+		methods:                   make(map[string]struct{}),
+		rpcMethods:                make(map[string]StreamingMode),
+		routes:                    make(map[string]*registeredRoute),
+		errorDetailHandlers:       DefaultErrorDetailHandlers(),
 	}
 
 	for _, opt := range opts {
@@ -105,14 +136,30 @@ func NewServeMux(opts ...ServeMuxOption) *ServeMux {
 	mux.router.HandleMethodNotAllowed = true
 	mux.router.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		_, outboundMarshaler := mux.MarshalerForRequest(r)
-		mux.routingErrorHandler(r.Context(), mux, outboundMarshaler, w, r, ErrRoutingMethodNotAllowed)
+		mux.RoutingError(r.Context(), outboundMarshaler, w, r, ErrRoutingMethodNotAllowed)
 	})
 
 	mux.router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		_, outboundMarshaler := mux.MarshalerForRequest(r)
-		mux.routingErrorHandler(r.Context(), mux, outboundMarshaler, w, r, ErrRoutingNotFound)
+		mux.RoutingError(r.Context(), outboundMarshaler, w, r, ErrRoutingNotFound)
 	})
 
+	if mux.cors != nil {
+		globalOptionsHandler := mux.router.GlobalOPTIONS
+		mux.router.GlobalOPTIONS = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if mux.cors.handlePreflight(w, r) {
+				return
+			}
+			if globalOptionsHandler != nil {
+				globalOptionsHandler.ServeHTTP(w, r)
+			}
+		})
+	}
+
+	mux.router.NotFound = deferRoutingHandler(mux.router.NotFound)
+	mux.router.MethodNotAllowed = deferRoutingHandler(mux.router.MethodNotAllowed)
+	mux.router.GlobalOPTIONS = deferRoutingHandler(mux.router.GlobalOPTIONS)
+
 	if mux.incomingHeaderMatcher == nil {
 		mux.incomingHeaderMatcher = DefaultHeaderMatcher
 	}
@@ -127,8 +174,22 @@ func NewServeMux(opts ...ServeMuxOption) *ServeMux {
 }
 
 // UpgradeToWebsocket upgrades an HTTP request to a websocket connection.
+//
+// If a subprotocol is chosen for the request, it is set in the Sec-WebSocket-Protocol header of the response before
+// the upgrade function is called. See WebsocketConfig.Subprotocols.
+//
+// For the requests of the streams of a multiplexed websocket connection, the connection of the stream is returned
+// without calling the upgrade function. See WithWebsocketMultiplexerAt.
 func (s *ServeMux) UpgradeToWebsocket(response http.ResponseWriter, req *http.Request) (websocket.Connection, error) {
+	if stream, ok := req.Context().Value(multiplexedStreamKey{}).(*multiplexedStream); ok {
+		stream.upgraded.Store(true)
+		response.WriteHeader(http.StatusSwitchingProtocols)
+		return stream, nil
+	}
 	if s.websocketUpgradeFunc != nil {
+		if protocol, _, ok := s.websocketSubprotocol(req); ok {
+			response.Header().Set(websocketProtocolHeader, protocol)
+		}
 		return s.websocketUpgradeFunc(response, req)
 	}
 
@@ -137,32 +198,356 @@ func (s *ServeMux) UpgradeToWebsocket(response http.ResponseWriter, req *http.Re
 
 // ServeHTTP dispatches the request to the first handler whose pattern matches to r.Method and r.URL.Path.
 func (s *ServeMux) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
-	// if explicitly requested and method overriding is enabled, change method.
-	if override := req.Header.Get("X-HTTP-Method-Override"); override != "" && s.isPathLengthFallback(req) {
-		req.Method = strings.ToUpper(override)
-		if err := req.ParseForm(); err != nil {
+	if s.metricsRecorder != nil || s.tracer != nil {
+		s.serveWithState(writer, req, s.serveHTTP)
+		return
+	}
+
+	s.serveHTTP(writer, req)
+}
+
+func (s *ServeMux) serveHTTP(writer http.ResponseWriter, req *http.Request) {
+	// preflight requests are handled by the router's global OPTIONS handler.
+	if s.cors != nil && !isPreflightRequest(req) {
+		if !s.cors.handleRequest(writer, req) && s.IsWebsocketUpgrade(req) {
 			_, outboundMarshaler := s.MarshalerForRequest(req)
-			sterr := status.Error(codes.InvalidArgument, err.Error())
-			s.errorHandler(req.Context(), s, outboundMarshaler, writer, req, sterr)
+			s.errorHandler(req.Context(), s, outboundMarshaler, writer, req, HTTPStatusError{
+				HTTPStatus: http.StatusForbidden,
+				Err:        status.Error(codes.PermissionDenied, "origin not allowed"),
+			})
 			return
 		}
 	}
 
-	// TODO: properly handle fallback to handle POST->GET. You can use LookUp here.
-	s.router.ServeHTTP(writer, req)
+	switch {
+	case s.grpcWeb != nil && isGRPCWebRequest(req):
+		s.serveGRPCWeb(writer, req)
+		return
+	case s.connect != nil && s.isConnectRequest(req):
+		s.serveConnect(writer, req)
+		return
+	case (s.grpcWeb != nil || s.connect != nil) && s.cors != nil && isPreflightRequest(req) &&
+		s.serveRPCMethodPreflight(writer, req):
+		return
+	}
+
+	if s.compression != nil && !isPreflightRequest(req) && !isUpgradeRequest(req) {
+		if compressionWriter := s.compression.newCompressionWriter(writer, req); compressionWriter != nil {
+			defer compressionWriter.Close()
+			writer = compressionWriter
+		}
+	}
+
+	if s.isPathLengthFallback(req) {
+		// X-HTTP-Method-Override is optional, POST requests without a POST route fall back to GET.
+		method := strings.ToUpper(req.Header.Get("X-HTTP-Method-Override"))
+		if method == "" {
+			if handle, _, _ := s.lookupRoute(http.MethodPost, req.URL.Path); handle != nil {
+				s.serveRoute(writer, req)
+				return
+			}
+			method = http.MethodGet
+		}
+
+		s.serveMethodOverride(writer, req, method)
+		return
+	}
+
+	s.serveRoute(writer, req)
+}
+
+// serveRoute dispatches the request to the matching route. The handle is looked up before it gets called so that new
+// routes can be registered while long-lived requests, such as streams, are being served.
+func (s *ServeMux) serveRoute(writer http.ResponseWriter, req *http.Request) {
+	if handle, params, _ := s.lookupRoute(req.Method, req.URL.Path); handle != nil {
+		if s.router.PanicHandler != nil {
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					s.router.PanicHandler(writer, req, recovered)
+				}
+			}()
+		}
+		handle(writer, req, params)
+		return
+	}
+
+	// redirects, OPTIONS requests and routing errors are handled by the router. The router only decides how the
+	// request is handled while the lock is held, the response is written once the lock is released so that slow
+	// clients and the handlers that use the ServeMux do not hold the lock.
+	decision := &routingDecision{}
+	recorder := &bufferedResponseWriter{header: make(http.Header)}
+	s.routesMutex.RLock()
+	s.router.ServeHTTP(recorder, req.WithContext(context.WithValue(req.Context(), routingDecisionKey{}, decision)))
+	s.routesMutex.RUnlock()
+
+	for key, values := range recorder.header {
+		writer.Header()[key] = values
+	}
+	if decision.handler != nil {
+		decision.handler.ServeHTTP(writer, req)
+		return
+	}
+	if recorder.statusCode != 0 {
+		writer.WriteHeader(recorder.statusCode)
+	}
+	_, _ = recorder.body.WriteTo(writer)
+}
+
+// routingDecisionKey is the context key of the routingDecision of the requests dispatched by the router in serveRoute.
+type routingDecisionKey struct{}
+
+// routingDecision holds the routing handler that the router has chosen for a request.
+type routingDecision struct {
+	handler http.Handler
+}
+
+// deferRoutingHandler wraps a routing handler of the router so that it is only recorded in the routing decision of
+// the request, to be called by serveRoute once the routes lock is released.
+func deferRoutingHandler(handler http.Handler) http.Handler {
+	if handler == nil {
+		return nil
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if decision, ok := r.Context().Value(routingDecisionKey{}).(*routingDecision); ok {
+			decision.handler = handler
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// bufferedResponseWriter records a response in memory.
+type bufferedResponseWriter struct {
+	header     http.Header
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedResponseWriter) Write(data []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	return w.body.Write(data)
+}
+
+func (w *bufferedResponseWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+}
+
+// lookupRoute returns the handle of the route that matches the method and the path.
+func (s *ServeMux) lookupRoute(method, path string) (httprouter.Handle, httprouter.Params, bool) {
+	s.routesMutex.RLock()
+	defer s.routesMutex.RUnlock()
+	return s.router.Lookup(method, path)
+}
+
+// lookupWebsocketRoute returns the handle of the route that supports websockets and matches the method and the path.
+func (s *ServeMux) lookupWebsocketRoute(method, path string) (httprouter.Handle, httprouter.Params, bool) {
+	s.routesMutex.RLock()
+	defer s.routesMutex.RUnlock()
+	return s.websocketRouter.Lookup(method, path)
+}
+
+// lookupRPCMethod returns the streaming mode of a gRPC method that has at least one registered route.
+func (s *ServeMux) lookupRPCMethod(rpcMethod string) (StreamingMode, bool) {
+	s.routesMutex.RLock()
+	defer s.routesMutex.RUnlock()
+	mode, ok := s.rpcMethods[rpcMethod]
+	return mode, ok
+}
+
+// serveMethodOverride serves a form-encoded POST request using the route registered for the method. The form values
+// in the request body are merged into the query parameters so that they can be used by the target route.
+func (s *ServeMux) serveMethodOverride(writer http.ResponseWriter, req *http.Request, method string) {
+	handle, params, _ := s.lookupRoute(method, req.URL.Path)
+	if handle == nil {
+		routingError := ErrRoutingNotFound
+		s.routesMutex.RLock()
+		for registeredMethod := range s.methods {
+			if h, _, _ := s.router.Lookup(registeredMethod, req.URL.Path); h != nil {
+				routingError = ErrRoutingMethodNotAllowed
+				break
+			}
+		}
+		s.routesMutex.RUnlock()
+		_, outboundMarshaler := s.MarshalerForRequest(req)
+		s.RoutingError(req.Context(), outboundMarshaler, writer, req, routingError)
+		return
+	}
+
+	// the form must be parsed before changing the method, otherwise the body does not get parsed.
+	if err := req.ParseForm(); err != nil {
+		_, outboundMarshaler := s.MarshalerForRequest(req)
+		sterr := status.Error(codes.InvalidArgument, err.Error())
+		s.HTTPError(req.Context(), outboundMarshaler, writer, req, sterr)
+		return
+	}
+
+	req.Method = method
+	req.URL.RawQuery = req.Form.Encode()
+	req.PostForm = url.Values{}
+	req.Body = http.NoBody
+	req.ContentLength = 0
+	req.Header.Del("Content-Type")
+
+	handle(writer, req, params)
 }
 
 // HandleWithParams registers a new handler for the method and pattern specified.
 //
 // NOTE: this method takes an httprouter.Handle function, helpful when path parameters are needed.
 // if using http.Handler is desired, use Handle instead.
-func (s *ServeMux) HandleWithParams(method, pattern string, handler httprouter.Handle) {
-	s.router.Handle(method, pattern, handler)
+//
+// Routes can be registered while the ServeMux is serving requests. Just like the router, this method panics if the
+// route conflicts with one of the registered routes. A route that was removed with RemoveRoute can be registered
+// again.
+func (s *ServeMux) HandleWithParams(method, pattern string, handler httprouter.Handle, options ...RouteOption) {
+	info := routeInfo(method, pattern, options)
+	s.register(info, s.wrapRoute(info, handler), false, true)
+}
+
+// ReplaceRoute registers a new handler for the method and pattern specified, replacing the handler and the RouteInfo
+// of the route if it is registered already.
+//
+// The requests that are in flight finish with the handler they started with, the new requests are served by the new
+// handler. The middlewares are selected again using the new RouteInfo, see WithMiddleware.
+func (s *ServeMux) ReplaceRoute(method, pattern string, handler httprouter.Handle, options ...RouteOption) {
+	info := routeInfo(method, pattern, options)
+	s.register(info, s.wrapRoute(info, handler), true, true)
+}
+
+// RemoveRoute removes the route with the method and pattern specified and reports whether or not the route was
+// registered.
+//
+// The route is no longer included in Routes and its requests are handled as routing errors with ErrRoutingNotFound,
+// see WithRoutingErrorHandler.
+func (s *ServeMux) RemoveRoute(method, pattern string) bool {
+	s.routesMutex.Lock()
+	defer s.routesMutex.Unlock()
+
+	route, ok := s.routes[routeKey(method, pattern)]
+	if !ok || route.active.Load() == nil {
+		return false
+	}
+
+	route.active.Store(nil)
+	s.updateRPCMethods()
+	return true
+}
+
+// handleEndpoint registers an endpoint of the ServeMux itself, which is not included in Routes and is not wrapped by
+// the middlewares.
+func (s *ServeMux) handleEndpoint(method, pattern string, handle httprouter.Handle) {
+	s.register(RouteInfo{HTTPMethod: method, Path: pattern}, handle, false, false)
+}
+
+func routeInfo(method, pattern string, options []RouteOption) RouteInfo {
+	info := RouteInfo{HTTPMethod: method, Path: pattern}
+	for _, option := range options {
+		option(&info)
+	}
+	return info
+}
+
+func (s *ServeMux) wrapRoute(info RouteInfo, handler httprouter.Handle) httprouter.Handle {
+	return s.wrapContentNegotiation(s.wrapRequestBody(info, s.wrapHandler(info, handler)))
+}
+
+// register registers the handle of a route on the routers or replaces the active handle of the route when "replace"
+// is set. The router panics if the route conflicts with the registered routes.
+func (s *ServeMux) register(info RouteInfo, handle httprouter.Handle, replace, listed bool) {
+	s.routesMutex.Lock()
+	defer s.routesMutex.Unlock()
+
+	key := routeKey(info.HTTPMethod, info.Path)
+	route, ok := s.routes[key]
+	if !ok {
+		route = &registeredRoute{}
+		s.router.Handle(info.HTTPMethod, info.Path, s.routeHandle(route, false))
+		s.routes[key] = route
+	} else if !replace && route.active.Load() != nil {
+		panic("a handle is already registered for path '" + info.Path + "'")
+	}
+
+	if info.SupportsWebsocket && !route.websocket {
+		s.websocketRouter.Handle(info.HTTPMethod, info.Path, s.routeHandle(route, true))
+		route.websocket = true
+	}
+
+	previous := route.active.Swap(&activeRoute{info: info, handle: handle, listed: listed})
+	s.methods[info.HTTPMethod] = struct{}{}
+	if previous == nil || previous.info.RPCMethod == info.RPCMethod {
+		if info.RPCMethod != "" {
+			s.rpcMethods[info.RPCMethod] = info.StreamingMode
+		}
+	} else {
+		s.updateRPCMethods()
+	}
+}
+
+// routeHandle returns the handle that is registered on the router for a route, which dispatches the requests to the
+// active handler of the route.
+func (s *ServeMux) routeHandle(route *registeredRoute, websocket bool) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		active := route.active.Load()
+		if active == nil || (websocket && !active.info.SupportsWebsocket) {
+			_, outboundMarshaler := s.MarshalerForRequest(r)
+			s.RoutingError(r.Context(), outboundMarshaler, w, r, ErrRoutingNotFound)
+			return
+		}
+
+		active.handle(w, r, p)
+	}
+}
+
+// updateRPCMethods rebuilds the gRPC methods that have at least one active route, routesMutex must be locked.
+func (s *ServeMux) updateRPCMethods() {
+	clear(s.rpcMethods)
+	for _, route := range s.routes {
+		if active := route.active.Load(); active != nil && active.info.RPCMethod != "" {
+			s.rpcMethods[active.info.RPCMethod] = active.info.StreamingMode
+		}
+	}
+}
+
+// Routes returns the routes that are registered on the ServeMux, sorted by their path and HTTP method.
+//
+// The routes registered with Handle and HandleWithParams are included, the routes removed with RemoveRoute are not.
+// The generated Register functions describe the gRPC method and binding behind each route, see RouteInfo.
+func (s *ServeMux) Routes() []RouteInfo {
+	s.routesMutex.RLock()
+	routes := make([]RouteInfo, 0, len(s.routes))
+	for _, route := range s.routes {
+		if active := route.active.Load(); active != nil && active.listed {
+			routes = append(routes, active.info)
+		}
+	}
+	s.routesMutex.RUnlock()
+
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].HTTPMethod < routes[j].HTTPMethod
+	})
+	return routes
 }
 
 // Handle registers a new handler for the method and pattern specified.
-func (s *ServeMux) Handle(method, pattern string, handler http.Handler) {
-	s.router.Handler(method, pattern, handler)
+func (s *ServeMux) Handle(method, pattern string, handler http.Handler, options ...RouteOption) {
+	s.HandleWithParams(method, pattern, func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		if len(p) > 0 {
+			r = r.WithContext(context.WithValue(r.Context(), httprouter.ParamsKey, p))
+		}
+		handler.ServeHTTP(w, r)
+	}, options...)
 }
 
 // MarshalerForRequest returns the inbound/outbound marshalers for this request.
@@ -171,14 +556,28 @@ func (s *ServeMux) Handle(method, pattern string, handler http.Handler) {
 // If there are multiple Content-Type headers set, choose the first one that it can
 // exactly match in the registry.
 // Otherwise, it follows the above logic for "*"/InboundMarshaler/OutboundMarshaler.
+//
+// The outbound marshaler is negotiated using the Accept header, supporting quality values, wildcards, media type
+// parameters and structured syntax suffixes such as "application/vnd.acme+json". If none of the registered marshalers
+// are acceptable, the inbound marshaler is used.
+//
+// For websocket upgrade requests, a marshaler chosen by the Sec-WebSocket-Protocol header is used for both directions,
+// see WebsocketConfig.Subprotocols.
 func (s *ServeMux) MarshalerForRequest(req *http.Request) (inbound, outbound Marshaler) {
-	for _, acceptVal := range req.Header[protomarshal.AcceptHeader] {
-		if m, ok := s.marshalers.MIMEMap[acceptVal]; ok {
-			outbound = m
-			break
+	inbound, outbound, _ = s.marshalersForRequest(req)
+	return inbound, outbound
+}
+
+// marshalersForRequest returns the inbound/outbound marshalers for this request and whether or not the outbound
+// marshaler is acceptable by the client.
+func (s *ServeMux) marshalersForRequest(req *http.Request) (inbound, outbound Marshaler, acceptable bool) {
+	if s.IsWebsocketUpgrade(req) {
+		if _, marshaler, ok := s.websocketSubprotocol(req); ok {
+			return marshaler, marshaler, true
 		}
 	}
 
+	inboundKey := protomarshal.MIMEWildcard
 	for _, contentTypeVal := range req.Header[protomarshal.ContentTypeHeader] {
 		contentType, _, err := mime.ParseMediaType(contentTypeVal)
 		if err != nil {
@@ -187,6 +586,10 @@ func (s *ServeMux) MarshalerForRequest(req *http.Request) (inbound, outbound Mar
 		}
 		if m, ok := s.marshalers.MIMEMap[contentType]; ok {
 			inbound = m
+			inboundKey = contentType
+			if aware, ok := m.(protomarshal.ContentTypeAware); ok {
+				inbound = aware.ForContentType(contentTypeVal)
+			}
 			break
 		}
 	}
@@ -194,16 +597,18 @@ func (s *ServeMux) MarshalerForRequest(req *http.Request) (inbound, outbound Mar
 	if inbound == nil {
 		inbound = s.marshalers.MIMEMap[protomarshal.MIMEWildcard]
 	}
-	if outbound == nil {
-		outbound = inbound
-	}
 
-	return inbound, outbound
+	outbound, acceptable = s.negotiateOutbound(req.Header[protomarshal.AcceptHeader], inbound, inboundKey)
+	return inbound, outbound, acceptable
 }
 
 // IsWebsocketUpgrade returns whether or not the client is requesting for connection upgrade to websocket and server is
-// capable of upgrading. If websocket upgrade function is not setup, this method returns false.
+// capable of upgrading. If websocket upgrade function is not setup, this method returns false. The requests of the
+// streams of a multiplexed websocket connection are always upgrade requests, see WithWebsocketMultiplexerAt.
 func (s *ServeMux) IsWebsocketUpgrade(req *http.Request) bool {
+	if _, ok := req.Context().Value(multiplexedStreamKey{}).(*multiplexedStream); ok {
+		return true
+	}
 	if s.websocketUpgradeFunc == nil {
 		return false
 	}
@@ -220,8 +625,20 @@ func (s *ServeMux) IsSSE(req *http.Request) bool {
 	return strings.Contains(req.Header.Get("Accept"), "text/event-stream")
 }
 
+func isUpgradeRequest(r *http.Request) bool {
+	return r.Header.Get("Upgrade") != ""
+}
+
+func isPreflightRequest(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get(corsRequestMethodHeader) != ""
+}
+
 func (s *ServeMux) isPathLengthFallback(r *http.Request) bool {
-	return !s.disablePathLengthFallback && r.Method == http.MethodPost && r.Header.Get("Content-Type") == "application/x-www-form-urlencoded"
+	if s.disablePathLengthFallback || r.Method != http.MethodPost {
+		return false
+	}
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && contentType == "application/x-www-form-urlencoded"
 }
 
 func (s *ServeMux) ForwardResponseMessage(
@@ -302,6 +719,7 @@ func (s *ServeMux) ForwardResponseStreamChunked(
 		http.Error(writer, "unexpected error", http.StatusInternalServerError)
 		return
 	}
+	defer s.startStream(ctx, StreamKindChunked)()
 	s.handleForwardResponseServerMetadata(writer, md)
 
 	writer.Header().Set("Transfer-Encoding", "chunked")
@@ -393,6 +811,7 @@ func (s *ServeMux) ForwardResponseStreamSSE(
 		http.Error(writer, "unexpected error", http.StatusInternalServerError)
 		return
 	}
+	defer s.startStream(ctx, StreamKindSSE)()
 	s.handleForwardResponseServerMetadata(writer, md)
 
 	writer.Header().Set("Content-Type", "text/event-stream")
@@ -470,29 +889,42 @@ func (s *ServeMux) ForwardWebsocket(
 	inboundMarshaler, outboundMarshaler Marshaler,
 	protoReq, protoRes ProtoMessage) {
 
+	defer s.startStream(ctx, StreamKindWebsocket)()
+	session := s.newWebsocketSession(ws, websocketMessageType(outboundMarshaler))
+	ws = session
 	closeWebsocketConnection := sync.OnceFunc(func() {
 		if err := ws.Close(); err != nil {
 			grpclog.Infof("Failed to close websocket connection: %v", err)
 		}
 	})
 	defer closeWebsocketConnection()
+	defer session.startKeepalive(func(err error) {
+		s.WebsocketError(ctx, outboundMarshaler, req, ws, err)
+		closeWebsocketConnection()
+	})()
 
 	getResponseBody, hasPartialResponseBody := protoRes.(partialResponse)
 	getRequestBody, hasPartialRequestBody := protoReq.(partialRequest)
 
 	// receive from gRPC stream and forward to websocket.
+	responsesDone := make(chan struct{})
 	go func() {
+		defer close(responsesDone)
 		defer closeWebsocketConnection()
 
+		if s.websocketConfig.Envelope {
+			if err := s.sendWebsocketHeader(outboundMarshaler, ws, stream); err != nil {
+				grpclog.Infof("Failed to send gRPC header via websocket connection: %v", err)
+				return
+			}
+		}
+
 		var data []byte
 		for {
 			protoRes.Reset()
 			err := stream.RecvMsg(protoRes)
-			if err == io.EOF {
-				break
-			}
 			if err != nil {
-				grpclog.Infof("Failed to receive message from gRPC stream: %v", err)
+				s.handleWebsocketStreamEnd(ctx, outboundMarshaler, req, session, stream, err)
 				break
 			}
 			if hasPartialResponseBody {
@@ -500,8 +932,11 @@ func (s *ServeMux) ForwardWebsocket(
 			} else {
 				data, err = outboundMarshaler.Marshal(protoRes)
 			}
+			if err == nil && s.websocketConfig.Envelope {
+				data, err = wrapWebsocketMessage(outboundMarshaler, data)
+			}
 			if err != nil {
-				s.websocketErrorHandler(ctx, outboundMarshaler, req, ws, ErrMarshal{Err: err, Inbound: false})
+				s.websocketErrorHandler(s.errorContext(ctx), outboundMarshaler, req, ws, ErrMarshal{Err: err, Inbound: false})
 				break
 			}
 			if err := ws.SendMessage(data); err != nil {
@@ -512,13 +947,19 @@ func (s *ServeMux) ForwardWebsocket(
 	}()
 
 	// receive from websocket, forward to gRPC stream.
+	inputEnded := false
 	for {
 		data, err := ws.ReceiveMessage()
 		if err == io.EOF {
 			break
 		}
+		if errors.Is(err, errMultiplexedStreamInputEnded) {
+			inputEnded = true
+			break
+		}
 		if err != nil {
 			grpclog.Infof("failed to receive message: %v", err)
+			s.handleWebsocketReceiveError(ctx, outboundMarshaler, req, ws, err)
 			break
 		}
 		protoReq.Reset()
@@ -529,7 +970,7 @@ func (s *ServeMux) ForwardWebsocket(
 		}
 		if err != nil {
 			grpclog.Infof("Failed to decode request from websocket: %v", err)
-			s.websocketErrorHandler(ctx, outboundMarshaler, req, ws, ErrMarshal{Err: err, Inbound: true})
+			s.websocketErrorHandler(s.errorContext(ctx), outboundMarshaler, req, ws, ErrMarshal{Err: err, Inbound: true})
 			break
 		}
 
@@ -543,6 +984,10 @@ func (s *ServeMux) ForwardWebsocket(
 	if err := stream.CloseSend(); err != nil {
 		grpclog.Infof("Failed to terminate gRPC client stream: %v")
 	}
+	if inputEnded {
+		// the responses are still forwarded after the client ends the input of a multiplexed stream.
+		<-responsesDone
+	}
 }
 
 func (s *ServeMux) ForwardWebsocketServerStreaming(
@@ -551,36 +996,45 @@ func (s *ServeMux) ForwardWebsocketServerStreaming(
 	outboundMarshaler Marshaler,
 	protoRes ProtoMessage) {
 
+	defer s.startStream(ctx, StreamKindWebsocket)()
+	session := s.newWebsocketSession(ws, websocketMessageType(outboundMarshaler))
+	ws = session
 	closeWebsocketConnection := sync.OnceFunc(func() {
 		if err := ws.Close(); err != nil {
 			grpclog.Infof("Failed to close websocket connection: %v", err)
 		}
 	})
 	defer closeWebsocketConnection()
+	defer session.startKeepalive(func(err error) {
+		s.WebsocketError(ctx, outboundMarshaler, req, ws, err)
+		closeWebsocketConnection()
+	})()
 
 	// receive from gRPC stream and forward to websocket.
+	responsesDone := make(chan struct{})
 	go func() {
+		defer close(responsesDone)
 		defer closeWebsocketConnection()
 
+		if s.websocketConfig.Envelope {
+			if err := s.sendWebsocketHeader(outboundMarshaler, ws, stream); err != nil {
+				grpclog.Infof("Failed to send gRPC header via websocket connection: %v", err)
+				return
+			}
+		}
+
 		for {
 			protoRes.Reset()
-			err := stream.RecvMsg(protoRes)
-			if err == io.EOF {
-				if err := ws.SendClose(); err != nil {
-					grpclog.Infof("Failed to send websocket close message: %v", err)
-				}
-				break
-			}
-			if err != nil {
-				if err := ws.SendClose(); err != nil {
-					grpclog.Infof("Failed to send websocket close message: %v", err)
-				}
-				grpclog.Infof("Failed to receive message from gRPC stream: %v", err)
+			if err := stream.RecvMsg(protoRes); err != nil {
+				s.handleWebsocketStreamEnd(ctx, outboundMarshaler, req, session, stream, err)
 				break
 			}
 			data, err := outboundMarshaler.Marshal(protoRes)
+			if err == nil && s.websocketConfig.Envelope {
+				data, err = wrapWebsocketMessage(outboundMarshaler, data)
+			}
 			if err != nil {
-				s.websocketErrorHandler(ctx, outboundMarshaler, req, ws, ErrMarshal{Err: err, Inbound: false})
+				s.websocketErrorHandler(s.errorContext(ctx), outboundMarshaler, req, ws, ErrMarshal{Err: err, Inbound: false})
 				break
 			}
 			if err := ws.SendMessage(data); err != nil {
@@ -590,14 +1044,20 @@ func (s *ServeMux) ForwardWebsocketServerStreaming(
 		}
 	}()
 
-	// receive from websocket, forward to gRPC stream.
+	// receive from websocket to process the control messages and to detect the closure of the connection.
 	for {
 		_, err := ws.ReceiveMessage()
 		if err == io.EOF {
 			break
 		}
+		if errors.Is(err, errMultiplexedStreamInputEnded) {
+			// the responses are still forwarded after the client ends the input of a multiplexed stream.
+			<-responsesDone
+			break
+		}
 		if err != nil {
 			grpclog.Infof("failed to receive message: %v", err)
+			s.handleWebsocketReceiveError(ctx, outboundMarshaler, req, ws, err)
 			break
 		}
 	}
@@ -0,0 +1,232 @@
+package gateway_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/meshapi/grpc-api-gateway/gateway"
+	"google.golang.org/grpc/codes"
+)
+
+func TestPathLengthFallback(t *testing.T) {
+	mux := gateway.NewServeMux()
+	mux.HandleWithParams(http.MethodGet, "/v1/items/:id", func(w http.ResponseWriter, r *http.Request, p gateway.Params) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("failed to parse form: %s", err)
+		}
+		_, _ = w.Write([]byte("GET " + p.ByName("id") + " " + r.Form.Encode()))
+	})
+	mux.HandleWithParams(http.MethodDelete, "/v1/items/:id", func(w http.ResponseWriter, r *http.Request, p gateway.Params) {
+		_, _ = w.Write([]byte("DELETE " + p.ByName("id") + " " + r.URL.Query().Encode()))
+	})
+	mux.HandleWithParams(http.MethodPost, "/v1/create", func(w http.ResponseWriter, r *http.Request, _ gateway.Params) {
+		_, _ = w.Write([]byte("POST"))
+	})
+
+	testCases := []struct {
+		Name           string
+		Path           string
+		Override       string
+		Form           url.Values
+		ExpectedStatus int
+		ExpectedBody   string
+	}{
+		{
+			Name:           "ImplicitGET",
+			Path:           "/v1/items/1?filter=a",
+			Form:           url.Values{"ids": {"1", "2"}},
+			ExpectedStatus: http.StatusOK,
+			ExpectedBody:   "GET 1 filter=a&ids=1&ids=2",
+		},
+		{
+			Name:           "Override",
+			Path:           "/v1/items/2",
+			Override:       "delete",
+			Form:           url.Values{"force": {"true"}},
+			ExpectedStatus: http.StatusOK,
+			ExpectedBody:   "DELETE 2 force=true",
+		},
+		{
+			Name:           "POSTRoute",
+			Path:           "/v1/create",
+			Form:           url.Values{"a": {"b"}},
+			ExpectedStatus: http.StatusOK,
+			ExpectedBody:   "POST",
+		},
+		{
+			Name:           "MethodNotAllowed",
+			Path:           "/v1/items/2",
+			Override:       "PUT",
+			ExpectedStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			Name:           "NotFound",
+			Path:           "/v1/unknown",
+			Override:       "GET",
+			ExpectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.Path, strings.NewReader(tt.Form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+			if tt.Override != "" {
+				req.Header.Set("X-HTTP-Method-Override", tt.Override)
+			}
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.ExpectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.ExpectedStatus, recorder.Code, recorder.Body.String())
+			}
+			if tt.ExpectedBody != "" && recorder.Body.String() != tt.ExpectedBody {
+				t.Fatalf("expected body %q, got %q", tt.ExpectedBody, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestPathLengthFallbackInvalidForm(t *testing.T) {
+	recorder := &requestsRecorder{}
+	mux := gateway.NewServeMux(gateway.WithMetricsRecorder(recorder))
+	mux.HandleWithParams(http.MethodGet, "/v1/items/:id", func(w http.ResponseWriter, r *http.Request, p gateway.Params) {
+		t.Error("expected the handler not to be called")
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/items/1", strings.NewReader("filter=%zz"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response := httptest.NewRecorder()
+	mux.ServeHTTP(response, req)
+
+	if response.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusBadRequest, response.Code, response.Body.String())
+	}
+	if len(recorder.requests) != 1 || recorder.requests[0].Code != codes.InvalidArgument {
+		t.Errorf("expected the request to be recorded with InvalidArgument, got %+v", recorder.requests)
+	}
+}
+
+func TestRoutingWithoutRoutesLock(t *testing.T) {
+	var mux *gateway.ServeMux
+	var registerOnce sync.Once
+	mux = gateway.NewServeMux(gateway.WithRoutingErrorHandler(func(
+		ctx context.Context, _ *gateway.ServeMux, marshaler gateway.Marshaler,
+		w http.ResponseWriter, r *http.Request, err gateway.ErrRouting) {
+
+		// registering a route waits for the routes lock, the routes can still be read by the routing error handler.
+		registerOnce.Do(func() {
+			registered := make(chan struct{})
+			go func() {
+				defer close(registered)
+				mux.HandleWithParams(http.MethodGet, "/v1/other", func(http.ResponseWriter, *http.Request, gateway.Params) {})
+			}()
+			time.Sleep(10 * time.Millisecond)
+			_ = mux.Routes()
+			<-registered
+		})
+
+		gateway.DefaultRoutingErrorHandler(ctx, mux, marshaler, w, r, err)
+	}))
+	mux.HandleWithParams(http.MethodGet, "/v1/items/", func(http.ResponseWriter, *http.Request, gateway.Params) {})
+
+	served := make(chan *httptest.ResponseRecorder)
+	go func() {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/missing", nil))
+		served <- recorder
+	}()
+	select {
+	case recorder := <-served:
+		if recorder.Code != http.StatusNotFound {
+			t.Errorf("expected 404, got %d", recorder.Code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the routing error handler is blocked by the routes lock")
+	}
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/items", nil))
+	if recorder.Code != http.StatusMovedPermanently || recorder.Header().Get("Location") != "/v1/items/" {
+		t.Errorf("expected a redirect to /v1/items/, got %d %q", recorder.Code, recorder.Header().Get("Location"))
+	}
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/v1/other", nil))
+	if recorder.Code != http.StatusMethodNotAllowed || recorder.Header().Get("Allow") == "" {
+		t.Errorf("expected 405 with the allowed methods, got %d %q", recorder.Code, recorder.Header().Get("Allow"))
+	}
+}
+
+func TestReplaceAndRemoveRoute(t *testing.T) {
+	var selected []string
+	mux := gateway.NewServeMux(
+		gateway.WithRoutingErrorHandler(func(
+			_ context.Context, _ *gateway.ServeMux, _ gateway.Marshaler, w http.ResponseWriter, _ *http.Request,
+			err gateway.ErrRouting) {
+			w.WriteHeader(http.StatusTeapot)
+		}),
+		gateway.WithRouteMiddleware(nil, func(info gateway.RouteInfo, next httprouter.Handle) httprouter.Handle {
+			selected = append(selected, info.RPCMethod)
+			return next
+		}),
+	)
+
+	respond := func(body string) func(http.ResponseWriter, *http.Request, gateway.Params) {
+		return func(w http.ResponseWriter, _ *http.Request, p gateway.Params) {
+			_, _ = w.Write([]byte(body + " " + p.ByName("id")))
+		}
+	}
+	serve := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/items/1", nil))
+		return recorder
+	}
+
+	mux.HandleWithParams(http.MethodGet, "/v1/items/:id", respond("first"),
+		gateway.WithRouteInfo(gateway.RouteInfo{RPCMethod: "/test.Service/First"}))
+	mux.ReplaceRoute(http.MethodGet, "/v1/items/:id", respond("second"),
+		gateway.WithRouteInfo(gateway.RouteInfo{RPCMethod: "/test.Service/Second"}))
+
+	if body := serve().Body.String(); body != "second 1" {
+		t.Errorf("expected the replaced handler to be served, got %q", body)
+	}
+	if routes := mux.Routes(); len(routes) != 1 || routes[0].RPCMethod != "/test.Service/Second" {
+		t.Errorf("expected the route info to be replaced, got %+v", routes)
+	}
+	if strings.Join(selected, ",") != "/test.Service/First,/test.Service/Second" {
+		t.Errorf("expected the middlewares to be selected with the new route info, got %v", selected)
+	}
+
+	if !mux.RemoveRoute(http.MethodGet, "/v1/items/:id") {
+		t.Error("expected the route to be removed")
+	}
+	if mux.RemoveRoute(http.MethodGet, "/v1/items/:id") {
+		t.Error("expected the removed route not to be removed again")
+	}
+	if routes := mux.Routes(); len(routes) != 0 {
+		t.Errorf("expected the removed route not to be listed, got %+v", routes)
+	}
+	if recorder := serve(); recorder.Code != http.StatusTeapot {
+		t.Errorf("expected the routing error handler to handle the removed route, got %d", recorder.Code)
+	}
+
+	mux.HandleWithParams(http.MethodGet, "/v1/items/:id", respond("third"))
+	if body := serve().Body.String(); body != "third 1" {
+		t.Errorf("expected the route to be registered again, got %q", body)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected registering an active route again to panic")
+		}
+	}()
+	mux.HandleWithParams(http.MethodGet, "/v1/items/:id", respond("fourth"))
+}
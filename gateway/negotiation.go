@@ -0,0 +1,218 @@
+package gateway
+
+import (
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/meshapi/grpc-api-gateway/protomarshal"
+)
+
+// mediaRange is a single media range of an Accept header, e.g. "application/*;q=0.5".
+type mediaRange struct {
+	mainType string
+	subType  string
+	params   map[string]string
+	quality  float64
+	// index is the position of the media range in the Accept header, used to break ties.
+	index int
+}
+
+// parseAccept parses the media ranges of the Accept header values. Invalid media ranges are ignored.
+func parseAccept(values []string) []mediaRange {
+	var ranges []mediaRange
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if strings.TrimSpace(item) == "" {
+				continue
+			}
+
+			mediaType, params, err := mime.ParseMediaType(item)
+			if err != nil {
+				continue
+			}
+
+			mainType, subType, found := strings.Cut(mediaType, "/")
+			if !found || mainType == "" || subType == "" || (mainType == "*" && subType != "*") {
+				continue
+			}
+
+			quality := 1.0
+			if value, ok := params["q"]; ok {
+				q, err := strconv.ParseFloat(value, 64)
+				if err != nil || q < 0 || q > 1 {
+					continue
+				}
+				quality = q
+				delete(params, "q")
+			}
+
+			ranges = append(ranges, mediaRange{
+				mainType: mainType,
+				subType:  subType,
+				params:   params,
+				quality:  quality,
+				index:    len(ranges),
+			})
+		}
+	}
+
+	return ranges
+}
+
+// media range match specificity levels, params add to these values.
+const (
+	matchAny = iota * 100
+	matchMainType
+	matchSuffix
+	matchExact
+)
+
+// match returns the specificity of the match of the media range for a media type and whether or not it matches.
+//
+// Structured syntax suffixes are supported, e.g. "application/vnd.acme+json" matches "application/json".
+// Parameters of the media range must match the parameters of the media type when the media type has them.
+func (m mediaRange) match(mainType, subType string, params map[string]string) (int, bool) {
+	var specificity int
+	switch {
+	case m.mainType == "*":
+		return matchAny, true
+	case m.mainType != mainType:
+		return 0, false
+	case m.subType == "*":
+		return matchMainType, true
+	case m.subType == subType:
+		specificity = matchExact
+	default:
+		if _, suffix, found := strings.Cut(m.subType, "+"); !found || suffix != subType {
+			return 0, false
+		}
+		specificity = matchSuffix
+	}
+
+	for key, value := range m.params {
+		expected, ok := params[key]
+		if !ok {
+			continue
+		}
+		if !strings.EqualFold(expected, value) {
+			return 0, false
+		}
+		specificity++
+	}
+
+	return specificity, true
+}
+
+// negotiationCandidate is a registered marshaler that can be selected for the response.
+type negotiationCandidate struct {
+	key         string
+	marshaler   Marshaler
+	quality     float64
+	specificity int
+	index       int
+}
+
+// negotiateOutbound selects the outbound marshaler using the Accept header values following the RFC 9110 content
+// negotiation. The marshaler registered for "*" is considered using its content type.
+//
+// When the highest quality media range matches multiple marshalers, explicitly registered marshalers are preferred
+// for named media types and the inbound marshaler is preferred otherwise. If no registered marshaler is acceptable,
+// the inbound marshaler is returned along with false.
+//
+// See: https://www.rfc-editor.org/rfc/rfc9110#name-accept
+func (s *ServeMux) negotiateOutbound(accept []string, inbound Marshaler, inboundKey string) (Marshaler, bool) {
+	ranges := parseAccept(accept)
+	if len(ranges) == 0 {
+		return inbound, true
+	}
+
+	keys := make([]string, 0, len(s.marshalers.MIMEMap))
+	for key := range s.marshalers.MIMEMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var best *negotiationCandidate
+	for _, key := range keys {
+		marshaler := s.marshalers.MIMEMap[key]
+		contentType := key
+		if key == protomarshal.MIMEWildcard {
+			contentType = marshaler.ContentType(nil)
+		}
+
+		candidate := negotiationCandidate{key: key, marshaler: marshaler, specificity: -1}
+		mediaType, params, err := mime.ParseMediaType(contentType)
+		if err == nil {
+			mainType, subType, _ := strings.Cut(mediaType, "/")
+			for _, mediaRange := range ranges {
+				specificity, ok := mediaRange.match(mainType, subType, params)
+				if !ok || specificity <= candidate.specificity {
+					continue
+				}
+				candidate.quality = mediaRange.quality
+				candidate.specificity = specificity
+				candidate.index = mediaRange.index
+			}
+		}
+
+		if candidate.quality == 0 {
+			continue
+		}
+
+		if best == nil || candidate.isPreferredOver(best, inboundKey) {
+			best = &candidate
+		}
+	}
+
+	if best == nil {
+		return inbound, false
+	}
+
+	return best.marshaler, true
+}
+
+func (c *negotiationCandidate) isPreferredOver(other *negotiationCandidate, inboundKey string) bool {
+	switch {
+	case c.quality != other.quality:
+		return c.quality > other.quality
+	case c.specificity != other.specificity:
+		return c.specificity > other.specificity
+	case c.index != other.index:
+		return c.index < other.index
+	}
+
+	// explicitly registered marshalers take precedence over the fallback marshaler for the media types named in the
+	// Accept header, otherwise the inbound marshaler is preferred.
+	cIsFallback, otherIsFallback := c.key == protomarshal.MIMEWildcard, other.key == protomarshal.MIMEWildcard
+	if c.specificity >= matchSuffix && cIsFallback != otherIsFallback {
+		return otherIsFallback
+	}
+	if (c.key == inboundKey) != (other.key == inboundKey) {
+		return c.key == inboundKey
+	}
+	return otherIsFallback && !cIsFallback
+}
+
+// wrapContentNegotiation returns a handler that responds with ErrRoutingNotAcceptable routing error when the strict
+// content negotiation is enabled and none of the registered marshalers are acceptable.
+func (s *ServeMux) wrapContentNegotiation(handler httprouter.Handle) httprouter.Handle {
+	if !s.strictContentNegotiation {
+		return handler
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		if !s.IsSSE(r) && !isUpgradeRequest(r) {
+			if _, outbound, acceptable := s.marshalersForRequest(r); !acceptable {
+				s.recordError(r, ErrRoutingNotAcceptable)
+				s.routingErrorHandler(r.Context(), s, outbound, w, r, ErrRoutingNotAcceptable)
+				return
+			}
+		}
+
+		handler(w, r, p)
+	}
+}
@@ -0,0 +1,135 @@
+package gateway_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/meshapi/grpc-api-gateway/gateway"
+	"github.com/meshapi/grpc-api-gateway/protomarshal"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestMarshalerForRequestNegotiation(t *testing.T) {
+	protoMarshaler := &protomarshal.ProtoMarshaller{}
+	jsonMarshaler := &protomarshal.JSONBuiltin{}
+	mux := gateway.NewServeMux(
+		gateway.WithMarshalerOption("application/x-protobuf", protoMarshaler),
+		gateway.WithMarshalerOption("application/json", jsonMarshaler),
+	)
+
+	testCases := []struct {
+		Name        string
+		Accept      []string
+		ContentType string
+		Expected    gateway.Marshaler
+	}{
+		{
+			Name:     "NoAccept",
+			Expected: protomarshal.DefaultMarshaler,
+		},
+		{
+			Name:     "Exact",
+			Accept:   []string{"application/x-protobuf"},
+			Expected: protoMarshaler,
+		},
+		{
+			Name:     "QualityValues",
+			Accept:   []string{"application/json;q=0.9, application/x-protobuf"},
+			Expected: protoMarshaler,
+		},
+		{
+			Name:     "MultipleHeaders",
+			Accept:   []string{"text/html", "application/json;q=0.5", "application/x-protobuf;q=0.4"},
+			Expected: jsonMarshaler,
+		},
+		{
+			Name:     "Parameters",
+			Accept:   []string{"application/json; charset=utf-8"},
+			Expected: jsonMarshaler,
+		},
+		{
+			Name:     "StructuredSuffix",
+			Accept:   []string{"application/vnd.acme+json"},
+			Expected: jsonMarshaler,
+		},
+		{
+			Name:        "MainTypeWildcardPrefersInbound",
+			Accept:      []string{"application/*"},
+			ContentType: "application/x-protobuf",
+			Expected:    protoMarshaler,
+		},
+		{
+			Name:        "AnyPrefersInbound",
+			Accept:      []string{"*/*"},
+			ContentType: "application/x-protobuf",
+			Expected:    protoMarshaler,
+		},
+		{
+			Name:     "MoreSpecificRangeWins",
+			Accept:   []string{"application/*;q=0.8, application/json;q=0.1"},
+			Expected: protoMarshaler,
+		},
+		{
+			Name:        "Excluded",
+			Accept:      []string{"application/x-protobuf;q=0, */*"},
+			ContentType: "application/x-protobuf",
+			Expected:    jsonMarshaler,
+		},
+		{
+			Name:        "NotAcceptableFallsBackToInbound",
+			Accept:      []string{"text/html"},
+			ContentType: "application/x-protobuf",
+			Expected:    protoMarshaler,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/items", nil)
+			req.Header["Accept"] = tt.Accept
+			if tt.ContentType != "" {
+				req.Header.Set("Content-Type", tt.ContentType)
+			}
+			if _, outbound := mux.MarshalerForRequest(req); outbound != tt.Expected {
+				t.Fatalf("expected outbound marshaler %T, got %T", tt.Expected, outbound)
+			}
+		})
+	}
+}
+
+func TestStrictContentNegotiation(t *testing.T) {
+	mux := gateway.NewServeMux(gateway.WithStrictContentNegotiation())
+	mux.HandleWithParams(http.MethodGet, "/v1/items", func(w http.ResponseWriter, r *http.Request, _ gateway.Params) {
+		ctx := gateway.NewServerMetadataContext(r.Context(), gateway.ServerMetadata{})
+		_, outbound := mux.MarshalerForRequest(r)
+		mux.ForwardResponseMessage(ctx, outbound, w, r, wrapperspb.String("item"))
+	})
+
+	testCases := []struct {
+		Name     string
+		Accept   string
+		Expected int
+	}{
+		{Name: "NoAccept", Expected: http.StatusOK},
+		{Name: "DefaultMarshaler", Accept: "application/json", Expected: http.StatusOK},
+		{Name: "Wildcard", Accept: "text/html, */*;q=0.1", Expected: http.StatusOK},
+		{Name: "NotAcceptable", Accept: "text/html, application/xml", Expected: http.StatusNotAcceptable},
+		{Name: "Excluded", Accept: "application/json;q=0", Expected: http.StatusNotAcceptable},
+		{Name: "EventStream", Accept: "text/event-stream", Expected: http.StatusOK},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/items", nil)
+			if tt.Accept != "" {
+				req.Header.Set("Accept", tt.Accept)
+			}
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, req)
+			if recorder.Code != tt.Expected {
+				t.Fatalf("expected status %d, got %d: %s", tt.Expected, recorder.Code, recorder.Body)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package gateway
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/julienschmidt/httprouter"
 
@@ -9,6 +10,7 @@ import (
 	"google.golang.org/grpc/grpclog"
 	"google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
 // SSEMessage describes a single Server-Sent Events (SSE) message.
@@ -71,6 +73,16 @@ func WithWebsocketUpgrader(upgradeFunc WebsocketUpgradeFunc) ServeMuxOption {
 	})
 }
 
+// WithWebsocketConfig sets the keepalive and the limits of the websocket connections.
+//
+// When a timeout passes, a DeadlineExceeded error is sent to the client through the websocket error handler and the
+// connection is closed, which ends the forwarding and cancels the context of the gRPC stream.
+func WithWebsocketConfig(config WebsocketConfig) ServeMuxOption {
+	return optionFunc(func(s *ServeMux) {
+		s.websocketConfig = config
+	})
+}
+
 // WithSSEConfig sets Server-Sent Events (SSE) configuration.
 func WithSSEConfig(config SSEConfig) ServeMuxOption {
 	return optionFunc(func(s *ServeMux) {
@@ -169,6 +181,90 @@ func WithStreamErrorHandler(fn StreamErrorHandlerFunc) ServeMuxOption {
 	})
 }
 
+// WithStatusCodeMapping returns a ServeMuxOption that overrides the HTTP status codes used for gRPC codes. Codes that
+// are not in the mapping use HTTPStatusFromCode. Multiple mappings get merged.
+//
+// The mapping is used by the default error handlers, including the routing errors. Custom error handlers can use
+// ServeMux.HTTPStatus or HTTPStatusFromContext to respect it.
+//
+// HTTP status codes must be between 200 and 999, the other ones are ignored. The default error handlers do not write
+// a response body for the 204 and 304 status codes.
+func WithStatusCodeMapping(mapping map[codes.Code]int) ServeMuxOption {
+	return optionFunc(func(s *ServeMux) {
+		if s.statusCodeMapping == nil {
+			s.statusCodeMapping = make(map[codes.Code]int, len(mapping))
+		}
+		for code, httpStatus := range mapping {
+			if !isValidMappedStatus(code, httpStatus) {
+				continue
+			}
+			s.statusCodeMapping[code] = httpStatus
+		}
+	})
+}
+
+// WithMethodStatusCodeMapping returns a ServeMuxOption that overrides the HTTP status codes used for gRPC codes
+// returned by a gRPC method in the format of "/package.service/method". The method mapping takes precedence over
+// the mapping configured using WithStatusCodeMapping.
+//
+// The HTTP status codes are validated the same way as WithStatusCodeMapping.
+func WithMethodStatusCodeMapping(rpcMethod string, mapping map[codes.Code]int) ServeMuxOption {
+	return optionFunc(func(s *ServeMux) {
+		if s.methodStatusCodeMappings == nil {
+			s.methodStatusCodeMappings = make(map[string]map[codes.Code]int)
+		}
+		methodMapping, ok := s.methodStatusCodeMappings[rpcMethod]
+		if !ok {
+			methodMapping = make(map[codes.Code]int, len(mapping))
+			s.methodStatusCodeMappings[rpcMethod] = methodMapping
+		}
+		for code, httpStatus := range mapping {
+			if !isValidMappedStatus(code, httpStatus) {
+				continue
+			}
+			methodMapping[code] = httpStatus
+		}
+	})
+}
+
+// isValidMappedStatus reports whether or not the HTTP status code can be used as the final status of an error
+// response, invalid status codes are logged.
+func isValidMappedStatus(code codes.Code, httpStatus int) bool {
+	if httpStatus < http.StatusOK || httpStatus > 999 {
+		grpclog.Warningf("Ignoring the invalid HTTP status code %d mapped to %s", httpStatus, code)
+		return false
+	}
+	return true
+}
+
+// WithErrorDetailHandler returns a ServeMuxOption that registers the handler that translates the google.rpc error
+// details with the full message name (e.g. "google.rpc.RetryInfo") into HTTP semantics, replacing any existing
+// handler for that message. A nil handler removes the handler for the message.
+//
+// See DefaultErrorDetailHandlers for the handlers that are registered by default.
+func WithErrorDetailHandler(name protoreflect.FullName, handler ErrorDetailHandlerFunc) ServeMuxOption {
+	return optionFunc(func(s *ServeMux) {
+		if handler == nil {
+			delete(s.errorDetailHandlers, name)
+			return
+		}
+		s.errorDetailHandlers[name] = handler
+	})
+}
+
+// WithProblemDetails returns a ServeMuxOption that configures the error, stream error, SSE error and websocket error
+// handlers to respond with RFC 7807 problem details documents.
+//
+// See ProblemDetailsFromStatus for how the gRPC status details get mapped.
+func WithProblemDetails() ServeMuxOption {
+	return optionFunc(func(s *ServeMux) {
+		s.errorHandler = ProblemDetailsHTTPErrorHandler
+		s.streamErrorHandler = ProblemDetailsStreamErrorHandler
+		s.sseErrorHandler = ProblemDetailsSSEErrorHandler
+		s.websocketErrorHandler = ProblemDetailsWebsocketErrorHandler
+	})
+}
+
 // WithRoutingErrorHandler returns a ServeMuxOption for configuring a custom error handler to handle http routing
 // errors.
 //
@@ -181,12 +277,41 @@ func WithRoutingErrorHandler(fn RoutingErrorHandlerFunc) ServeMuxOption {
 }
 
 // WithDisablePathLengthFallback returns a ServeMuxOption for disable path length fallback.
+//
+// Path length fallback allows clients to send requests with long query strings as POST requests with form-encoded
+// bodies. These requests are served by the route registered for the method specified in the X-HTTP-Method-Override
+// header or by the GET route when the header is absent and there is no POST route for the path. The form values get
+// merged into the query parameters.
 func WithDisablePathLengthFallback() ServeMuxOption {
 	return optionFunc(func(s *ServeMux) {
 		s.disablePathLengthFallback = true
 	})
 }
 
+// WithMarshalerOption returns a ServeMuxOption that registers a marshaler for a MIME type. Use "*"
+// (protomarshal.MIMEWildcard) to replace the fallback marshaler.
+//
+// The inbound marshaler is selected using the Content-Type header and the outbound marshaler is negotiated using the
+// Accept header.
+func WithMarshalerOption(mime string, marshaler Marshaler) ServeMuxOption {
+	return optionFunc(func(s *ServeMux) {
+		if err := s.marshalers.Add(mime, marshaler); err != nil {
+			panic(err)
+		}
+	})
+}
+
+// WithStrictContentNegotiation returns a ServeMuxOption that responds with ErrRoutingNotAcceptable routing error (406)
+// when the Accept header of a request does not accept any of the registered marshalers. By default, the inbound
+// marshaler is used in this case.
+//
+// Server-Sent Events and upgrade requests are not affected by this option.
+func WithStrictContentNegotiation() ServeMuxOption {
+	return optionFunc(func(s *ServeMux) {
+		s.strictContentNegotiation = true
+	})
+}
+
 // WithMethodNotAllowedHandler sets a configurable http.Handler which is called when a request
 // cannot be routed and HandleMethodNotAllowed is true.
 // If it is not set, http.Error with http.StatusMethodNotAllowed is used.
@@ -234,6 +359,118 @@ func WithGlobalOptionsHandler(handler http.Handler) ServeMuxOption {
 	})
 }
 
+// WithMiddleware returns a ServeMuxOption that wraps the handlers of all routes with the middlewares.
+//
+// Middlewares only apply to the routes registered after the ServeMux is created and the first middleware is the
+// outermost one.
+func WithMiddleware(middlewares ...Middleware) ServeMuxOption {
+	return optionFunc(func(s *ServeMux) {
+		for _, middleware := range middlewares {
+			middleware := middleware
+			s.middlewares = append(s.middlewares, middlewareEntry{
+				middleware: func(_ RouteInfo, handler httprouter.Handle) httprouter.Handle {
+					return middleware(handler)
+				},
+			})
+		}
+	})
+}
+
+// WithRouteMiddleware returns a ServeMuxOption that wraps the handlers of the routes selected by the selector with
+// the middleware. If the selector is nil, all routes are selected.
+//
+// The route information is available to the middleware when the route gets registered as well as in the request
+// context, see RouteInfoFromContext.
+func WithRouteMiddleware(selector RouteSelectorFunc, middleware RouteMiddleware) ServeMuxOption {
+	return optionFunc(func(s *ServeMux) {
+		s.middlewares = append(s.middlewares, middlewareEntry{selector: selector, middleware: middleware})
+	})
+}
+
+// WithMetricsRecorder returns a ServeMuxOption that records the metrics of all requests and response streams
+// using the recorder.
+func WithMetricsRecorder(recorder MetricsRecorder) ServeMuxOption {
+	return optionFunc(func(s *ServeMux) {
+		s.metricsRecorder = recorder
+	})
+}
+
+// WithTracer returns a ServeMuxOption that starts a span using the tracer for every request routed to a gRPC method.
+//
+// The W3C trace context (traceparent, tracestate and baggage headers) of the incoming request is the parent of the
+// span, the trace context of the span gets injected into the outgoing gRPC metadata and echoed back in the
+// traceresponse header. Use NoopTracer to only propagate the incoming trace context.
+func WithTracer(tracer Tracer) ServeMuxOption {
+	return optionFunc(func(s *ServeMux) {
+		s.tracer = tracer
+	})
+}
+
+// WithCompression returns a ServeMuxOption that compresses the responses using the content-coding negotiated through
+// the Accept-Encoding request header.
+//
+// Streaming responses (chunked transfer and SSE) are compressed and flushed per message. Websocket upgrades are never
+// compressed.
+func WithCompression(config CompressionConfig) ServeMuxOption {
+	return optionFunc(func(s *ServeMux) {
+		if config.Registry.compressors == nil {
+			config.Registry = NewCompressorRegistry()
+		}
+		if config.MinSize == 0 {
+			config.MinSize = DefaultCompressionMinSize
+		}
+		s.compression = &config
+	})
+}
+
+// WithMaxRequestBodySize returns a ServeMuxOption that limits the size of the request bodies in bytes. Reading more
+// than the limit fails with ErrRequestBodyTooLarge, which gets reported as ResourceExhausted with HTTP status 413.
+//
+// The limit applies to the decompressed body when request decompression is enabled. Zero or less means no limit,
+// which is the default.
+func WithMaxRequestBodySize(limit int64) ServeMuxOption {
+	return optionFunc(func(s *ServeMux) {
+		s.maxRequestBodySize = limit
+	})
+}
+
+// WithRouteMaxRequestBodySize returns a ServeMuxOption that overrides the request body size limit for the selected
+// routes. When multiple selectors match a route, the last one wins. Zero or less removes the limit for the selected
+// routes.
+//
+// NOTE: Limits are resolved when the routes are registered.
+func WithRouteMaxRequestBodySize(selector RouteSelectorFunc, limit int64) ServeMuxOption {
+	return optionFunc(func(s *ServeMux) {
+		s.requestBodyLimits = append(s.requestBodyLimits, requestBodyLimit{selector: selector, limit: limit})
+	})
+}
+
+// WithRequestDecompression returns a ServeMuxOption that transparently decompresses the request bodies based on the
+// Content-Encoding request header. Requests with an unsupported content-coding get rejected with HTTP status 415.
+func WithRequestDecompression(config DecompressionConfig) ServeMuxOption {
+	return optionFunc(func(s *ServeMux) {
+		decompressors := defaultDecompressors()
+		if config.Decompressors != nil {
+			decompressors = make(map[string]DecompressorFunc, len(config.Decompressors))
+			for name, decompressor := range config.Decompressors {
+				decompressors[strings.ToLower(name)] = decompressor
+			}
+		}
+		s.decompressors = decompressors
+	})
+}
+
+// WithCORS returns a ServeMuxOption that enforces the Cross-Origin Resource Sharing (CORS) policy on all routes.
+//
+// Preflight requests are answered by the automatic OPTIONS handling, so WithoutHandlingOptions disables them. If a
+// global OPTIONS handler is configured, it only receives OPTIONS requests that are not preflight requests.
+// Websocket upgrade requests from origins not allowed by the policy are rejected.
+func WithCORS(policy CORSPolicy) ServeMuxOption {
+	return optionFunc(func(s *ServeMux) {
+		s.cors = newCORSHandler(policy)
+	})
+}
+
 // WithHealthEndpointAt returns a ServeMuxOption that will add an endpoint to the created ServeMux at the path specified by endpointPath.
 // When called the handler will forward the request to the upstream grpc service health check (defined in the
 // gRPC Health Checking Protocol).
@@ -279,3 +516,29 @@ func WithHealthEndpointAt(healthCheckClient grpc_health_v1.HealthClient, endpoin
 func WithHealthzEndpoint(healthCheckClient grpc_health_v1.HealthClient) ServeMuxOption {
 	return WithHealthEndpointAt(healthCheckClient, "/healthz")
 }
+
+// WithGRPCWeb returns a ServeMuxOption that serves the gRPC-Web requests, which are the requests with the
+// "application/grpc-web", "application/grpc-web+proto" or "application/grpc-web-text" content types, on the
+// "/package.Service/Method" paths of the gRPC methods that have routes registered on the ServeMux or that belong to
+// one of the services of the config, see GRPCWebConfig.Services.
+//
+// The requests are forwarded through the connection of the config and the responses, including server-streaming
+// responses, are encoded as gRPC-Web frames with the trailers in the trailer frame.
+func WithGRPCWeb(config GRPCWebConfig) ServeMuxOption {
+	return optionFunc(func(s *ServeMux) {
+		s.grpcWeb = &config
+	})
+}
+
+// WithConnect returns a ServeMuxOption that serves the Connect protocol requests on the "/package.Service/Method"
+// paths of the gRPC methods that have routes registered on the ServeMux or that belong to one of the services of the
+// config, see ConnectConfig.Services. Unary methods accept the "application/json" and "application/proto" content
+// types and streaming methods accept the "application/connect+json" and "application/connect+proto" content types.
+//
+// The requests are forwarded through the connection of the config and the errors are written in the Connect error
+// format.
+func WithConnect(config ConnectConfig) ServeMuxOption {
+	return optionFunc(func(s *ServeMux) {
+		s.connect = &config
+	})
+}
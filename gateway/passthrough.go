@@ -0,0 +1,169 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// connForService returns the connection of the service, falling back to the default connection.
+func connForService(
+	conn grpc.ClientConnInterface, serviceConns map[string]grpc.ClientConnInterface, service string) grpc.ClientConnInterface {
+	if serviceConn, ok := serviceConns[service]; ok {
+		return serviceConn
+	}
+	return conn
+}
+
+// serveRPCMethodPreflight answers the CORS preflight requests of the gRPC method paths used by gRPC-Web and Connect,
+// which do not have routes on the router. It returns false if the request does not target a gRPC method.
+func (s *ServeMux) serveRPCMethodPreflight(w http.ResponseWriter, r *http.Request) bool {
+	_, isGRPCWebMethod := s.lookupGRPCWebMethod(r.URL.Path)
+	_, isConnectMethod := s.lookupConnectMethod(r.URL.Path)
+	if !isGRPCWebMethod && !isConnectMethod {
+		return false
+	}
+
+	w.Header().Set("Allow", "OPTIONS, POST")
+	if !s.cors.handlePreflight(w, r) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+	return true
+}
+
+// lookupPassthroughMethod returns the streaming mode of the gRPC method of a gRPC-Web or Connect request path. The
+// methods that have routes are always found, the other methods are only found in "files" if their service is one of
+// "services".
+func (s *ServeMux) lookupPassthroughMethod(
+	rpcMethod string, services []string, files *protoregistry.Files) (StreamingMode, bool) {
+
+	if mode, ok := s.lookupRPCMethod(rpcMethod); ok {
+		return mode, true
+	}
+
+	info := RouteInfo{RPCMethod: rpcMethod}
+	if !strings.HasPrefix(rpcMethod, "/") || !slices.Contains(services, info.Service()) {
+		return 0, false
+	}
+	if files == nil {
+		files = protoregistry.GlobalFiles
+	}
+
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(info.Service() + "." + info.Method()))
+	if err != nil {
+		return 0, false
+	}
+	method, ok := desc.(protoreflect.MethodDescriptor)
+	if !ok {
+		return 0, false
+	}
+
+	switch {
+	case method.IsStreamingClient() && method.IsStreamingServer():
+		return StreamingModeBidirectional, true
+	case method.IsStreamingClient():
+		return StreamingModeClient, true
+	case method.IsStreamingServer():
+		return StreamingModeServer, true
+	default:
+		return StreamingModeUnary, true
+	}
+}
+
+// forwardPassthrough sends the serialized request messages to the gRPC method and calls onMessage with the headers
+// and every serialized response message. It returns the headers, the trailers and the status of the call.
+//
+// Non-server-streaming methods stop after the first response message.
+func forwardPassthrough(
+	ctx context.Context,
+	conn grpc.ClientConnInterface,
+	info RouteInfo,
+	messages [][]byte,
+	onMessage func(header metadata.MD, message []byte) error) (metadata.MD, metadata.MD, *status.Status) {
+
+	if conn == nil {
+		return nil, nil, status.Newf(codes.Unimplemented, "no connection for service %s", info.Service())
+	}
+
+	desc := &grpc.StreamDesc{
+		StreamName:    info.Method(),
+		ClientStreams: info.StreamingMode == StreamingModeClient || info.StreamingMode == StreamingModeBidirectional,
+		ServerStreams: info.StreamingMode == StreamingModeServer || info.StreamingMode == StreamingModeBidirectional,
+	}
+	stream, err := conn.NewStream(ctx, desc, info.RPCMethod, grpc.ForceCodec(passthroughCodec{}))
+	if err != nil {
+		return nil, nil, status.Convert(err)
+	}
+
+	for _, message := range messages {
+		// io.EOF means the stream has been terminated, the status is returned by RecvMsg.
+		if err := stream.SendMsg(message); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, nil, status.Convert(err)
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, nil, status.Convert(err)
+	}
+
+	header, err := stream.Header()
+	if err != nil {
+		return nil, stream.Trailer(), status.Convert(err)
+	}
+
+	for {
+		var message []byte
+		if err := stream.RecvMsg(&message); err != nil {
+			if errors.Is(err, io.EOF) {
+				return header, stream.Trailer(), status.New(codes.OK, "")
+			}
+			return header, stream.Trailer(), status.Convert(err)
+		}
+
+		if err := onMessage(header, message); err != nil {
+			return header, stream.Trailer(), status.Convert(err)
+		}
+
+		if !desc.ServerStreams {
+			return header, stream.Trailer(), status.New(codes.OK, "")
+		}
+	}
+}
+
+// passthroughCodec passes the serialized messages through without decoding them.
+type passthroughCodec struct{}
+
+func (passthroughCodec) Marshal(v any) ([]byte, error) {
+	data, ok := v.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("unexpected message type %T", v)
+	}
+	return data, nil
+}
+
+func (passthroughCodec) Unmarshal(data []byte, v any) error {
+	target, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("unexpected message type %T", v)
+	}
+	// the data buffer may get reused after this call.
+	*target = append((*target)[:0], data...)
+	return nil
+}
+
+func (passthroughCodec) Name() string {
+	return "proto"
+}
@@ -0,0 +1,235 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/meshapi/grpc-api-gateway/websocket"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/status"
+)
+
+// ProblemDetailsContentType is the media type of the RFC 7807 problem details JSON documents.
+const ProblemDetailsContentType = "application/problem+json"
+
+// ProblemDetails is a problem details document as described in RFC 7807.
+//
+// See: https://www.rfc-editor.org/rfc/rfc7807
+type ProblemDetails struct {
+	// Type is a URI reference that identifies the problem type. "about:blank" is used when the problem has no
+	// additional semantics beyond the HTTP status code.
+	Type string
+	// Title is a short, human-readable summary of the problem type.
+	Title string
+	// Status is the HTTP status code.
+	Status int
+	// Detail is a human-readable explanation specific to this occurrence of the problem.
+	Detail string
+	// Instance is a URI reference that identifies the specific occurrence of the problem.
+	Instance string
+
+	// Extensions holds the extension members of the document. Members that collide with the standard members are
+	// ignored.
+	Extensions map[string]any
+}
+
+// ProblemDetailsInvalidParam describes a single invalid request parameter.
+type ProblemDetailsInvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// MarshalJSON encodes the standard members and the extension members in a single JSON object.
+func (p ProblemDetails) MarshalJSON() ([]byte, error) {
+	document := make(map[string]any, len(p.Extensions)+5)
+	for key, value := range p.Extensions {
+		document[key] = value
+	}
+
+	document["type"] = p.Type
+	if p.Title != "" {
+		document["title"] = p.Title
+	}
+	if p.Status != 0 {
+		document["status"] = p.Status
+	}
+	if p.Detail != "" {
+		document["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		document["instance"] = p.Instance
+	}
+
+	return json.Marshal(document)
+}
+
+// ProblemDetailsFromStatus creates a problem details document for a gRPC status.
+//
+// The gRPC code is added as the "code" extension member and the following error details are mapped:
+//   - ErrorInfo: "reason", "domain" and "metadata" extension members.
+//   - BadRequest: field violations are added to the "invalid_params" extension member.
+//   - LocalizedMessage: replaces the detail and adds the "locale" extension member.
+func ProblemDetailsFromStatus(st *status.Status, httpStatus int, instance string) *ProblemDetails {
+	problem := &ProblemDetails{
+		Type:       "about:blank",
+		Title:      http.StatusText(httpStatus),
+		Status:     httpStatus,
+		Detail:     st.Message(),
+		Instance:   instance,
+		Extensions: map[string]any{"code": st.Code().String()},
+	}
+
+	for _, detail := range st.Details() {
+		switch detail := detail.(type) {
+		case *errdetails.ErrorInfo:
+			if detail.GetReason() != "" {
+				problem.Extensions["reason"] = detail.GetReason()
+			}
+			if detail.GetDomain() != "" {
+				problem.Extensions["domain"] = detail.GetDomain()
+			}
+			if len(detail.GetMetadata()) > 0 {
+				problem.Extensions["metadata"] = detail.GetMetadata()
+			}
+		case *errdetails.BadRequest:
+			params, _ := problem.Extensions["invalid_params"].([]ProblemDetailsInvalidParam)
+			for _, violation := range detail.GetFieldViolations() {
+				params = append(params, ProblemDetailsInvalidParam{
+					Name:   violation.GetField(),
+					Reason: violation.GetDescription(),
+				})
+			}
+			if len(params) > 0 {
+				problem.Extensions["invalid_params"] = params
+			}
+		case *errdetails.LocalizedMessage:
+			if detail.GetMessage() != "" {
+				problem.Detail = detail.GetMessage()
+			}
+			if detail.GetLocale() != "" {
+				problem.Extensions["locale"] = detail.GetLocale()
+			}
+		}
+	}
+
+	return problem
+}
+
+// problemDetailsForError converts the error into a problem details document.
+func problemDetailsForError(ctx context.Context, r *http.Request, err error) (*status.Status, *ProblemDetails) {
+	st, httpStatus := statusForError(ctx, err)
+	return st, ProblemDetailsFromStatus(st, httpStatus, r.URL.Path)
+}
+
+// ProblemDetailsHTTPErrorHandler is an ErrorHandlerFunc that replies with an RFC 7807 problem details document.
+//
+// The HTTP status code and headers are resolved the same way as DefaultHTTPErrorHandler and the response is always
+// JSON encoded, regardless of the marshaler.
+func ProblemDetailsHTTPErrorHandler(
+	ctx context.Context, mux *ServeMux, _ Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	// return Internal when Marshal failed
+	const fallback = `{"type": "about:blank", "title": "Internal Server Error", "status": 500}`
+
+	st, httpStatus := mux.statusForResponse(ctx, w.Header(), err)
+	problem := ProblemDetailsFromStatus(st, httpStatus, r.URL.Path)
+
+	w.Header().Del("Trailer")
+	w.Header().Del("Transfer-Encoding")
+	w.Header().Set("Content-Type", ProblemDetailsContentType)
+
+	if st.Code() == codes.Unauthenticated {
+		w.Header().Set("WWW-Authenticate", st.Message())
+	}
+
+	buf, merr := json.Marshal(problem)
+	if merr != nil {
+		grpclog.Infof("Failed to marshal problem details %q: %v", st, merr)
+		w.WriteHeader(http.StatusInternalServerError)
+		if _, err := io.WriteString(w, fallback); err != nil {
+			grpclog.Infof("Failed to write response: %v", err)
+		}
+		return
+	}
+
+	md, ok := ServerMetadataFromContext(ctx)
+	if !ok {
+		grpclog.Infof("Failed to extract ServerMetadata from context")
+	}
+
+	mux.handleForwardResponseServerMetadata(w, md)
+
+	if !statusAllowsBody(problem.Status) {
+		w.Header().Del("Content-Type")
+		w.WriteHeader(problem.Status)
+		return
+	}
+
+	doForwardTrailers := requestAcceptsTrailers(r)
+	if doForwardTrailers {
+		handleForwardResponseTrailerHeader(w, md)
+		w.Header().Set("Transfer-Encoding", "chunked")
+	}
+
+	w.WriteHeader(problem.Status)
+	if _, err := w.Write(buf); err != nil {
+		grpclog.Infof("Failed to write response: %v", err)
+	}
+
+	if doForwardTrailers {
+		handleForwardResponseTrailer(w, md)
+	}
+}
+
+// ProblemDetailsStreamErrorHandler is a StreamErrorHandlerFunc that returns an RFC 7807 problem details document.
+//
+// The document is always JSON encoded, regardless of the marshaler, and the response has the
+// "application/problem+json" content type when the error is sent before any of the response messages.
+func ProblemDetailsStreamErrorHandler(ctx context.Context, r *http.Request, err error) (int, any) {
+	_, problem := problemDetailsForError(ctx, r, err)
+	return problem.Status, problem
+}
+
+// ProblemDetailsSSEErrorHandler is an SSEErrorHandlerFunc that sends an RFC 7807 problem details document in the
+// data of the "failure" event.
+func ProblemDetailsSSEErrorHandler(ctx context.Context, _ Marshaler, r *http.Request, err error) *SSEMessage {
+	const fallback = `{"type": "about:blank", "title": "Internal Server Error", "status": 500}`
+
+	message := &SSEMessage{
+		Event: "failure",
+	}
+
+	_, problem := problemDetailsForError(ctx, r, err)
+	message.Data, err = json.Marshal(problem)
+	if err != nil {
+		grpclog.Infof("Failed to marshal SSE problem details: %v", err)
+		message.Data = []byte(fallback)
+	}
+
+	return message
+}
+
+// ProblemDetailsWebsocketErrorHandler is a WebsocketErrorHandlerFunc that sends an RFC 7807 problem details document
+// in a text message before closing the connection.
+//
+// The connection is closed with the close code mapped from the gRPC code and the status message as the reason, the
+// same way CloseWebsocketWithStatus does. See WebsocketConfig.CloseCodeFunc.
+func ProblemDetailsWebsocketErrorHandler(
+	ctx context.Context, _ Marshaler, r *http.Request, connection websocket.Connection, err error) {
+	defer connection.Close()
+	st, problem := problemDetailsForError(ctx, r, err)
+	data, merr := json.Marshal(problem)
+	if merr != nil {
+		grpclog.Infof("failed to marshal websocket problem details: %s", merr)
+	} else if err := connection.SendMessageWithType(websocket.TextMessage, data); err != nil && err != io.EOF {
+		grpclog.Infof("failed to send websocket error: %s", err)
+	}
+
+	code := WebsocketCloseCodeFromContext(ctx, st.Code())
+	if err := connection.SendCloseWithCode(code, truncateCloseReason(st.Message())); err != nil && err != io.EOF {
+		grpclog.Infof("failed to send websocket close message: %s", err)
+	}
+}
@@ -0,0 +1,163 @@
+package gateway_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/meshapi/grpc-api-gateway/gateway"
+	"github.com/meshapi/grpc-api-gateway/protomarshal"
+	"github.com/meshapi/grpc-api-gateway/websocket"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestProblemDetailsHTTPErrorHandler(t *testing.T) {
+	st, err := status.New(codes.InvalidArgument, "invalid request").WithDetails(
+		&errdetails.ErrorInfo{Reason: "INVALID_NAME", Domain: "example.com", Metadata: map[string]string{"max": "10"}},
+		&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{
+			{Field: "name", Description: "name is too long"},
+		}},
+		&errdetails.LocalizedMessage{Locale: "en-US", Message: "The name is too long."},
+	)
+	if err != nil {
+		t.Fatalf("failed to create status: %s", err)
+	}
+
+	mux := gateway.NewServeMux(gateway.WithProblemDetails())
+	mux.HandleWithParams(http.MethodPost, "/v1/items", func(w http.ResponseWriter, r *http.Request, _ gateway.Params) {
+		_, outbound := mux.MarshalerForRequest(r)
+		mux.HTTPError(r.Context(), outbound, w, r, st.Err())
+	})
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/v1/items?debug=true", nil))
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, recorder.Code)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != gateway.ProblemDetailsContentType {
+		t.Fatalf("expected content type %q, got %q", gateway.ProblemDetailsContentType, contentType)
+	}
+
+	var document map[string]any
+	if err := json.Unmarshal(recorder.Body.Bytes(), &document); err != nil {
+		t.Fatalf("failed to unmarshal response: %s", err)
+	}
+
+	expected := map[string]any{
+		"type":     "about:blank",
+		"title":    "Bad Request",
+		"status":   float64(http.StatusBadRequest),
+		"detail":   "The name is too long.",
+		"instance": "/v1/items",
+		"code":     "InvalidArgument",
+		"reason":   "INVALID_NAME",
+		"domain":   "example.com",
+		"metadata": map[string]any{"max": "10"},
+		"locale":   "en-US",
+		"invalid_params": []any{
+			map[string]any{"name": "name", "reason": "name is too long"},
+		},
+	}
+	if diff := cmp.Diff(expected, document); diff != "" {
+		t.Fatalf("unexpected problem details (-want +got):\n%s", diff)
+	}
+}
+
+func TestProblemDetailsRoutingError(t *testing.T) {
+	mux := gateway.NewServeMux(gateway.WithProblemDetails())
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/unknown", nil))
+
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, recorder.Code)
+	}
+
+	var problem struct {
+		Type   string `json:"type"`
+		Title  string `json:"title"`
+		Status int    `json:"status"`
+		Code   string `json:"code"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("failed to unmarshal response: %s", err)
+	}
+	if problem.Type != "about:blank" || problem.Title != "Not Found" || problem.Status != http.StatusNotFound ||
+		problem.Code != "NotFound" {
+		t.Fatalf("unexpected problem details: %+v", problem)
+	}
+}
+
+func TestProblemDetailsSSEErrorHandler(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/v1/events", nil)
+	message := gateway.ProblemDetailsSSEErrorHandler(req.Context(), nil, req, status.Error(codes.Unavailable, "down"))
+
+	if message.Event != "failure" {
+		t.Fatalf("unexpected event: %q", message.Event)
+	}
+
+	var document map[string]any
+	if err := json.Unmarshal(message.Data, &document); err != nil {
+		t.Fatalf("failed to unmarshal message: %s", err)
+	}
+	if document["status"] != float64(http.StatusServiceUnavailable) || document["detail"] != "down" {
+		t.Fatalf("unexpected problem details: %s", message.Data)
+	}
+}
+
+func TestProblemDetailsStreamErrorHandler(t *testing.T) {
+	mux := gateway.NewServeMux(gateway.WithProblemDetails())
+	mux.HandleWithParams(http.MethodGet, "/v1/watch", func(w http.ResponseWriter, r *http.Request, _ gateway.Params) {
+		ctx := gateway.NewServerMetadataContext(r.Context(), gateway.ServerMetadata{})
+		mux.ForwardResponseStreamChunked(ctx, &protomarshal.ProtoMarshaller{}, w, r, func() (proto.Message, error) {
+			return nil, status.Error(codes.Unavailable, "down")
+		})
+	})
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/watch", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status %d, got %d", http.StatusServiceUnavailable, recorder.Code)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != gateway.ProblemDetailsContentType {
+		t.Fatalf("expected content type %q, got %q", gateway.ProblemDetailsContentType, contentType)
+	}
+
+	var document map[string]any
+	if err := json.NewDecoder(recorder.Body).Decode(&document); err != nil {
+		t.Fatalf("failed to decode the problem details: %s", err)
+	}
+	if document["status"] != float64(http.StatusServiceUnavailable) || document["detail"] != "down" {
+		t.Fatalf("unexpected problem details: %v", document)
+	}
+}
+
+func TestProblemDetailsWebsocketErrorHandler(t *testing.T) {
+	mux := gateway.NewServeMux(gateway.WithProblemDetails())
+	ws := newFakeWebsocket(false)
+	req := httptest.NewRequest(http.MethodGet, "/v1/stream", nil)
+
+	err := status.Error(codes.NotFound, "missing")
+	mux.WebsocketError(context.Background(), &protomarshal.ProtoMarshaller{}, req, ws, err)
+
+	var document map[string]any
+	if err := json.Unmarshal(<-ws.sent, &document); err != nil {
+		t.Fatalf("failed to unmarshal the problem details: %s", err)
+	}
+	if document["status"] != float64(http.StatusNotFound) || document["detail"] != "missing" {
+		t.Fatalf("unexpected problem details: %v", document)
+	}
+	if messageType := int(ws.lastMessageType.Load()); messageType != websocket.TextMessage {
+		t.Errorf("expected a text message, got %d", messageType)
+	}
+	if code, reason := ws.closeMessage(); code != 4005 || reason != "missing" {
+		t.Errorf("expected close code 4005 with the status message, got %d %q", code, reason)
+	}
+}
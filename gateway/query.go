@@ -2,7 +2,6 @@ package gateway
 
 import (
 	"net/url"
-	"strings"
 
 	"github.com/meshapi/grpc-api-gateway/dotpath"
 	"github.com/meshapi/grpc-api-gateway/protopath"
@@ -41,7 +40,7 @@ type DefaultQueryParser struct{}
 // A value is ignored if its key starts with one of the elements in "filter".
 func (*DefaultQueryParser) Parse(msg proto.Message, values url.Values, input QueryParameterParseOptions) error {
 	for key, values := range values {
-		if messageKey, mapKey, ok := matchMapKey(key); ok {
+		if messageKey, mapKey, ok := protopath.SplitMapKey(key); ok {
 			key = messageKey
 			values = append([]string{mapKey}, values...)
 		}
@@ -61,15 +60,3 @@ func (*DefaultQueryParser) Parse(msg proto.Message, values url.Values, input Que
 	}
 	return nil
 }
-
-func matchMapKey(key string) (string, string, bool) {
-	start := strings.IndexByte(key, '[')
-	if start == -1 { // 0 is also not acceptable because it means there is no key, only braces.
-		return "", "", false
-	}
-	end := strings.LastIndexByte(key, ']')
-	if end == -1 || end != len(key)-1 || end <= start {
-		return "", "", false
-	}
-	return key[:start], key[start+1 : end], true
-}
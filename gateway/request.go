@@ -0,0 +1,90 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type requestStateKey struct{}
+
+// requestState collects information about the request while it is being served, used for metrics and tracing.
+type requestState struct {
+	rpcMethod       string
+	httpPathPattern string
+	responseHeader  http.Header
+	span            Span
+
+	err     error
+	code    codes.Code
+	hasCode bool
+}
+
+func requestStateFromRequest(req *http.Request) *requestState {
+	state, _ := req.Context().Value(requestStateKey{}).(*requestState)
+	return state
+}
+
+// recordError records the error that gets written in the response.
+func (s *ServeMux) recordError(req *http.Request, err error) {
+	if state := requestStateFromRequest(req); state != nil && !state.hasCode {
+		var customStatus HTTPStatusError
+		if errors.As(err, &customStatus) {
+			err = customStatus.Err
+		}
+		state.err = err
+		state.code = status.Code(err)
+		state.hasCode = true
+	}
+}
+
+// serveWithState serves the request using "serve" while collecting the request state and reports it to the metrics
+// recorder and the tracer.
+func (s *ServeMux) serveWithState(
+	writer http.ResponseWriter, req *http.Request, serve func(http.ResponseWriter, *http.Request)) {
+
+	state := &requestState{responseHeader: writer.Header()}
+	var recorder *metricsResponseWriter
+	if s.metricsRecorder != nil {
+		recorder = &metricsResponseWriter{ResponseWriter: writer}
+		writer = recorder
+	}
+	start := time.Now()
+
+	serve(writer, req.WithContext(context.WithValue(req.Context(), requestStateKey{}, state)))
+
+	if state.span != nil {
+		if state.hasCode {
+			state.span.SetStatus(state.code, state.err.Error())
+		} else {
+			state.span.SetStatus(codes.OK, "")
+		}
+		state.span.End()
+	}
+
+	if recorder == nil {
+		return
+	}
+
+	measurements := RequestMetrics{
+		RPCMethod:       state.rpcMethod,
+		HTTPPathPattern: state.httpPathPattern,
+		HTTPMethod:      req.Method,
+		HTTPStatus:      recorder.status,
+		Code:            state.code,
+		Duration:        time.Since(start),
+		ResponseSize:    recorder.size,
+	}
+	if measurements.HTTPStatus == 0 {
+		measurements.HTTPStatus = http.StatusOK
+	}
+	if !state.hasCode && measurements.HTTPStatus >= http.StatusBadRequest {
+		measurements.Code = codes.Unknown
+	}
+
+	s.metricsRecorder.RecordRequest(req.Context(), measurements)
+}
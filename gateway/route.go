@@ -0,0 +1,225 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"strings"
+	"sync/atomic"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// StreamingMode describes the streaming mode of the gRPC method behind a route.
+type StreamingMode uint8
+
+const (
+	// StreamingModeUnary is for unary gRPC methods.
+	StreamingModeUnary StreamingMode = iota
+	// StreamingModeClient is for client streaming gRPC methods.
+	StreamingModeClient
+	// StreamingModeServer is for server streaming gRPC methods.
+	StreamingModeServer
+	// StreamingModeBidirectional is for bidirectional streaming gRPC methods.
+	StreamingModeBidirectional
+)
+
+func (m StreamingMode) String() string {
+	switch m {
+	case StreamingModeUnary:
+		return "unary"
+	case StreamingModeClient:
+		return "client_streaming"
+	case StreamingModeServer:
+		return "server_streaming"
+	case StreamingModeBidirectional:
+		return "bidi_streaming"
+	default:
+		return "unknown"
+	}
+}
+
+// RouteInfo describes a route registered on the ServeMux.
+type RouteInfo struct {
+	// HTTPMethod is the HTTP method of the route.
+	HTTPMethod string
+
+	// Path is the path registered on the router.
+	Path string
+
+	// RPCMethod is the full gRPC method name in the format of "/package.service/method".
+	//
+	// This value is empty for routes that are not bound to a gRPC method.
+	RPCMethod string
+
+	// HTTPPathPattern is the HTTP path pattern in the google.api.http path template format.
+	HTTPPathPattern string
+
+	// BindingIndex is the index of the HTTP binding of the gRPC method.
+	BindingIndex int
+
+	// StreamingMode is the streaming mode of the gRPC method.
+	StreamingMode StreamingMode
+
+	// RequestBody is the field selector of the request message that is read from the HTTP body, "*" indicates the
+	// entire message. It is empty if no part of the request is read from the HTTP body.
+	RequestBody string
+
+	// ResponseBody is the field selector of the response message that is written to the HTTP body. It is empty if
+	// the entire response message is written.
+	ResponseBody string
+
+	// SupportsChunkedTransfer indicates whether the server streaming responses can use chunked transfer encoding.
+	SupportsChunkedTransfer bool
+
+	// SupportsSSE indicates whether the server streaming responses can use server-sent events.
+	SupportsSSE bool
+
+	// SupportsWebsocket indicates whether the streaming method can be used over websockets.
+	SupportsWebsocket bool
+}
+
+// Service returns the full name of the gRPC service in the format of "package.service".
+func (r RouteInfo) Service() string {
+	name := strings.TrimPrefix(r.RPCMethod, "/")
+	if index := strings.LastIndexByte(name, '/'); index != -1 {
+		return name[:index]
+	}
+	return ""
+}
+
+// Method returns the name of the gRPC method without the service name.
+func (r RouteInfo) Method() string {
+	if index := strings.LastIndexByte(r.RPCMethod, '/'); index != -1 {
+		return r.RPCMethod[index+1:]
+	}
+	return ""
+}
+
+// RouteOption configures a route registered on the ServeMux.
+type RouteOption func(*RouteInfo)
+
+// WithRouteInfo returns a RouteOption that describes the gRPC method and binding behind the route.
+//
+// HTTPMethod and Path are always taken from the registration call and are ignored here.
+func WithRouteInfo(info RouteInfo) RouteOption {
+	return func(r *RouteInfo) {
+		method, path := r.HTTPMethod, r.Path
+		*r = info
+		r.HTTPMethod, r.Path = method, path
+	}
+}
+
+// registeredRoute is a route that is registered on the routers of the ServeMux. The handle that is registered on the
+// routers stays the same while the handler of the route gets replaced or removed.
+type registeredRoute struct {
+	// active is nil when the route is removed.
+	active atomic.Pointer[activeRoute]
+	// websocket indicates whether the route is registered on the websocket router.
+	websocket bool
+}
+
+// activeRoute is the handler of a registered route.
+type activeRoute struct {
+	info   RouteInfo
+	handle httprouter.Handle
+	// listed indicates whether the route is included in the routes of the ServeMux.
+	listed bool
+}
+
+func routeKey(method, pattern string) string {
+	return method + " " + pattern
+}
+
+// Middleware wraps a route handler.
+type Middleware func(httprouter.Handle) httprouter.Handle
+
+// RouteMiddleware wraps a route handler using the information about the route.
+//
+// Route middlewares get called once when the route is registered.
+type RouteMiddleware func(RouteInfo, httprouter.Handle) httprouter.Handle
+
+// RouteSelectorFunc reports whether or not a route should be wrapped with a middleware.
+type RouteSelectorFunc func(RouteInfo) bool
+
+// SelectService returns a RouteSelectorFunc that selects routes of the gRPC services.
+// Service names are in the format of "package.service".
+func SelectService(services ...string) RouteSelectorFunc {
+	return func(r RouteInfo) bool {
+		service := r.Service()
+		for _, name := range services {
+			if name == service {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// SelectRPCMethod returns a RouteSelectorFunc that selects routes of the gRPC methods.
+// Method names are in the format of "/package.service/method".
+func SelectRPCMethod(methods ...string) RouteSelectorFunc {
+	return func(r RouteInfo) bool {
+		for _, name := range methods {
+			if name == r.RPCMethod {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// SelectPath returns a RouteSelectorFunc that selects routes whose HTTP path pattern matches any of the glob
+// patterns. The syntax of the patterns is the same as path.Match; for instance "/v1/users/*" selects
+// "/v1/users/{id}" but not "/v1/users/{id}/posts".
+//
+// If the route has no HTTP path pattern, the registered path is used instead.
+func SelectPath(patterns ...string) RouteSelectorFunc {
+	return func(r RouteInfo) bool {
+		value := r.HTTPPathPattern
+		if value == "" {
+			value = r.Path
+		}
+		for _, pattern := range patterns {
+			if matched, err := path.Match(pattern, value); err == nil && matched {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+type routeInfoKey struct{}
+
+// RouteInfoFromContext returns the RouteInfo of the route that is handling the request, if one exists.
+//
+// NOTE: route information is only available in the request context when middlewares are configured.
+func RouteInfoFromContext(ctx context.Context) (RouteInfo, bool) {
+	info, ok := ctx.Value(routeInfoKey{}).(RouteInfo)
+	return info, ok
+}
+
+type middlewareEntry struct {
+	selector   RouteSelectorFunc
+	middleware RouteMiddleware
+}
+
+// wrapHandler applies all the selected middlewares to the route handler. The first configured middleware is the
+// outermost one.
+func (s *ServeMux) wrapHandler(info RouteInfo, handler httprouter.Handle) httprouter.Handle {
+	if len(s.middlewares) == 0 {
+		return handler
+	}
+
+	for index := len(s.middlewares) - 1; index >= 0; index-- {
+		entry := s.middlewares[index]
+		if entry.selector != nil && !entry.selector(info) {
+			continue
+		}
+		handler = entry.middleware(info, handler)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		handler(w, r.WithContext(context.WithValue(r.Context(), routeInfoKey{}, info)), p)
+	}
+}
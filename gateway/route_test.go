@@ -0,0 +1,85 @@
+package gateway_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/meshapi/grpc-api-gateway/gateway"
+)
+
+func TestRouteMiddleware(t *testing.T) {
+	var calls []string
+	record := func(name string) gateway.Middleware {
+		return func(next httprouter.Handle) httprouter.Handle {
+			return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+				calls = append(calls, name)
+				next(w, r, p)
+			}
+		}
+	}
+	recordRoute := func(name string) gateway.RouteMiddleware {
+		return func(info gateway.RouteInfo, next httprouter.Handle) httprouter.Handle {
+			return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+				fromContext, ok := gateway.RouteInfoFromContext(r.Context())
+				if !ok || fromContext.RPCMethod != info.RPCMethod {
+					t.Errorf("unexpected route info in context: %+v", fromContext)
+				}
+				calls = append(calls, name+":"+info.Method())
+				next(w, r, p)
+			}
+		}
+	}
+
+	mux := gateway.NewServeMux(
+		gateway.WithMiddleware(record("global")),
+		gateway.WithRouteMiddleware(gateway.SelectService("example.Users"), recordRoute("users")),
+		gateway.WithRouteMiddleware(gateway.SelectRPCMethod("/example.Posts/List"), recordRoute("posts")),
+		gateway.WithRouteMiddleware(gateway.SelectPath("/v1/users/*"), recordRoute("path")),
+	)
+
+	handler := func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		calls = append(calls, "handler")
+	}
+	mux.HandleWithParams(http.MethodGet, "/v1/users/:id", handler, gateway.WithRouteInfo(gateway.RouteInfo{
+		RPCMethod:       "/example.Users/Get",
+		HTTPPathPattern: "/v1/users/{id}",
+	}))
+	mux.HandleWithParams(http.MethodGet, "/v1/users/:id/posts", handler, gateway.WithRouteInfo(gateway.RouteInfo{
+		RPCMethod:       "/example.Posts/List",
+		HTTPPathPattern: "/v1/users/{id}/posts",
+		StreamingMode:   gateway.StreamingModeServer,
+	}))
+	mux.HandleWithParams(http.MethodGet, "/healthz", handler)
+
+	testCases := []struct {
+		Path     string
+		Expected string
+	}{
+		{Path: "/v1/users/1", Expected: "global,users:Get,path:Get,handler"},
+		{Path: "/v1/users/1/posts", Expected: "global,posts:List,handler"},
+		{Path: "/healthz", Expected: "global,handler"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.Path, func(t *testing.T) {
+			calls = nil
+			mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.Path, nil))
+			if result := strings.Join(calls, ","); result != tt.Expected {
+				t.Fatalf("expected calls %q, got %q", tt.Expected, result)
+			}
+		})
+	}
+}
+
+func TestRouteInfoNames(t *testing.T) {
+	info := gateway.RouteInfo{RPCMethod: "/meshapi.example.Users/Get"}
+	if info.Service() != "meshapi.example.Users" {
+		t.Errorf("unexpected service name: %q", info.Service())
+	}
+	if info.Method() != "Get" {
+		t.Errorf("unexpected method name: %q", info.Method())
+	}
+}
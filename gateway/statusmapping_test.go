@@ -0,0 +1,138 @@
+package gateway_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/meshapi/grpc-api-gateway/gateway"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestStatusCodeMapping(t *testing.T) {
+	mux := gateway.NewServeMux(
+		gateway.WithStatusCodeMapping(map[codes.Code]int{
+			codes.NotFound:         http.StatusGone,
+			codes.Unavailable:      http.StatusBadGateway,
+			codes.PermissionDenied: http.StatusNotFound,
+			codes.Internal:         0,
+			codes.Unknown:          http.StatusContinue,
+		}),
+		gateway.WithMethodStatusCodeMapping("/test.Service/Get", map[codes.Code]int{
+			codes.NotFound: http.StatusNoContent,
+		}),
+	)
+
+	var handlerErr error
+	mux.HandleWithParams(http.MethodGet, "/v1/items", func(w http.ResponseWriter, r *http.Request, _ gateway.Params) {
+		ctx, err := gateway.AnnotateContext(r.Context(), mux, r, "/test.Service/Get")
+		if err != nil {
+			t.Fatalf("failed to annotate context: %s", err)
+		}
+		_, outbound := mux.MarshalerForRequest(r)
+		mux.HTTPError(ctx, outbound, w, r, handlerErr)
+	})
+
+	testCases := []struct {
+		Name     string
+		Method   string
+		Path     string
+		Err      error
+		Expected int
+	}{
+		{
+			Name:     "MethodMapping",
+			Method:   http.MethodGet,
+			Path:     "/v1/items",
+			Err:      status.Error(codes.NotFound, "missing"),
+			Expected: http.StatusNoContent,
+		},
+		{
+			Name:     "GlobalMapping",
+			Method:   http.MethodGet,
+			Path:     "/v1/items",
+			Err:      status.Error(codes.Unavailable, "down"),
+			Expected: http.StatusBadGateway,
+		},
+		{
+			Name:     "InvalidMapping",
+			Method:   http.MethodGet,
+			Path:     "/v1/items",
+			Err:      status.Error(codes.Internal, "failed"),
+			Expected: http.StatusInternalServerError,
+		},
+		{
+			Name:     "InvalidInformationalMapping",
+			Method:   http.MethodGet,
+			Path:     "/v1/items",
+			Err:      status.Error(codes.Unknown, "failed"),
+			Expected: http.StatusInternalServerError,
+		},
+		{
+			Name:     "Unmapped",
+			Method:   http.MethodGet,
+			Path:     "/v1/items",
+			Err:      status.Error(codes.InvalidArgument, "invalid"),
+			Expected: http.StatusBadRequest,
+		},
+		{
+			Name:     "RoutingNotFound",
+			Method:   http.MethodGet,
+			Path:     "/v1/unknown",
+			Expected: http.StatusGone,
+		},
+		{
+			Name:     "RoutingMethodNotAllowed",
+			Method:   http.MethodPost,
+			Path:     "/v1/items",
+			Expected: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			handlerErr = tt.Err
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, httptest.NewRequest(tt.Method, tt.Path, nil))
+			if recorder.Code != tt.Expected {
+				t.Fatalf("expected status %d, got %d", tt.Expected, recorder.Code)
+			}
+			if hasBody := recorder.Body.Len() > 0; hasBody != (tt.Expected != http.StatusNoContent) {
+				t.Fatalf("unexpected response body for status %d: %q", recorder.Code, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestStatusCodeMappingStream(t *testing.T) {
+	mux := gateway.NewServeMux(
+		gateway.WithMethodStatusCodeMapping("/test.Service/Watch", map[codes.Code]int{
+			codes.Unavailable: http.StatusBadGateway,
+		}),
+	)
+	mux.HandleWithParams(http.MethodGet, "/v1/watch", func(w http.ResponseWriter, r *http.Request, _ gateway.Params) {
+		ctx, err := gateway.AnnotateContext(r.Context(), mux, r, "/test.Service/Watch")
+		if err != nil {
+			t.Fatalf("failed to annotate context: %s", err)
+		}
+		ctx = gateway.NewServerMetadataContext(ctx, gateway.ServerMetadata{})
+		_, outbound := mux.MarshalerForRequest(r)
+		mux.ForwardResponseStreamChunked(ctx, outbound, w, r, func() (proto.Message, error) {
+			return nil, status.Error(codes.Unavailable, "down")
+		})
+	})
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v1/watch", nil))
+	if recorder.Code != http.StatusBadGateway {
+		t.Fatalf("expected status %d, got %d", http.StatusBadGateway, recorder.Code)
+	}
+
+	got := gateway.HTTPStatusFromContext(context.Background(), codes.Unavailable)
+	if got != http.StatusServiceUnavailable {
+		t.Fatalf("expected status %d without mappings, got %d", http.StatusServiceUnavailable, got)
+	}
+}
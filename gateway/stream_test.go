@@ -0,0 +1,86 @@
+package gateway_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/meshapi/grpc-api-gateway/gateway"
+	"github.com/meshapi/grpc-api-gateway/protomarshal"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// newStreamFramingTestMux returns a mux with an endpoint that echoes the client stream back as a chunked stream.
+func newStreamFramingTestMux() *gateway.ServeMux {
+	mux := gateway.NewServeMux(
+		gateway.WithMarshalerOption("application/x-protobuf-delimited", &protomarshal.ProtoDelimitedMarshaller{}),
+		gateway.WithMarshalerOption("application/x-ndjson", &protomarshal.NDJSONPb{}),
+	)
+	mux.HandleWithParams(http.MethodPost, "/v1/echo", func(w http.ResponseWriter, r *http.Request, _ gateway.Params) {
+		ctx := gateway.NewServerMetadataContext(r.Context(), gateway.ServerMetadata{})
+		inbound, outbound := mux.MarshalerForRequest(r)
+		decoder := inbound.NewDecoder(r.Body)
+		mux.ForwardResponseStreamChunked(ctx, outbound, w, r, func() (proto.Message, error) {
+			msg := &wrapperspb.StringValue{}
+			if err := decoder.Decode(msg); err != nil {
+				return nil, err
+			}
+			return msg, nil
+		})
+	})
+	return mux
+}
+
+func TestStreamFraming(t *testing.T) {
+	mux := newStreamFramingTestMux()
+	messages := []string{"foo", "", "line\nbreak", strings.Repeat("a", 300)}
+
+	marshalers := map[string]gateway.Marshaler{
+		"application/x-protobuf-delimited": &protomarshal.ProtoDelimitedMarshaller{},
+		"application/x-ndjson":             &protomarshal.NDJSONPb{},
+	}
+
+	for contentType, marshaler := range marshalers {
+		t.Run(contentType, func(t *testing.T) {
+			reader, writer := io.Pipe()
+			go func() {
+				encoder := marshaler.NewEncoder(writer)
+				for _, value := range messages {
+					if err := encoder.Encode(wrapperspb.String(value)); err != nil {
+						_ = writer.CloseWithError(err)
+						return
+					}
+				}
+				_ = writer.Close()
+			}()
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/echo", reader)
+			req.Header.Set("Content-Type", contentType)
+			req.Header.Set("Accept", contentType)
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, req)
+
+			if got := recorder.Header().Get("Content-Type"); got != contentType {
+				t.Errorf("expected content type %q, got %q", contentType, got)
+			}
+
+			decoder := marshaler.NewDecoder(recorder.Body)
+			for _, value := range messages {
+				msg := &wrapperspb.StringValue{}
+				if err := decoder.Decode(msg); err != nil {
+					t.Fatalf("failed to decode response message: %s", err)
+				}
+				if msg.Value != value {
+					t.Errorf("expected %q, got %q", value, msg.Value)
+				}
+			}
+			if err := decoder.Decode(&wrapperspb.StringValue{}); !errors.Is(err, io.EOF) {
+				t.Errorf("expected end of stream, got: %v", err)
+			}
+		})
+	}
+}
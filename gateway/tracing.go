@@ -0,0 +1,178 @@
+package gateway
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	traceParentHeader   = "Traceparent"
+	traceStateHeader    = "Tracestate"
+	baggageHeader       = "Baggage"
+	traceResponseHeader = "Traceresponse"
+)
+
+// TraceContext is the W3C trace context of a span.
+//
+// See: https://www.w3.org/TR/trace-context/
+type TraceContext struct {
+	// TraceID is the ID of the whole trace.
+	TraceID [16]byte
+	// SpanID is the ID of the span.
+	SpanID [8]byte
+	// Flags holds the trace flags, such as sampled.
+	Flags byte
+	// TraceState holds the vendor-specific trace information in the tracestate header format.
+	TraceState string
+	// Baggage holds the user-defined properties in the W3C baggage header format.
+	Baggage string
+}
+
+// TraceFlagSampled is the trace flag that indicates the trace may have been sampled by the caller.
+const TraceFlagSampled byte = 0x01
+
+// ParseTraceParent parses the value of a traceparent header.
+func ParseTraceParent(value string) (TraceContext, error) {
+	var tc TraceContext
+
+	// version-traceid-parentid-flags: 2 + 1 + 32 + 1 + 16 + 1 + 2
+	value = strings.TrimSpace(value)
+	if len(value) < 55 || value[2] != '-' || value[35] != '-' || value[52] != '-' {
+		return tc, errors.New("malformed traceparent")
+	}
+
+	version, err := hex.DecodeString(value[:2])
+	if err != nil || version[0] == 0xff || (version[0] == 0 && len(value) != 55) {
+		return tc, errors.New("unsupported traceparent version")
+	}
+	if len(value) > 55 && value[55] != '-' {
+		return tc, errors.New("malformed traceparent")
+	}
+
+	if _, err := hex.Decode(tc.TraceID[:], []byte(value[3:35])); err != nil {
+		return tc, errors.New("malformed trace ID in traceparent")
+	}
+	if _, err := hex.Decode(tc.SpanID[:], []byte(value[36:52])); err != nil {
+		return tc, errors.New("malformed parent ID in traceparent")
+	}
+	flags, err := hex.DecodeString(value[53:55])
+	if err != nil {
+		return tc, errors.New("malformed flags in traceparent")
+	}
+	tc.Flags = flags[0]
+
+	if !tc.IsValid() {
+		return tc, errors.New("invalid trace ID or parent ID in traceparent")
+	}
+
+	return tc, nil
+}
+
+// IsValid reports whether or not both the trace ID and the span ID are set.
+func (t TraceContext) IsValid() bool {
+	return t.TraceID != [16]byte{} && t.SpanID != [8]byte{}
+}
+
+// IsSampled reports whether or not the sampled flag is set.
+func (t TraceContext) IsSampled() bool {
+	return t.Flags&TraceFlagSampled != 0
+}
+
+// TraceParent returns the value of the traceparent header for this trace context.
+func (t TraceContext) TraceParent() string {
+	return "00-" + hex.EncodeToString(t.TraceID[:]) + "-" + hex.EncodeToString(t.SpanID[:]) + "-" +
+		hex.EncodeToString([]byte{t.Flags})
+}
+
+// TraceContextFromRequest extracts the W3C trace context from the headers of a request.
+func TraceContextFromRequest(req *http.Request) (TraceContext, bool) {
+	tc, err := ParseTraceParent(req.Header.Get(traceParentHeader))
+	if err != nil {
+		return TraceContext{}, false
+	}
+
+	tc.TraceState = strings.Join(req.Header.Values(traceStateHeader), ",")
+	tc.Baggage = strings.Join(req.Header.Values(baggageHeader), ",")
+
+	return tc, true
+}
+
+// Span is a gateway span, started for every request that is routed to a gRPC method.
+type Span interface {
+	// TraceContext returns the trace context of the span, which gets injected into the outgoing gRPC metadata.
+	TraceContext() TraceContext
+
+	// SetStatus sets the final gRPC status of the request.
+	SetStatus(code codes.Code, message string)
+
+	// End completes the span.
+	End()
+}
+
+// Tracer starts the gateway spans. Tracer is intended to be adapted to tracing libraries such as OpenTelemetry.
+type Tracer interface {
+	// Start starts a new span named after the full gRPC method name. The parent is the trace context extracted from
+	// the HTTP request, if the request does not have a valid trace context, the parent is the zero value.
+	//
+	// The returned context is used for the gRPC call.
+	Start(ctx context.Context, name string, parent TraceContext, req *http.Request) (context.Context, Span)
+}
+
+// NoopTracer is a Tracer that does not record any spans. The incoming trace context is propagated to the gRPC
+// server as is.
+type NoopTracer struct{}
+
+// Start returns a span that carries the parent trace context.
+func (NoopTracer) Start(ctx context.Context, _ string, parent TraceContext, _ *http.Request) (context.Context, Span) {
+	return ctx, noopSpan{traceContext: parent}
+}
+
+type noopSpan struct {
+	traceContext TraceContext
+}
+
+func (s noopSpan) TraceContext() TraceContext { return s.traceContext }
+func (noopSpan) SetStatus(codes.Code, string) {}
+func (noopSpan) End()                         {}
+
+// isTraceContextHeader reports whether or not the canonical header key is a W3C trace context header.
+func isTraceContextHeader(key string) bool {
+	return key == traceParentHeader || key == traceStateHeader || key == baggageHeader
+}
+
+// startSpan starts the gateway span for the request and returns the metadata pairs that propagate the span to the
+// gRPC server.
+func (s *ServeMux) startSpan(ctx context.Context, req *http.Request, rpcMethodName string) (context.Context, []string) {
+	// spans can only be completed when the request is served by the ServeMux.
+	state := requestStateFromRequest(req)
+	if state == nil {
+		return ctx, nil
+	}
+
+	if state.span == nil {
+		parent, _ := TraceContextFromRequest(req)
+		ctx, state.span = s.tracer.Start(ctx, rpcMethodName, parent, req)
+	}
+
+	tc := state.span.TraceContext()
+	if !tc.IsValid() {
+		return ctx, nil
+	}
+
+	state.responseHeader.Set(traceResponseHeader, tc.TraceParent())
+
+	pairs := []string{strings.ToLower(traceParentHeader), tc.TraceParent()}
+	if tc.TraceState != "" {
+		pairs = append(pairs, strings.ToLower(traceStateHeader), tc.TraceState)
+	}
+	if tc.Baggage != "" {
+		pairs = append(pairs, strings.ToLower(baggageHeader), tc.Baggage)
+	}
+
+	return ctx, pairs
+}
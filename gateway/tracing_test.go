@@ -0,0 +1,117 @@
+package gateway_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/meshapi/grpc-api-gateway/gateway"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	testCases := []struct {
+		Value string
+		Valid bool
+	}{
+		{Value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", Valid: true},
+		{Value: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future", Valid: true},
+		{Value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", Valid: false},
+		{Value: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", Valid: false},
+		{Value: "00-00000000000000000000000000000000-00f067aa0ba902b7-01", Valid: false},
+		{Value: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", Valid: false},
+		{Value: "00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01", Valid: false},
+		{Value: "00-xbf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", Valid: false},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.Value, func(t *testing.T) {
+			tc, err := gateway.ParseTraceParent(tt.Value)
+			if tt.Valid != (err == nil) {
+				t.Fatalf("expected valid=%v, got error: %v", tt.Valid, err)
+			}
+			if tt.Valid && tc.TraceParent() != "00"+tt.Value[2:55] {
+				t.Fatalf("unexpected traceparent: %s", tc.TraceParent())
+			}
+		})
+	}
+}
+
+type testSpan struct {
+	traceContext gateway.TraceContext
+	name         string
+	parent       gateway.TraceContext
+	code         codes.Code
+	ended        bool
+}
+
+func (s *testSpan) TraceContext() gateway.TraceContext  { return s.traceContext }
+func (s *testSpan) SetStatus(code codes.Code, _ string) { s.code = code }
+func (s *testSpan) End()                                { s.ended = true }
+
+type testTracer struct {
+	spans []*testSpan
+}
+
+func (t *testTracer) Start(
+	ctx context.Context, name string, parent gateway.TraceContext, _ *http.Request) (context.Context, gateway.Span) {
+
+	span := &testSpan{name: name, parent: parent, traceContext: parent}
+	span.traceContext.SpanID = [8]byte{1, 2, 3, 4, 5, 6, 7, byte(len(t.spans) + 1)}
+	t.spans = append(t.spans, span)
+	return ctx, span
+}
+
+func TestTracer(t *testing.T) {
+	tracer := &testTracer{}
+	mux := gateway.NewServeMux(gateway.WithTracer(tracer))
+
+	var outgoing metadata.MD
+	mux.HandleWithParams(http.MethodGet, "/v1/items", func(w http.ResponseWriter, r *http.Request, _ gateway.Params) {
+		ctx, err := gateway.AnnotateContext(r.Context(), mux, r, "/example.Items/List")
+		if err != nil {
+			t.Fatalf("failed to annotate context: %s", err)
+		}
+		outgoing, _ = metadata.FromOutgoingContext(ctx)
+		_, outbound := mux.MarshalerForRequest(r)
+		mux.HTTPError(ctx, outbound, w, r, status.Error(codes.NotFound, "not found"))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/items", nil)
+	req.Header.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("Tracestate", "vendor=value")
+	req.Header.Set("Baggage", "user=1")
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, req)
+
+	if len(tracer.spans) != 1 {
+		t.Fatalf("expected one span, got %d", len(tracer.spans))
+	}
+	span := tracer.spans[0]
+	if span.name != "/example.Items/List" {
+		t.Errorf("unexpected span name: %q", span.name)
+	}
+	if !span.parent.IsValid() || !span.parent.IsSampled() {
+		t.Errorf("expected a valid and sampled parent: %+v", span.parent)
+	}
+	if span.code != codes.NotFound || !span.ended {
+		t.Errorf("expected span to end with NotFound, got code=%s ended=%v", span.code, span.ended)
+	}
+
+	expectedTraceParent := "00-4bf92f3577b34da6a3ce929d0e0e4736-0102030405060701-01"
+	if values := outgoing.Get("traceparent"); len(values) != 1 || values[0] != expectedTraceParent {
+		t.Errorf("unexpected outgoing traceparent: %v", values)
+	}
+	if values := outgoing.Get("tracestate"); len(values) != 1 || values[0] != "vendor=value" {
+		t.Errorf("unexpected outgoing tracestate: %v", values)
+	}
+	if values := outgoing.Get("baggage"); len(values) != 1 || values[0] != "user=1" {
+		t.Errorf("unexpected outgoing baggage: %v", values)
+	}
+	if value := recorder.Header().Get("Traceresponse"); value != expectedTraceParent {
+		t.Errorf("unexpected traceresponse header: %q", value)
+	}
+}
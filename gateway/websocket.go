@@ -0,0 +1,477 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/meshapi/grpc-api-gateway/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/grpclog"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// WebsocketConfig configures the keepalive and the limits of the websocket connections.
+type WebsocketConfig struct {
+	// PingInterval is the interval between the ping messages that are sent to the client. Zero disables the pings.
+	PingInterval time.Duration
+
+	// PongTimeout is the amount of time to wait for a pong after sending a ping before the connection is considered
+	// dead. Default is PingInterval.
+	PongTimeout time.Duration
+
+	// IdleTimeout closes the connection when no messages are sent or received for this amount of time, pings and
+	// pongs do not count as messages. Zero disables the idle timeout.
+	IdleTimeout time.Duration
+
+	// MaxMessageSize is the maximum size in bytes of the messages that are received from the client. Zero means no
+	// limit.
+	MaxMessageSize int64
+
+	// CloseCodeFunc maps the gRPC code of the final status of the RPC to the code of the close message. Default is
+	// WebsocketCloseCodeFromCode.
+	CloseCodeFunc func(codes.Code) int
+
+	// SendStatusFrame sends a terminal message with the final status and the trailers of the RPC before the close
+	// message, including when the RPC completes successfully. When disabled, only the errors are sent as
+	// google.rpc.Status messages.
+	//
+	// The terminal message is an object with the "status" and "trailers" fields, "trailers" maps the trailer keys to
+	// the lists of their values.
+	SendStatusFrame bool
+
+	// Subprotocols maps the websocket subprotocols, such as "json" or "proto", to the MIME types of the marshalers
+	// registered in the ServeMux. Browsers cannot set the Accept and the Content-Type headers of websocket requests, so
+	// the marshaler of a websocket connection is chosen by the first subprotocol of the Sec-WebSocket-Protocol header
+	// that is in this map.
+	//
+	// The chosen subprotocol is set in the Sec-WebSocket-Protocol header of the response before the websocket upgrade
+	// function is called, the upgrade function must include the response headers in the handshake response.
+	Subprotocols map[string]string
+
+	// Envelope wraps the messages that are sent to the client in envelopes to deliver the gRPC metadata and the final
+	// status. The first envelope holds the header metadata, each response is wrapped in a message envelope and the
+	// last envelope holds the final status and the trailers:
+	//
+	//	{"type": "header", "metadata": {"key": ["value"]}}
+	//	{"type": "message", "message": {...}}
+	//	{"type": "trailer", "status": {"code": 0, "message": ""}, "trailers": {"key": ["value"]}}
+	//
+	// Responses that are not marshaled to JSON, such as protobuf messages, are set in the "data" field of the message
+	// envelopes as base64 strings. The messages that are received from the client are not wrapped. See
+	// WebsocketClient for reading the envelopes in Go.
+	Envelope bool
+}
+
+// websocketProtocolHeader is the header that holds the websocket subprotocols.
+var websocketProtocolHeader = http.CanonicalHeaderKey("Sec-WebSocket-Protocol")
+
+// websocketSubprotocol returns the subprotocol that is chosen for a websocket upgrade request and its marshaler.
+func (s *ServeMux) websocketSubprotocol(req *http.Request) (string, Marshaler, bool) {
+	if len(s.websocketConfig.Subprotocols) == 0 {
+		return "", nil, false
+	}
+
+	for _, value := range req.Header[websocketProtocolHeader] {
+		for _, protocol := range strings.Split(value, ",") {
+			protocol = strings.TrimSpace(protocol)
+			mimeType, ok := s.websocketConfig.Subprotocols[protocol]
+			if !ok {
+				continue
+			}
+			if marshaler, ok := s.marshalers.MIMEMap[mimeType]; ok {
+				return protocol, marshaler, true
+			}
+		}
+	}
+
+	return "", nil, false
+}
+
+// websocketMessageType returns the message type to use for the messages of a marshaler, text for the textual formats
+// such as JSON and YAML and binary for every other format.
+func websocketMessageType(marshaler Marshaler) int {
+	mainType, subType, ok := marshalerMediaType(marshaler)
+	if !ok {
+		return websocket.TextMessage
+	}
+
+	switch {
+	case mainType == "text":
+		return websocket.TextMessage
+	case mainType == "application" && (subType == "json" || subType == "x-ndjson" || subType == "yaml" ||
+		subType == "xml"):
+		return websocket.TextMessage
+	}
+
+	return websocket.BinaryMessage
+}
+
+// isJSONMarshaler returns whether or not the messages of a marshaler are JSON values.
+func isJSONMarshaler(marshaler Marshaler) bool {
+	mainType, subType, ok := marshalerMediaType(marshaler)
+	return ok && mainType == "application" && (subType == "json" || subType == "x-ndjson")
+}
+
+// marshalerMediaType returns the type and the subtype of the content type of a marshaler, the subtype of the
+// structured syntax suffixes is the suffix, e.g. "json" for "application/problem+json".
+func marshalerMediaType(marshaler Marshaler) (mainType, subType string, ok bool) {
+	mediaType, _, err := mime.ParseMediaType(marshaler.ContentType(nil))
+	if err != nil {
+		return "", "", false
+	}
+
+	mainType, subType, _ = strings.Cut(mediaType, "/")
+	if _, suffix, ok := strings.Cut(subType, "+"); ok {
+		subType = suffix
+	}
+	return mainType, subType, true
+}
+
+// WebsocketCloseCodeFromCode maps a gRPC code to a websocket close code.
+//
+//   - OK is mapped to 1000 (normal closure).
+//   - PermissionDenied and Unauthenticated are mapped to 1008 (policy violation).
+//   - Unknown, Internal and DataLoss are mapped to 1011 (internal error).
+//   - Every other code is mapped to the private close code 4000 plus the gRPC code, for example 4004 for
+//     DeadlineExceeded.
+func WebsocketCloseCodeFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return websocket.CloseNormalClosure
+	case codes.PermissionDenied, codes.Unauthenticated:
+		return websocket.ClosePolicyViolation
+	case codes.Unknown, codes.Internal, codes.DataLoss:
+		return websocket.CloseInternalServerError
+	}
+
+	return websocket.ClosePrivateCodeStart + int(code)
+}
+
+// WebsocketCloseCodeFromContext returns the websocket close code for the gRPC code using the CloseCodeFunc of the
+// ServeMux that invoked the error handler, falling back to WebsocketCloseCodeFromCode.
+func WebsocketCloseCodeFromContext(ctx context.Context, code codes.Code) int {
+	if mux, ok := ctx.Value(statusCodeMapperKey{}).(*ServeMux); ok && mux.websocketConfig.CloseCodeFunc != nil {
+		return mux.websocketConfig.CloseCodeFunc(code)
+	}
+	return WebsocketCloseCodeFromCode(code)
+}
+
+// CloseWebsocketWithStatus sends the final status of an RPC to the client and closes the connection with the close
+// code mapped from the gRPC code and the status message as the reason. The trailers are read from the ServerMetadata
+// of the context and filtered using the outgoing header matcher of the ServeMux.
+//
+// Unless the ServeMux is configured to send status frames or envelopes, the status is only sent for errors, as a
+// google.rpc.Status message. See WebsocketConfig.
+func CloseWebsocketWithStatus(
+	ctx context.Context, marshaler Marshaler, connection websocket.Connection, st *status.Status) {
+
+	var config WebsocketConfig
+	mux, hasMux := ctx.Value(statusCodeMapperKey{}).(*ServeMux)
+	if hasMux {
+		config = mux.websocketConfig
+	}
+
+	var message proto.Message
+	switch {
+	case config.SendStatusFrame || config.Envelope:
+		md, _ := ServerMetadataFromContext(ctx)
+		trailers := md.TrailerMD
+		if hasMux {
+			trailers = mux.outgoingMetadata(trailers)
+		}
+		frame := websocketStatusFrame(st, trailers)
+		if config.Envelope {
+			frame.Fields["type"] = structpb.NewStringValue(WebsocketEnvelopeTrailer)
+		}
+		message = frame
+	case st.Code() != codes.OK:
+		message = st.Proto()
+	}
+
+	if message != nil {
+		data, err := marshaler.Marshal(message)
+		if frame, ok := message.(*structpb.Struct); ok && err != nil {
+			// the status is still delivered when the trailers cannot be encoded.
+			grpclog.Infof("failed to marshal websocket trailers: %s", err)
+			frame.Fields["trailers"] = metadataValue(nil)
+			data, err = marshaler.Marshal(frame)
+		}
+		if err != nil {
+			grpclog.Infof("failed to marshal websocket status: %s", err)
+		} else if err := connection.SendMessageWithType(websocketMessageType(marshaler), data); err != nil &&
+			err != io.EOF {
+			grpclog.Infof("failed to send websocket status: %s", err)
+		}
+	}
+
+	code := WebsocketCloseCodeFromContext(ctx, st.Code())
+	if err := connection.SendCloseWithCode(code, truncateCloseReason(st.Message())); err != nil && err != io.EOF {
+		grpclog.Infof("failed to send websocket close message: %s", err)
+	}
+}
+
+// websocketStatusFrame creates the terminal message that holds the final status and the trailers of an RPC.
+func websocketStatusFrame(st *status.Status, trailers metadata.MD) *structpb.Struct {
+	statusValue := &structpb.Struct{}
+	if data, err := protojson.Marshal(st.Proto()); err != nil || protojson.Unmarshal(data, statusValue) != nil {
+		// the details could not be resolved, the code and the message are still delivered.
+		statusValue = &structpb.Struct{}
+	}
+	if statusValue.Fields == nil {
+		statusValue.Fields = map[string]*structpb.Value{}
+	}
+	statusValue.Fields["code"] = structpb.NewNumberValue(float64(st.Code()))
+	statusValue.Fields["message"] = structpb.NewStringValue(st.Message())
+
+	return &structpb.Struct{Fields: map[string]*structpb.Value{
+		"status":   structpb.NewStructValue(statusValue),
+		"trailers": metadataValue(trailers),
+	}}
+}
+
+// truncateCloseReason truncates the reason to MaxCloseReasonLength bytes without splitting a UTF-8 character.
+func truncateCloseReason(reason string) string {
+	if len(reason) <= websocket.MaxCloseReasonLength {
+		return reason
+	}
+
+	reason = reason[:websocket.MaxCloseReasonLength]
+	for len(reason) > 0 && !utf8.ValidString(reason) {
+		reason = reason[:len(reason)-1]
+	}
+	return reason
+}
+
+// errWebsocketMessageTooLarge is returned when a received message exceeds the maximum message size.
+var errWebsocketMessageTooLarge = errors.New("websocket message exceeds the maximum message size")
+
+// websocketSession wraps a websocket connection to serialize the writes, enforce the limits and keep track of the
+// activity on the connection.
+type websocketSession struct {
+	websocket.Connection
+
+	config      WebsocketConfig
+	messageType int
+	sendMutex   sync.Mutex
+
+	// lastActivity and lastPong are the unix nano times of the last message and the last pong.
+	lastActivity atomic.Int64
+	lastPong     atomic.Int64
+
+	closed atomic.Bool
+}
+
+func (s *ServeMux) newWebsocketSession(ws websocket.Connection, messageType int) *websocketSession {
+	session := &websocketSession{
+		Connection:  ws,
+		config:      s.websocketConfig,
+		messageType: messageType,
+	}
+	session.lastActivity.Store(time.Now().UnixNano())
+	if _, ok := ws.(*multiplexedStream); ok {
+		// the pings are sent on the multiplexed connection.
+		session.config.PingInterval = 0
+	}
+
+	if session.config.MaxMessageSize > 0 {
+		ws.SetReadLimit(session.config.MaxMessageSize)
+	}
+	if session.config.PingInterval > 0 {
+		ws.SetPongHandler(func() {
+			session.lastPong.Store(time.Now().UnixNano())
+		})
+	}
+
+	return session
+}
+
+func (w *websocketSession) SendMessage(data []byte) error {
+	w.sendMutex.Lock()
+	defer w.sendMutex.Unlock()
+
+	w.lastActivity.Store(time.Now().UnixNano())
+	return w.Connection.SendMessageWithType(w.messageType, data)
+}
+
+func (w *websocketSession) SendMessageWithType(messageType int, data []byte) error {
+	w.sendMutex.Lock()
+	defer w.sendMutex.Unlock()
+
+	w.lastActivity.Store(time.Now().UnixNano())
+	return w.Connection.SendMessageWithType(messageType, data)
+}
+
+func (w *websocketSession) SendClose() error {
+	w.sendMutex.Lock()
+	defer w.sendMutex.Unlock()
+
+	return w.Connection.SendClose()
+}
+
+func (w *websocketSession) SendCloseWithCode(code int, reason string) error {
+	w.sendMutex.Lock()
+	defer w.sendMutex.Unlock()
+
+	return w.Connection.SendCloseWithCode(code, reason)
+}
+
+func (w *websocketSession) SendPing() error {
+	w.sendMutex.Lock()
+	defer w.sendMutex.Unlock()
+
+	return w.Connection.SendPing()
+}
+
+func (w *websocketSession) ReceiveMessage() ([]byte, error) {
+	data, err := w.Connection.ReceiveMessage()
+	if err != nil {
+		return data, err
+	}
+
+	w.lastActivity.Store(time.Now().UnixNano())
+	if w.config.MaxMessageSize > 0 && int64(len(data)) > w.config.MaxMessageSize {
+		return nil, errWebsocketMessageTooLarge
+	}
+	return data, nil
+}
+
+func (w *websocketSession) Close() error {
+	w.closed.Store(true)
+	return w.Connection.Close()
+}
+
+// isClosed returns whether or not the gateway has closed the connection.
+func (w *websocketSession) isClosed() bool {
+	return w.closed.Load()
+}
+
+// startKeepalive sends the pings and watches the timeouts until the returned function is called. When a timeout
+// passes, "onTimeout" gets called with a DeadlineExceeded error.
+func (w *websocketSession) startKeepalive(onTimeout func(error)) (stop func()) {
+	if w.config.PingInterval <= 0 && w.config.IdleTimeout <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		if err := w.keepalive(done); err != nil {
+			onTimeout(err)
+		}
+	}()
+
+	return sync.OnceFunc(func() {
+		close(done)
+		<-stopped
+	})
+}
+
+// keepalive returns a DeadlineExceeded error once a timeout passes, or nil when done gets closed or the connection
+// breaks.
+func (w *websocketSession) keepalive(done <-chan struct{}) error {
+	pingInterval, idleTimeout := w.config.PingInterval, w.config.IdleTimeout
+	pongTimeout := w.config.PongTimeout
+	if pongTimeout <= 0 {
+		pongTimeout = pingInterval
+	}
+
+	var pingSentAt time.Time
+	awaitingPong := false
+	nextPing := time.Now().Add(pingInterval)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	<-timer.C
+
+	for {
+		now := time.Now()
+
+		if awaitingPong && w.lastPong.Load() >= pingSentAt.UnixNano() {
+			awaitingPong = false
+		}
+		if awaitingPong && !now.Before(pingSentAt.Add(pongTimeout)) {
+			return status.Errorf(codes.DeadlineExceeded, "websocket connection timed out: no pong received in %s",
+				pongTimeout)
+		}
+
+		lastActivity := time.Unix(0, w.lastActivity.Load())
+		if idleTimeout > 0 && !now.Before(lastActivity.Add(idleTimeout)) {
+			return status.Errorf(codes.DeadlineExceeded, "websocket connection has been idle for %s", idleTimeout)
+		}
+
+		if pingInterval > 0 && !awaitingPong && !now.Before(nextPing) {
+			if err := w.SendPing(); err != nil {
+				return nil
+			}
+			pingSentAt, awaitingPong = now, true
+			nextPing = now.Add(pingInterval)
+		}
+
+		// while waiting for a pong, wake up for the next ping too since the pong may arrive in the meantime.
+		var wakeUp time.Time
+		if pingInterval > 0 {
+			wakeUp = nextPing
+			if pongDeadline := pingSentAt.Add(pongTimeout); awaitingPong &&
+				(!nextPing.After(now) || pongDeadline.Before(nextPing)) {
+				wakeUp = pongDeadline
+			}
+		}
+		if idleTimeout > 0 && (wakeUp.IsZero() || lastActivity.Add(idleTimeout).Before(wakeUp)) {
+			wakeUp = lastActivity.Add(idleTimeout)
+		}
+
+		timer.Reset(time.Until(wakeUp))
+		select {
+		case <-done:
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// handleWebsocketReceiveError reports the errors of receiving messages that are caused by the limits to the client.
+func (s *ServeMux) handleWebsocketReceiveError(
+	ctx context.Context, marshaler Marshaler, req *http.Request, ws websocket.Connection, err error) {
+
+	if errors.Is(err, errWebsocketMessageTooLarge) {
+		s.WebsocketError(ctx, marshaler, req, ws, status.Errorf(codes.ResourceExhausted,
+			"websocket message exceeds the maximum message size of %d bytes", s.websocketConfig.MaxMessageSize))
+	}
+}
+
+// handleWebsocketStreamEnd closes the connection with the final status of the gRPC stream once receiving from the
+// stream returns "err", unless the connection is already closed.
+func (s *ServeMux) handleWebsocketStreamEnd(
+	ctx context.Context, marshaler Marshaler, req *http.Request, session *websocketSession,
+	stream grpc.ClientStream, err error) {
+
+	if session.isClosed() {
+		return
+	}
+
+	md, _ := ServerMetadataFromContext(ctx)
+	md.TrailerMD = stream.Trailer()
+	ctx = NewServerMetadataContext(ctx, md)
+
+	if err == io.EOF {
+		CloseWebsocketWithStatus(s.errorContext(ctx), marshaler, session, status.New(codes.OK, ""))
+		return
+	}
+
+	grpclog.Infof("Failed to receive message from gRPC stream: %v", err)
+	s.WebsocketError(ctx, marshaler, req, session, err)
+}
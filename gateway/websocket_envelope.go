@@ -0,0 +1,265 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/meshapi/grpc-api-gateway/websocket"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Types of the envelopes that are sent in the websocket envelope mode, see WebsocketConfig.Envelope.
+const (
+	// WebsocketEnvelopeHeader is the type of the first envelope, which holds the header metadata.
+	WebsocketEnvelopeHeader = "header"
+
+	// WebsocketEnvelopeMessage is the type of the envelopes that hold the responses.
+	WebsocketEnvelopeMessage = "message"
+
+	// WebsocketEnvelopeTrailer is the type of the last envelope, which holds the final status and the trailers.
+	WebsocketEnvelopeTrailer = "trailer"
+)
+
+// sendWebsocketHeader sends the header envelope once the header metadata of the stream is received. The header
+// metadata is filtered using the outgoing header matcher.
+func (s *ServeMux) sendWebsocketHeader(
+	marshaler Marshaler, ws websocket.Connection, stream grpc.ClientStream) error {
+
+	header, err := stream.Header()
+	if err != nil {
+		// the error of the stream gets reported once receiving from the stream fails.
+		return nil
+	}
+
+	data, err := marshaler.Marshal(&structpb.Struct{Fields: map[string]*structpb.Value{
+		"type":     structpb.NewStringValue(WebsocketEnvelopeHeader),
+		"metadata": metadataValue(s.outgoingMetadata(header)),
+	}})
+	if err != nil {
+		return fmt.Errorf("failed to marshal header envelope: %w", err)
+	}
+
+	return ws.SendMessage(data)
+}
+
+// outgoingMetadata returns the metadata whose keys are accepted by the outgoing header matcher.
+func (s *ServeMux) outgoingMetadata(md metadata.MD) metadata.MD {
+	filtered := metadata.MD{}
+	for key, values := range md {
+		if _, ok := s.outgoingHeaderMatcher(key); ok {
+			filtered[key] = values
+		}
+	}
+
+	return filtered
+}
+
+// wrapWebsocketMessage wraps a marshaled response in a message envelope. The responses of the JSON marshalers are
+// embedded as they are in the "message" field and the responses of the other marshalers are set in the "data" field
+// as base64 strings.
+func wrapWebsocketMessage(marshaler Marshaler, data []byte) ([]byte, error) {
+	if isJSONMarshaler(marshaler) {
+		return json.Marshal(map[string]json.RawMessage{
+			"type":    json.RawMessage(`"` + WebsocketEnvelopeMessage + `"`),
+			"message": data,
+		})
+	}
+
+	return marshaler.Marshal(&structpb.Struct{Fields: map[string]*structpb.Value{
+		"type": structpb.NewStringValue(WebsocketEnvelopeMessage),
+		"data": structpb.NewStringValue(base64.StdEncoding.EncodeToString(data)),
+	}})
+}
+
+// metadataValue returns a struct value that maps the metadata keys to the lists of their values. The values of the
+// binary keys, which end with "-bin", are encoded using base64.
+func metadataValue(md metadata.MD) *structpb.Value {
+	fields := make(map[string]*structpb.Value, len(md))
+	for key, values := range md {
+		binary := strings.HasSuffix(key, "-bin")
+		list := &structpb.ListValue{Values: make([]*structpb.Value, 0, len(values))}
+		for _, value := range values {
+			if binary {
+				value = base64.RawStdEncoding.EncodeToString([]byte(value))
+			}
+			list.Values = append(list.Values, structpb.NewStringValue(value))
+		}
+		fields[key] = structpb.NewListValue(list)
+	}
+
+	return structpb.NewStructValue(&structpb.Struct{Fields: fields})
+}
+
+// metadataFromValue is the inverse of metadataValue.
+func metadataFromValue(value *structpb.Value) (metadata.MD, error) {
+	md := metadata.MD{}
+	for key, values := range value.GetStructValue().GetFields() {
+		binary := strings.HasSuffix(key, "-bin")
+		for _, value := range values.GetListValue().GetValues() {
+			if !binary {
+				md.Append(key, value.GetStringValue())
+				continue
+			}
+
+			data, err := decodeBinHeader(value.GetStringValue())
+			if err != nil {
+				return nil, fmt.Errorf("invalid binary metadata %s: %w", key, err)
+			}
+			md.Append(key, string(data))
+		}
+	}
+
+	return md, nil
+}
+
+// WebsocketClient reads the envelopes that are sent in the websocket envelope mode and exposes them the same way a
+// gRPC client stream does. It can be used in tests and in Go clients of the gateway, see WebsocketConfig.Envelope.
+//
+// The connection is the client side of a websocket connection, for example a gorilla/websocket client connection
+// that is wrapped using gorillawrapper. The marshaler must be the marshaler that the gateway uses for the connection.
+type WebsocketClient struct {
+	connection websocket.Connection
+	marshaler  Marshaler
+
+	header     metadata.MD
+	trailer    metadata.MD
+	status     *status.Status
+	headerRead bool
+}
+
+// NewWebsocketClient creates a WebsocketClient for a websocket connection in the envelope mode.
+func NewWebsocketClient(connection websocket.Connection, marshaler Marshaler) *WebsocketClient {
+	return &WebsocketClient{connection: connection, marshaler: marshaler}
+}
+
+// Header returns the header metadata, waiting for it to be received if needed. If the stream fails before the
+// header metadata is sent, the error of the stream is returned.
+func (c *WebsocketClient) Header() (metadata.MD, error) {
+	for !c.headerRead && c.status == nil {
+		envelope, err := c.receiveEnvelope()
+		if err != nil {
+			return nil, err
+		}
+		if envelope.Fields["type"].GetStringValue() == WebsocketEnvelopeMessage {
+			return nil, errors.New("unexpected message envelope before the header envelope")
+		}
+	}
+
+	if !c.headerRead {
+		return nil, c.status.Err()
+	}
+	return c.header, nil
+}
+
+// Trailer returns the trailers once RecvMsg has returned a non-nil error.
+func (c *WebsocketClient) Trailer() metadata.MD {
+	return c.trailer
+}
+
+// Status returns the final status of the stream once RecvMsg has returned a non-nil error, or nil if the connection
+// was closed without a trailer envelope.
+func (c *WebsocketClient) Status() *status.Status {
+	return c.status
+}
+
+// SendMsg marshals and sends a request message.
+func (c *WebsocketClient) SendMsg(v any) error {
+	data, err := c.marshaler.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	return c.connection.SendMessage(data)
+}
+
+// RecvMsg receives the next response into v. It returns io.EOF when the stream completes successfully, the error of
+// the final status when the stream fails and io.ErrUnexpectedEOF if the connection closes without a trailer envelope.
+func (c *WebsocketClient) RecvMsg(v any) error {
+	for c.status == nil {
+		envelope, err := c.receiveEnvelope()
+		if err != nil {
+			return err
+		}
+		if envelope.Fields["type"].GetStringValue() != WebsocketEnvelopeMessage {
+			continue
+		}
+
+		if message, ok := envelope.Fields["message"]; ok {
+			data, err := protojson.Marshal(message)
+			if err != nil {
+				return fmt.Errorf("failed to read message: %w", err)
+			}
+			return c.marshaler.Unmarshal(data, v)
+		}
+
+		data, err := base64.StdEncoding.DecodeString(envelope.Fields["data"].GetStringValue())
+		if err != nil {
+			return fmt.Errorf("failed to read message data: %w", err)
+		}
+		return c.marshaler.Unmarshal(data, v)
+	}
+
+	if c.status.Code() == codes.OK {
+		return io.EOF
+	}
+	return c.status.Err()
+}
+
+// Close closes the connection.
+func (c *WebsocketClient) Close() error {
+	return c.connection.Close()
+}
+
+// receiveEnvelope receives the next envelope and keeps track of the metadata and the final status.
+func (c *WebsocketClient) receiveEnvelope() (*structpb.Struct, error) {
+	data, err := c.connection.ReceiveMessage()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	envelope := &structpb.Struct{}
+	if err := c.marshaler.Unmarshal(data, envelope); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal envelope: %w", err)
+	}
+
+	switch envelope.Fields["type"].GetStringValue() {
+	case WebsocketEnvelopeHeader:
+		header, err := metadataFromValue(envelope.Fields["metadata"])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read header: %w", err)
+		}
+		c.header = header
+		c.headerRead = true
+	case WebsocketEnvelopeTrailer:
+		trailer, err := metadataFromValue(envelope.Fields["trailers"])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read trailers: %w", err)
+		}
+		c.trailer = trailer
+
+		statusData, err := protojson.Marshal(envelope.Fields["status"])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read status: %w", err)
+		}
+		statusProto := &spb.Status{}
+		if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(statusData, statusProto); err != nil {
+			return nil, fmt.Errorf("failed to read status: %w", err)
+		}
+		c.status = status.FromProto(statusProto)
+	}
+
+	return envelope, nil
+}
@@ -0,0 +1,265 @@
+package gateway_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/meshapi/grpc-api-gateway/gateway"
+	"github.com/meshapi/grpc-api-gateway/protomarshal"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// recordedConnection is the client side of a fakeWebsocket that receives the messages the server has sent.
+type recordedConnection struct {
+	*fakeWebsocket
+}
+
+func (r recordedConnection) ReceiveMessage() ([]byte, error) {
+	select {
+	case data := <-r.sent:
+		return data, nil
+	default:
+		return nil, io.EOF
+	}
+}
+
+func TestWebsocketEnvelope(t *testing.T) {
+	ws := newFakeWebsocket(false)
+	mux := gateway.NewServeMux(
+		gateway.WithWebsocketConfig(gateway.WebsocketConfig{Envelope: true}),
+		gateway.WithOutgoingHeaderMatcher(func(key string) (string, bool) {
+			return key, key != "x-internal"
+		}))
+	marshaler := &protomarshal.JSONPb{}
+	req := httptest.NewRequest(http.MethodGet, "/v1/stream", nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := replyStream{
+		blockingStream: blockingStream{ctx: ctx},
+		header:         metadata.Pairs("x-token", "abc", "x-internal", "secret"),
+		trailer:        metadata.Pairs("x-total", "2", "x-internal", "secret"),
+		responses:      []proto.Message{wrapperspb.String("first"), wrapperspb.String("second")},
+		index:          new(int),
+	}
+	mux.ForwardWebsocketServerStreaming(ctx, req, stream, ws, marshaler, &wrapperspb.StringValue{})
+
+	expectedFrames := []string{
+		`{"metadata":{"x-token":["abc"]},"type":"header"}`,
+		`{"message":"first","type":"message"}`,
+		`{"message":"second","type":"message"}`,
+		`{"status":{"code":0,"message":""},"trailers":{"x-total":["2"]},"type":"trailer"}`,
+	}
+	var frames [][]byte
+	for len(ws.sent) > 0 {
+		frames = append(frames, <-ws.sent)
+	}
+	if len(frames) != len(expectedFrames) {
+		t.Fatalf("expected %d frames, got %d", len(expectedFrames), len(frames))
+	}
+	for index, frame := range frames {
+		if compactJSON(t, frame) != expectedFrames[index] {
+			t.Errorf("expected frame %s, got %s", expectedFrames[index], frame)
+		}
+		ws.sent <- frame
+	}
+
+	client := gateway.NewWebsocketClient(recordedConnection{ws}, marshaler)
+	header, err := client.Header()
+	if err != nil {
+		t.Fatalf("failed to read header: %s", err)
+	}
+	if len(header) != 1 || header.Get("x-token")[0] != "abc" {
+		t.Errorf("unexpected header: %v", header)
+	}
+
+	for _, expected := range []string{"first", "second"} {
+		response := &wrapperspb.StringValue{}
+		if err := client.RecvMsg(response); err != nil {
+			t.Fatalf("failed to receive message: %s", err)
+		}
+		if response.GetValue() != expected {
+			t.Errorf("expected %q, got %q", expected, response.GetValue())
+		}
+	}
+	if err := client.RecvMsg(&wrapperspb.StringValue{}); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+	if trailer := client.Trailer(); len(trailer.Get("x-total")) != 1 || trailer.Get("x-total")[0] != "2" {
+		t.Errorf("unexpected trailer: %v", trailer)
+	}
+	if code, _ := ws.closeMessage(); code != 1000 {
+		t.Errorf("expected normal closure, got %d", code)
+	}
+}
+
+func TestWebsocketEnvelopeError(t *testing.T) {
+	ws := newFakeWebsocket(false)
+	mux := gateway.NewServeMux(gateway.WithWebsocketConfig(gateway.WebsocketConfig{Envelope: true}))
+	marshaler := &protomarshal.ProtoMarshaller{}
+	req := httptest.NewRequest(http.MethodGet, "/v1/stream", nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := replyStream{
+		blockingStream: blockingStream{ctx: ctx},
+		trailer:        metadata.Pairs("x-retry", "later"),
+		responses:      []proto.Message{wrapperspb.String("partial")},
+		index:          new(int),
+		err:            status.Error(codes.Unavailable, "backend is down"),
+	}
+	mux.ForwardWebsocket(
+		ctx, req, stream, ws, marshaler, marshaler, &wrapperspb.StringValue{}, &wrapperspb.StringValue{})
+
+	client := gateway.NewWebsocketClient(recordedConnection{ws}, marshaler)
+	if header, err := client.Header(); err != nil || len(header) != 0 {
+		t.Fatalf("unexpected header %v: %v", header, err)
+	}
+
+	response := &wrapperspb.StringValue{}
+	if err := client.RecvMsg(response); err != nil || response.GetValue() != "partial" {
+		t.Fatalf("unexpected response %v: %v", response, err)
+	}
+
+	err := client.RecvMsg(response)
+	if status.Code(err) != codes.Unavailable || status.Convert(err).Message() != "backend is down" {
+		t.Errorf("expected the status of the stream, got %v", err)
+	}
+	if trailer := client.Trailer(); len(trailer.Get("x-retry")) != 1 {
+		t.Errorf("unexpected trailer: %v", trailer)
+	}
+	if err := client.RecvMsg(response); status.Code(err) != codes.Unavailable {
+		t.Errorf("expected the status to be returned again, got %v", err)
+	}
+}
+
+func TestWebsocketEnvelopeBinaryMessage(t *testing.T) {
+	ws := newFakeWebsocket(false)
+	mux := gateway.NewServeMux(gateway.WithWebsocketConfig(gateway.WebsocketConfig{Envelope: true}))
+	marshaler := &protomarshal.ProtoMarshaller{}
+	req := httptest.NewRequest(http.MethodGet, "/v1/stream", nil)
+
+	// the protobuf encoding of this message is a valid JSON value, it must still be sent as binary data.
+	value := `"` + strings.Repeat("a", 30) + `"`
+	data, err := marshaler.Marshal(wrapperspb.String(value))
+	if err != nil || !json.Valid(data) {
+		t.Fatalf("expected the message to be encoded as a valid JSON value, got %q: %v", data, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := replyStream{
+		blockingStream: blockingStream{ctx: ctx},
+		responses:      []proto.Message{wrapperspb.String(value)},
+		index:          new(int),
+	}
+	mux.ForwardWebsocketServerStreaming(ctx, req, stream, ws, marshaler, &wrapperspb.StringValue{})
+
+	var frames [][]byte
+	for len(ws.sent) > 0 {
+		frames = append(frames, <-ws.sent)
+	}
+	if len(frames) != 3 {
+		t.Fatalf("expected 3 frames, got %d", len(frames))
+	}
+
+	envelope := &structpb.Struct{}
+	if err := marshaler.Unmarshal(frames[1], envelope); err != nil {
+		t.Fatalf("failed to unmarshal envelope: %s", err)
+	}
+	if _, ok := envelope.Fields["message"]; ok || envelope.Fields["data"].GetStringValue() == "" {
+		t.Errorf("expected the message to be set in the data field, got %v", envelope)
+	}
+
+	for _, frame := range frames {
+		ws.sent <- frame
+	}
+	client := gateway.NewWebsocketClient(recordedConnection{ws}, marshaler)
+	response := &wrapperspb.StringValue{}
+	if err := client.RecvMsg(response); err != nil || response.GetValue() != value {
+		t.Errorf("unexpected response %v: %v", response, err)
+	}
+}
+
+func TestWebsocketEnvelopeBinaryMetadata(t *testing.T) {
+	tests := []struct {
+		Name      string
+		Marshaler gateway.Marshaler
+	}{
+		{Name: "JSON", Marshaler: &protomarshal.JSONPb{}},
+		{Name: "Proto", Marshaler: &protomarshal.ProtoMarshaller{}},
+	}
+
+	// the values of the binary keys hold raw bytes that are not valid UTF-8.
+	header := metadata.Pairs("x-token", "abc", "x-signature-bin", "\xff\x00\xfe")
+	trailer := metadata.Pairs("x-trace-bin", "\x80\x81")
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			ws := newFakeWebsocket(false)
+			mux := gateway.NewServeMux(gateway.WithWebsocketConfig(gateway.WebsocketConfig{Envelope: true}))
+			req := httptest.NewRequest(http.MethodGet, "/v1/stream", nil)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			stream := replyStream{
+				blockingStream: blockingStream{ctx: ctx},
+				header:         header,
+				trailer:        trailer,
+				responses:      []proto.Message{wrapperspb.String("first")},
+				index:          new(int),
+			}
+			mux.ForwardWebsocketServerStreaming(ctx, req, stream, ws, tt.Marshaler, &wrapperspb.StringValue{})
+
+			var frames [][]byte
+			for len(ws.sent) > 0 {
+				frames = append(frames, <-ws.sent)
+			}
+			if len(frames) != 3 {
+				t.Fatalf("expected 3 frames, got %d", len(frames))
+			}
+
+			envelope := &structpb.Struct{}
+			if err := tt.Marshaler.Unmarshal(frames[0], envelope); err != nil {
+				t.Fatalf("failed to unmarshal header envelope: %s", err)
+			}
+			values := envelope.Fields["metadata"].GetStructValue().GetFields()["x-signature-bin"].GetListValue()
+			if len(values.GetValues()) != 1 || values.GetValues()[0].GetStringValue() != "/wD+" {
+				t.Errorf("expected the binary header to be base64 encoded, got %v", values)
+			}
+
+			for _, frame := range frames {
+				ws.sent <- frame
+			}
+			client := gateway.NewWebsocketClient(recordedConnection{ws}, tt.Marshaler)
+			received, err := client.Header()
+			if err != nil {
+				t.Fatalf("failed to read header: %s", err)
+			}
+			if !reflect.DeepEqual(received, header) {
+				t.Errorf("expected header %v, got %v", header, received)
+			}
+
+			response := &wrapperspb.StringValue{}
+			if err := client.RecvMsg(response); err != nil || response.GetValue() != "first" {
+				t.Fatalf("unexpected response %v: %v", response, err)
+			}
+			if err := client.RecvMsg(response); err != io.EOF {
+				t.Errorf("expected io.EOF, got %v", err)
+			}
+			if !reflect.DeepEqual(client.Trailer(), trailer) {
+				t.Errorf("expected trailer %v, got %v", trailer, client.Trailer())
+			}
+		})
+	}
+}
@@ -0,0 +1,524 @@
+package gateway_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/meshapi/grpc-api-gateway/gateway"
+	"github.com/meshapi/grpc-api-gateway/protomarshal"
+	"github.com/meshapi/grpc-api-gateway/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// fakeWebsocket is an in-memory websocket connection.
+type fakeWebsocket struct {
+	incoming chan []byte
+	sent     chan []byte
+	pongs    chan struct{}
+	closed   chan struct{}
+
+	autoPong    bool
+	pings       atomic.Int32
+	readLimit   atomic.Int64
+	pongHandler atomic.Pointer[func()]
+	closeOnce   sync.Once
+
+	lastMessageType atomic.Int32
+
+	closeMutex  sync.Mutex
+	closeCode   int
+	closeReason string
+}
+
+func newFakeWebsocket(autoPong bool) *fakeWebsocket {
+	return &fakeWebsocket{
+		incoming: make(chan []byte),
+		sent:     make(chan []byte, 100),
+		pongs:    make(chan struct{}, 100),
+		closed:   make(chan struct{}),
+		autoPong: autoPong,
+	}
+}
+
+func (f *fakeWebsocket) SendMessage(data []byte) error {
+	return f.SendMessageWithType(websocket.TextMessage, data)
+}
+
+func (f *fakeWebsocket) SendMessageWithType(messageType int, data []byte) error {
+	f.lastMessageType.Store(int32(messageType))
+	select {
+	case <-f.closed:
+		return errors.New("connection is closed")
+	default:
+		f.sent <- data
+		return nil
+	}
+}
+
+func (f *fakeWebsocket) SendClose() error { return nil }
+
+func (f *fakeWebsocket) SendCloseWithCode(code int, reason string) error {
+	f.closeMutex.Lock()
+	defer f.closeMutex.Unlock()
+
+	if f.closeCode == 0 {
+		f.closeCode, f.closeReason = code, reason
+	}
+	return nil
+}
+
+// closeMessage returns the code and the reason of the first close message, or zero if none was sent.
+func (f *fakeWebsocket) closeMessage() (int, string) {
+	f.closeMutex.Lock()
+	defer f.closeMutex.Unlock()
+
+	return f.closeCode, f.closeReason
+}
+
+func (f *fakeWebsocket) SendPing() error {
+	f.pings.Add(1)
+	if f.autoPong {
+		f.pongs <- struct{}{}
+	}
+	return nil
+}
+
+func (f *fakeWebsocket) SetPongHandler(handler func()) { f.pongHandler.Store(&handler) }
+
+func (f *fakeWebsocket) SetReadLimit(limit int64) { f.readLimit.Store(limit) }
+
+func (f *fakeWebsocket) ReceiveMessage() ([]byte, error) {
+	for {
+		select {
+		case <-f.pongs:
+			if handler := f.pongHandler.Load(); handler != nil {
+				(*handler)()
+			}
+		case data, ok := <-f.incoming:
+			if !ok {
+				return nil, io.EOF
+			}
+			return data, nil
+		case <-f.closed:
+			return nil, errors.New("connection is closed")
+		}
+	}
+}
+
+func (f *fakeWebsocket) Close() error {
+	f.closeOnce.Do(func() { close(f.closed) })
+	return nil
+}
+
+// errorCode returns the code of the first status sent over the connection, or OK if none was sent.
+func (f *fakeWebsocket) errorCode(t *testing.T) codes.Code {
+	t.Helper()
+
+	select {
+	case data := <-f.sent:
+		var message struct {
+			Code codes.Code `json:"code"`
+		}
+		if err := json.Unmarshal(data, &message); err != nil {
+			t.Fatalf("failed to unmarshal status %q: %s", data, err)
+		}
+		return message.Code
+	default:
+		return codes.OK
+	}
+}
+
+// blockingStream is a gRPC client stream that does not send any responses until its context is done.
+type blockingStream struct {
+	ctx context.Context
+}
+
+func (b blockingStream) Header() (metadata.MD, error) { return nil, nil }
+func (b blockingStream) Trailer() metadata.MD         { return nil }
+func (b blockingStream) CloseSend() error             { return nil }
+func (b blockingStream) Context() context.Context     { return b.ctx }
+func (b blockingStream) SendMsg(any) error            { return nil }
+func (b blockingStream) RecvMsg(any) error {
+	<-b.ctx.Done()
+	return b.ctx.Err()
+}
+
+var _ grpc.ClientStream = blockingStream{}
+
+func newBlockingStream(ctx context.Context) grpc.ClientStream {
+	return blockingStream{ctx: ctx}
+}
+
+// finishedStream is a gRPC client stream that ends with an error and trailers without sending any responses.
+type finishedStream struct {
+	blockingStream
+
+	err     error
+	trailer metadata.MD
+}
+
+func (f finishedStream) Trailer() metadata.MD { return f.trailer }
+func (f finishedStream) RecvMsg(any) error    { return f.err }
+
+// newFinishedStream returns a function that creates a stream that ends with err and the trailers.
+func newFinishedStream(err error, trailer metadata.MD) func(context.Context) grpc.ClientStream {
+	return func(ctx context.Context) grpc.ClientStream {
+		return finishedStream{blockingStream: blockingStream{ctx: ctx}, err: err, trailer: trailer}
+	}
+}
+
+// replyStream is a gRPC client stream that sends the responses and ends successfully.
+type replyStream struct {
+	blockingStream
+
+	header    metadata.MD
+	trailer   metadata.MD
+	responses []proto.Message
+	index     *int
+
+	// err ends the stream after the responses, the stream ends successfully if it is nil.
+	err error
+}
+
+func (r replyStream) Header() (metadata.MD, error) { return r.header, nil }
+func (r replyStream) Trailer() metadata.MD         { return r.trailer }
+
+func (r replyStream) RecvMsg(message any) error {
+	if *r.index == len(r.responses) {
+		if r.err != nil {
+			return r.err
+		}
+		return io.EOF
+	}
+	proto.Merge(message.(proto.Message), r.responses[*r.index])
+	*r.index++
+	return nil
+}
+
+// forwardWebsocket forwards the connection the same way the generated handlers do and returns once forwarding ends.
+func forwardWebsocket(
+	t *testing.T, config gateway.WebsocketConfig, ws *fakeWebsocket, serverStreaming bool,
+	newStream func(context.Context) grpc.ClientStream) {
+
+	t.Helper()
+
+	mux := gateway.NewServeMux(gateway.WithWebsocketConfig(config))
+	marshaler := &protomarshal.JSONPb{}
+	req := httptest.NewRequest("GET", "/v1/stream", nil)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		stream := newStream(ctx)
+		if serverStreaming {
+			mux.ForwardWebsocketServerStreaming(ctx, req, stream, ws, marshaler, &wrapperspb.StringValue{})
+			return
+		}
+		mux.ForwardWebsocket(
+			ctx, req, stream, ws, marshaler, marshaler, &wrapperspb.StringValue{}, &wrapperspb.StringValue{})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("forwarding did not end")
+	}
+}
+
+func TestWebsocketPongTimeout(t *testing.T) {
+	ws := newFakeWebsocket(false)
+	forwardWebsocket(t, gateway.WebsocketConfig{
+		PingInterval: 10 * time.Millisecond,
+		PongTimeout:  20 * time.Millisecond,
+	}, ws, false, newBlockingStream)
+
+	if ws.pings.Load() != 1 {
+		t.Errorf("expected one ping, got %d", ws.pings.Load())
+	}
+	if code := ws.errorCode(t); code != codes.DeadlineExceeded {
+		t.Errorf("expected DeadlineExceeded to be reported, got %s", code)
+	}
+}
+
+func TestWebsocketKeepalive(t *testing.T) {
+	ws := newFakeWebsocket(true)
+	time.AfterFunc(100*time.Millisecond, func() { close(ws.incoming) })
+	forwardWebsocket(t, gateway.WebsocketConfig{
+		PingInterval: 10 * time.Millisecond,
+		PongTimeout:  50 * time.Millisecond,
+	}, ws, false, newBlockingStream)
+
+	if ws.pings.Load() < 3 {
+		t.Errorf("expected pings to be sent periodically, got %d", ws.pings.Load())
+	}
+	if code := ws.errorCode(t); code != codes.OK {
+		t.Errorf("expected no errors, got %s", code)
+	}
+}
+
+func TestWebsocketIdleTimeout(t *testing.T) {
+	ws := newFakeWebsocket(true)
+	start := time.Now()
+	go func() {
+		// messages from the client keep the connection active.
+		for index := 0; index < 3; index++ {
+			time.Sleep(10 * time.Millisecond)
+			ws.incoming <- []byte(`"hi"`)
+		}
+	}()
+	forwardWebsocket(t, gateway.WebsocketConfig{
+		PingInterval: 10 * time.Millisecond,
+		IdleTimeout:  40 * time.Millisecond,
+	}, ws, true, newBlockingStream)
+
+	if elapsed := time.Since(start); elapsed < 70*time.Millisecond {
+		t.Errorf("expected the messages to reset the idle timeout, the connection was closed after %s", elapsed)
+	}
+	if code := ws.errorCode(t); code != codes.DeadlineExceeded {
+		t.Errorf("expected DeadlineExceeded to be reported, got %s", code)
+	}
+}
+
+func TestWebsocketMaxMessageSize(t *testing.T) {
+	ws := newFakeWebsocket(false)
+	go func() { ws.incoming <- []byte(`"this message is too long"`) }()
+	forwardWebsocket(t, gateway.WebsocketConfig{MaxMessageSize: 8}, ws, false, newBlockingStream)
+
+	if ws.readLimit.Load() != 8 {
+		t.Errorf("expected the read limit of the connection to be set, got %d", ws.readLimit.Load())
+	}
+	if code := ws.errorCode(t); code != codes.ResourceExhausted {
+		t.Errorf("expected ResourceExhausted to be reported, got %s", code)
+	}
+}
+
+func TestWebsocketCloseCodeFromCode(t *testing.T) {
+	testCases := map[codes.Code]int{
+		codes.OK:                1000,
+		codes.Unauthenticated:   1008,
+		codes.PermissionDenied:  1008,
+		codes.Internal:          1011,
+		codes.Unknown:           1011,
+		codes.Canceled:          4001,
+		codes.DeadlineExceeded:  4004,
+		codes.NotFound:          4005,
+		codes.ResourceExhausted: 4008,
+	}
+	for code, expected := range testCases {
+		if closeCode := gateway.WebsocketCloseCodeFromCode(code); closeCode != expected {
+			t.Errorf("expected close code %d for %s, got %d", expected, code, closeCode)
+		}
+	}
+}
+
+func TestWebsocketCloseWithStatus(t *testing.T) {
+	trailer := metadata.Pairs("x-total", "3", "x-total", "4")
+	notFound := status.Error(codes.NotFound, "user not found")
+
+	testCases := []struct {
+		Name            string
+		Config          gateway.WebsocketConfig
+		Err             error
+		Trailer         metadata.MD
+		ServerStreaming bool
+		ExpectedCode    int
+		ExpectedReason  string
+		ExpectedFrame   string
+	}{
+		{
+			Name:            "ServerStreamingSuccess",
+			Err:             io.EOF,
+			ServerStreaming: true,
+			ExpectedCode:    1000,
+		},
+		{
+			Name:            "ServerStreamingError",
+			Err:             notFound,
+			ServerStreaming: true,
+			ExpectedCode:    4005,
+			ExpectedReason:  "user not found",
+			ExpectedFrame:   `{"code":5,"message":"user not found"}`,
+		},
+		{
+			Name:           "BidiError",
+			Err:            status.Error(codes.Internal, "failed"),
+			ExpectedCode:   1011,
+			ExpectedReason: "failed",
+			ExpectedFrame:  `{"code":13,"message":"failed"}`,
+		},
+		{
+			Name:          "StatusFrameOnSuccess",
+			Config:        gateway.WebsocketConfig{SendStatusFrame: true},
+			Err:           io.EOF,
+			ExpectedCode:  1000,
+			ExpectedFrame: `{"status":{"code":0,"message":""},"trailers":{"x-total":["3","4"]}}`,
+		},
+		{
+			Name:            "StatusFrameOnError",
+			Config:          gateway.WebsocketConfig{SendStatusFrame: true},
+			Err:             notFound,
+			ServerStreaming: true,
+			ExpectedCode:    4005,
+			ExpectedReason:  "user not found",
+			ExpectedFrame:   `{"status":{"code":5,"message":"user not found"},"trailers":{"x-total":["3","4"]}}`,
+		},
+		{
+			Name:          "StatusFrameBinaryTrailer",
+			Config:        gateway.WebsocketConfig{SendStatusFrame: true},
+			Err:           io.EOF,
+			Trailer:       metadata.Pairs("x-trace-bin", "\xff\x00\xfe"),
+			ExpectedCode:  1000,
+			ExpectedFrame: `{"status":{"code":0,"message":""},"trailers":{"x-trace-bin":["/wD+"]}}`,
+		},
+		{
+			Name:            "StatusFrameInvalidTrailer",
+			Config:          gateway.WebsocketConfig{SendStatusFrame: true},
+			Err:             notFound,
+			Trailer:         metadata.Pairs("x-trace", "\xff"),
+			ServerStreaming: true,
+			ExpectedCode:    4005,
+			ExpectedReason:  "user not found",
+			ExpectedFrame:   `{"status":{"code":5,"message":"user not found"},"trailers":{}}`,
+		},
+		{
+			Name: "CustomCloseCode",
+			Config: gateway.WebsocketConfig{CloseCodeFunc: func(code codes.Code) int {
+				return 4900 + int(code)
+			}},
+			Err:            notFound,
+			ExpectedCode:   4905,
+			ExpectedReason: "user not found",
+			ExpectedFrame:  `{"code":5,"message":"user not found"}`,
+		},
+		{
+			Name:           "LongReason",
+			Err:            status.Error(codes.Aborted, strings.Repeat("é", 100)),
+			ExpectedCode:   4010,
+			ExpectedReason: strings.Repeat("é", 61),
+			ExpectedFrame:  `{"code":10,"message":"` + strings.Repeat("é", 100) + `"}`,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.Name, func(t *testing.T) {
+			ws := newFakeWebsocket(false)
+			if tt.Trailer == nil {
+				tt.Trailer = trailer
+			}
+			forwardWebsocket(t, tt.Config, ws, tt.ServerStreaming, newFinishedStream(tt.Err, tt.Trailer))
+
+			code, reason := ws.closeMessage()
+			if code != tt.ExpectedCode || reason != tt.ExpectedReason {
+				t.Errorf("expected close message %d %q, got %d %q", tt.ExpectedCode, tt.ExpectedReason, code, reason)
+			}
+
+			var frame string
+			select {
+			case data := <-ws.sent:
+				frame = compactJSON(t, data)
+			default:
+			}
+			if frame != tt.ExpectedFrame {
+				t.Errorf("expected terminal message %s, got %s", tt.ExpectedFrame, frame)
+			}
+		})
+	}
+}
+
+func compactJSON(t *testing.T, data []byte) string {
+	t.Helper()
+
+	buffer := &bytes.Buffer{}
+	if err := json.Compact(buffer, data); err != nil {
+		t.Fatalf("failed to compact %q: %s", data, err)
+	}
+	return buffer.String()
+}
+
+func TestWebsocketSubprotocol(t *testing.T) {
+	ws := newFakeWebsocket(false)
+	mux := gateway.NewServeMux(
+		gateway.WithMarshalerOption("application/x-protobuf", &protomarshal.ProtoMarshaller{}),
+		gateway.WithMarshalerOption("application/json", &protomarshal.JSONPb{}),
+		gateway.WithWebsocketUpgrader(func(http.ResponseWriter, *http.Request) (websocket.Connection, error) {
+			return ws, nil
+		}),
+		gateway.WithWebsocketConfig(gateway.WebsocketConfig{Subprotocols: map[string]string{
+			"json":    "application/json",
+			"proto":   "application/x-protobuf",
+			"missing": "application/missing",
+		}}))
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/stream", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Protocol", "mqtt, missing, proto")
+	req.Header.Add("Sec-WebSocket-Protocol", "json")
+
+	inbound, outbound := mux.MarshalerForRequest(req)
+	if _, ok := inbound.(*protomarshal.ProtoMarshaller); !ok {
+		t.Errorf("expected the proto marshaler to be chosen for the requests, got %T", inbound)
+	}
+	if _, ok := outbound.(*protomarshal.ProtoMarshaller); !ok {
+		t.Fatalf("expected the proto marshaler to be chosen for the responses, got %T", outbound)
+	}
+
+	rec := httptest.NewRecorder()
+	connection, err := mux.UpgradeToWebsocket(rec, req)
+	if err != nil {
+		t.Fatalf("failed to upgrade: %s", err)
+	}
+	if protocol := rec.Header().Get("Sec-WebSocket-Protocol"); protocol != "proto" {
+		t.Errorf("expected the chosen subprotocol in the response, got %q", protocol)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := replyStream{
+		blockingStream: blockingStream{ctx: ctx},
+		responses:      []proto.Message{wrapperspb.String("hello")},
+		index:          new(int),
+	}
+	mux.ForwardWebsocketServerStreaming(ctx, req, stream, connection, outbound, &wrapperspb.StringValue{})
+
+	response := &wrapperspb.StringValue{}
+	if err := proto.Unmarshal(<-ws.sent, response); err != nil || response.GetValue() != "hello" {
+		t.Errorf("unexpected response %v: %v", response, err)
+	}
+	if ws.lastMessageType.Load() != websocket.BinaryMessage {
+		t.Errorf("expected a binary message, got message type %d", ws.lastMessageType.Load())
+	}
+	if code, _ := ws.closeMessage(); code != websocket.CloseNormalClosure {
+		t.Errorf("expected normal closure, got %d", code)
+	}
+
+	req.Header.Set("Sec-WebSocket-Protocol", "json")
+	_, outbound = mux.MarshalerForRequest(req)
+	if _, ok := outbound.(*protomarshal.JSONPb); !ok {
+		t.Errorf("expected the JSON marshaler to be chosen, got %T", outbound)
+	}
+
+	// without a known subprotocol, the marshalers are chosen by the headers.
+	req.Header.Set("Sec-WebSocket-Protocol", "mqtt")
+	if _, outbound = mux.MarshalerForRequest(req); outbound != protomarshal.DefaultMarshaler {
+		t.Errorf("expected the default marshaler to be chosen, got %T", outbound)
+	}
+}
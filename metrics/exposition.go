@@ -0,0 +1,184 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the content type of the Prometheus text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+type metricKind uint8
+
+const (
+	kindCounter metricKind = iota
+	kindGauge
+	kindHistogram
+)
+
+func (k metricKind) String() string {
+	switch k {
+	case kindCounter:
+		return "counter"
+	case kindGauge:
+		return "gauge"
+	default:
+		return "histogram"
+	}
+}
+
+// family is a group of series that share the same metric name.
+type family struct {
+	name    string
+	help    string
+	kind    metricKind
+	labels  []string
+	buckets []float64
+
+	series map[string]*series
+}
+
+// series holds the value of a metric for a unique set of label values.
+type series struct {
+	labelValues []string
+
+	value        float64
+	bucketCounts []uint64
+	count        uint64
+}
+
+// with returns the series for the label values, creating it if needed.
+func (f *family) with(labelValues ...string) *series {
+	key := strings.Join(labelValues, "\xff")
+	if s, ok := f.series[key]; ok {
+		return s
+	}
+
+	if f.series == nil {
+		f.series = make(map[string]*series)
+	}
+	s := &series{labelValues: labelValues}
+	if f.kind == kindHistogram {
+		s.bucketCounts = make([]uint64, len(f.buckets))
+	}
+	f.series[key] = s
+
+	return s
+}
+
+func (s *series) add(value float64) {
+	s.value += value
+}
+
+// observe adds an observation to a histogram series, value holds the sum of all observations.
+func (s *series) observe(value float64, buckets []float64) {
+	s.value += value
+	s.count++
+	for index, upperBound := range buckets {
+		if value <= upperBound {
+			s.bucketCounts[index]++
+		}
+	}
+}
+
+func (f *family) write(w io.Writer) error {
+	if len(f.series) == 0 {
+		return nil
+	}
+
+	writer := bufio.NewWriter(w)
+	writer.WriteString("# HELP ")
+	writer.WriteString(f.name)
+	writer.WriteByte(' ')
+	writer.WriteString(escapeHelp(f.help))
+	writer.WriteString("\n# TYPE ")
+	writer.WriteString(f.name)
+	writer.WriteByte(' ')
+	writer.WriteString(f.kind.String())
+	writer.WriteByte('\n')
+
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := f.series[key]
+		if f.kind != kindHistogram {
+			writeSample(writer, f.name, f.labels, s.labelValues, "", "", s.value)
+			continue
+		}
+
+		for index, upperBound := range f.buckets {
+			writeSample(writer, f.name+"_bucket", f.labels, s.labelValues,
+				"le", formatFloat(upperBound), float64(s.bucketCounts[index]))
+		}
+		writeSample(writer, f.name+"_bucket", f.labels, s.labelValues, "le", "+Inf", float64(s.count))
+		writeSample(writer, f.name+"_sum", f.labels, s.labelValues, "", "", s.value)
+		writeSample(writer, f.name+"_count", f.labels, s.labelValues, "", "", float64(s.count))
+	}
+
+	return writer.Flush()
+}
+
+func writeSample(
+	writer *bufio.Writer, name string, labels, labelValues []string, extraLabel, extraValue string, value float64) {
+
+	writer.WriteString(name)
+	if len(labels) > 0 || extraLabel != "" {
+		writer.WriteByte('{')
+		for index, label := range labels {
+			if index > 0 {
+				writer.WriteByte(',')
+			}
+			writer.WriteString(label)
+			writer.WriteString(`="`)
+			writer.WriteString(escapeLabelValue(labelValues[index]))
+			writer.WriteByte('"')
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				writer.WriteByte(',')
+			}
+			writer.WriteString(extraLabel)
+			writer.WriteString(`="`)
+			writer.WriteString(extraValue)
+			writer.WriteByte('"')
+		}
+		writer.WriteByte('}')
+	}
+	writer.WriteByte(' ')
+	writer.WriteString(formatFloat(value))
+	writer.WriteByte('\n')
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
+
+var (
+	helpReplacer       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(value string) string {
+	return helpReplacer.Replace(value)
+}
+
+func escapeLabelValue(value string) string {
+	return labelValueReplacer.Replace(value)
+}
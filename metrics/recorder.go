@@ -0,0 +1,170 @@
+// Package metrics implements a gateway.MetricsRecorder that keeps the request and stream metrics in memory and
+// exposes them in the Prometheus text exposition format, without depending on the Prometheus client library.
+//
+//	recorder := metrics.NewRecorder()
+//	mux := gateway.NewServeMux(gateway.WithMetricsRecorder(recorder))
+//	http.Handle("/metrics", recorder)
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/meshapi/grpc-api-gateway/gateway"
+)
+
+var (
+	// DefaultDurationBuckets are the default histogram buckets for request durations in seconds.
+	DefaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+	// DefaultSizeBuckets are the default histogram buckets for response sizes in bytes.
+	DefaultSizeBuckets = []float64{100, 1000, 10000, 100000, 1000000, 10000000}
+)
+
+// DefaultNamespace is the default prefix of all metric names.
+const DefaultNamespace = "grpc_api_gateway"
+
+// Option configures a Recorder.
+type Option func(*Recorder)
+
+// WithNamespace sets the prefix of all metric names.
+func WithNamespace(namespace string) Option {
+	return func(r *Recorder) {
+		r.namespace = namespace
+	}
+}
+
+// WithDurationBuckets sets the upper bounds of the request duration histogram buckets in seconds.
+func WithDurationBuckets(buckets ...float64) Option {
+	return func(r *Recorder) {
+		r.durationBuckets = buckets
+	}
+}
+
+// WithSizeBuckets sets the upper bounds of the response size histogram buckets in bytes.
+func WithSizeBuckets(buckets ...float64) Option {
+	return func(r *Recorder) {
+		r.sizeBuckets = buckets
+	}
+}
+
+// Recorder records the gateway metrics in memory and serves them in the Prometheus text exposition format.
+//
+// The following metrics are recorded:
+//
+//   - <namespace>_http_requests_total: counter of requests by RPC method, HTTP path pattern, HTTP method, gRPC code
+//     and HTTP status.
+//   - <namespace>_http_request_duration_seconds: histogram of request durations by RPC method, HTTP path pattern
+//     and HTTP method.
+//   - <namespace>_http_response_size_bytes: histogram of response sizes by RPC method, HTTP path pattern and HTTP
+//     method.
+//   - <namespace>_active_streams: gauge of active response streams by RPC method, HTTP path pattern and stream kind.
+type Recorder struct {
+	namespace       string
+	durationBuckets []float64
+	sizeBuckets     []float64
+
+	mutex     sync.Mutex
+	requests  *family
+	durations *family
+	sizes     *family
+	streams   *family
+}
+
+// NewRecorder creates a new Recorder.
+func NewRecorder(options ...Option) *Recorder {
+	recorder := &Recorder{
+		namespace:       DefaultNamespace,
+		durationBuckets: DefaultDurationBuckets,
+		sizeBuckets:     DefaultSizeBuckets,
+	}
+
+	for _, option := range options {
+		option(recorder)
+	}
+
+	recorder.requests = &family{
+		name:   recorder.metricName("http_requests_total"),
+		help:   "Total number of HTTP requests served by the gateway.",
+		kind:   kindCounter,
+		labels: []string{"rpc_method", "path_pattern", "http_method", "code", "http_status"},
+	}
+	recorder.durations = &family{
+		name:    recorder.metricName("http_request_duration_seconds"),
+		help:    "Duration of HTTP requests served by the gateway in seconds.",
+		kind:    kindHistogram,
+		labels:  []string{"rpc_method", "path_pattern", "http_method"},
+		buckets: recorder.durationBuckets,
+	}
+	recorder.sizes = &family{
+		name:    recorder.metricName("http_response_size_bytes"),
+		help:    "Size of HTTP response bodies written by the gateway in bytes.",
+		kind:    kindHistogram,
+		labels:  []string{"rpc_method", "path_pattern", "http_method"},
+		buckets: recorder.sizeBuckets,
+	}
+	recorder.streams = &family{
+		name:   recorder.metricName("active_streams"),
+		help:   "Number of response streams currently being forwarded by the gateway.",
+		kind:   kindGauge,
+		labels: []string{"rpc_method", "path_pattern", "kind"},
+	}
+
+	return recorder
+}
+
+func (r *Recorder) metricName(name string) string {
+	if r.namespace == "" {
+		return name
+	}
+	return r.namespace + "_" + name
+}
+
+// RecordRequest records the measurements of a served request.
+func (r *Recorder) RecordRequest(_ context.Context, metrics gateway.RequestMetrics) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.requests.with(
+		metrics.RPCMethod, metrics.HTTPPathPattern, metrics.HTTPMethod,
+		metrics.Code.String(), strconv.Itoa(metrics.HTTPStatus)).add(1)
+	r.durations.with(metrics.RPCMethod, metrics.HTTPPathPattern, metrics.HTTPMethod).
+		observe(metrics.Duration.Seconds(), r.durationBuckets)
+	r.sizes.with(metrics.RPCMethod, metrics.HTTPPathPattern, metrics.HTTPMethod).
+		observe(float64(metrics.ResponseSize), r.sizeBuckets)
+}
+
+// StreamStarted increments the active streams gauge and returns the function that decrements it.
+func (r *Recorder) StreamStarted(_ context.Context, metrics gateway.StreamMetrics) func() {
+	r.mutex.Lock()
+	stream := r.streams.with(metrics.RPCMethod, metrics.HTTPPathPattern, metrics.Kind.String())
+	stream.add(1)
+	r.mutex.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			r.mutex.Lock()
+			stream.add(-1)
+			r.mutex.Unlock()
+		})
+	}
+}
+
+// ServeHTTP writes all the metrics in the Prometheus text exposition format.
+func (r *Recorder) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+
+	// the metrics are rendered before writing the response so that slow scrapers do not block the recording.
+	buffer := &bytes.Buffer{}
+	r.mutex.Lock()
+	for _, f := range []*family{r.requests, r.durations, r.sizes, r.streams} {
+		_ = f.write(buffer)
+	}
+	r.mutex.Unlock()
+
+	_, _ = buffer.WriteTo(w)
+}
@@ -0,0 +1,142 @@
+package metrics_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meshapi/grpc-api-gateway/gateway"
+	"github.com/meshapi/grpc-api-gateway/metrics"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func scrape(t *testing.T, recorder *metrics.Recorder) string {
+	t.Helper()
+
+	response := httptest.NewRecorder()
+	recorder.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if contentType := response.Header().Get("Content-Type"); contentType != metrics.ContentType {
+		t.Fatalf("unexpected content type: %q", contentType)
+	}
+	return response.Body.String()
+}
+
+func expectLines(t *testing.T, output string, lines ...string) {
+	t.Helper()
+
+	for _, line := range lines {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("expected line %q in output:\n%s", line, output)
+		}
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	recorder := metrics.NewRecorder(metrics.WithNamespace("test"), metrics.WithDurationBuckets(60))
+	mux := gateway.NewServeMux(gateway.WithMetricsRecorder(recorder))
+
+	var streamOutput string
+	mux.HandleWithParams(http.MethodGet, "/v1/items/:id", func(w http.ResponseWriter, r *http.Request, _ gateway.Params) {
+		ctx, err := gateway.AnnotateContext(r.Context(), mux, r, "/example.Items/Get", gateway.WithHTTPPathPattern("/v1/items/{id}"))
+		_, outbound := mux.MarshalerForRequest(r)
+		if err != nil {
+			mux.HTTPError(ctx, outbound, w, r, err)
+			return
+		}
+		if r.URL.Query().Get("fail") != "" {
+			mux.HTTPError(ctx, outbound, w, r, status.Error(codes.PermissionDenied, "denied"))
+			return
+		}
+		mux.ForwardResponseMessage(gateway.NewServerMetadataContext(ctx, gateway.ServerMetadata{}), outbound, w, r, &emptypb.Empty{})
+	})
+	mux.HandleWithParams(http.MethodGet, "/v1/stream", func(w http.ResponseWriter, r *http.Request, _ gateway.Params) {
+		ctx, _ := gateway.AnnotateContext(r.Context(), mux, r, "/example.Items/Watch", gateway.WithHTTPPathPattern("/v1/stream"))
+		ctx = gateway.NewServerMetadataContext(ctx, gateway.ServerMetadata{})
+		_, outbound := mux.MarshalerForRequest(r)
+		sent := false
+		mux.ForwardResponseStreamChunked(ctx, outbound, w, r, func() (proto.Message, error) {
+			if sent {
+				return nil, io.EOF
+			}
+			sent = true
+			streamOutput = scrape(t, recorder)
+			return wrapperspb.String("item"), nil
+		})
+	})
+
+	for _, path := range []string{"/v1/items/1", "/v1/items/2", "/v1/items/3?fail=1", "/v1/unknown", "/v1/stream"} {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	expectLines(t, streamOutput,
+		`# TYPE test_active_streams gauge`,
+		`test_active_streams{rpc_method="/example.Items/Watch",path_pattern="/v1/stream",kind="chunked"} 1`)
+
+	expectLines(t, scrape(t, recorder),
+		`# TYPE test_http_requests_total counter`,
+		`test_http_requests_total{rpc_method="/example.Items/Get",path_pattern="/v1/items/{id}",http_method="GET",code="OK",http_status="200"} 2`,
+		`test_http_requests_total{rpc_method="/example.Items/Get",path_pattern="/v1/items/{id}",http_method="GET",code="PermissionDenied",http_status="403"} 1`,
+		`test_http_requests_total{rpc_method="",path_pattern="",http_method="GET",code="NotFound",http_status="404"} 1`,
+		`test_http_requests_total{rpc_method="/example.Items/Watch",path_pattern="/v1/stream",http_method="GET",code="OK",http_status="200"} 1`,
+		`# TYPE test_http_request_duration_seconds histogram`,
+		`test_http_request_duration_seconds_bucket{rpc_method="/example.Items/Get",path_pattern="/v1/items/{id}",http_method="GET",le="60"} 3`,
+		`test_http_request_duration_seconds_bucket{rpc_method="/example.Items/Get",path_pattern="/v1/items/{id}",http_method="GET",le="+Inf"} 3`,
+		`test_http_request_duration_seconds_count{rpc_method="/example.Items/Get",path_pattern="/v1/items/{id}",http_method="GET"} 3`,
+		`test_http_response_size_bytes_bucket{rpc_method="/example.Items/Get",path_pattern="/v1/items/{id}",http_method="GET",le="100"} 3`,
+		`test_active_streams{rpc_method="/example.Items/Watch",path_pattern="/v1/stream",kind="chunked"} 0`)
+}
+
+// blockingWriter is a response writer whose writes block until it is released.
+type blockingWriter struct {
+	*httptest.ResponseRecorder
+
+	writing chan struct{}
+	release chan struct{}
+}
+
+func (w *blockingWriter) Write(data []byte) (int, error) {
+	close(w.writing)
+	<-w.release
+	return w.ResponseRecorder.Write(data)
+}
+
+func TestRecorderSlowScrape(t *testing.T) {
+	recorder := metrics.NewRecorder()
+	recorder.RecordRequest(context.Background(), gateway.RequestMetrics{HTTPMethod: http.MethodGet, HTTPStatus: 200})
+
+	writer := &blockingWriter{
+		ResponseRecorder: httptest.NewRecorder(),
+		writing:          make(chan struct{}),
+		release:          make(chan struct{}),
+	}
+	scraped := make(chan struct{})
+	go func() {
+		defer close(scraped)
+		recorder.ServeHTTP(writer, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	}()
+	<-writer.writing
+
+	recorded := make(chan struct{})
+	go func() {
+		defer close(recorded)
+		recorder.RecordRequest(context.Background(), gateway.RequestMetrics{HTTPMethod: http.MethodGet, HTTPStatus: 200})
+	}()
+	select {
+	case <-recorded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("recording was blocked by a slow scrape")
+	}
+
+	close(writer.release)
+	<-scraped
+	expectLines(t, writer.Body.String(),
+		`grpc_api_gateway_http_requests_total{rpc_method="",path_pattern="",http_method="GET",code="OK",http_status="200"} 1`)
+}
@@ -0,0 +1,220 @@
+package protomarshal
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// marshalBinaryValue converts "v" into the data model of the binary serialization formats using nil, bool, int64,
+// uint64, float64, string, []byte, []any and map[string]any values.
+//
+// Messages follow the protojson field names and representation of the well-known types, except that bytes are byte
+// strings, 64-bit integers are integers rather than strings and enums are encoded using their numbers. Values that are
+// not messages are converted using JSONPb.
+func marshalBinaryValue(options protojson.MarshalOptions, v interface{}) (interface{}, error) {
+	message, ok := v.(proto.Message)
+	if !ok {
+		return marshalJSONValue(options, v)
+	}
+
+	if options.Resolver == nil {
+		options.Resolver = protoregistry.GlobalTypes
+	}
+
+	return binaryValueEncoder{options: options}.message(message.ProtoReflect())
+}
+
+// hasCustomJSON reports whether or not the message has a protojson representation other than a JSON object with its
+// fields.
+func hasCustomJSON(name protoreflect.FullName) bool {
+	if name.Parent() != "google.protobuf" {
+		return false
+	}
+
+	switch name.Name() {
+	case "Any", "Timestamp", "Duration", "FieldMask", "Struct", "Value", "ListValue", "Empty",
+		"DoubleValue", "FloatValue", "Int64Value", "UInt64Value", "Int32Value", "UInt32Value", "BoolValue",
+		"StringValue", "BytesValue":
+		return true
+	}
+
+	return false
+}
+
+// binaryValueEncoder walks the messages to convert them into the data model of the binary serialization formats.
+type binaryValueEncoder struct {
+	options protojson.MarshalOptions
+}
+
+func (e binaryValueEncoder) message(m protoreflect.Message) (interface{}, error) {
+	name := m.Descriptor().FullName()
+	if hasCustomJSON(name) {
+		switch name.Name() {
+		case "Any":
+			return e.any(m)
+		case "Timestamp", "Duration", "FieldMask", "Struct", "Value", "ListValue", "Empty":
+			// NB: these types do not hold bytes or 64-bit integers, so their protojson representation is used as is.
+			return marshalJSONValue(e.options, m.Interface())
+		default: // wrappers
+			field := m.Descriptor().Fields().ByNumber(1)
+			return e.singular(field, m.Get(field))
+		}
+	}
+
+	fields := make(map[string]interface{})
+	if err := e.fields(m, fields); err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+// fields sets the fields of the message in "out", the unpopulated fields are handled the same way protojson does.
+func (e binaryValueEncoder) fields(m protoreflect.Message, out map[string]interface{}) error {
+	var err error
+	setField := func(field protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		var item interface{}
+		if value.IsValid() {
+			item, err = e.field(field, value)
+			if err != nil {
+				return false
+			}
+		}
+		out[e.fieldName(field)] = item
+		return true
+	}
+
+	if e.options.EmitUnpopulated || e.options.EmitDefaultValues {
+		fields := m.Descriptor().Fields()
+		for index := 0; index < fields.Len(); index++ {
+			field := fields.Get(index)
+			if m.Has(field) || field.ContainingOneof() != nil {
+				continue
+			}
+
+			value := m.Get(field)
+			isProto2Scalar := field.Syntax() == protoreflect.Proto2 && field.Default().IsValid()
+			isSingularMessage := field.Cardinality() != protoreflect.Repeated && field.Message() != nil
+			if isProto2Scalar || isSingularMessage {
+				if !e.options.EmitUnpopulated {
+					continue
+				}
+				value = protoreflect.Value{}
+			}
+			if !setField(field, value) {
+				return err
+			}
+		}
+	}
+
+	m.Range(setField)
+	return err
+}
+
+func (e binaryValueEncoder) fieldName(field protoreflect.FieldDescriptor) string {
+	switch {
+	case field.IsExtension():
+		return "[" + string(field.FullName()) + "]"
+	case e.options.UseProtoNames:
+		return field.TextName()
+	default:
+		return field.JSONName()
+	}
+}
+
+func (e binaryValueEncoder) field(field protoreflect.FieldDescriptor, value protoreflect.Value) (interface{}, error) {
+	switch {
+	case field.IsList():
+		list := value.List()
+		items := make([]interface{}, 0, list.Len())
+		for index := 0; index < list.Len(); index++ {
+			item, err := e.singular(field, list.Get(index))
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case field.IsMap():
+		items := make(map[string]interface{}, value.Map().Len())
+		var err error
+		value.Map().Range(func(key protoreflect.MapKey, value protoreflect.Value) bool {
+			var item interface{}
+			item, err = e.singular(field.MapValue(), value)
+			items[key.String()] = item
+			return err == nil
+		})
+		return items, err
+	default:
+		return e.singular(field, value)
+	}
+}
+
+func (e binaryValueEncoder) singular(field protoreflect.FieldDescriptor, value protoreflect.Value) (interface{}, error) {
+	switch field.Kind() {
+	case protoreflect.BoolKind:
+		return value.Bool(), nil
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return value.Int(), nil
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return value.Uint(), nil
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return value.Float(), nil
+	case protoreflect.StringKind:
+		return value.String(), nil
+	case protoreflect.BytesKind:
+		if data := value.Bytes(); data != nil {
+			return data, nil
+		}
+		return []byte{}, nil
+	case protoreflect.EnumKind:
+		if field.Enum().FullName() == "google.protobuf.NullValue" {
+			return nil, nil
+		}
+		return int64(value.Enum()), nil
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return e.message(value.Message())
+	default:
+		return nil, fmt.Errorf("unsupported field kind %s", field.Kind())
+	}
+}
+
+// any converts a google.protobuf.Any message, the embedded message is converted with the "@type" field the same way
+// protojson does.
+func (e binaryValueEncoder) any(m protoreflect.Message) (interface{}, error) {
+	fields := m.Descriptor().Fields()
+	typeURL := m.Get(fields.ByNumber(1)).String()
+	data := m.Get(fields.ByNumber(2)).Bytes()
+	if typeURL == "" && len(data) == 0 {
+		return map[string]interface{}{}, nil
+	}
+
+	messageType, err := e.options.Resolver.FindMessageByURL(typeURL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve %q: %w", typeURL, err)
+	}
+
+	embedded := messageType.New()
+	unmarshalOptions := proto.UnmarshalOptions{AllowPartial: true, Resolver: e.options.Resolver}
+	if err := unmarshalOptions.Unmarshal(data, embedded.Interface()); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal %q: %w", typeURL, err)
+	}
+
+	value, err := e.message(embedded)
+	if err != nil {
+		return nil, err
+	}
+
+	if hasCustomJSON(embedded.Descriptor().FullName()) {
+		return map[string]interface{}{"@type": typeURL, "value": value}, nil
+	}
+
+	object := value.(map[string]interface{})
+	object["@type"] = typeURL
+	return object, nil
+}
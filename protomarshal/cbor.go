@@ -0,0 +1,503 @@
+package protomarshal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// CBORPb is a Marshaler which marshals/unmarshals into/from CBOR (RFC 8949) following the protojson field names and
+// representation of the well-known types such as google.protobuf.Timestamp, Duration, Any and Struct. Unlike protojson,
+// bytes are encoded as byte strings, 64-bit integers as integers and enums as their numbers.
+//
+// Streams are encoded as CBOR sequences (RFC 8742), the data items are concatenated without a delimiter.
+type CBORPb struct {
+	protojson.MarshalOptions
+	protojson.UnmarshalOptions
+}
+
+// ContentType always returns "application/cbor".
+func (*CBORPb) ContentType(_ interface{}) string {
+	return "application/cbor"
+}
+
+// Marshal marshals "v" into CBOR.
+func (c *CBORPb) Marshal(v interface{}) ([]byte, error) {
+	value, err := marshalBinaryValue(c.MarshalOptions, v)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := encodeCBOR(&buf, value); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Unmarshal unmarshals CBOR "data" into "v".
+func (c *CBORPb) Unmarshal(data []byte, v interface{}) error {
+	reader := bytes.NewReader(data)
+	value, err := (&cborDecoder{reader: reader}).decode(0)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	if reader.Len() > 0 {
+		return errors.New("cbor: unexpected data after the top-level data item")
+	}
+
+	return unmarshalJSONValue(c.UnmarshalOptions, value, v)
+}
+
+// NewDecoder returns a Decoder which reads a CBOR sequence from "r".
+func (c *CBORPb) NewDecoder(r io.Reader) Decoder {
+	decoder := &cborDecoder{reader: byteReader(r)}
+	return DecoderFunc(func(v interface{}) error {
+		value, err := decoder.decode(0)
+		if err != nil {
+			return err
+		}
+
+		return unmarshalJSONValue(c.UnmarshalOptions, value, v)
+	})
+}
+
+// NewEncoder returns an Encoder which writes a CBOR sequence into "w".
+func (c *CBORPb) NewEncoder(w io.Writer) Encoder {
+	return EncoderFunc(func(v interface{}) error {
+		data, err := c.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		_, err = w.Write(data)
+		return err
+	})
+}
+
+// Delimiter for CBOR sequences is empty since the data items are self-delimiting.
+func (c *CBORPb) Delimiter() []byte {
+	return []byte{}
+}
+
+// CBOR major types.
+const (
+	cborUnsignedInt byte = iota << 5
+	cborNegativeInt
+	cborByteString
+	cborTextString
+	cborArray
+	cborMap
+	cborTag
+	cborSimple
+)
+
+const (
+	cborFalse      = cborSimple | 20
+	cborTrue       = cborSimple | 21
+	cborNull       = cborSimple | 22
+	cborUndefined  = cborSimple | 23
+	cborFloat16    = cborSimple | 25
+	cborFloat32    = cborSimple | 26
+	cborFloat64    = cborSimple | 27
+	cborBreak      = cborSimple | 31
+	cborIndefinite = 31
+
+	cborTagEpoch = 1
+)
+
+// maxNestingDepth is the maximum nesting depth of arrays and maps when decoding binary formats.
+const maxNestingDepth = 10000
+
+func encodeCBORHead(buf *bytes.Buffer, majorType byte, argument uint64) {
+	switch {
+	case argument < 24:
+		buf.WriteByte(majorType | byte(argument))
+	case argument <= math.MaxUint8:
+		buf.Write([]byte{majorType | 24, byte(argument)})
+	case argument <= math.MaxUint16:
+		buf.WriteByte(majorType | 25)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(argument)))
+	case argument <= math.MaxUint32:
+		buf.WriteByte(majorType | 26)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(argument)))
+	default:
+		buf.WriteByte(majorType | 27)
+		buf.Write(binary.BigEndian.AppendUint64(nil, argument))
+	}
+}
+
+// encodeCBOR encodes a value of the JSON data model or a byte string into CBOR, map keys are sorted to produce deterministic output.
+func encodeCBOR(buf *bytes.Buffer, value interface{}) error {
+	switch value := value.(type) {
+	case nil:
+		buf.WriteByte(cborNull)
+	case bool:
+		if value {
+			buf.WriteByte(cborTrue)
+		} else {
+			buf.WriteByte(cborFalse)
+		}
+	case int64:
+		if value < 0 {
+			encodeCBORHead(buf, cborNegativeInt, uint64(-(value + 1)))
+		} else {
+			encodeCBORHead(buf, cborUnsignedInt, uint64(value))
+		}
+	case uint64:
+		encodeCBORHead(buf, cborUnsignedInt, value)
+	case float64:
+		buf.WriteByte(cborFloat64)
+		buf.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(value)))
+	case string:
+		encodeCBORHead(buf, cborTextString, uint64(len(value)))
+		buf.WriteString(value)
+	case []byte:
+		encodeCBORHead(buf, cborByteString, uint64(len(value)))
+		buf.Write(value)
+	case []interface{}:
+		encodeCBORHead(buf, cborArray, uint64(len(value)))
+		for _, item := range value {
+			if err := encodeCBOR(buf, item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		encodeCBORHead(buf, cborMap, uint64(len(value)))
+		for _, key := range keys {
+			encodeCBORHead(buf, cborTextString, uint64(len(key)))
+			buf.WriteString(key)
+			if err := encodeCBOR(buf, value[key]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("cbor: unsupported type %T", value)
+	}
+
+	return nil
+}
+
+// binaryReader is the reader used by the binary format decoders.
+type binaryReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// byteReader returns a reader that can read single bytes without reading ahead of them when possible.
+func byteReader(r io.Reader) binaryReader {
+	if reader, ok := r.(binaryReader); ok {
+		return reader
+	}
+	return bufio.NewReader(r)
+}
+
+// unexpectedEOF converts io.EOF to io.ErrUnexpectedEOF, used when a complete data item is expected.
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// readBinaryString reads a string of the specified length without allocating the whole length upfront, which
+// protects against bogus lengths.
+func readBinaryString(reader io.Reader, length uint64) ([]byte, error) {
+	if length > math.MaxInt32 {
+		return nil, fmt.Errorf("string length %d is too large", length)
+	}
+
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, reader, int64(length)); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// cborDecoder decodes CBOR data items into the JSON data model.
+//
+// Byte strings are decoded into []byte values, date/time tags into RFC 3339 strings and other tags are ignored.
+type cborDecoder struct {
+	reader binaryReader
+}
+
+// decode decodes a single data item, io.EOF is returned only if the reader has no more data items.
+func (d *cborDecoder) decode(depth int) (interface{}, error) {
+	initial, err := d.reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := d.decodeItem(initial, depth)
+	return value, unexpectedEOF(err)
+}
+
+func (d *cborDecoder) readArgument(info byte) (uint64, error) {
+	switch {
+	case info < 24:
+		return uint64(info), nil
+	case info == 24:
+		b, err := d.reader.ReadByte()
+		return uint64(b), err
+	case info <= 27:
+		buf := make([]byte, 1<<(info-24))
+		if _, err := io.ReadFull(d.reader, buf); err != nil {
+			return 0, err
+		}
+		var argument uint64
+		for _, b := range buf {
+			argument = argument<<8 | uint64(b)
+		}
+		return argument, nil
+	default:
+		return 0, fmt.Errorf("cbor: invalid additional information %d", info)
+	}
+}
+
+func (d *cborDecoder) decodeItem(initial byte, depth int) (interface{}, error) {
+	if depth > maxNestingDepth {
+		return nil, errors.New("cbor: exceeded max nesting depth")
+	}
+
+	majorType, info := initial&0xe0, initial&0x1f
+	if majorType == cborSimple {
+		return d.decodeSimple(initial)
+	}
+
+	if info == cborIndefinite {
+		return d.decodeIndefinite(majorType, depth)
+	}
+
+	argument, err := d.readArgument(info)
+	if err != nil {
+		return nil, err
+	}
+
+	switch majorType {
+	case cborUnsignedInt:
+		if argument <= math.MaxInt64 {
+			return int64(argument), nil
+		}
+		return argument, nil
+	case cborNegativeInt:
+		if argument > math.MaxInt64 {
+			return -1 - float64(argument), nil
+		}
+		return -1 - int64(argument), nil
+	case cborByteString:
+		return readBinaryString(d.reader, argument)
+	case cborTextString:
+		data, err := readBinaryString(d.reader, argument)
+		return string(data), err
+	case cborArray:
+		items := make([]interface{}, 0, min(argument, 1024))
+		for index := uint64(0); index < argument; index++ {
+			item, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case cborMap:
+		items := make(map[interface{}]interface{}, min(argument, 1024))
+		for index := uint64(0); index < argument; index++ {
+			initial, err := d.reader.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			if err := d.decodeMapEntry(items, initial, depth); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default: // cborTag
+		return d.decodeTag(argument, depth)
+	}
+}
+
+// decodeMapEntry decodes a key/value pair of a map, the initial byte of the key is already read.
+func (d *cborDecoder) decodeMapEntry(items map[interface{}]interface{}, keyInitial byte, depth int) error {
+	key, err := d.decodeItem(keyInitial, depth+1)
+	if err != nil {
+		return err
+	}
+	if data, ok := key.([]byte); ok {
+		key = string(data)
+	}
+	switch key.(type) {
+	case []interface{}, map[interface{}]interface{}:
+		return fmt.Errorf("cbor: unsupported map key type %T", key)
+	}
+
+	item, err := d.decode(depth + 1)
+	if err != nil {
+		return err
+	}
+
+	items[key] = item
+	return nil
+}
+
+func (d *cborDecoder) decodeTag(tag uint64, depth int) (interface{}, error) {
+	content, err := d.decode(depth + 1)
+	if err != nil {
+		return nil, err
+	}
+
+	if tag == cborTagEpoch {
+		var seconds float64
+		switch content := content.(type) {
+		case int64:
+			seconds = float64(content)
+		case uint64:
+			seconds = float64(content)
+		case float64:
+			seconds = content
+		default:
+			return nil, fmt.Errorf("cbor: invalid epoch date/time content type %T", content)
+		}
+		whole, fraction := math.Modf(seconds)
+		return time.Unix(int64(whole), int64(fraction*1e9)).UTC().Format(time.RFC3339Nano), nil
+	}
+
+	// NB: the content of the standard date/time string tag (0) is already an RFC 3339 string and the other tags carry
+	// no meaning in protojson.
+	return content, nil
+}
+
+func (d *cborDecoder) decodeIndefinite(majorType byte, depth int) (interface{}, error) {
+	switch majorType {
+	case cborByteString, cborTextString:
+		var buf bytes.Buffer
+		for {
+			initial, err := d.reader.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			if initial == cborBreak {
+				break
+			}
+			if initial&0xe0 != majorType || initial&0x1f == cborIndefinite {
+				return nil, errors.New("cbor: invalid indefinite-length string chunk")
+			}
+			length, err := d.readArgument(initial & 0x1f)
+			if err != nil {
+				return nil, err
+			}
+			chunk, err := readBinaryString(d.reader, length)
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(chunk)
+		}
+		if majorType == cborTextString {
+			return buf.String(), nil
+		}
+		return buf.Bytes(), nil
+	case cborArray:
+		items := []interface{}{}
+		for {
+			initial, err := d.reader.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			if initial == cborBreak {
+				return items, nil
+			}
+			item, err := d.decodeItem(initial, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+	case cborMap:
+		items := map[interface{}]interface{}{}
+		for {
+			initial, err := d.reader.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			if initial == cborBreak {
+				return items, nil
+			}
+			if err := d.decodeMapEntry(items, initial, depth); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("cbor: invalid indefinite-length major type %d", majorType>>5)
+	}
+}
+
+func (d *cborDecoder) decodeSimple(initial byte) (interface{}, error) {
+	switch initial {
+	case cborFalse:
+		return false, nil
+	case cborTrue:
+		return true, nil
+	case cborNull, cborUndefined:
+		return nil, nil
+	case cborFloat16:
+		var buf [2]byte
+		if _, err := io.ReadFull(d.reader, buf[:]); err != nil {
+			return nil, err
+		}
+		return float16ToFloat64(binary.BigEndian.Uint16(buf[:])), nil
+	case cborFloat32:
+		var buf [4]byte
+		if _, err := io.ReadFull(d.reader, buf[:]); err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(buf[:]))), nil
+	case cborFloat64:
+		var buf [8]byte
+		if _, err := io.ReadFull(d.reader, buf[:]); err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(buf[:])), nil
+	default:
+		return nil, fmt.Errorf("cbor: unsupported simple value 0x%x", initial)
+	}
+}
+
+// float16ToFloat64 converts an IEEE 754 half-precision float.
+func float16ToFloat64(bits uint16) float64 {
+	exponent := int(bits>>10) & 0x1f
+	mantissa := float64(bits & 0x3ff)
+
+	var value float64
+	switch exponent {
+	case 0:
+		value = math.Ldexp(mantissa, -24)
+	case 0x1f:
+		if mantissa == 0 {
+			value = math.Inf(1)
+		} else {
+			value = math.NaN()
+		}
+	default:
+		value = math.Ldexp(mantissa+1024, exponent-25)
+	}
+
+	if bits&0x8000 != 0 {
+		return -value
+	}
+	return value
+}
@@ -0,0 +1,96 @@
+package protomarshal_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/meshapi/grpc-api-gateway/internal/examplepb"
+	"github.com/meshapi/grpc-api-gateway/protomarshal"
+)
+
+func TestCBORPb(t *testing.T) {
+	testStructuredMarshaler(t, &protomarshal.CBORPb{})
+}
+
+func TestCBORPbMarshal(t *testing.T) {
+	m := &protomarshal.CBORPb{}
+	buf, err := m.Marshal(&examplepb.ABitOfEverything{Uuid: "foo", BoolValue: true})
+	if err != nil {
+		t.Fatalf("m.Marshal failed with %v; want success", err)
+	}
+
+	// {"boolValue": true, "uuid": "foo"}
+	want := append([]byte{0xa2, 0x69}, "boolValue"...)
+	want = append(want, 0xf5, 0x64)
+	want = append(want, "uuid"...)
+	want = append(want, 0x63)
+	want = append(want, "foo"...)
+	if !bytes.Equal(buf, want) {
+		t.Errorf("got = %x; want %x", buf, want)
+	}
+}
+
+func TestCBORPbMarshalNativeTypes(t *testing.T) {
+	m := &protomarshal.CBORPb{}
+	msg := &examplepb.ABitOfEverything{BytesValue: []byte{1, 2}, EnumValue: examplepb.NumericEnum_ONE, Int64Value: 12}
+	buf, err := m.Marshal(msg)
+	if err != nil {
+		t.Fatalf("m.Marshal failed with %v; want success", err)
+	}
+
+	// {"bytesValue": h'0102', "enumValue": 1, "int64Value": 12}
+	want := append([]byte{0xa3, 0x6a}, "bytesValue"...)
+	want = append(want, 0x42, 0x01, 0x02, 0x69)
+	want = append(want, "enumValue"...)
+	want = append(want, 0x01, 0x6a)
+	want = append(want, "int64Value"...)
+	want = append(want, 0x0c)
+	if !bytes.Equal(buf, want) {
+		t.Errorf("got = %x; want %x", buf, want)
+	}
+}
+
+func TestCBORPbUnmarshal(t *testing.T) {
+	for _, spec := range []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{
+			name: "indefinite-length",
+			// {_ "uuid": (_ "f", "oo")}
+			data: append(append([]byte{0xbf, 0x64}, "uuid"...), 0x7f, 0x61, 'f', 0x62, 'o', 'o', 0xff, 0xff),
+			want: "foo",
+		},
+		{
+			name: "tagged",
+			// {"uuid": 32("foo")}
+			data: append(append([]byte{0xa1, 0x64}, "uuid"...), 0xd8, 0x20, 0x63, 'f', 'o', 'o'),
+			want: "foo",
+		},
+	} {
+		t.Run(spec.name, func(t *testing.T) {
+			m := &protomarshal.CBORPb{}
+			got := new(examplepb.ABitOfEverything)
+			if err := m.Unmarshal(spec.data, got); err != nil {
+				t.Fatalf("m.Unmarshal(%x) failed with %v; want success", spec.data, err)
+			}
+			if got.Uuid != spec.want {
+				t.Errorf("got.Uuid = %q; want %q", got.Uuid, spec.want)
+			}
+		})
+	}
+}
+
+func TestCBORPbUnmarshalErrors(t *testing.T) {
+	for _, data := range [][]byte{
+		{0xa1, 0x64, 'u', 'u'},
+		{0xa0, 0xa0},
+		{0x1c},
+	} {
+		m := &protomarshal.CBORPb{}
+		if err := m.Unmarshal(data, new(examplepb.ABitOfEverything)); err == nil {
+			t.Errorf("m.Unmarshal(%x) succeeded; want error", data)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package protomarshal
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"sort"
+
+	"github.com/meshapi/grpc-api-gateway/dotpath"
+	"github.com/meshapi/grpc-api-gateway/protopath"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// FormPb is an inbound Marshaler for "application/x-www-form-urlencoded" request bodies. The form values populate the
+// request message following the same field path rules as the query parameters, e.g. "nested.field=value" and
+// "map_field[key]=value".
+//
+// Form bodies only describe inbound requests, marshaling is delegated to the outbound Marshaler.
+type FormPb struct {
+	// Marshaler is used to marshal the outbound messages. If nil, DefaultMarshaler is used.
+	Marshaler Marshaler
+}
+
+func (f *FormPb) outbound() Marshaler {
+	if f.Marshaler == nil {
+		return DefaultMarshaler
+	}
+	return f.Marshaler
+}
+
+// ContentType returns the content type of the outbound Marshaler.
+func (f *FormPb) ContentType(v interface{}) string {
+	return f.outbound().ContentType(v)
+}
+
+// Marshal marshals "v" using the outbound Marshaler.
+func (f *FormPb) Marshal(v interface{}) ([]byte, error) {
+	return f.outbound().Marshal(v)
+}
+
+// NewEncoder returns an Encoder of the outbound Marshaler.
+func (f *FormPb) NewEncoder(w io.Writer) Encoder {
+	return f.outbound().NewEncoder(w)
+}
+
+// Delimiter returns the delimiter of the outbound Marshaler.
+func (f *FormPb) Delimiter() []byte {
+	if delimited, ok := f.outbound().(Delimited); ok {
+		return delimited.Delimiter()
+	}
+	return []byte("\n")
+}
+
+// Unmarshal unmarshals the form-urlencoded "data" into "v".
+func (f *FormPb) Unmarshal(data []byte, v interface{}) error {
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return err
+	}
+
+	msg, err := protoMessageTarget(v)
+	if err != nil {
+		return err
+	}
+
+	return populateFormValues(msg.ProtoReflect(), values)
+}
+
+// NewDecoder returns a Decoder which reads the form-urlencoded body from "r". Since a form describes a single
+// message, subsequent calls return io.EOF.
+func (f *FormPb) NewDecoder(r io.Reader) Decoder {
+	done := false
+	return DecoderFunc(func(v interface{}) error {
+		if done {
+			return io.EOF
+		}
+		done = true
+
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+
+		return f.Unmarshal(data, v)
+	})
+}
+
+// populateFormValues populates the form values into the message using the query parameter field path rules.
+func populateFormValues(msg protoreflect.Message, values url.Values) error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fieldValues := values[key]
+		if fieldKey, mapKey, ok := protopath.SplitMapKey(key); ok {
+			key = fieldKey
+			fieldValues = append([]string{mapKey}, fieldValues...)
+		}
+
+		if err := protopath.PopulateFieldValueFromPath(msg, dotpath.Parse(&key), fieldValues); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// protoMessageTarget returns the proto message that "v" refers to. When "v" is a pointer to a nil message pointer,
+// such as a body field of the request message, a new message gets allocated.
+func protoMessageTarget(v interface{}) (proto.Message, error) {
+	if msg, ok := v.(proto.Message); ok {
+		return msg, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() && rv.Elem().Kind() == reflect.Ptr {
+		if msg, ok := reflect.New(rv.Elem().Type().Elem()).Interface().(proto.Message); ok {
+			if rv.Elem().IsNil() {
+				rv.Elem().Set(reflect.ValueOf(msg))
+				return msg, nil
+			}
+			return rv.Elem().Interface().(proto.Message), nil
+		}
+	}
+
+	return nil, fmt.Errorf("unsupported type %T, expected a proto message", v)
+}
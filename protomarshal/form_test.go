@@ -0,0 +1,82 @@
+package protomarshal_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/meshapi/grpc-api-gateway/internal/examplepb"
+	"github.com/meshapi/grpc-api-gateway/protomarshal"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestFormPbUnmarshal(t *testing.T) {
+	m := &protomarshal.FormPb{}
+	data := "string_value=foo&nested.int32Value=12&repeated_value=a&repeated_value=b&map_value[k]=v" +
+		"&timestamp_value=2024-01-02T03:04:05Z&unknown=ignored"
+
+	got := new(examplepb.Proto3Message)
+	if err := m.Unmarshal([]byte(data), got); err != nil {
+		t.Fatalf("m.Unmarshal(%q) failed with %v; want success", data, err)
+	}
+
+	want := &examplepb.Proto3Message{
+		StringValue:    "foo",
+		Nested:         &examplepb.Proto3Message{Int32Value: 12},
+		RepeatedValue:  []string{"a", "b"},
+		MapValue:       map[string]string{"k": "v"},
+		TimestampValue: &timestamppb.Timestamp{Seconds: 1704164645},
+	}
+	if diff := cmp.Diff(got, want, protocmp.Transform()); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestFormPbUnmarshalErrors(t *testing.T) {
+	m := &protomarshal.FormPb{}
+	for _, data := range []string{
+		"int32_value=abc",
+		"string_value=a&string_value=b",
+		"%zz=1",
+	} {
+		if err := m.Unmarshal([]byte(data), new(examplepb.Proto3Message)); err == nil {
+			t.Errorf("m.Unmarshal(%q) succeeded; want error", data)
+		}
+	}
+}
+
+func TestFormPbDecoder(t *testing.T) {
+	m := &protomarshal.FormPb{}
+	decoder := m.NewDecoder(strings.NewReader("string_value=foo"))
+
+	// body fields are decoded into a pointer to the field.
+	var got *examplepb.Proto3Message
+	if err := decoder.Decode(&got); err != nil {
+		t.Fatalf("decoder.Decode(&got) failed with %v; want success", err)
+	}
+	if got.GetStringValue() != "foo" {
+		t.Errorf("got.StringValue = %q; want %q", got.GetStringValue(), "foo")
+	}
+
+	if err := decoder.Decode(new(examplepb.Proto3Message)); !errors.Is(err, io.EOF) {
+		t.Errorf("decoder.Decode() returned %v; want io.EOF", err)
+	}
+}
+
+func TestFormPbOutbound(t *testing.T) {
+	m := &protomarshal.FormPb{}
+	if got, want := m.ContentType(nil), "application/json"; got != want {
+		t.Errorf("m.ContentType() = %q; want %q", got, want)
+	}
+
+	buf, err := m.Marshal(&examplepb.SimpleMessage{Id: "foo"})
+	if err != nil {
+		t.Fatalf("m.Marshal failed with %v; want success", err)
+	}
+	if !strings.Contains(string(buf), `"id":"foo"`) {
+		t.Errorf("m.Marshal() = %q; want JSON output", buf)
+	}
+}
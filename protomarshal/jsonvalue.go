@@ -0,0 +1,126 @@
+package protomarshal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// marshalJSONValue marshals "v" with JSONPb and converts the result into the JSON data model using nil, bool, int64,
+// uint64, float64, string, []any and map[string]any values. This lets other serialization formats follow the
+// protojson field names and well-known type representations.
+func marshalJSONValue(options protojson.MarshalOptions, v interface{}) (interface{}, error) {
+	// NB: indentation is irrelevant since the output is decoded again.
+	options.Multiline = false
+	options.Indent = ""
+
+	data, err := (&JSONPb{MarshalOptions: options}).Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	return normalizeJSONNumbers(value), nil
+}
+
+// normalizeJSONNumbers replaces the json.Number values with int64, uint64 or float64 values.
+func normalizeJSONNumbers(value interface{}) interface{} {
+	switch value := value.(type) {
+	case json.Number:
+		if n, err := strconv.ParseInt(string(value), 10, 64); err == nil {
+			return n
+		}
+		if n, err := strconv.ParseUint(string(value), 10, 64); err == nil {
+			return n
+		}
+		n, _ := value.Float64()
+		return n
+	case []interface{}:
+		for index := range value {
+			value[index] = normalizeJSONNumbers(value[index])
+		}
+	case map[string]interface{}:
+		for key := range value {
+			value[key] = normalizeJSONNumbers(value[key])
+		}
+	}
+
+	return value
+}
+
+// unmarshalJSONValue unmarshals a decoded value of another serialization format into "v" with JSONPb.
+//
+// Byte strings become base64 strings, which is the protojson representation of bytes fields, non-finite floats become
+// the protojson strings for them and map keys are converted to strings.
+func unmarshalJSONValue(options protojson.UnmarshalOptions, value interface{}, v interface{}) error {
+	value, err := normalizeDecodedValue(value)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return unmarshalJSONPb(data, options, v)
+}
+
+// normalizeDecodedValue converts maps with arbitrary keys into map[string]any and non-finite floats into strings so
+// that the value can be encoded as JSON.
+func normalizeDecodedValue(value interface{}) (interface{}, error) {
+	switch value := value.(type) {
+	case float64:
+		switch {
+		case math.IsNaN(value):
+			return "NaN", nil
+		case math.IsInf(value, 1):
+			return "Infinity", nil
+		case math.IsInf(value, -1):
+			return "-Infinity", nil
+		}
+	case []interface{}:
+		for index := range value {
+			item, err := normalizeDecodedValue(value[index])
+			if err != nil {
+				return nil, err
+			}
+			value[index] = item
+		}
+	case map[string]interface{}:
+		for key := range value {
+			item, err := normalizeDecodedValue(value[key])
+			if err != nil {
+				return nil, err
+			}
+			value[key] = item
+		}
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			switch key.(type) {
+			case []interface{}, map[string]interface{}, map[interface{}]interface{}:
+				return nil, fmt.Errorf("unsupported map key type: %T", key)
+			}
+			item, err := normalizeDecodedValue(item)
+			if err != nil {
+				return nil, err
+			}
+			result[fmt.Sprint(key)] = item
+		}
+		return result, nil
+	}
+
+	return value, nil
+}
@@ -48,3 +48,10 @@ type Delimited interface {
 	// Delimiter returns the record separator for the stream.
 	Delimiter() []byte
 }
+
+// ContentTypeAware is implemented by marshalers that depend on the parameters of the request Content-Type, such as
+// the boundary of multipart request bodies.
+type ContentTypeAware interface {
+	// ForContentType returns the Marshaler to use for a request with the specified Content-Type header value.
+	ForContentType(contentType string) Marshaler
+}
@@ -0,0 +1,436 @@
+package protomarshal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// MessagePackPb is a Marshaler which marshals/unmarshals into/from MessagePack following the protojson field names
+// and representation of the well-known types such as google.protobuf.Timestamp, Duration, Any and Struct. Unlike
+// protojson, bytes are encoded as binary data, 64-bit integers as integers and enums as their numbers.
+//
+// Streams are encoded as concatenated MessagePack objects without a delimiter.
+type MessagePackPb struct {
+	protojson.MarshalOptions
+	protojson.UnmarshalOptions
+}
+
+// ContentType always returns "application/msgpack".
+func (*MessagePackPb) ContentType(_ interface{}) string {
+	return "application/msgpack"
+}
+
+// Marshal marshals "v" into MessagePack.
+func (m *MessagePackPb) Marshal(v interface{}) ([]byte, error) {
+	value, err := marshalBinaryValue(m.MarshalOptions, v)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := encodeMessagePack(&buf, value); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Unmarshal unmarshals MessagePack "data" into "v".
+func (m *MessagePackPb) Unmarshal(data []byte, v interface{}) error {
+	reader := bytes.NewReader(data)
+	value, err := (&messagePackDecoder{reader: reader}).decode(0)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	if reader.Len() > 0 {
+		return errors.New("msgpack: unexpected data after the top-level object")
+	}
+
+	return unmarshalJSONValue(m.UnmarshalOptions, value, v)
+}
+
+// NewDecoder returns a Decoder which reads a stream of MessagePack objects from "r".
+func (m *MessagePackPb) NewDecoder(r io.Reader) Decoder {
+	decoder := &messagePackDecoder{reader: byteReader(r)}
+	return DecoderFunc(func(v interface{}) error {
+		value, err := decoder.decode(0)
+		if err != nil {
+			return err
+		}
+
+		return unmarshalJSONValue(m.UnmarshalOptions, value, v)
+	})
+}
+
+// NewEncoder returns an Encoder which writes a stream of MessagePack objects into "w".
+func (m *MessagePackPb) NewEncoder(w io.Writer) Encoder {
+	return EncoderFunc(func(v interface{}) error {
+		data, err := m.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		_, err = w.Write(data)
+		return err
+	})
+}
+
+// Delimiter for MessagePack streams is empty since the objects are self-delimiting.
+func (m *MessagePackPb) Delimiter() []byte {
+	return []byte{}
+}
+
+// MessagePack formats.
+const (
+	msgpackNil      = 0xc0
+	msgpackFalse    = 0xc2
+	msgpackTrue     = 0xc3
+	msgpackBin8     = 0xc4
+	msgpackBin16    = 0xc5
+	msgpackBin32    = 0xc6
+	msgpackExt8     = 0xc7
+	msgpackExt16    = 0xc8
+	msgpackExt32    = 0xc9
+	msgpackFloat32  = 0xca
+	msgpackFloat64  = 0xcb
+	msgpackUint8    = 0xcc
+	msgpackUint16   = 0xcd
+	msgpackUint32   = 0xce
+	msgpackUint64   = 0xcf
+	msgpackInt8     = 0xd0
+	msgpackInt16    = 0xd1
+	msgpackInt32    = 0xd2
+	msgpackInt64    = 0xd3
+	msgpackFixExt1  = 0xd4
+	msgpackFixExt16 = 0xd8
+	msgpackStr8     = 0xd9
+	msgpackStr16    = 0xda
+	msgpackStr32    = 0xdb
+	msgpackArray16  = 0xdc
+	msgpackArray32  = 0xdd
+	msgpackMap16    = 0xde
+	msgpackMap32    = 0xdf
+
+	msgpackFixMap   = 0x80
+	msgpackFixArray = 0x90
+	msgpackFixStr   = 0xa0
+
+	msgpackExtTimestamp = -1
+)
+
+// encodeMessagePackLength writes the header of a string, array or map using the smallest format.
+func encodeMessagePackLength(buf *bytes.Buffer, length int, fixFormat, fixMax byte, format16 byte) {
+	switch {
+	case length <= int(fixMax):
+		buf.WriteByte(fixFormat | byte(length))
+	case length <= math.MaxUint16:
+		buf.WriteByte(format16)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(length)))
+	default:
+		// NB: the 32-bit format always follows the 16-bit format.
+		buf.WriteByte(format16 + 1)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(length)))
+	}
+}
+
+// encodeMessagePack encodes a value of the JSON data model or a byte string into MessagePack, map keys are sorted to produce
+// deterministic output.
+func encodeMessagePack(buf *bytes.Buffer, value interface{}) error {
+	switch value := value.(type) {
+	case nil:
+		buf.WriteByte(msgpackNil)
+	case bool:
+		if value {
+			buf.WriteByte(msgpackTrue)
+		} else {
+			buf.WriteByte(msgpackFalse)
+		}
+	case int64:
+		switch {
+		case value >= 0:
+			encodeMessagePackUint(buf, uint64(value))
+		case value >= -32:
+			buf.WriteByte(byte(value))
+		case value >= math.MinInt8:
+			buf.Write([]byte{msgpackInt8, byte(value)})
+		case value >= math.MinInt16:
+			buf.WriteByte(msgpackInt16)
+			buf.Write(binary.BigEndian.AppendUint16(nil, uint16(value)))
+		case value >= math.MinInt32:
+			buf.WriteByte(msgpackInt32)
+			buf.Write(binary.BigEndian.AppendUint32(nil, uint32(value)))
+		default:
+			buf.WriteByte(msgpackInt64)
+			buf.Write(binary.BigEndian.AppendUint64(nil, uint64(value)))
+		}
+	case uint64:
+		encodeMessagePackUint(buf, value)
+	case float64:
+		buf.WriteByte(msgpackFloat64)
+		buf.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(value)))
+	case string:
+		if len(value) > 31 && len(value) <= math.MaxUint8 {
+			buf.Write([]byte{msgpackStr8, byte(len(value))})
+		} else {
+			encodeMessagePackLength(buf, len(value), msgpackFixStr, 31, msgpackStr16)
+		}
+		buf.WriteString(value)
+	case []byte:
+		switch {
+		case len(value) <= math.MaxUint8:
+			buf.Write([]byte{msgpackBin8, byte(len(value))})
+		case len(value) <= math.MaxUint16:
+			buf.WriteByte(msgpackBin16)
+			buf.Write(binary.BigEndian.AppendUint16(nil, uint16(len(value))))
+		default:
+			buf.WriteByte(msgpackBin32)
+			buf.Write(binary.BigEndian.AppendUint32(nil, uint32(len(value))))
+		}
+		buf.Write(value)
+	case []interface{}:
+		encodeMessagePackLength(buf, len(value), msgpackFixArray, 15, msgpackArray16)
+		for _, item := range value {
+			if err := encodeMessagePack(buf, item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		encodeMessagePackLength(buf, len(value), msgpackFixMap, 15, msgpackMap16)
+		for _, key := range keys {
+			if err := encodeMessagePack(buf, key); err != nil {
+				return err
+			}
+			if err := encodeMessagePack(buf, value[key]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("msgpack: unsupported type %T", value)
+	}
+
+	return nil
+}
+
+func encodeMessagePackUint(buf *bytes.Buffer, value uint64) {
+	switch {
+	case value <= math.MaxInt8:
+		buf.WriteByte(byte(value))
+	case value <= math.MaxUint8:
+		buf.Write([]byte{msgpackUint8, byte(value)})
+	case value <= math.MaxUint16:
+		buf.WriteByte(msgpackUint16)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(value)))
+	case value <= math.MaxUint32:
+		buf.WriteByte(msgpackUint32)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(value)))
+	default:
+		buf.WriteByte(msgpackUint64)
+		buf.Write(binary.BigEndian.AppendUint64(nil, value))
+	}
+}
+
+// messagePackDecoder decodes MessagePack objects into the JSON data model.
+//
+// Binary values are decoded into []byte values, timestamp extensions into RFC 3339 strings and other extension types
+// are not supported.
+type messagePackDecoder struct {
+	reader binaryReader
+}
+
+// decode decodes a single object, io.EOF is returned only if the reader has no more objects.
+func (d *messagePackDecoder) decode(depth int) (interface{}, error) {
+	format, err := d.reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := d.decodeObject(format, depth)
+	return value, unexpectedEOF(err)
+}
+
+// readUint reads a big-endian unsigned integer of the specified size in bytes.
+func (d *messagePackDecoder) readUint(size int) (uint64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(d.reader, buf[:size]); err != nil {
+		return 0, err
+	}
+
+	var value uint64
+	for _, b := range buf[:size] {
+		value = value<<8 | uint64(b)
+	}
+	return value, nil
+}
+
+func (d *messagePackDecoder) decodeObject(format byte, depth int) (interface{}, error) {
+	if depth > maxNestingDepth {
+		return nil, errors.New("msgpack: exceeded max nesting depth")
+	}
+
+	switch {
+	case format <= 0x7f:
+		return int64(format), nil
+	case format >= 0xe0:
+		return int64(int8(format)), nil
+	case format&0xf0 == msgpackFixMap:
+		return d.decodeMap(uint64(format&0x0f), depth)
+	case format&0xf0 == msgpackFixArray:
+		return d.decodeArray(uint64(format&0x0f), depth)
+	case format&0xe0 == msgpackFixStr:
+		data, err := readBinaryString(d.reader, uint64(format&0x1f))
+		return string(data), err
+	case format >= msgpackFixExt1 && format <= msgpackFixExt16:
+		return d.decodeExtension(1 << (format - msgpackFixExt1))
+	}
+
+	switch format {
+	case msgpackNil:
+		return nil, nil
+	case msgpackFalse:
+		return false, nil
+	case msgpackTrue:
+		return true, nil
+	case msgpackFloat32:
+		bits, err := d.readUint(4)
+		return float64(math.Float32frombits(uint32(bits))), err
+	case msgpackFloat64:
+		bits, err := d.readUint(8)
+		return math.Float64frombits(bits), err
+	case msgpackUint8, msgpackUint16, msgpackUint32, msgpackUint64:
+		value, err := d.readUint(1 << (format - msgpackUint8))
+		if err != nil {
+			return nil, err
+		}
+		if value <= math.MaxInt64 {
+			return int64(value), nil
+		}
+		return value, nil
+	case msgpackInt8, msgpackInt16, msgpackInt32, msgpackInt64:
+		size := 1 << (format - msgpackInt8)
+		value, err := d.readUint(size)
+		if err != nil {
+			return nil, err
+		}
+		// sign-extend the value.
+		shift := 64 - 8*size
+		return int64(value<<shift) >> shift, nil
+	}
+
+	length, err := d.readLength(format)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case msgpackStr8, msgpackStr16, msgpackStr32:
+		data, err := readBinaryString(d.reader, length)
+		return string(data), err
+	case msgpackBin8, msgpackBin16, msgpackBin32:
+		return readBinaryString(d.reader, length)
+	case msgpackArray16, msgpackArray32:
+		return d.decodeArray(length, depth)
+	case msgpackMap16, msgpackMap32:
+		return d.decodeMap(length, depth)
+	default: // msgpackExt8, msgpackExt16, msgpackExt32
+		return d.decodeExtension(length)
+	}
+}
+
+// readLength reads the length of the variable sized formats.
+func (d *messagePackDecoder) readLength(format byte) (uint64, error) {
+	switch format {
+	case msgpackStr8, msgpackBin8, msgpackExt8:
+		return d.readUint(1)
+	case msgpackStr16, msgpackBin16, msgpackExt16, msgpackArray16, msgpackMap16:
+		return d.readUint(2)
+	case msgpackStr32, msgpackBin32, msgpackExt32, msgpackArray32, msgpackMap32:
+		return d.readUint(4)
+	default:
+		return 0, fmt.Errorf("msgpack: invalid format 0x%x", format)
+	}
+}
+
+func (d *messagePackDecoder) decodeArray(length uint64, depth int) (interface{}, error) {
+	items := make([]interface{}, 0, min(length, 1024))
+	for index := uint64(0); index < length; index++ {
+		item, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+func (d *messagePackDecoder) decodeMap(length uint64, depth int) (interface{}, error) {
+	items := make(map[interface{}]interface{}, min(length, 1024))
+	for index := uint64(0); index < length; index++ {
+		key, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if data, ok := key.([]byte); ok {
+			key = string(data)
+		}
+		switch key.(type) {
+		case []interface{}, map[interface{}]interface{}:
+			return nil, fmt.Errorf("msgpack: unsupported map key type %T", key)
+		}
+
+		item, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		items[key] = item
+	}
+
+	return items, nil
+}
+
+// decodeExtension decodes an extension object, only the timestamp extension type is supported.
+func (d *messagePackDecoder) decodeExtension(length uint64) (interface{}, error) {
+	extensionType, err := d.reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	data, err := readBinaryString(d.reader, length)
+	if err != nil {
+		return nil, err
+	}
+
+	if int8(extensionType) != msgpackExtTimestamp {
+		return nil, fmt.Errorf("msgpack: unsupported extension type %d", int8(extensionType))
+	}
+
+	var seconds, nanoseconds int64
+	switch len(data) {
+	case 4:
+		seconds = int64(binary.BigEndian.Uint32(data))
+	case 8:
+		value := binary.BigEndian.Uint64(data)
+		nanoseconds = int64(value >> 34)
+		seconds = int64(value & 0x3ffffffff)
+	case 12:
+		nanoseconds = int64(binary.BigEndian.Uint32(data))
+		seconds = int64(binary.BigEndian.Uint64(data[4:]))
+	default:
+		return nil, fmt.Errorf("msgpack: invalid timestamp length %d", len(data))
+	}
+
+	return time.Unix(seconds, nanoseconds).UTC().Format(time.RFC3339Nano), nil
+}
@@ -0,0 +1,89 @@
+package protomarshal_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/meshapi/grpc-api-gateway/internal/examplepb"
+	"github.com/meshapi/grpc-api-gateway/protomarshal"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestMessagePackPb(t *testing.T) {
+	testStructuredMarshaler(t, &protomarshal.MessagePackPb{})
+}
+
+func TestMessagePackPbMarshal(t *testing.T) {
+	m := &protomarshal.MessagePackPb{}
+	buf, err := m.Marshal(&examplepb.ABitOfEverything{Uuid: "foo", BoolValue: true})
+	if err != nil {
+		t.Fatalf("m.Marshal failed with %v; want success", err)
+	}
+
+	// {"boolValue": true, "uuid": "foo"}
+	want := append([]byte{0x82, 0xa9}, "boolValue"...)
+	want = append(want, 0xc3, 0xa4)
+	want = append(want, "uuid"...)
+	want = append(want, 0xa3)
+	want = append(want, "foo"...)
+	if !bytes.Equal(buf, want) {
+		t.Errorf("got = %x; want %x", buf, want)
+	}
+}
+
+func TestMessagePackPbMarshalNativeTypes(t *testing.T) {
+	m := &protomarshal.MessagePackPb{}
+	msg := &examplepb.ABitOfEverything{BytesValue: []byte{1, 2}, EnumValue: examplepb.NumericEnum_ONE, Int64Value: 12}
+	buf, err := m.Marshal(msg)
+	if err != nil {
+		t.Fatalf("m.Marshal failed with %v; want success", err)
+	}
+
+	// {"bytesValue": bin(0102), "enumValue": 1, "int64Value": 12}
+	want := append([]byte{0x83, 0xaa}, "bytesValue"...)
+	want = append(want, 0xc4, 0x02, 0x01, 0x02, 0xa9)
+	want = append(want, "enumValue"...)
+	want = append(want, 0x01, 0xaa)
+	want = append(want, "int64Value"...)
+	want = append(want, 0x0c)
+	if !bytes.Equal(buf, want) {
+		t.Errorf("got = %x; want %x", buf, want)
+	}
+
+	got := new(examplepb.ABitOfEverything)
+	if err := m.Unmarshal(buf, got); err != nil {
+		t.Fatalf("m.Unmarshal(%x) failed with %v; want success", buf, err)
+	}
+	if !proto.Equal(got, msg) {
+		t.Errorf("got = %v; want %v", got, msg)
+	}
+}
+
+func TestMessagePackPbUnmarshalTimestamp(t *testing.T) {
+	m := &protomarshal.MessagePackPb{}
+	// timestamp 32 extension for 1700000000 seconds.
+	data := []byte{0xd6, 0xff, 0x65, 0x53, 0xf1, 0x00}
+
+	got := new(timestamppb.Timestamp)
+	if err := m.Unmarshal(data, got); err != nil {
+		t.Fatalf("m.Unmarshal(%x) failed with %v; want success", data, err)
+	}
+	if got.GetSeconds() != 1700000000 {
+		t.Errorf("got.Seconds = %d; want %d", got.GetSeconds(), 1700000000)
+	}
+}
+
+func TestMessagePackPbUnmarshalErrors(t *testing.T) {
+	for _, data := range [][]byte{
+		{0x81, 0xa4, 'u', 'u'},
+		{0x80, 0x80},
+		{0xc1},
+		{0xd4, 0x01, 0x00},
+	} {
+		m := &protomarshal.MessagePackPb{}
+		if err := m.Unmarshal(data, new(examplepb.ABitOfEverything)); err == nil {
+			t.Errorf("m.Unmarshal(%x) succeeded; want error", data)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package protomarshal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/url"
+
+	"github.com/meshapi/grpc-api-gateway/dotpath"
+	"github.com/meshapi/grpc-api-gateway/protopath"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// DefaultMaxPartSize is the default maximum size of a single part of a multipart request body in bytes.
+const DefaultMaxPartSize = 10 << 20
+
+// ErrPartTooLarge is the error returned when a part of a multipart request body exceeds the configured limit.
+type ErrPartTooLarge struct {
+	// Name is the form name of the part.
+	Name string
+	// Limit is the maximum number of bytes allowed in a part.
+	Limit int64
+}
+
+func (e ErrPartTooLarge) Error() string {
+	return fmt.Sprintf("part %q exceeds the limit of %d bytes", e.Name, e.Limit)
+}
+
+// MultipartFormPb is an inbound Marshaler for "multipart/form-data" request bodies.
+//
+// Parts that are not files populate the request message following the same field path rules as the query
+// parameters. File parts, which are the parts with a file name, populate bytes fields with the file content and
+// google.api.HttpBody fields with the content type and the content of the file. File parts targeting other fields are
+// treated as form values.
+//
+// Multipart bodies only describe inbound requests, marshaling is delegated to the outbound Marshaler.
+type MultipartFormPb struct {
+	// Marshaler is used to marshal the outbound messages. If nil, DefaultMarshaler is used.
+	Marshaler Marshaler
+
+	// MaxPartSize is the maximum size of a single part in bytes. If not positive, DefaultMaxPartSize is used.
+	MaxPartSize int64
+
+	// MaxParts is the maximum number of parts in a request body. If not positive, the number of parts is not limited.
+	MaxParts int
+
+	// boundary is the multipart boundary of the request Content-Type.
+	boundary string
+}
+
+// ForContentType returns a MultipartFormPb that uses the boundary parameter of the Content-Type.
+func (m *MultipartFormPb) ForContentType(contentType string) Marshaler {
+	marshaler := *m
+	marshaler.boundary = ""
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		marshaler.boundary = params["boundary"]
+	}
+	return &marshaler
+}
+
+func (m *MultipartFormPb) outbound() Marshaler {
+	if m.Marshaler == nil {
+		return DefaultMarshaler
+	}
+	return m.Marshaler
+}
+
+// ContentType returns the content type of the outbound Marshaler.
+func (m *MultipartFormPb) ContentType(v interface{}) string {
+	return m.outbound().ContentType(v)
+}
+
+// Marshal marshals "v" using the outbound Marshaler.
+func (m *MultipartFormPb) Marshal(v interface{}) ([]byte, error) {
+	return m.outbound().Marshal(v)
+}
+
+// NewEncoder returns an Encoder of the outbound Marshaler.
+func (m *MultipartFormPb) NewEncoder(w io.Writer) Encoder {
+	return m.outbound().NewEncoder(w)
+}
+
+// Delimiter returns the delimiter of the outbound Marshaler.
+func (m *MultipartFormPb) Delimiter() []byte {
+	if delimited, ok := m.outbound().(Delimited); ok {
+		return delimited.Delimiter()
+	}
+	return []byte("\n")
+}
+
+// Unmarshal unmarshals the multipart "data" into "v".
+func (m *MultipartFormPb) Unmarshal(data []byte, v interface{}) error {
+	return m.decode(bytes.NewReader(data), v)
+}
+
+// NewDecoder returns a Decoder which reads the multipart body from "r". Since a multipart body describes a single
+// message, subsequent calls return io.EOF.
+func (m *MultipartFormPb) NewDecoder(r io.Reader) Decoder {
+	done := false
+	return DecoderFunc(func(v interface{}) error {
+		if done {
+			return io.EOF
+		}
+		done = true
+
+		return m.decode(r, v)
+	})
+}
+
+func (m *MultipartFormPb) decode(r io.Reader, v interface{}) error {
+	if m.boundary == "" {
+		return errors.New("multipart: missing boundary in the content type")
+	}
+
+	msg, err := protoMessageTarget(v)
+	if err != nil {
+		return err
+	}
+
+	maxPartSize := m.MaxPartSize
+	if maxPartSize <= 0 {
+		maxPartSize = DefaultMaxPartSize
+	}
+
+	values := url.Values{}
+	reader := multipart.NewReader(r, m.boundary)
+	for count := 1; ; count++ {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if m.MaxParts > 0 && count > m.MaxParts {
+			return fmt.Errorf("multipart: exceeded the limit of %d parts", m.MaxParts)
+		}
+
+		name := part.FormName()
+		data, err := io.ReadAll(io.LimitReader(part, maxPartSize+1))
+		if err != nil {
+			return err
+		}
+		if int64(len(data)) > maxPartSize {
+			return ErrPartTooLarge{Name: name, Limit: maxPartSize}
+		}
+		if name == "" {
+			continue
+		}
+
+		if part.FileName() != "" {
+			contentType := part.Header.Get("Content-Type")
+			if contentType == "" {
+				contentType = "application/octet-stream"
+			}
+			populated, err := populateFilePart(msg.ProtoReflect(), name, contentType, data)
+			if err != nil {
+				return err
+			}
+			if populated {
+				continue
+			}
+		}
+
+		values.Add(name, string(data))
+	}
+
+	return populateFormValues(msg.ProtoReflect(), values)
+}
+
+// populateFilePart populates a bytes or a google.api.HttpBody field with the file content and returns whether or
+// not the field has been populated.
+func populateFilePart(msg protoreflect.Message, key string, contentType string, data []byte) (bool, error) {
+	msg, fieldDescriptor, err := protopath.FieldFromPath(msg, dotpath.Parse(&key))
+	if err != nil || fieldDescriptor == nil || fieldDescriptor.IsMap() {
+		return false, err
+	}
+
+	var value protoreflect.Value
+	switch {
+	case fieldDescriptor.Kind() == protoreflect.BytesKind:
+		value = protoreflect.ValueOfBytes(data)
+	case fieldDescriptor.Message() != nil && fieldDescriptor.Message().FullName() == "google.api.HttpBody":
+		var body protoreflect.Message
+		if fieldDescriptor.IsList() {
+			body = msg.Mutable(fieldDescriptor).List().NewElement().Message()
+		} else {
+			body = msg.NewField(fieldDescriptor).Message()
+		}
+		fields := body.Descriptor().Fields()
+		body.Set(fields.ByName("content_type"), protoreflect.ValueOfString(contentType))
+		body.Set(fields.ByName("data"), protoreflect.ValueOfBytes(data))
+		value = protoreflect.ValueOfMessage(body)
+	default:
+		return false, nil
+	}
+
+	if fieldDescriptor.IsList() {
+		msg.Mutable(fieldDescriptor).List().Append(value)
+		return true, nil
+	}
+
+	if of := fieldDescriptor.ContainingOneof(); of != nil {
+		if f := msg.WhichOneof(of); f != nil {
+			return false, fmt.Errorf("field already set for oneof %q", of.FullName().Name())
+		}
+	}
+
+	msg.Set(fieldDescriptor, value)
+	return true, nil
+}
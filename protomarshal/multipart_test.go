@@ -0,0 +1,194 @@
+package protomarshal_test
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/textproto"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/meshapi/grpc-api-gateway/internal/examplepb"
+	"github.com/meshapi/grpc-api-gateway/protomarshal"
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+type multipartFile struct {
+	name        string
+	fileName    string
+	contentType string
+	data        string
+}
+
+func multipartBody(t *testing.T, files []multipartFile) (*bytes.Buffer, string) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	for _, file := range files {
+		header := textproto.MIMEHeader{}
+		disposition := `form-data; name="` + file.name + `"`
+		if file.fileName != "" {
+			disposition += `; filename="` + file.fileName + `"`
+		}
+		header.Set("Content-Disposition", disposition)
+		if file.contentType != "" {
+			header.Set("Content-Type", file.contentType)
+		}
+
+		part, err := writer.CreatePart(header)
+		if err != nil {
+			t.Fatalf("writer.CreatePart failed with %v; want success", err)
+		}
+		if _, err := part.Write([]byte(file.data)); err != nil {
+			t.Fatalf("part.Write failed with %v; want success", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("writer.Close failed with %v; want success", err)
+	}
+
+	return &buf, writer.FormDataContentType()
+}
+
+func TestMultipartFormPbUnmarshal(t *testing.T) {
+	body, contentType := multipartBody(t, []multipartFile{
+		{name: "string_value", data: "foo"},
+		{name: "nested.repeated_value", data: "a"},
+		{name: "nested.repeated_value", data: "b"},
+		{name: "map_value[k]", data: "v"},
+		{name: "bytes_value", fileName: "data.bin", data: "\x00\x01\xff"},
+		{name: "nested.string_value", fileName: "notes.txt", contentType: "text/plain", data: "bar"},
+	})
+
+	m := (&protomarshal.MultipartFormPb{}).ForContentType(contentType)
+	got := new(examplepb.Proto3Message)
+	if err := m.Unmarshal(body.Bytes(), got); err != nil {
+		t.Fatalf("m.Unmarshal() failed with %v; want success", err)
+	}
+
+	want := &examplepb.Proto3Message{
+		StringValue: "foo",
+		BytesValue:  []byte{0, 1, 0xff},
+		MapValue:    map[string]string{"k": "v"},
+		Nested: &examplepb.Proto3Message{
+			RepeatedValue: []string{"a", "b"},
+			StringValue:   "bar",
+		},
+	}
+	if diff := cmp.Diff(got, want, protocmp.Transform()); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestMultipartFormPbHTTPBody(t *testing.T) {
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String("upload.proto"),
+		Package:    proto.String("upload"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/api/httpbody.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Upload"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{
+					Name:     proto.String("file"),
+					Number:   proto.Int32(1),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+					TypeName: proto.String(".google.api.HttpBody"),
+					JsonName: proto.String("file"),
+				},
+				{
+					Name:     proto.String("attachments"),
+					Number:   proto.Int32(2),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum(),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+					TypeName: proto.String(".google.api.HttpBody"),
+					JsonName: proto.String("attachments"),
+				},
+			},
+		}},
+	}, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatalf("protodesc.NewFile failed with %v; want success", err)
+	}
+
+	body, contentType := multipartBody(t, []multipartFile{
+		{name: "file", fileName: "a.png", contentType: "image/png", data: "png"},
+		{name: "attachments", fileName: "b.bin", data: "one"},
+		{name: "attachments", fileName: "c.txt", contentType: "text/plain", data: "two"},
+	})
+
+	m := (&protomarshal.MultipartFormPb{}).ForContentType(contentType)
+	msg := dynamicpb.NewMessage(file.Messages().ByName("Upload"))
+	if err := m.NewDecoder(body).Decode(msg); err != nil {
+		t.Fatalf("decoder.Decode() failed with %v; want success", err)
+	}
+
+	fields := msg.Descriptor().Fields()
+	bodies := []*httpbody.HttpBody{
+		convertHTTPBody(t, msg.Get(fields.ByName("file")).Message().Interface()),
+	}
+	attachments := msg.Get(fields.ByName("attachments")).List()
+	for index := 0; index < attachments.Len(); index++ {
+		bodies = append(bodies, convertHTTPBody(t, attachments.Get(index).Message().Interface()))
+	}
+
+	want := []*httpbody.HttpBody{
+		{ContentType: "image/png", Data: []byte("png")},
+		{ContentType: "application/octet-stream", Data: []byte("one")},
+		{ContentType: "text/plain", Data: []byte("two")},
+	}
+	if diff := cmp.Diff(bodies, want, protocmp.Transform()); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func convertHTTPBody(t *testing.T, msg proto.Message) *httpbody.HttpBody {
+	t.Helper()
+
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatalf("proto.Marshal failed with %v; want success", err)
+	}
+	result := new(httpbody.HttpBody)
+	if err := proto.Unmarshal(data, result); err != nil {
+		t.Fatalf("proto.Unmarshal failed with %v; want success", err)
+	}
+	return result
+}
+
+func TestMultipartFormPbLimits(t *testing.T) {
+	body, contentType := multipartBody(t, []multipartFile{
+		{name: "string_value", data: "foo"},
+		{name: "bytes_value", fileName: "data.bin", data: "0123456789"},
+	})
+
+	m := (&protomarshal.MultipartFormPb{MaxPartSize: 5}).ForContentType(contentType)
+	err := m.Unmarshal(body.Bytes(), new(examplepb.Proto3Message))
+	var tooLarge protomarshal.ErrPartTooLarge
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("m.Unmarshal() returned %v; want ErrPartTooLarge", err)
+	}
+	if tooLarge.Name != "bytes_value" || tooLarge.Limit != 5 {
+		t.Errorf("got = %+v; want name %q and limit %d", tooLarge, "bytes_value", 5)
+	}
+
+	m = (&protomarshal.MultipartFormPb{MaxParts: 1}).ForContentType(contentType)
+	if err := m.Unmarshal(body.Bytes(), new(examplepb.Proto3Message)); err == nil {
+		t.Error("m.Unmarshal() succeeded; want error for too many parts")
+	}
+}
+
+func TestMultipartFormPbMissingBoundary(t *testing.T) {
+	m := &protomarshal.MultipartFormPb{}
+	if err := m.Unmarshal(nil, new(examplepb.Proto3Message)); err == nil {
+		t.Error("m.Unmarshal() succeeded; want error")
+	}
+}
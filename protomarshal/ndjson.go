@@ -0,0 +1,66 @@
+package protomarshal
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// NDJSONPb is a Marshaler which marshals/unmarshals into/from newline delimited JSON (NDJSON) using JSONPb. Each
+// message is marshaled on a single line regardless of the multiline options.
+//
+// The decoder reads one message per line and skips empty lines, so request streams are framed the same way as the
+// response streams.
+//
+// See: https://github.com/ndjson/ndjson-spec
+type NDJSONPb struct {
+	JSONPb
+}
+
+// ContentType always returns "application/x-ndjson".
+func (*NDJSONPb) ContentType(_ interface{}) string {
+	return "application/x-ndjson"
+}
+
+// Marshal marshals "v" into a single line of JSON.
+func (n *NDJSONPb) Marshal(v interface{}) ([]byte, error) {
+	marshaler := n.JSONPb
+	marshaler.Multiline = false
+	marshaler.Indent = ""
+
+	return marshaler.Marshal(v)
+}
+
+// NewDecoder returns a Decoder which reads a JSON message per line from "r".
+func (n *NDJSONPb) NewDecoder(r io.Reader) Decoder {
+	reader := bufio.NewReader(r)
+	return DecoderFunc(func(v interface{}) error {
+		for {
+			line, err := reader.ReadBytes('\n')
+			if err != nil && !errors.Is(err, io.EOF) {
+				return err
+			}
+
+			if line = bytes.TrimSpace(line); len(line) > 0 {
+				return n.Unmarshal(line, v)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// NewEncoder returns an Encoder which writes a JSON message per line into "w".
+func (n *NDJSONPb) NewEncoder(w io.Writer) Encoder {
+	return EncoderFunc(func(v interface{}) error {
+		data, err := n.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		_, err = w.Write(append(data, n.Delimiter()...))
+		return err
+	})
+}
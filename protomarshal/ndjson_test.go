@@ -0,0 +1,89 @@
+package protomarshal_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/meshapi/grpc-api-gateway/internal/examplepb"
+	"github.com/meshapi/grpc-api-gateway/protomarshal"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestNDJSONPbMarshal(t *testing.T) {
+	m := &protomarshal.NDJSONPb{
+		JSONPb: protomarshal.JSONPb{MarshalOptions: protojson.MarshalOptions{Multiline: true, Indent: "  "}},
+	}
+
+	buf, err := m.Marshal(&examplepb.ABitOfEverything{Uuid: "foo\nbar", Int64Value: 12})
+	if err != nil {
+		t.Fatalf("m.Marshal failed with %v; want success", err)
+	}
+	if bytes.ContainsRune(buf, '\n') {
+		t.Errorf("m.Marshal() = %q; want a single line", buf)
+	}
+
+	if got, want := m.ContentType(nil), "application/x-ndjson"; got != want {
+		t.Errorf("m.ContentType() = %q; want %q", got, want)
+	}
+	if got, want := string(m.Delimiter()), "\n"; got != want {
+		t.Errorf("m.Delimiter() = %q; want %q", got, want)
+	}
+}
+
+func TestNDJSONPbStream(t *testing.T) {
+	m := &protomarshal.NDJSONPb{}
+	messages := []*examplepb.SimpleMessage{{Id: "foo"}, {}, {Id: "bar", Num: 12}}
+
+	var buf bytes.Buffer
+	encoder := m.NewEncoder(&buf)
+	for _, msg := range messages {
+		if err := encoder.Encode(msg); err != nil {
+			t.Fatalf("encoder.Encode(%v) failed with %v; want success", msg, err)
+		}
+	}
+	if got, want := strings.Count(buf.String(), "\n"), len(messages); got != want {
+		t.Errorf("got %d lines; want %d", got, want)
+	}
+
+	decoder := m.NewDecoder(&buf)
+	for _, msg := range messages {
+		got := &examplepb.SimpleMessage{}
+		if err := decoder.Decode(got); err != nil {
+			t.Fatalf("decoder.Decode() failed with %v; want success", err)
+		}
+		if !proto.Equal(got, msg) {
+			t.Errorf("decoder.Decode() = %v; want %v", got, msg)
+		}
+	}
+
+	if err := decoder.Decode(&examplepb.SimpleMessage{}); !errors.Is(err, io.EOF) {
+		t.Errorf("decoder.Decode() returned %v; want io.EOF", err)
+	}
+}
+
+func TestNDJSONPbDecoderFraming(t *testing.T) {
+	m := &protomarshal.NDJSONPb{}
+	decoder := m.NewDecoder(strings.NewReader("{\"id\":\"foo\"}\r\n\n  \n{\"id\":\"bar\"}"))
+	for _, want := range []string{"foo", "bar"} {
+		got := &examplepb.SimpleMessage{}
+		if err := decoder.Decode(got); err != nil {
+			t.Fatalf("decoder.Decode() failed with %v; want success", err)
+		}
+		if got.Id != want {
+			t.Errorf("got.Id = %q; want %q", got.Id, want)
+		}
+	}
+	if err := decoder.Decode(&examplepb.SimpleMessage{}); !errors.Is(err, io.EOF) {
+		t.Errorf("decoder.Decode() returned %v; want io.EOF", err)
+	}
+
+	// a message split across lines is not a valid frame.
+	decoder = m.NewDecoder(strings.NewReader("{\"id\":\n\"foo\"}\n"))
+	if err := decoder.Decode(&examplepb.SimpleMessage{}); err == nil {
+		t.Error("decoder.Decode() succeeded; want error")
+	}
+}
@@ -0,0 +1,89 @@
+package protomarshal
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"google.golang.org/protobuf/encoding/protodelim"
+	"google.golang.org/protobuf/proto"
+)
+
+// ProtoDelimitedMarshaller is a Marshaller which marshals/unmarshals into/from proto bytes that are prefixed with
+// their varint encoded length, compatible with the protodelim package. Every payload, streamed or not, is framed
+// which makes the request and the response streams unambiguous.
+type ProtoDelimitedMarshaller struct {
+	// MaxSize is the maximum size of a single message in bytes. If zero, the protodelim default of 4 MiB is used and
+	// if -1, the size is not limited.
+	MaxSize int64
+}
+
+// ContentType always returns "application/x-protobuf-delimited".
+func (*ProtoDelimitedMarshaller) ContentType(_ interface{}) string {
+	return "application/x-protobuf-delimited"
+}
+
+// Marshal marshals "value" into length-prefixed proto bytes.
+func (*ProtoDelimitedMarshaller) Marshal(value interface{}) ([]byte, error) {
+	message, ok := value.(proto.Message)
+	if !ok {
+		return nil, errors.New("unable to marshal non proto field")
+	}
+
+	var buffer bytes.Buffer
+	if _, err := protodelim.MarshalTo(&buffer, message); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// Unmarshal unmarshals a single length-prefixed proto message in "data" into "value".
+func (marshaller *ProtoDelimitedMarshaller) Unmarshal(data []byte, value interface{}) error {
+	reader := bytes.NewReader(data)
+	if err := marshaller.unmarshalFrom(reader, value); err != nil {
+		return unexpectedEOF(err)
+	}
+	if reader.Len() > 0 {
+		return errors.New("unexpected data after the length-prefixed message")
+	}
+
+	return nil
+}
+
+// NewDecoder returns a Decoder which reads length-prefixed proto messages from "reader". io.EOF is returned once
+// there are no more messages.
+func (marshaller *ProtoDelimitedMarshaller) NewDecoder(reader io.Reader) Decoder {
+	byteReader := byteReader(reader)
+	return DecoderFunc(func(value interface{}) error {
+		return marshaller.unmarshalFrom(byteReader, value)
+	})
+}
+
+func (marshaller *ProtoDelimitedMarshaller) unmarshalFrom(reader protodelim.Reader, value interface{}) error {
+	message, ok := value.(proto.Message)
+	if !ok {
+		return errors.New("unable to unmarshal non proto field")
+	}
+
+	options := protodelim.UnmarshalOptions{MaxSize: marshaller.MaxSize}
+	return options.UnmarshalFrom(reader, message)
+}
+
+// NewEncoder returns an Encoder which writes length-prefixed proto messages into "writer".
+func (marshaller *ProtoDelimitedMarshaller) NewEncoder(writer io.Writer) Encoder {
+	return EncoderFunc(func(value interface{}) error {
+		message, ok := value.(proto.Message)
+		if !ok {
+			return errors.New("unable to marshal non proto field")
+		}
+
+		_, err := protodelim.MarshalTo(writer, message)
+		return err
+	})
+}
+
+// Delimiter for length-prefixed proto streams is empty since each message is prefixed with its length.
+func (*ProtoDelimitedMarshaller) Delimiter() []byte {
+	return []byte{}
+}
@@ -0,0 +1,88 @@
+package protomarshal_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/meshapi/grpc-api-gateway/internal/examplepb"
+	"github.com/meshapi/grpc-api-gateway/protomarshal"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+func TestProtoDelimitedMarshalUnmarshal(t *testing.T) {
+	marshaller := &protomarshal.ProtoDelimitedMarshaller{}
+
+	buffer, err := marshaller.Marshal(message)
+	if err != nil {
+		t.Fatalf("marshaller.Marshal(%v) failed with %v; want success", message, err)
+	}
+
+	unmarshalled := &examplepb.ABitOfEverything{}
+	if err := protodelim.UnmarshalFrom(bytes.NewReader(buffer), unmarshalled); err != nil {
+		t.Fatalf("protodelim.UnmarshalFrom failed with %v; want success", err)
+	}
+	if diff := cmp.Diff(unmarshalled, message, protocmp.Transform()); diff != "" {
+		t.Error(diff)
+	}
+
+	unmarshalled = &examplepb.ABitOfEverything{}
+	if err := marshaller.Unmarshal(buffer, unmarshalled); err != nil {
+		t.Fatalf("marshaller.Unmarshal failed with %v; want success", err)
+	}
+	if !proto.Equal(unmarshalled, message) {
+		t.Errorf("marshaller.Unmarshal() = %v; want %v", unmarshalled, message)
+	}
+
+	for _, data := range [][]byte{buffer[:len(buffer)-1], append(buffer, 0)} {
+		if err := marshaller.Unmarshal(data, &examplepb.ABitOfEverything{}); err == nil {
+			t.Errorf("marshaller.Unmarshal(%x) succeeded; want error", data)
+		}
+	}
+}
+
+func TestProtoDelimitedStream(t *testing.T) {
+	marshaller := &protomarshal.ProtoDelimitedMarshaller{}
+	messages := []*examplepb.SimpleMessage{{Id: "foo"}, {}, {Id: "bar", Num: 12}}
+
+	var buffer bytes.Buffer
+	encoder := marshaller.NewEncoder(&buffer)
+	for _, msg := range messages {
+		if err := encoder.Encode(msg); err != nil {
+			t.Fatalf("encoder.Encode(%v) failed with %v; want success", msg, err)
+		}
+	}
+
+	decoder := marshaller.NewDecoder(&buffer)
+	for _, msg := range messages {
+		got := &examplepb.SimpleMessage{}
+		if err := decoder.Decode(got); err != nil {
+			t.Fatalf("decoder.Decode() failed with %v; want success", err)
+		}
+		if !proto.Equal(got, msg) {
+			t.Errorf("decoder.Decode() = %v; want %v", got, msg)
+		}
+	}
+
+	if err := decoder.Decode(&examplepb.SimpleMessage{}); !errors.Is(err, io.EOF) {
+		t.Errorf("decoder.Decode() returned %v; want io.EOF", err)
+	}
+}
+
+func TestProtoDelimitedMaxSize(t *testing.T) {
+	buffer, err := (&protomarshal.ProtoDelimitedMarshaller{}).Marshal(message)
+	if err != nil {
+		t.Fatalf("marshaller.Marshal(%v) failed with %v; want success", message, err)
+	}
+
+	marshaller := &protomarshal.ProtoDelimitedMarshaller{MaxSize: 8}
+	err = marshaller.NewDecoder(bytes.NewReader(buffer)).Decode(&examplepb.ABitOfEverything{})
+	var sizeTooLarge *protodelim.SizeTooLargeError
+	if !errors.As(err, &sizeTooLarge) {
+		t.Errorf("decoder.Decode() returned %v; want SizeTooLargeError", err)
+	}
+}
@@ -0,0 +1,100 @@
+package protomarshal
+
+import (
+	"io"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"gopkg.in/yaml.v3"
+)
+
+// YAMLPb is a Marshaler which marshals/unmarshals into/from YAML following the protojson field names and
+// representation of the well-known types such as google.protobuf.Timestamp, Duration, Any and Struct.
+//
+// Streams are encoded as YAML documents that are followed by the "---" document marker.
+type YAMLPb struct {
+	protojson.MarshalOptions
+	protojson.UnmarshalOptions
+}
+
+// ContentType always returns "application/yaml".
+func (*YAMLPb) ContentType(_ interface{}) string {
+	return "application/yaml"
+}
+
+// Marshal marshals "v" into YAML.
+func (y *YAMLPb) Marshal(v interface{}) ([]byte, error) {
+	value, err := marshalJSONValue(y.MarshalOptions, v)
+	if err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(value)
+}
+
+// Unmarshal unmarshals YAML "data" into "v".
+func (y *YAMLPb) Unmarshal(data []byte, v interface{}) error {
+	var value interface{}
+	if err := yaml.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	return unmarshalJSONValue(y.UnmarshalOptions, value, v)
+}
+
+// NewDecoder returns a Decoder which reads YAML documents from "r", empty documents are skipped.
+func (y *YAMLPb) NewDecoder(r io.Reader) Decoder {
+	decoder := yaml.NewDecoder(r)
+	return DecoderFunc(func(v interface{}) error {
+		var node yaml.Node
+		for {
+			node = yaml.Node{}
+			if err := decoder.Decode(&node); err != nil {
+				return err
+			}
+			if !isEmptyYAMLDocument(&node) {
+				break
+			}
+		}
+
+		var value interface{}
+		if err := node.Decode(&value); err != nil {
+			return err
+		}
+
+		return unmarshalJSONValue(y.UnmarshalOptions, value, v)
+	})
+}
+
+// isEmptyYAMLDocument returns whether or not the document has no content, which is the case for a trailing document
+// marker at the end of a stream.
+func isEmptyYAMLDocument(node *yaml.Node) bool {
+	if node.Kind != yaml.DocumentNode || len(node.Content) > 1 {
+		return false
+	}
+	if len(node.Content) == 0 {
+		return true
+	}
+	content := node.Content[0]
+	return content.Kind == yaml.ScalarNode && content.Tag == "!!null" && content.Value == ""
+}
+
+// NewEncoder returns an Encoder which writes YAML documents into "w".
+func (y *YAMLPb) NewEncoder(w io.Writer) Encoder {
+	return EncoderFunc(func(v interface{}) error {
+		data, err := y.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+
+		_, err = w.Write(y.Delimiter())
+		return err
+	})
+}
+
+// Delimiter for YAML streams is the document marker.
+func (y *YAMLPb) Delimiter() []byte {
+	return []byte("---\n")
+}
@@ -0,0 +1,134 @@
+package protomarshal_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/meshapi/grpc-api-gateway/internal/examplepb"
+	"github.com/meshapi/grpc-api-gateway/protomarshal"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// structuredFixtures are messages used to verify the marshalers that follow the protojson representation.
+func structuredFixtures(t *testing.T) []proto.Message {
+	t.Helper()
+
+	anyValue, err := anypb.New(durationpb.New(90 * time.Second))
+	if err != nil {
+		t.Fatalf("anypb.New failed with %v; want success", err)
+	}
+
+	structValue, err := structpb.NewStruct(map[string]interface{}{
+		"name":   "foo",
+		"count":  42,
+		"ratio":  0.5,
+		"nested": map[string]interface{}{"list": []interface{}{true, nil, "bar"}},
+	})
+	if err != nil {
+		t.Fatalf("structpb.NewStruct failed with %v; want success", err)
+	}
+
+	return []proto.Message{
+		&examplepb.ABitOfEverything{
+			Uuid:              "6ba7b811-9dad-11d1-80b4-00c04fd430c8",
+			Int64Value:        -1 << 62,
+			Uint64Value:       1<<64 - 1,
+			DoubleValue:       1.5,
+			BytesValue:        []byte{0, 1, 2, 0xff},
+			TimestampValue:    timestamppb.New(time.Date(2024, 1, 2, 3, 4, 5, 6000, time.UTC)),
+			MappedStringValue: map[string]string{"a": "b", "c": ""},
+			Anytype:           anyValue,
+		},
+		structValue,
+		durationpb.New(-1500 * time.Millisecond),
+	}
+}
+
+// testStructuredMarshaler verifies the round trip of the fixtures using Marshal/Unmarshal as well as the stream
+// encoder and decoder.
+func testStructuredMarshaler(t *testing.T, m protomarshal.Marshaler) {
+	t.Helper()
+
+	fixtures := structuredFixtures(t)
+	for _, msg := range fixtures {
+		buf, err := m.Marshal(msg)
+		if err != nil {
+			t.Fatalf("m.Marshal(%v) failed with %v; want success", msg, err)
+		}
+
+		got := msg.ProtoReflect().New().Interface()
+		if err := m.Unmarshal(buf, got); err != nil {
+			t.Fatalf("m.Unmarshal(%q, got) failed with %v; want success", buf, err)
+		}
+		if diff := cmp.Diff(got, msg, protocmp.Transform()); diff != "" {
+			t.Error(diff)
+		}
+	}
+
+	var buf bytes.Buffer
+	encoder := m.NewEncoder(&buf)
+	for _, msg := range fixtures {
+		if err := encoder.Encode(msg); err != nil {
+			t.Fatalf("encoder.Encode(%v) failed with %v; want success", msg, err)
+		}
+	}
+
+	decoder := m.NewDecoder(&buf)
+	for _, msg := range fixtures {
+		got := msg.ProtoReflect().New().Interface()
+		if err := decoder.Decode(got); err != nil {
+			t.Fatalf("decoder.Decode(got) failed with %v; want success", err)
+		}
+		if diff := cmp.Diff(got, msg, protocmp.Transform()); diff != "" {
+			t.Error(diff)
+		}
+	}
+
+	if err := decoder.Decode(new(durationpb.Duration)); !errors.Is(err, io.EOF) {
+		t.Errorf("decoder.Decode() returned %v; want io.EOF", err)
+	}
+}
+
+func TestYAMLPb(t *testing.T) {
+	testStructuredMarshaler(t, &protomarshal.YAMLPb{})
+}
+
+func TestYAMLPbFieldNames(t *testing.T) {
+	m := &protomarshal.YAMLPb{}
+	buf, err := m.Marshal(&examplepb.ABitOfEverything{Int64Value: 12, Uuid: "foo"})
+	if err != nil {
+		t.Fatalf("m.Marshal failed with %v; want success", err)
+	}
+
+	if got, want := string(buf), "int64Value: \"12\"\nuuid: foo\n"; got != want {
+		t.Errorf("got = %q; want %q", got, want)
+	}
+}
+
+func TestYAMLPbDecoderDocuments(t *testing.T) {
+	m := &protomarshal.YAMLPb{}
+	decoder := m.NewDecoder(strings.NewReader("---\nuuid: foo\n---\n---\nuuid: bar\n"))
+	for _, want := range []string{"foo", "bar"} {
+		got := new(examplepb.ABitOfEverything)
+		if err := decoder.Decode(got); err != nil {
+			t.Fatalf("decoder.Decode(got) failed with %v; want success", err)
+		}
+		if got.Uuid != want {
+			t.Errorf("got.Uuid = %q; want %q", got.Uuid, want)
+		}
+	}
+
+	if err := decoder.Decode(new(examplepb.ABitOfEverything)); !errors.Is(err, io.EOF) {
+		t.Errorf("decoder.Decode() returned %v; want io.EOF", err)
+	}
+}
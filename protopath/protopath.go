@@ -26,14 +26,50 @@ func PopulateFieldFromPath(msg proto.Message, fieldPathString string, value stri
 	return PopulateFieldValueFromPath(msg.ProtoReflect(), dotpath.Parse(&fieldPathString), []string{value})
 }
 
+// PopulateFieldValueFromPath sets the values of the field identified by the field path in a nested Protobuf
+// structure. Repeated fields append the values and map fields expect the key and the value.
 func PopulateFieldValueFromPath(msgValue protoreflect.Message, fieldPath dotpath.Instance, values []string) error {
-	if fieldPath.NumberOfSegments() < 1 {
-		return errors.New("no field path")
-	}
 	if len(values) < 1 {
 		return errors.New("no value provided")
 	}
 
+	msgValue, fieldDescriptor, err := FieldFromPath(msgValue, fieldPath)
+	if err != nil || fieldDescriptor == nil {
+		return err
+	}
+
+	// Check if oneof already set
+	if of := fieldDescriptor.ContainingOneof(); of != nil {
+		if f := msgValue.WhichOneof(of); f != nil {
+			return fmt.Errorf("field already set for oneof %q", of.FullName().Name())
+		}
+	}
+
+	switch {
+	case fieldDescriptor.IsList():
+		return populateRepeatedField(fieldDescriptor, msgValue.Mutable(fieldDescriptor).List(), values)
+	case fieldDescriptor.IsMap():
+		return populateMapField(fieldDescriptor, msgValue.Mutable(fieldDescriptor).Map(), values)
+	}
+
+	if len(values) > 1 {
+		return fmt.Errorf("too many values for field %q: %s", fieldDescriptor.FullName().Name(), strings.Join(values, ", "))
+	}
+
+	return populateField(fieldDescriptor, msgValue, values[0])
+}
+
+// FieldFromPath resolves the field path in a nested Protobuf structure and returns the descriptor of the field along
+// with the message that holds it, creating the intermediate messages as needed.
+//
+// Field names and JSON names are both accepted. If a field cannot be found, a nil descriptor is returned since it
+// could just be an extra parameter that isn't part of the message.
+func FieldFromPath(
+	msgValue protoreflect.Message, fieldPath dotpath.Instance) (protoreflect.Message, protoreflect.FieldDescriptor, error) {
+	if fieldPath.NumberOfSegments() < 1 {
+		return nil, nil, errors.New("no field path")
+	}
+
 	var fieldDescriptor protoreflect.FieldDescriptor
 	for i := 0; i < fieldPath.NumberOfSegments(); i++ {
 		fieldName := fieldPath.Index(i)
@@ -47,7 +83,7 @@ func PopulateFieldValueFromPath(msgValue protoreflect.Message, fieldPath dotpath
 				// We're not returning an error here because this could just be
 				// an extra query parameter that isn't part of the request.
 				grpclog.Infof("field not found in %q: %q", msgValue.Descriptor().FullName(), fieldPath.String())
-				return nil
+				return nil, nil, nil
 			}
 		}
 
@@ -58,32 +94,27 @@ func PopulateFieldValueFromPath(msgValue protoreflect.Message, fieldPath dotpath
 
 		// Only singular message fields are allowed
 		if fieldDescriptor.Message() == nil || fieldDescriptor.Cardinality() == protoreflect.Repeated {
-			return fmt.Errorf("invalid path: %q is not a message", fieldName)
+			return nil, nil, fmt.Errorf("invalid path: %q is not a message", fieldName)
 		}
 
 		// Get the nested message
 		msgValue = msgValue.Mutable(fieldDescriptor).Message()
 	}
 
-	// Check if oneof already set
-	if of := fieldDescriptor.ContainingOneof(); of != nil {
-		if f := msgValue.WhichOneof(of); f != nil {
-			return fmt.Errorf("field already set for oneof %q", of.FullName().Name())
-		}
-	}
+	return msgValue, fieldDescriptor, nil
+}
 
-	switch {
-	case fieldDescriptor.IsList():
-		return populateRepeatedField(fieldDescriptor, msgValue.Mutable(fieldDescriptor).List(), values)
-	case fieldDescriptor.IsMap():
-		return populateMapField(fieldDescriptor, msgValue.Mutable(fieldDescriptor).Map(), values)
+// SplitMapKey splits a parameter key in the "field[key]" format into the field path and the map key.
+func SplitMapKey(key string) (string, string, bool) {
+	start := strings.IndexByte(key, '[')
+	if start == -1 { // 0 is also not acceptable because it means there is no key, only braces.
+		return "", "", false
 	}
-
-	if len(values) > 1 {
-		return fmt.Errorf("too many values for field %q: %s", fieldDescriptor.FullName().Name(), strings.Join(values, ", "))
+	end := strings.LastIndexByte(key, ']')
+	if end == -1 || end != len(key)-1 || end <= start {
+		return "", "", false
 	}
-
-	return populateField(fieldDescriptor, msgValue, values[0])
+	return key[:start], key[start+1 : end], true
 }
 
 func populateField(fieldDescriptor protoreflect.FieldDescriptor, msgValue protoreflect.Message, value string) error {
@@ -137,22 +168,24 @@ func parseField(fieldDescriptor protoreflect.FieldDescriptor, value string) (pro
 		}
 		return protoreflect.ValueOfBool(v), nil
 	case protoreflect.EnumKind:
-		enum, err := protoregistry.GlobalTypes.FindEnumByName(fieldDescriptor.Enum().FullName())
-		if err != nil {
-			if errors.Is(err, protoregistry.NotFound) {
-				return protoreflect.Value{}, fmt.Errorf("enum %q is not registered", fieldDescriptor.Enum().FullName())
-			}
+		// enums of the dynamic messages are not registered, their descriptors are used instead.
+		enumDescriptor := fieldDescriptor.Enum()
+		enum, err := protoregistry.GlobalTypes.FindEnumByName(enumDescriptor.FullName())
+		switch {
+		case err == nil:
+			enumDescriptor = enum.Descriptor()
+		case !errors.Is(err, protoregistry.NotFound):
 			return protoreflect.Value{}, fmt.Errorf("failed to look up enum: %w", err)
 		}
 		// Look for enum by name
-		v := enum.Descriptor().Values().ByName(protoreflect.Name(value))
+		v := enumDescriptor.Values().ByName(protoreflect.Name(value))
 		if v == nil {
 			i, err := strconv.Atoi(value)
 			if err != nil {
 				return protoreflect.Value{}, fmt.Errorf("%q is not a valid value", value)
 			}
 			// Look for enum by number
-			if v = enum.Descriptor().Values().ByNumber(protoreflect.EnumNumber(i)); v == nil {
+			if v = enumDescriptor.Values().ByNumber(protoreflect.EnumNumber(i)); v == nil {
 				return protoreflect.Value{}, fmt.Errorf("%q is not a valid value", value)
 			}
 		}
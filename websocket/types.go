@@ -1,5 +1,33 @@
 package websocket
 
+// Close codes defined in RFC 6455 that are used by the gateway.
+const (
+	// CloseNormalClosure indicates that the RPC completed successfully.
+	CloseNormalClosure = 1000
+
+	// ClosePolicyViolation indicates that the request was not authenticated or not permitted.
+	ClosePolicyViolation = 1008
+
+	// CloseInternalServerError indicates that the server failed to complete the RPC.
+	CloseInternalServerError = 1011
+
+	// ClosePrivateCodeStart is the first close code that is reserved for private use. The gRPC codes that have no
+	// equivalent close code are sent as ClosePrivateCodeStart plus the gRPC code.
+	ClosePrivateCodeStart = 4000
+)
+
+// Message types of the data frames, the values are the frame opcodes defined in RFC 6455.
+const (
+	// TextMessage denotes a text data message that holds UTF-8 encoded text.
+	TextMessage = 1
+
+	// BinaryMessage denotes a binary data message.
+	BinaryMessage = 2
+)
+
+// MaxCloseReasonLength is the maximum length in bytes of the reason of a close message.
+const MaxCloseReasonLength = 123
+
 // Connection defines the server-side behavior of a streaming websocket connnection.
 type Connection interface {
 	// SendMessage sends a message. On error, SendMessage aborts the stream and the
@@ -21,9 +49,19 @@ type Connection interface {
 	// libraries and stats handlers may use the message lazily.
 	SendMessage(data []byte) error
 
+	// SendMessageWithType sends a message in a data frame of the message type, TextMessage or BinaryMessage. SendMessage
+	// is the same as sending a TextMessage.
+	//
+	// The same concurrency rules of SendMessage apply.
+	SendMessageWithType(messageType int, data []byte) error
+
 	// SendClose should send a close message to the client.
 	SendClose() error
 
+	// SendCloseWithCode sends a close message with a close code and a reason to the client. The reason must not be
+	// longer than MaxCloseReasonLength bytes.
+	SendCloseWithCode(code int, reason string) error
+
 	// ReceiveMessage blocks until it receives a message into m or the stream is
 	// done. It returns io.EOF when the client has performed a CloseSend. On
 	// any non-EOF error, the stream is aborted and the error contains the
@@ -34,6 +72,19 @@ type Connection interface {
 	// safe to call ReceiveMessage on the same stream in different goroutines.
 	ReceiveMessage() ([]byte, error)
 
+	// SendPing sends a ping control message.
+	//
+	// It is safe to call SendPing and SendMessage on the same stream in different goroutines.
+	SendPing() error
+
+	// SetPongHandler sets the function that gets called when a pong control message is received. The handler is
+	// called from ReceiveMessage, so pongs are only processed while a goroutine is receiving messages.
+	SetPongHandler(handler func())
+
+	// SetReadLimit sets the maximum size in bytes of the messages that are received. Once a message exceeds the
+	// limit, ReceiveMessage returns an error and the connection is closed. Zero means no limit.
+	SetReadLimit(limit int64)
+
 	// Close closes the connection immediately.
 	//
 	// NOTE: This method must be idempotent.
@@ -15,6 +15,9 @@ type Connection struct {
 
 	// CloseTimeout is the amount of time to wait after sending a closure status.
 	CloseTimeout time.Duration
+
+	// PingTimeout is the amount of time to wait for sending a ping message.
+	PingTimeout time.Duration
 }
 
 // New creates a new Connection instance with a valid gorilla connection.
@@ -22,6 +25,7 @@ func New(conn *websocket.Conn) Connection {
 	return Connection{
 		underlyingConnection: conn,
 		CloseTimeout:         30 * time.Second,
+		PingTimeout:          10 * time.Second,
 	}
 }
 
@@ -29,10 +33,39 @@ func (c Connection) SendMessage(data []byte) error {
 	return c.underlyingConnection.WriteMessage(websocket.TextMessage, data)
 }
 
+func (c Connection) SendMessageWithType(messageType int, data []byte) error {
+	return c.underlyingConnection.WriteMessage(messageType, data)
+}
+
 func (c Connection) SendClose() error {
 	return c.underlyingConnection.WriteControl(websocket.CloseMessage, nil, time.Now().Add(c.CloseTimeout))
 }
 
+func (c Connection) SendCloseWithCode(code int, reason string) error {
+	return c.underlyingConnection.WriteControl(
+		websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(c.CloseTimeout))
+}
+
+func (c Connection) SendPing() error {
+	return c.underlyingConnection.WriteControl(websocket.PingMessage, nil, time.Now().Add(c.PingTimeout))
+}
+
+func (c Connection) SetPongHandler(handler func()) {
+	if handler == nil {
+		c.underlyingConnection.SetPongHandler(nil)
+		return
+	}
+
+	c.underlyingConnection.SetPongHandler(func(string) error {
+		handler()
+		return nil
+	})
+}
+
+func (c Connection) SetReadLimit(limit int64) {
+	c.underlyingConnection.SetReadLimit(limit)
+}
+
 func (c Connection) ReceiveMessage() ([]byte, error) {
 	_, data, err := c.underlyingConnection.ReadMessage()
 	if err != nil && isClosedConnectionError(err) {